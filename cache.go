@@ -4,9 +4,9 @@ import (
 	"container/heap"
 	"container/list"
 	"errors"
-	"fmt"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,6 +15,9 @@ const MaxDuration time.Duration = 1<<63 - 1
 
 var ErrKeyNotFound = errors.New("Key not found")
 var ErrHashKeyNotFound = errors.New("Hash key not found")
+var ErrWrongType = errors.New("Operation against a key holding the wrong kind of value")
+var ErrTooLong = errors.New("List or hash has reached its maximum length")
+var ErrKeyExists = errors.New("Key already exists")
 
 // Internal cache item
 type item struct {
@@ -22,6 +25,7 @@ type item struct {
 	value    interface{}
 	ttl      time.Duration
 	expireAt time.Time
+	size     int // approximate memory held by the key and the value
 }
 
 type priorityQueue []*item
@@ -59,9 +63,34 @@ func (pq *priorityQueue) Peek() interface{} {
 }
 
 type Cache struct {
-	items map[string]*item
-	pq    *priorityQueue
-	mutex sync.RWMutex
+	// Counters are updated atomically, they go first to be aligned on 32 bit platforms
+	stats counters
+
+	items    map[string]*item
+	pq       *priorityQueue
+	mutex    sync.RWMutex
+	maxItems int
+
+	// Approximate memory held by the items and its limit, zero means no limit
+	used      int64
+	maxMemory int64
+
+	// Limits of the number of elements of a list and of fields of a hash, zero means no limit
+	maxListLength int
+	maxHashLength int
+
+	evictionMutex    sync.Mutex
+	evictionInterval time.Duration
+	stopEviction     chan bool
+
+	listeners      []func(key string)
+	listenersMutex sync.RWMutex
+
+	// Keys evicted for the limits while the cache is locked, reported by the change which evicted them.
+	// Guarded by the mutex, evictions are recorded only if there are listeners
+	evicted   []string
+	listening int32
+	pending   int32
 }
 
 func (c *Cache) getItem(key string) (*item, bool) {
@@ -88,23 +117,124 @@ func (c *Cache) evict() {
 
 		if item.expireAt.Before(now) {
 			heap.Pop(c.pq)
-			delete(c.items, item.key)
+			if c.remove(item) {
+				atomic.AddUint64(&c.stats.expirations, 1)
+			}
 		} else {
 			break
 		}
 	}
 }
 
+// Delete the item unless the key has been set again since the item was queued.
+// Return whether the item has been deleted
+func (c *Cache) remove(item *item) bool {
+	if c.items[item.key] == item {
+		delete(c.items, item.key)
+		c.used -= int64(item.size)
+		return true
+	}
+	return false
+}
+
+// Change the size of the item by delta and evict other items if the memory is over the limit
+func (c *Cache) grow(item *item, delta int) {
+	item.size += delta
+	c.used += int64(delta)
+	c.shrink(item)
+}
+
+// Evict the items which expire soonest until the memory is within the limit.
+// The item just written is kept even if it does not fit alone
+func (c *Cache) shrink(keep *item) {
+	kept := false
+
+	for c.maxMemory > 0 && c.used > c.maxMemory && c.pq.Len() != 0 {
+		item := heap.Pop(c.pq).(*item)
+		if item == keep {
+			kept = true
+			continue
+		}
+
+		if c.remove(item) {
+			atomic.AddUint64(&c.stats.evictions, 1)
+			c.recordEviction(item.key)
+		}
+	}
+
+	if kept {
+		heap.Push(c.pq, keep)
+	}
+}
+
+// Evict the item which expires soonest to make room for a new key
+func (c *Cache) evictSoonest() {
+	for c.pq.Len() != 0 {
+		item := heap.Pop(c.pq).(*item)
+		if c.remove(item) {
+			atomic.AddUint64(&c.stats.evictions, 1)
+			c.recordEviction(item.key)
+			return
+		}
+	}
+}
+
+// Register a function called with the key after every write of the key:
+// set, update, delete, list push or pop and hash set. Keys evicted for the limits are reported
+// along with the change which evicted them, expired keys are not reported. Flush reports the empty key.
+// The function is called after the write is complete and must not block
+func (c *Cache) OnChange(listener func(key string)) {
+	c.listenersMutex.Lock()
+	c.listeners = append(c.listeners, listener)
+	c.listenersMutex.Unlock()
+
+	atomic.StoreInt32(&c.listening, 1)
+}
+
+// Record the key evicted while the cache is locked, so that it's reported once the cache is unlocked
+func (c *Cache) recordEviction(key string) {
+	if atomic.LoadInt32(&c.listening) == 0 {
+		return
+	}
+
+	c.evicted = append(c.evicted, key)
+	atomic.StoreInt32(&c.pending, 1)
+}
+
+// Notify the listeners about changed keys, and about the keys evicted by the changes
+func (c *Cache) changed(keys ...string) {
+	if atomic.LoadInt32(&c.pending) != 0 {
+		c.mutex.Lock()
+		evicted := c.evicted
+		c.evicted = nil
+		atomic.StoreInt32(&c.pending, 0)
+		c.mutex.Unlock()
+
+		keys = append(evicted, keys...)
+	}
+
+	c.listenersMutex.RLock()
+	defer c.listenersMutex.RUnlock()
+
+	for _, listener := range c.listeners {
+		for _, key := range keys {
+			listener(key)
+		}
+	}
+}
+
 // Get the value of key.
 // If the key does not exist the special value nil is returned
 func (c *Cache) Get(key string) (interface{}, error) {
 	c.mutex.RLock()
 	if item, ok := c.getItem(key); ok {
 		c.mutex.RUnlock()
+		c.stats.hit()
 		return item.value, nil
 	}
 
 	c.mutex.RUnlock()
+	c.stats.miss()
 
 	return nil, ErrKeyNotFound
 }
@@ -137,24 +267,43 @@ func (c *Cache) Set(key string, value interface{}, ttl time.Duration) {
 	c.mutex.Lock()
 	c.set(key, value, ttl)
 	c.mutex.Unlock()
+
+	atomic.AddUint64(&c.stats.sets, 1)
+	c.changed(key)
 }
 
 func (c *Cache) set(key string, value interface{}, ttl time.Duration) {
+	c.setUntil(key, value, ttl, time.Now().Add(ttl))
+}
+
+// Set key to hold the value until expireAt. ttl is kept for updates
+func (c *Cache) setUntil(key string, value interface{}, ttl time.Duration, expireAt time.Time) {
 
 	c.evict()
 
-	expireAt := time.Now().Add(ttl)
+	// Make room for a new key if the cache is bounded
+	if _, exists := c.items[key]; !exists && c.maxItems > 0 && len(c.items) >= c.maxItems {
+		c.evictSoonest()
+	}
+
+	if old, exists := c.items[key]; exists {
+		c.used -= int64(old.size)
+	}
 
 	item := &item{
 		key:      key,
 		value:    value,
 		ttl:      ttl,
 		expireAt: expireAt,
+		size:     itemSize(key, value),
 	}
 
 	c.items[key] = item
+	c.used += int64(item.size)
 
 	heap.Push(c.pq, item)
+
+	c.shrink(item)
 }
 
 // Update the value of the key
@@ -169,6 +318,9 @@ func (c *Cache) Update(key string, value interface{}) error {
 	c.set(key, value, item.ttl)
 	c.mutex.Unlock()
 
+	atomic.AddUint64(&c.stats.sets, 1)
+	c.changed(key)
+
 	return nil
 }
 
@@ -185,6 +337,9 @@ func (c *Cache) UpdateWithTll(key string, value interface{}, ttl time.Duration)
 	c.set(key, value, ttl)
 	c.mutex.Unlock()
 
+	atomic.AddUint64(&c.stats.sets, 1)
+	c.changed(key)
+
 	return nil
 }
 
@@ -192,9 +347,11 @@ func (c *Cache) UpdateWithTll(key string, value interface{}, ttl time.Duration)
 func (c *Cache) Del(key string) (err error) {
 
 	c.mutex.Lock()
-	if _, ok := c.getItem(key); ok {
-		delete(c.items, key)
+	if item, ok := c.getItem(key); ok {
+		c.remove(item)
 		c.mutex.Unlock()
+		atomic.AddUint64(&c.stats.deletes, 1)
+		c.changed(key)
 	} else {
 		c.mutex.Unlock()
 		err = ErrKeyNotFound
@@ -203,6 +360,81 @@ func (c *Cache) Del(key string) (err error) {
 	return err
 }
 
+// Get values of the keys. The value of a missing key is nil
+func (c *Cache) MGet(keys ...string) []interface{} {
+	values := make([]interface{}, len(keys))
+
+	c.mutex.RLock()
+	for i, key := range keys {
+		if item, ok := c.getItem(key); ok {
+			values[i] = item.value
+			c.stats.hit()
+		} else {
+			c.stats.miss()
+		}
+	}
+	c.mutex.RUnlock()
+
+	return values
+}
+
+// Set all the keys to hold the values atomically
+func (c *Cache) MSet(items map[string]interface{}, ttl time.Duration) {
+	c.mutex.Lock()
+	keys := make([]string, 0, len(items))
+	for key, value := range items {
+		c.set(key, value, ttl)
+		keys = append(keys, key)
+	}
+	c.mutex.Unlock()
+
+	atomic.AddUint64(&c.stats.sets, uint64(len(keys)))
+	c.changed(keys...)
+}
+
+// Set all the keys to hold the values only if none of them exists.
+// Return whether the keys have been set
+func (c *Cache) MSetNX(items map[string]interface{}, ttl time.Duration) bool {
+	c.mutex.Lock()
+	for key := range items {
+		if _, exists := c.getItem(key); exists {
+			c.mutex.Unlock()
+			return false
+		}
+	}
+
+	keys := make([]string, 0, len(items))
+	for key, value := range items {
+		c.set(key, value, ttl)
+		keys = append(keys, key)
+	}
+	c.mutex.Unlock()
+
+	atomic.AddUint64(&c.stats.sets, uint64(len(keys)))
+	c.changed(keys...)
+
+	return true
+}
+
+// Delete the keys. Return the number of deleted keys
+func (c *Cache) MDel(keys ...string) int {
+	deleted := []string{}
+
+	c.mutex.Lock()
+	for _, key := range keys {
+		if item, ok := c.getItem(key); ok {
+			c.remove(item)
+			deleted = append(deleted, key)
+		}
+	}
+	c.mutex.Unlock()
+
+	atomic.AddUint64(&c.stats.deletes, uint64(len(deleted)))
+	c.changed(deleted...)
+
+	return len(deleted)
+}
+
 // Return all keys in the cache
 func (c *Cache) Keys() []string {
 
@@ -219,6 +451,59 @@ func (c *Cache) Keys() []string {
 	return keys
 }
 
+// Get up to count keys following the cursor in the order of the keys, and the cursor of the next keys,
+// which is empty once there are none. A scan starts with an empty cursor. Keys which exist during
+// the whole scan are returned once, keys set or deleted meanwhile may be returned or not
+func (c *Cache) Scan(cursor string, count int) ([]string, string) {
+	if count <= 0 {
+		return []string{}, ""
+	}
+
+	// The lowest keys after the cursor, the highest of them on top
+	lowest := keyHeap{}
+	now := time.Now()
+
+	c.mutex.RLock()
+	for key, item := range c.items {
+		if key <= cursor || item.expireAt.Before(now) {
+			continue
+		}
+
+		if len(lowest) < count {
+			heap.Push(&lowest, key)
+		} else if key < lowest[0] {
+			lowest[0] = key
+			heap.Fix(&lowest, 0)
+		}
+	}
+	c.mutex.RUnlock()
+
+	keys := make([]string, len(lowest))
+	for i := len(keys) - 1; i >= 0; i-- {
+		keys[i] = heap.Pop(&lowest).(string)
+	}
+
+	if len(keys) < count {
+		return keys, ""
+	}
+	return keys, keys[len(keys)-1]
+}
+
+// Max heap of keys
+type keyHeap []string
+
+func (h keyHeap) Len() int            { return len(h) }
+func (h keyHeap) Less(i, j int) bool  { return h[i] > h[j] }
+func (h keyHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *keyHeap) Push(x interface{}) { *h = append(*h, x.(string)) }
+
+func (h *keyHeap) Pop() interface{} {
+	old := *h
+	key := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return key
+}
+
 
 // Left push value into the list
 func (c *Cache) LPush(key string, value interface{}) error {
@@ -235,9 +520,14 @@ func (c *Cache) listPush(key string, value interface{}, push func(l *list.List))
 		l, ok := item.value.(*list.List)
 		if !ok {
 			c.mutex.Unlock()
-			return fmt.Errorf("Given '%s' is not a list key", key)
+			return ErrWrongType
+		}
+		if c.maxListLength > 0 && l.Len() >= c.maxListLength {
+			c.mutex.Unlock()
+			return ErrTooLong
 		}
 		push(l)
+		c.grow(item, listElementSize(value))
 	} else {
 		//Create new list
 		l := list.New()
@@ -248,26 +538,37 @@ func (c *Cache) listPush(key string, value interface{}, push func(l *list.List))
 
 	c.mutex.Unlock()
 
+	c.changed(key)
+
 	return nil
 }
 
 func (c *Cache) listPop(key string, pop func(l *list.List) interface{}) (interface{}, error) {
-	c.mutex.RLock()
+	c.mutex.Lock()
 
 	if item, ok := c.getItem(key); ok {
 		l, ok := item.value.(*list.List)
 		if !ok {
-			c.mutex.RUnlock()
-			return nil, fmt.Errorf("Given %s is not a list key", key)
+			c.mutex.Unlock()
+			return nil, ErrWrongType
+		}
+
+		// Nothing to pop from an empty list
+		if l.Len() == 0 {
+			c.mutex.Unlock()
+			return nil, ErrKeyNotFound
 		}
 
 		element := pop(l)
-		c.mutex.RUnlock()
+		c.grow(item, -listElementSize(element))
+		c.mutex.Unlock()
+
+		c.changed(key)
 
 		return element, nil
 
 	} else {
-		c.mutex.RUnlock()
+		c.mutex.Unlock()
 		return nil, ErrKeyNotFound
 	}
 }
@@ -309,7 +610,7 @@ func (c *Cache) LRange(key string, from int, to int) ([]interface{}, error) {
 		l, ok := item.value.(*list.List)
 		if !ok {
 			c.mutex.RUnlock()
-			return nil, fmt.Errorf("Given '%s' is not a list key", key)
+			return nil, ErrWrongType
 		}
 
 		index := 0
@@ -324,10 +625,12 @@ func (c *Cache) LRange(key string, from int, to int) ([]interface{}, error) {
 		}
 
 		c.mutex.RUnlock()
+		c.stats.hit()
 		return result, nil
 
 	} else {
 		c.mutex.RUnlock()
+		c.stats.miss()
 		return nil, ErrKeyNotFound
 	}
 
@@ -341,9 +644,19 @@ func (c *Cache) HSet(key string, hashKey string, value interface{}) error {
 		hash, ok := item.value.(map[string]interface{})
 		if !ok {
 			c.mutex.Unlock()
-			return fmt.Errorf("Given %s is not a hash key", key)
+			return ErrWrongType
 		}
+
+		delta := hashEntrySize(hashKey, value)
+		if old, exists := hash[hashKey]; exists {
+			delta -= hashEntrySize(hashKey, old)
+		} else if c.maxHashLength > 0 && len(hash) >= c.maxHashLength {
+			c.mutex.Unlock()
+			return ErrTooLong
+		}
+
 		hash[hashKey] = value
+		c.grow(item, delta)
 	} else {
 		//Create new hash
 		hash := make(map[string]interface{})
@@ -353,6 +666,8 @@ func (c *Cache) HSet(key string, hashKey string, value interface{}) error {
 
 	c.mutex.Unlock()
 
+	c.changed(key)
+
 	return nil
 }
 
@@ -365,21 +680,24 @@ func (c *Cache) HGet(key string, hashKey string) (interface{}, error) {
 		hash, ok := item.value.(map[string]interface{})
 		if !ok {
 			c.mutex.RUnlock()
-			return nil, fmt.Errorf("Given '%s' is not a hash key", key)
+			return nil, ErrWrongType
 		}
 
 		value, ok := hash[hashKey]
 		if !ok {
 			c.mutex.RUnlock()
+			c.stats.miss()
 			return nil, ErrHashKeyNotFound
 		}
 
 		c.mutex.RUnlock()
+		c.stats.hit()
 
 		return value, nil
 
 	} else {
 		c.mutex.RUnlock()
+		c.stats.miss()
 		return nil, ErrKeyNotFound
 	}
 
@@ -408,25 +726,28 @@ func schedule(what func(), delay time.Duration) chan bool {
 
 // Create a new cache
 func NewCache() *Cache {
+	return NewCacheWithLimit(0)
+}
+
+// Create a new cache holding at most maxItems keys. When the cache is full,
+// setting a new key evicts the key which expires soonest. Zero means no limit
+func NewCacheWithLimit(maxItems int) *Cache {
 
 	pq := priorityQueue{}
 	heap.Init(&pq)
 
 	cache := &Cache{
-		items: make(map[string]*item),
-		pq:    &pq,
+		items:    make(map[string]*item),
+		pq:       &pq,
+		maxItems: maxItems,
 	}
 
 	// Schedule eviction execution on interval
-	stop := schedule(func() {
-		cache.mutex.Lock()
-		cache.evict()
-		cache.mutex.Unlock()
-	}, DefaultEvictionInterval)
+	cache.startEviction(DefaultEvictionInterval)
 
 	// Stop scheduling on finalization
 	runtime.SetFinalizer(cache, func(cache *Cache) {
-		stop <- true
+		cache.StopEviction()
 	})
 
 	return cache
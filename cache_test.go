@@ -20,6 +20,35 @@ func TestCache_Keys(t *testing.T) {
 	}
 }
 
+func TestCache_Scan(t *testing.T) {
+	cache := NewCache()
+
+	for i := 0; i < 10; i++ {
+		cache.Set("key"+strconv.Itoa(i), "value", time.Minute)
+	}
+
+	scanned := []string{}
+	cursor := ""
+	for {
+		var keys []string
+		keys, cursor = cache.Scan(cursor, 3)
+		scanned = append(scanned, keys...)
+		if cursor == "" {
+			break
+		}
+	}
+
+	if len(scanned) != 10 {
+		t.Fatal("Expected is", 10, "but actual is", len(scanned))
+	}
+
+	for i, key := range scanned {
+		if key != "key"+strconv.Itoa(i) {
+			t.Error("Expected", "key"+strconv.Itoa(i), "but actual", key)
+		}
+	}
+}
+
 func TestCache_Get(t *testing.T) {
 
 	const value = 24
@@ -300,6 +329,180 @@ func TestCache_HSet_HGet(t *testing.T) {
 	}
 }
 
+func TestCache_MSetMGetMDel(t *testing.T) {
+
+	cache := NewCache()
+
+	cache.MSet(map[string]interface{}{"key1": "value1", "key2": "value2"}, time.Second)
+
+	values := cache.MGet("key1", "missing", "key2")
+
+	if len(values) != 3 || values[0] != "value1" || values[1] != nil || values[2] != "value2" {
+		t.Errorf("Expected [value1 <nil> value2] but actual %v", values)
+	}
+
+	deleted := cache.MDel("key1", "missing", "key2")
+
+	if deleted != 2 || cache.Count() != 0 {
+		t.Errorf("Expected 2 deleted keys but actual %d", deleted)
+	}
+}
+
+func TestCache_MSetNX(t *testing.T) {
+
+	cache := NewCache()
+
+	if !cache.MSetNX(map[string]interface{}{"key1": "value1", "key2": "value2"}, time.Second) {
+		t.Fatal("Failed to set new keys")
+	}
+
+	if cache.MSetNX(map[string]interface{}{"key2": "updated", "key3": "value3"}, time.Second) {
+		t.Error("Keys are set though key2 exists")
+	}
+
+	if value, _ := cache.Get("key2"); value != "value2" {
+		t.Error("Existing key is overwritten, value is", value)
+	}
+
+	if _, err := cache.Get("key3"); err != ErrKeyNotFound {
+		t.Error("Key3 should not be set")
+	}
+}
+
+func TestCache_WrongType(t *testing.T) {
+
+	const key = "key"
+
+	cache := NewCache()
+	cache.Set(key, "value", time.Second)
+
+	if err := cache.LPush(key, "value"); err != ErrWrongType {
+		t.Error("Expected wrong type on LPush but actual", err)
+	}
+
+	if _, err := cache.LRange(key, 0, 1); err != ErrWrongType {
+		t.Error("Expected wrong type on LRange but actual", err)
+	}
+
+	if err := cache.HSet(key, "hashKey", "value"); err != ErrWrongType {
+		t.Error("Expected wrong type on HSet but actual", err)
+	}
+
+	if _, err := cache.HGet(key, "hashKey"); err != ErrWrongType {
+		t.Error("Expected wrong type on HGet but actual", err)
+	}
+}
+
+func TestCache_PopEmptyList(t *testing.T) {
+
+	const key = "list"
+
+	cache := NewCache()
+	cache.LPush(key, "value")
+	cache.LPop(key)
+
+	if _, err := cache.LPop(key); err != ErrKeyNotFound {
+		t.Error("Expected key not found popping from an empty list but actual", err)
+	}
+
+	if _, err := cache.RPop(key); err != ErrKeyNotFound {
+		t.Error("Expected key not found popping from an empty list but actual", err)
+	}
+}
+
+func TestCache_Limit(t *testing.T) {
+
+	cache := NewCacheWithLimit(2)
+
+	cache.Set("key1", "value", 10*time.Second)
+	cache.Set("key2", "value", 1*time.Second)
+	cache.Set("key1", "value", 10*time.Second)
+	cache.Set("key3", "value", 10*time.Second)
+
+	if count := cache.Count(); count != 2 {
+		t.Fatal("Expected 2 keys but actual", count)
+	}
+
+	if _, err := cache.Get("key2"); err != ErrKeyNotFound {
+		t.Error("Expected the soonest expiring key to be evicted but actual", err)
+	}
+}
+
+func TestCache_SetAgainKeepsNewTtl(t *testing.T) {
+
+	cache := NewCache()
+
+	cache.Set("key", "value", 10*time.Millisecond)
+	cache.Set("key", "value", 10*time.Second)
+
+	time.Sleep(20 * time.Millisecond)
+
+	// Eviction of the outdated queue entry must not delete the key
+	cache.Set("other", "value", time.Second)
+
+	if _, err := cache.Get("key"); err != nil {
+		t.Error("Expected the key set again to be kept but actual", err)
+	}
+}
+
+func TestCache_OnChange(t *testing.T) {
+
+	cache := NewCache()
+
+	changed := []string{}
+	cache.OnChange(func(key string) {
+		changed = append(changed, key)
+	})
+
+	cache.Set("key", "value", time.Second)
+	cache.Update("key", "value2")
+	cache.Del("key")
+	cache.Del("missing")
+	cache.LPush("list", "value")
+	cache.HSet("hash", "hashKey", "value")
+	cache.MDel("list", "hash", "missing")
+
+	expected := []string{"key", "key", "key", "list", "hash", "list", "hash"}
+
+	if len(changed) != len(expected) {
+		t.Fatal("Expected changes", expected, "but actual", changed)
+	}
+
+	for i := range expected {
+		if changed[i] != expected[i] {
+			t.Error("Expected changes", expected, "but actual", changed)
+			break
+		}
+	}
+}
+
+func TestCache_OnChangeEviction(t *testing.T) {
+
+	cache := NewCacheWithLimit(2)
+
+	changed := []string{}
+	cache.OnChange(func(key string) {
+		changed = append(changed, key)
+	})
+
+	cache.Set("a", "value", time.Second)
+	cache.Set("b", "value", time.Minute)
+	cache.Set("c", "value", time.Minute)
+
+	expected := []string{"a", "b", "a", "c"}
+
+	if len(changed) != len(expected) {
+		t.Fatal("Expected changes", expected, "but actual", changed)
+	}
+
+	for i := range expected {
+		if changed[i] != expected[i] {
+			t.Error("Expected changes", expected, "but actual", changed)
+			break
+		}
+	}
+}
+
 func BenchmarkCache_SetGet(b *testing.B) {
 
 	cache := NewCache()
@@ -0,0 +1,187 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"gcache/protocol"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Fields of INFO of a server, e.g. info["uptime_in_seconds"]
+type Info map[string]string
+
+// Get INFO of every shard in the order of the connections
+func (client *Client) Info(ctx context.Context) ([]Info, error) {
+
+	infos := make([]Info, 0, len(client.conns))
+
+	for _, conn := range client.conns {
+		body, err := client.adminRequest(ctx, conn, http.MethodGet, protocol.InfoPath)
+		if err != nil {
+			return nil, err
+		}
+
+		info := Info{}
+		for _, line := range lines(body) {
+			if strings.HasPrefix(line, "#") {
+				continue
+			}
+			if i := strings.IndexByte(line, ':'); i > 0 {
+				info[line[:i]] = line[i+1:]
+			}
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+// Delete the keys of all the databases of every shard
+func (client *Client) FlushAll(ctx context.Context) error {
+	defer client.flushNearCache()
+	return client.adminCommand(ctx, http.MethodPost, protocol.FlushAllPath)
+}
+
+// Delete the keys of the database of the connections on every shard
+func (client *Client) FlushDB(ctx context.Context) error {
+	defer client.flushNearCache()
+	return client.adminCommand(ctx, http.MethodPost, protocol.FlushDBPath)
+}
+
+// Save the snapshot of every shard now
+func (client *Client) Save(ctx context.Context) error {
+	return client.adminCommand(ctx, http.MethodPost, protocol.SavePath)
+}
+
+// Get the number of keys of the database summed over the shards
+func (client *Client) DBSize(ctx context.Context) (int, error) {
+
+	size := 0
+
+	for _, conn := range client.conns {
+		body, err := client.adminRequest(ctx, conn, http.MethodGet, protocol.DBSizePath)
+		if err != nil {
+			return 0, err
+		}
+
+		n, err := strconv.Atoi(strings.TrimSpace(body))
+		if err != nil {
+			return 0, err
+		}
+		size += n
+	}
+
+	return size, nil
+}
+
+// Get the settings matching the glob pattern of every shard in the order of the connections
+func (client *Client) ConfigGet(ctx context.Context, pattern string) ([]map[string]string, error) {
+
+	configs := make([]map[string]string, 0, len(client.conns))
+
+	for _, conn := range client.conns {
+		body, err := client.adminRequest(ctx, conn, http.MethodGet, protocol.ConfigPath+"?name="+url.QueryEscape(pattern))
+		if err != nil {
+			return nil, err
+		}
+
+		config := map[string]string{}
+		for _, line := range lines(body) {
+			if i := strings.IndexByte(line, ' '); i > 0 {
+				config[line[:i]] = line[i+1:]
+			}
+		}
+		configs = append(configs, config)
+	}
+
+	return configs, nil
+}
+
+// Set the setting on every shard
+func (client *Client) ConfigSet(ctx context.Context, name string, value string) error {
+	query := url.Values{"name": {name}, "value": {value}}
+	return client.adminCommand(ctx, http.MethodPost, protocol.ConfigPath+"?"+query.Encode())
+}
+
+// Get the latest slow commands of every shard merged, the slowest first, at most count
+func (client *Client) SlowlogGet(ctx context.Context, count int) ([]protocol.SlowlogEntry, error) {
+
+	entries := []protocol.SlowlogEntry{}
+
+	for _, conn := range client.conns {
+		body, err := client.adminRequest(ctx, conn, http.MethodGet, protocol.SlowlogPath+"?count="+strconv.Itoa(count))
+		if err != nil {
+			return nil, err
+		}
+
+		shardEntries := []protocol.SlowlogEntry{}
+		if err := json.Unmarshal([]byte(body), &shardEntries); err != nil {
+			return nil, err
+		}
+		entries = append(entries, shardEntries...)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Duration > entries[j].Duration
+	})
+
+	if len(entries) > count {
+		entries = entries[:count]
+	}
+
+	return entries, nil
+}
+
+// Delete the slow commands of every shard
+func (client *Client) SlowlogReset(ctx context.Context) error {
+	return client.adminCommand(ctx, http.MethodPost, protocol.SlowlogPath+"?op=reset")
+}
+
+// Run the command on every shard, stopping at the first error
+func (client *Client) adminCommand(ctx context.Context, method string, urlStr string) error {
+	for _, conn := range client.conns {
+		if _, err := client.adminRequest(ctx, conn, method, urlStr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (client *Client) adminRequest(ctx context.Context, conn Connection, method string, urlStr string) (string, error) {
+
+	resp, err := client.doIdempotentRequest(ctx, conn, method, urlStr, nil)
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	if err := statusError(resp); err != nil {
+		return "", err
+	}
+
+	return readValue(resp)
+}
+
+// Drop the near cache, the flushed keys may be streamed only once the shards are done
+func (client *Client) flushNearCache() {
+	if client.near != nil {
+		client.near.flush()
+	}
+}
+
+func lines(text string) []string {
+	result := []string{}
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			result = append(result, line)
+		}
+	}
+	return result
+}
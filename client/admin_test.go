@@ -0,0 +1,93 @@
+package client_test
+
+import (
+	"errors"
+	. "gcache/client"
+	"gcache/gcachetest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestClient_Admin(t *testing.T) {
+
+	first := gcachetest.NewServer(t)
+	second := gcachetest.NewServer(t)
+
+	client := NewClient(Connections{first.Connection(), second.Connection()})
+
+	for i := 0; i < 10; i++ {
+		if err := client.Set(ctx, "key"+strconv.Itoa(i), "value", 60); err != nil {
+			t.Fatal("Failed to set the key", err)
+		}
+	}
+
+	if size, err := client.DBSize(ctx); err != nil || size != 10 {
+		t.Errorf("Expected 10 keys but actual %d, err = %v", size, err)
+	}
+
+	infos, err := client.Info(ctx)
+	if err != nil || len(infos) != 2 {
+		t.Fatalf("Expected the info of 2 shards but actual %d, err = %v", len(infos), err)
+	}
+	if infos[0]["version"] == "" || infos[0]["db_0"] == "" {
+		t.Errorf("Unexpected info %v", infos[0])
+	}
+
+	if err := client.ConfigSet(ctx, "maxmemory", "1mb"); err != nil {
+		t.Fatal("Failed to set the config", err)
+	}
+
+	configs, err := client.ConfigGet(ctx, "max*")
+	if err != nil || len(configs) != 2 || configs[1]["maxmemory"] != "1048576" || configs[1]["maxitems"] != "0" {
+		t.Errorf("Unexpected config %v, err = %v", configs, err)
+	}
+
+	var serverError *Error
+	if err := client.ConfigSet(ctx, "unknown", "1"); !errors.As(err, &serverError) || serverError.Code != "BAD_REQUEST" {
+		t.Error("Expected a bad request but actual", err)
+	}
+
+	first.SetSlowlogSlowerThan(time.Nanosecond)
+	client.Get(ctx, "key1")
+	client.Get(ctx, "key2")
+
+	entries, err := client.SlowlogGet(ctx, 1)
+	if err != nil || len(entries) != 1 {
+		t.Errorf("Expected 1 slow command but actual %d, err = %v", len(entries), err)
+	}
+
+	if err := client.SlowlogReset(ctx); err != nil {
+		t.Error("Failed to reset the slow log", err)
+	}
+
+	if err := client.FlushDB(ctx); err != nil {
+		t.Fatal("Failed to flush", err)
+	}
+
+	if size, _ := client.DBSize(ctx); size != 0 {
+		t.Errorf("Expected no keys but actual %d", size)
+	}
+
+	client.Set(ctx, "key", "value", 60)
+
+	if err := client.FlushAll(ctx); err != nil {
+		t.Fatal("Failed to flush", err)
+	}
+
+	if _, err := client.Get(ctx, "key"); err != ErrKeyNotFound {
+		t.Error("Expected the key to be flushed but actual", err)
+	}
+}
+
+func TestClient_AdminNoPerm(t *testing.T) {
+
+	server := gcachetest.NewServer(t)
+	server.ACL().SetUser("reader", "on", ">reader", "allkeys", "+@read")
+
+	client := NewClient(Connections{NewUserConnection(server.URL, "reader", "reader")})
+
+	if err := client.FlushAll(ctx); !errors.Is(err, ErrNoPerm) {
+		t.Error("Expected no permissions but actual", err)
+	}
+}
@@ -0,0 +1,173 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("Circuit breaker is open")
+
+const (
+	DefaultBreakerFailureThreshold int           = 5
+	DefaultBreakerOpenTimeout      time.Duration = 5 * time.Second
+)
+
+// State of a circuit breaker
+type BreakerState int
+
+const (
+	// Requests pass through
+	BreakerClosed BreakerState = iota
+	// Requests fail fast with ErrCircuitOpen
+	BreakerOpen
+	// A single probe request is let through to check whether the shard is back
+	BreakerHalfOpen
+)
+
+var breakerStateNames = []string{"closed", "open", "half-open"}
+
+func (s BreakerState) String() string {
+	if s < BreakerClosed || s > BreakerHalfOpen {
+		return "unknown"
+	}
+	return breakerStateNames[s]
+}
+
+// Circuit breaker configuration
+type BreakerSettings struct {
+	// Number of consecutive failures which opens the breaker. Zero disables the breaker
+	FailureThreshold int
+	// How long the breaker stays open before a probe request is let through
+	OpenTimeout time.Duration
+	// Called on every state transition of a shard's breaker
+	OnStateChange func(addr string, from BreakerState, to BreakerState)
+}
+
+var DefaultBreakerSettings = BreakerSettings{
+	FailureThreshold: DefaultBreakerFailureThreshold,
+	OpenTimeout:      DefaultBreakerOpenTimeout,
+}
+
+// Configure the circuit breakers of the shards
+func WithCircuitBreaker(settings BreakerSettings) Option {
+	return func(o *options) {
+		o.breaker = settings
+	}
+}
+
+// Circuit breaker of a single shard
+type breaker struct {
+	addr     string
+	settings BreakerSettings
+
+	mutex    sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newBreaker(addr string, settings BreakerSettings) *breaker {
+	return &breaker{
+		addr:     addr,
+		settings: settings,
+	}
+}
+
+// Check whether a request may be sent
+func (b *breaker) allow() bool {
+	if b.settings.FailureThreshold <= 0 {
+		return true
+	}
+
+	b.mutex.Lock()
+	from := b.state
+	allowed := true
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.settings.OpenTimeout {
+			allowed = false
+		} else {
+			b.state = BreakerHalfOpen
+			b.probing = true
+		}
+
+	case BreakerHalfOpen:
+		if b.probing {
+			allowed = false
+		} else {
+			b.probing = true
+		}
+	}
+
+	to := b.state
+	b.mutex.Unlock()
+
+	b.notify(from, to)
+
+	return allowed
+}
+
+// Record the outcome of a request let through by allow
+func (b *breaker) record(success bool) {
+	if b.settings.FailureThreshold <= 0 {
+		return
+	}
+
+	b.mutex.Lock()
+	from := b.state
+
+	if success {
+		b.failures = 0
+		b.probing = false
+		b.state = BreakerClosed
+	} else {
+		b.failures++
+		if b.state == BreakerHalfOpen || b.failures >= b.settings.FailureThreshold {
+			b.probing = false
+			b.openedAt = time.Now()
+			b.state = BreakerOpen
+		}
+	}
+
+	to := b.state
+	b.mutex.Unlock()
+
+	b.notify(from, to)
+}
+
+// Forget a request let through by allow whose outcome is unknown, e.g. it was cancelled by the caller
+func (b *breaker) release() {
+	b.mutex.Lock()
+	b.probing = false
+	b.mutex.Unlock()
+}
+
+func (b *breaker) currentState() BreakerState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.state
+}
+
+func (b *breaker) notify(from BreakerState, to BreakerState) {
+	if from != to && b.settings.OnStateChange != nil {
+		b.settings.OnStateChange(b.addr, from, to)
+	}
+}
+
+// A shard is considered failed if it can not be reached or a proxy in front of it reports it's down
+func isShardFailure(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClient_CircuitBreaker(t *testing.T) {
+
+	var healthy int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("value"))
+	}))
+	defer ts.Close()
+
+	var mutex sync.Mutex
+	transitions := []BreakerState{}
+
+	settings := BreakerSettings{
+		FailureThreshold: 2,
+		OpenTimeout:      100 * time.Millisecond,
+		OnStateChange: func(addr string, from BreakerState, to BreakerState) {
+			mutex.Lock()
+			transitions = append(transitions, to)
+			mutex.Unlock()
+		},
+	}
+
+	client := NewClient(Connections{NewConnection(ts.URL, "")}, WithCircuitBreaker(settings))
+
+	// Open the breaker
+	for i := 0; i < 2; i++ {
+		if _, err := client.Get(ctx, "key"); err == nil || err == ErrCircuitOpen {
+			t.Fatal("Expected the server error but actual", err)
+		}
+	}
+
+	if _, err := client.Get(ctx, "key"); err != ErrCircuitOpen {
+		t.Fatal("Expected the breaker to be open but actual", err)
+	}
+
+	stats := client.PoolStats()[0]
+
+	if stats.Breaker != BreakerOpen || stats.Rejected != 1 || stats.Requests != 2 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	// Probe the recovered shard after the open timeout
+	atomic.StoreInt32(&healthy, 1)
+	time.Sleep(settings.OpenTimeout)
+
+	if _, err := client.Get(ctx, "key"); err != nil {
+		t.Fatal("Failed to get the key", err)
+	}
+
+	if state := client.PoolStats()[0].Breaker; state != BreakerClosed {
+		t.Errorf("Expected the breaker to be closed but actual %s", state)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	expected := []BreakerState{BreakerOpen, BreakerHalfOpen, BreakerClosed}
+
+	if len(transitions) != len(expected) {
+		t.Fatalf("Expected transitions %v but actual %v", expected, transitions)
+	}
+
+	for i := range expected {
+		if transitions[i] != expected[i] {
+			t.Errorf("Expected transitions %v but actual %v", expected, transitions)
+		}
+	}
+}
+
+func TestBreaker_HalfOpenFailure(t *testing.T) {
+
+	b := newBreaker("addr", BreakerSettings{FailureThreshold: 1, OpenTimeout: time.Millisecond})
+
+	b.record(false)
+
+	if b.currentState() != BreakerOpen {
+		t.Fatal("Expected the breaker to be open")
+	}
+
+	time.Sleep(2 * time.Millisecond)
+
+	if !b.allow() {
+		t.Fatal("Expected the probe request to be allowed")
+	}
+
+	// Only one probe at a time
+	if b.allow() {
+		t.Error("Expected the second request to be rejected while probing")
+	}
+
+	b.record(false)
+
+	if b.currentState() != BreakerOpen {
+		t.Error("Expected the failed probe to open the breaker again")
+	}
+}
@@ -1,165 +1,336 @@
 package client
 
 import (
+	"bytes"
+	"context"
 	"encoding/csv"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
+	"gcache/protocol"
 	"io/ioutil"
 	"net/http"
+	"sort"
+	"strings"
 )
 
 const headerAuthorization = "Authorization"
 
+// Raw values are preferred, errors are accepted as structured json
+var acceptedTypes = strings.Join([]string{
+	protocol.ContentTypeBinary,
+	protocol.ContentTypeValues,
+	protocol.ContentTypeJSON,
+}, ", ")
+
 var ErrKeyNotFound = errors.New("Key Not Found")
+var ErrWrongType = errors.New("Operation against a key holding the wrong kind of value")
 var ErrServerError = errors.New("Internal Server error")
+var ErrNoMembers = errors.New("No alive cluster members")
+var ErrUnauthorized = errors.New("Invalid username-password pair or user is disabled")
+var ErrNoPerm = errors.New("No permissions to run the command")
+var ErrNoDatabase = errors.New("Database does not exist")
+var ErrRateLimited = errors.New("Too many requests")
+var ErrTooLarge = errors.New("Request is too large")
+var ErrKeyExists = errors.New("Key already exists")
+var ErrBadCursor = errors.New("Invalid scan cursor")
+var ErrEmptyKey = errors.New("Key or hash key is empty")
 
 type Client struct {
 	conns Connections
+	retry RetryPolicy
+	near  *nearCache
+	// Values encoded by codecs longer than this are compressed
+	compressAbove int
+	// Compressed values decompressing to more bytes are not decoded
+	maxDecompressedSize int
 }
 
-func NewClient(conns Connections) *Client {
-	return &Client{
-		conns: conns,
+// Create a client sharding keys between the given connections.
+// Every shard gets its own http client configured by the options
+func NewClient(conns Connections, opts ...Option) *Client {
+
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	shards := make(Connections, len(conns))
+	for i, conn := range conns {
+		conn.pool = newPool(conn, o)
+		shards[i] = conn
 	}
+
+	client := &Client{
+		conns:               shards,
+		retry:               o.retry,
+		compressAbove:       o.compressAbove,
+		maxDecompressedSize: o.maxDecompressedSize,
+	}
+
+	if o.nearCacheSize > 0 {
+		client.near = newNearCache(o.nearCacheSize, o.nearCacheTtl, shards)
+	}
+
+	return client
 }
 
-func (client *Client) Get(key string) (string, error) {
+// Stop following the invalidation streams of the near cache and close idle connections.
+// The client must not be used afterwards
+func (client *Client) Close() {
+	if client.near != nil {
+		client.near.close()
+	}
 
-	conn := client.conns.getShard(key)
-	resp, err := conn.doRequest(http.MethodGet, "/keys?key=" + key, nil)
+	for _, conn := range client.conns {
+		conn.pool.httpClient.CloseIdleConnections()
+	}
+}
 
-	if err != nil {
-		return "", err
+// Drop the keys written by this client from the near cache, not waiting for the server to stream them
+func (client *Client) invalidate(keys ...string) {
+	if client.near != nil {
+		client.near.invalidate(keys...)
 	}
+}
 
-	if resp.StatusCode == http.StatusNotFound {
-		return "", ErrKeyNotFound
+// Return connection pool statistics per shard
+func (client *Client) PoolStats() []PoolStats {
+	stats := make([]PoolStats, len(client.conns))
+	for i, conn := range client.conns {
+		stats[i] = conn.pool.snapshot()
 	}
+	return stats
+}
+
+// Create a client for a gossip cluster. The membership view is fetched from the seed
+// and every member which is not dead becomes a shard. All the members share the password
+func NewClientFromSeed(ctx context.Context, seed string, psw string, opts ...Option) (*Client, error) {
+	return NewClientFromSeedConnection(ctx, NewConnection(seed, psw), opts...)
+}
 
-	if resp.StatusCode == http.StatusInternalServerError {
-		return "", ErrServerError
+// Create a client for a gossip cluster from the connection to the seed, e.g. a TLS connection.
+// The members are reached with the credentials, the database and the TLS settings of the seed connection
+func NewClientFromSeedConnection(ctx context.Context, seed Connection, opts ...Option) (*Client, error) {
+
+	seedClient := NewClient(Connections{seed}, opts...)
+	defer seedClient.Close()
+
+	resp, err := seedClient.doIdempotentRequest(ctx, seedClient.conns[0], http.MethodGet, "/cluster", nil)
+
+	if err != nil {
+		return nil, err
 	}
 
+	defer resp.Body.Close()
+
 	if resp.StatusCode != http.StatusOK {
-		return "", unexpectedStatusError(resp.StatusCode)
+		return nil, unexpectedStatusError(resp.StatusCode)
 	}
 
-	defer resp.Body.Close()
-	content, err := ioutil.ReadAll(resp.Body)
+	rows, err := csv.NewReader(resp.Body).ReadAll()
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return string(content), nil
+	// Rows are address, state and incarnation
+	addrs := []string{}
+	for _, row := range rows {
+		if len(row) > 1 && row[1] != "dead" {
+			addrs = append(addrs, row[0])
+		}
+	}
 
-}
+	if len(addrs) == 0 {
+		return nil, ErrNoMembers
+	}
 
-func (client *Client) Set(key string, value string, ttl int) error {
+	// Keep the order stable so that every client maps keys to the same shards
+	sort.Strings(addrs)
 
-	url := fmt.Sprintf("/keys?key=%s&value=%s&ttl=%d", key, value, ttl)
+	conns := make(Connections, len(addrs))
+	for i, addr := range addrs {
+		conns[i] = seed
+		conns[i].addr = addr
+	}
 
-	conn := client.conns.getShard(key)
-	resp, err := conn.doRequest(http.MethodPost, url, nil)
-	if err != nil {
-		return err
+	return NewClient(conns, opts...), nil
+}
+
+func (client *Client) Get(ctx context.Context, key string) (string, error) {
+
+	if key == "" {
+		return "", ErrEmptyKey
 	}
 
-	if resp.StatusCode == http.StatusInternalServerError {
-		return ErrServerError
+	if client.near == nil {
+		return client.get(ctx, key)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return unexpectedStatusError(resp.StatusCode)
+	shard := client.conns.shardIndex(key)
+
+	if value, ok := client.near.get(shard, key); ok {
+		return value, nil
 	}
 
-	return nil
+	epoch := client.near.currentEpoch()
+	value, err := client.get(ctx, key)
+
+	if err == nil {
+		client.near.set(shard, key, value, epoch)
+	}
 
+	return value, err
 }
 
-func (client *Client) updateKey(conn Connection, url string) error {
+func (client *Client) get(ctx context.Context, key string) (string, error) {
 
-	resp, err := conn.doRequest(http.MethodPatch, url, nil)
+	conn := client.conns.getShard(key)
+	resp, err := client.doIdempotentRequest(ctx, conn, http.MethodGet, keyPath(key), nil)
 
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	if err != nil {
-		return err
+	defer resp.Body.Close()
+
+	if err := statusError(resp); err != nil {
+		return "", err
 	}
 
-	if resp.StatusCode == http.StatusNotFound {
-		return ErrKeyNotFound
+	return readValue(resp)
+}
+
+// Get the ttl of the key in seconds, as it was set
+func (client *Client) Ttl(ctx context.Context, key string) (int, error) {
+
+	if key == "" {
+		return 0, ErrEmptyKey
 	}
 
-	if resp.StatusCode == http.StatusInternalServerError {
-		return ErrServerError
+	conn := client.conns.getShard(key)
+	resp, err := conn.doStructuredRequest(ctx, http.MethodGet, keyPath(key))
+
+	if err != nil {
+		return 0, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return unexpectedStatusError(resp.StatusCode)
+	defer resp.Body.Close()
+
+	if err := statusError(resp); err != nil {
+		return 0, err
 	}
 
-	return nil
+	response := protocol.ValueResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return 0, err
+	}
 
-}
+	// The key expired between reading the value and the ttl
+	if response.Ttl == nil {
+		return 0, ErrKeyNotFound
+	}
 
-func (client *Client) Update(key string, value string) error {
-	conn := client.conns.getShard(key)
-	url := fmt.Sprintf("/keys?key=%s&value=%s", key, value)
-	return client.updateKey(conn, url)
+	return int(*response.Ttl), nil
 }
 
-func (client *Client) UpdateWithTtl(key string, value string, ttl int) error {
+func (client *Client) Set(ctx context.Context, key string, value string, ttl int) error {
+
+	if key == "" {
+		return ErrEmptyKey
+	}
+
+	url := fmt.Sprintf("%s?ttl=%d", keyPath(key), ttl)
+
+	defer client.invalidate(key)
+
 	conn := client.conns.getShard(key)
-	url := fmt.Sprintf("/keys?key=%s&value=%s&ttl=%d", key, value, ttl)
-	return client.updateKey(conn, url)
+	resp, err := client.doIdempotentRequest(ctx, conn, http.MethodPost, url, []byte(value))
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	return statusError(resp)
 }
 
-func (client *Client) Del(key string) error {
+func (client *Client) updateKey(ctx context.Context, key string, url string, value string) error {
 
-	conn := client.conns.getShard(key)
+	if key == "" {
+		return ErrEmptyKey
+	}
 
-	url := "/keys?key=" + key
+	defer client.invalidate(key)
 
-	resp, err := conn.doRequest(http.MethodDelete, url, nil)
+	conn := client.conns.getShard(key)
+	resp, err := conn.doRequest(ctx, http.MethodPatch, url, bytes.NewBufferString(value))
 
 	if err != nil {
 		return err
 	}
 
-	if resp.StatusCode == http.StatusNotFound {
-		return ErrKeyNotFound
-	}
+	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusInternalServerError {
-		return ErrServerError
+	return statusError(resp)
+}
+
+func (client *Client) Update(ctx context.Context, key string, value string) error {
+	return client.updateKey(ctx, key, keyPath(key), value)
+}
+
+func (client *Client) UpdateWithTtl(ctx context.Context, key string, value string, ttl int) error {
+	url := fmt.Sprintf("%s?ttl=%d", keyPath(key), ttl)
+	return client.updateKey(ctx, key, url, value)
+}
+
+func (client *Client) Del(ctx context.Context, key string) error {
+
+	if key == "" {
+		return ErrEmptyKey
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return unexpectedStatusError(resp.StatusCode)
+	defer client.invalidate(key)
+
+	conn := client.conns.getShard(key)
+	resp, err := client.doIdempotentRequest(ctx, conn, http.MethodDelete, keyPath(key), nil)
+
+	if err != nil {
+		return err
 	}
 
-	return nil
+	defer resp.Body.Close()
+
+	return statusError(resp)
 }
 
-func (client *Client) Keys() ([]string, error) {
+func (client *Client) Keys(ctx context.Context) ([]string, error) {
 
-	responses := client.conns.doParallelGetRequest("/keys")
+	responses := client.conns.doParallelGetRequest(ctx, protocol.KeysPath)
+
+	for _, resp := range responses {
+		if resp.err == nil {
+			defer resp.response.Body.Close()
+		}
+	}
 
 	// If there are any error, return it
 	for _, resp := range responses {
 		if resp.err != nil {
 			return nil, resp.err
 		}
+
+		if err := statusError(resp.response); err != nil {
+			return nil, err
+		}
 	}
 
 	// Concatenate keys
 	keys := []string{}
 	for _, resp := range responses {
-		content, err := readCsv(resp.response.Body)
+		content, err := protocol.ReadValues(resp.response.Body)
 
 		if err != nil {
 			return nil, err
@@ -172,168 +343,227 @@ func (client *Client) Keys() ([]string, error) {
 
 //------ LIST ---------
 
-func (client *Client) LPush(key string, value string) error {
-	return client.push("lpush", key, value)
+func (client *Client) LPush(ctx context.Context, key string, value string) error {
+	return client.push(ctx, "lpush", key, value)
 }
 
-func (client *Client) RPush(key string, value string) error {
-	return client.push("rpush", key, value)
+func (client *Client) RPush(ctx context.Context, key string, value string) error {
+	return client.push(ctx, "rpush", key, value)
 }
 
-func (client *Client) LRange(key string, from int, to int) ([]string, error) {
+func (client *Client) LRange(ctx context.Context, key string, from int, to int) ([]string, error) {
 
+	if key == "" {
+		return nil, ErrEmptyKey
+	}
 
-	url := fmt.Sprintf("/lists?op=range&key=%s&from=%d&to=%d", key, from, to)
+	url := fmt.Sprintf("%s?op=range&from=%d&to=%d", listPath(key), from, to)
 
 	conn := client.conns.getShard(key)
-	resp, err := conn.doRequest(http.MethodGet, url, nil)
+	resp, err := client.doIdempotentRequest(ctx, conn, http.MethodGet, url, nil)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if resp.StatusCode == http.StatusNotFound {
-		return nil, ErrKeyNotFound
-	}
-
-	if resp.StatusCode == http.StatusInternalServerError {
-		return nil, ErrServerError
-	}
+	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, unexpectedStatusError(resp.StatusCode)
+	if err := statusError(resp); err != nil {
+		return nil, err
 	}
 
-	defer resp.Body.Close()
-
-	return readCsv(resp.Body)
+	return protocol.ReadValues(resp.Body)
 }
 
-func (client *Client) LPop(key string) (string, error) {
-	return client.pop("lpop", key)
+func (client *Client) LPop(ctx context.Context, key string) (string, error) {
+	return client.pop(ctx, "lpop", key)
 }
 
-func (client *Client) RPop(key string) (string, error) {
-	return client.pop("rpop", key)
+func (client *Client) RPop(ctx context.Context, key string) (string, error) {
+	return client.pop(ctx, "rpop", key)
 }
 
-func (client *Client) push(method string, key string, value string) error {
+func (client *Client) push(ctx context.Context, method string, key string, value string) error {
 
-	url := fmt.Sprintf("/lists?op=%s&key=%s&value=%s", method, key, value)
+	if key == "" {
+		return ErrEmptyKey
+	}
+
+	url := fmt.Sprintf("%s?op=%s", listPath(key), method)
 
 	conn := client.conns.getShard(key)
-	resp, err := conn.doRequest(http.MethodPost, url, nil)
+	resp, err := conn.doRequest(ctx, http.MethodPost, url, bytes.NewBufferString(value))
 
 	if err != nil {
 		return err
 	}
 
-	if resp.StatusCode == http.StatusInternalServerError {
-		return ErrServerError
+	defer resp.Body.Close()
+
+	return statusError(resp)
+}
+
+func (client *Client) pop(ctx context.Context, method string, key string) (string, error) {
+
+	if key == "" {
+		return "", ErrEmptyKey
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return unexpectedStatusError(resp.StatusCode)
+	url := fmt.Sprintf("%s?op=%s", listPath(key), method)
+
+	conn := client.conns.getShard(key)
+	resp, err := conn.doRequest(ctx, http.MethodPost, url, nil)
+
+	if err != nil {
+		return "", err
 	}
 
-	return nil
+	defer resp.Body.Close()
+
+	if err := statusError(resp); err != nil {
+		return "", err
+	}
+
+	return readValue(resp)
 }
 
-func (client *Client) pop(method string, key string) (string, error) {
+//------- HASH -----------
+
+func (client *Client) HGet(ctx context.Context, key string, hashKey string) (string, error) {
 
-	url := fmt.Sprintf("/lists?op=%s&key=%s", method, key)
+	if key == "" || hashKey == "" {
+		return "", ErrEmptyKey
+	}
 
 	conn := client.conns.getShard(key)
-	resp, err := conn.doRequest(http.MethodPost, url, nil)
+	resp, err := client.doIdempotentRequest(ctx, conn, http.MethodGet, hashPath(key, hashKey), nil)
 
 	if err != nil {
 		return "", err
 	}
 
-	if resp.StatusCode == http.StatusInternalServerError {
-		return "", ErrServerError
+	defer resp.Body.Close()
+
+	if err := statusError(resp); err != nil {
+		return "", err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", unexpectedStatusError(resp.StatusCode)
+	return readValue(resp)
+}
+
+func (client *Client) HSet(ctx context.Context, key string, hashKey string, value string) error {
+
+	if key == "" || hashKey == "" {
+		return ErrEmptyKey
 	}
 
-	defer resp.Body.Close()
-	content, err := ioutil.ReadAll(resp.Body)
+	conn := client.conns.getShard(key)
+	resp, err := conn.doRequest(ctx, http.MethodPost, hashPath(key, hashKey), bytes.NewBufferString(value))
 
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	return string(content), nil
-}
+	defer resp.Body.Close()
 
-func unexpectedStatusError(status int) error {
-	return fmt.Errorf("Unexpected status %d", status)
+	return statusError(resp)
 }
 
-func readCsv(body io.Reader) ([]string, error) {
-	reader := csv.NewReader(body)
-	result, err := reader.Read()
+func keyPath(key string) string {
+	return protocol.KeysPath + "/" + protocol.EscapeSegment(key)
+}
 
-	if err != nil && err != io.EOF {
-		return nil, err
-	}
+func listPath(key string) string {
+	return protocol.ListsPath + "/" + protocol.EscapeSegment(key)
+}
 
-	return result, nil
+func hashPath(key string, hashKey string) string {
+	return protocol.HashesPath + "/" + protocol.EscapeSegment(key) + "/" + protocol.EscapeSegment(hashKey)
 }
 
-//------- HASH -----------
+// Error reported by the server in a structured response
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+}
 
-func (client *Client) HGet(key string, hashKey string) (string, error) {
-	url := fmt.Sprintf("/hashes?key=%s&hashKey=%s", key, hashKey)
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s (status %d)", e.Code, e.Message, e.Status)
+}
 
-	conn := client.conns.getShard(key)
-	resp, err := conn.doRequest(http.MethodGet, url, nil)
+// Map the response to an error. Structured errors are mapped by their code
+func statusError(resp *http.Response) error {
 
-	if err != nil {
-		return "", err
+	if resp.StatusCode == http.StatusOK {
+		return nil
 	}
 
-	if resp.StatusCode == http.StatusNotFound {
-		return "", ErrKeyNotFound
-	}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), protocol.ContentTypeJSON) {
+		errorResponse := protocol.ErrorResponse{}
 
-	if resp.StatusCode == http.StatusInternalServerError {
-		return "", ErrServerError
+		if err := json.NewDecoder(resp.Body).Decode(&errorResponse); err == nil && errorResponse.Error.Code != "" {
+			return codeError(resp.StatusCode, errorResponse.Error)
+		}
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", unexpectedStatusError(resp.StatusCode)
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return ErrKeyNotFound
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	case http.StatusRequestEntityTooLarge:
+		return ErrTooLarge
+	case http.StatusInternalServerError:
+		return ErrServerError
 	}
 
-	defer resp.Body.Close()
-	content, err := ioutil.ReadAll(resp.Body)
+	return unexpectedStatusError(resp.StatusCode)
+}
 
-	if err != nil {
-		return "", err
+// Map the structured error to an error by its code
+func codeError(status int, body protocol.ErrorBody) error {
+
+	switch body.Code {
+	case protocol.CodeNotFound:
+		return ErrKeyNotFound
+	case protocol.CodeWrongType:
+		return ErrWrongType
+	case protocol.CodeNoDatabase:
+		return ErrNoDatabase
+	case protocol.CodeNoPerm:
+		return fmt.Errorf("%w: %s", ErrNoPerm, body.Message)
+	case protocol.CodeRateLimited:
+		return ErrRateLimited
+	case protocol.CodeTooLarge:
+		return fmt.Errorf("%w: %s", ErrTooLarge, body.Message)
+	case protocol.CodeKeyExists:
+		return ErrKeyExists
+	}
+
+	return &Error{
+		Status:  status,
+		Code:    body.Code,
+		Message: body.Message,
 	}
+}
 
-	return string(content), nil
+func unexpectedResultsError(expected int, actual int) error {
+	return fmt.Errorf("Expected %d results but received %d", expected, actual)
 }
 
-func (client *Client) HSet(key string, hashKey string, value string) error {
-	url := fmt.Sprintf("/hashes?key=%s&hashKey=%s&value=%s", key, hashKey, value)
+func unexpectedStatusError(status int) error {
+	return fmt.Errorf("Unexpected status %d", status)
+}
 
-	conn := client.conns.getShard(key)
-	resp, err := conn.doRequest(http.MethodPost, url, nil)
+func readValue(resp *http.Response) (string, error) {
+	content, err := ioutil.ReadAll(resp.Body)
 
 	if err != nil {
-		return err
-	}
-
-	if resp.StatusCode == http.StatusInternalServerError {
-		return ErrServerError
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return unexpectedStatusError(resp.StatusCode)
+		return "", err
 	}
 
-	return nil
+	return string(content), nil
 }
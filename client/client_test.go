@@ -1,20 +1,36 @@
-package client
+package client_test
 
 import (
+	"context"
+	"errors"
+	. "gcache/client"
+	"gcache/gcachetest"
+	"gcache/server"
+	"gcache/server/cluster"
+	"gcache/trace"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"strconv"
+	"sync"
 	"testing"
+	"time"
 )
 
-// NOTE, before running the test execute the server.sh script in the ./cmd/gcache folder.
-// The scripts runs two cache servers on ports 8080 and 8081
-// The 8081 server is run with authentication psw=123
+// Servers are run in process by gcachetest, the auth server is run with psw=123
+const psw string = "123"
 
-const (
-	connectionString string = "http://localhost:8080"
-	connectionStringAuth string = "http://localhost:8081"
-	psw string = "123"
-)
+var ctx = context.Background()
+
+// Connection to a new server without auth
+func connection(t *testing.T) Connection {
+	return gcachetest.NewServer(t).Connection()
+}
+
+// Connection to a new server with auth
+func connectionAuth(t *testing.T) Connection {
+	return gcachetest.NewServerWithAuth(t, psw).Connection()
+}
 
 func TestClient_SetGetDel(t *testing.T) {
 
@@ -22,7 +38,7 @@ func TestClient_SetGetDel(t *testing.T) {
 	const value = "value"
 
 	conns := Connections{
-		{connectionString, ""},
+		connection(t),
 	}
 
 	client := NewClient(conns)
@@ -36,7 +52,7 @@ func TestClient_SetGetDel_WithAuth(t *testing.T) {
 	const value = "value"
 
 	conns := Connections{
-		{connectionStringAuth, psw},
+		connectionAuth(t),
 	}
 
 	client := NewClient(conns)
@@ -48,22 +64,20 @@ func TestClient_Keys_Sharded(t *testing.T) {
 	const n = 10
 
 	// Two shards
-	conns := Connections{
-		{connectionString, ""},
-		{connectionStringAuth, psw},
-	}
+	conn, connAuth := connection(t), connectionAuth(t)
+	conns := Connections{conn, connAuth}
 
 	client := NewClient(conns)
 
 	for i := 0; i < n; i++ {
-		err := client.Set(strconv.Itoa(i), "value", 5)
+		err := client.Set(ctx, strconv.Itoa(i), "value", 5)
 
 		if err != nil {
 			t.Error("Failed to set the key", err)
 		}
 	}
 
-	keys, err := client.Keys()
+	keys, err := client.Keys(ctx)
 
 	if err != nil {
 		t.Error("Failed to get keys", err)
@@ -75,17 +89,13 @@ func TestClient_Keys_Sharded(t *testing.T) {
 	}
 
 	// Make sure keys are distributed between shards
-	client1 := NewClient(Connections{
-		{connectionString, ""},
-	})
+	client1 := NewClient(Connections{conn})
 
-	client2 := NewClient(Connections{
-		{connectionStringAuth, psw},
-	})
+	client2 := NewClient(Connections{connAuth})
 
 
-	keys1, _ := client1.Keys()
-	keys2, _ := client2.Keys()
+	keys1, _ := client1.Keys(ctx)
+	keys2, _ := client2.Keys(ctx)
 
 
 	if len(keys1) == 0 || len(keys2) == 0 {
@@ -94,20 +104,20 @@ func TestClient_Keys_Sharded(t *testing.T) {
 
 	//Tear down
 	for i := 0; i < n; i++ {
-		client.Del(strconv.Itoa(i))
+		client.Del(ctx, strconv.Itoa(i))
 	}
 }
 
 
 func test_SetGetDel(client *Client, key string, value string, t *testing.T) {
 
-	err := client.Set(key, value, 5)
+	err := client.Set(ctx, key, value, 5)
 
 	if err != nil {
 		t.Error("Failed to set the key", err)
 	}
 
-	returnedValue, err := client.Get(key)
+	returnedValue, err := client.Get(ctx, key)
 
 	if err != nil {
 		t.Error("Failed to get the key", err)
@@ -117,7 +127,7 @@ func test_SetGetDel(client *Client, key string, value string, t *testing.T) {
 		t.Error("Set value", value, "is not equal to returned value", returnedValue)
 	}
 
-	err = client.Del(key)
+	err = client.Del(ctx, key)
 
 	if err != nil {
 		t.Error("Failed to delete the key", err)
@@ -127,12 +137,12 @@ func test_SetGetDel(client *Client, key string, value string, t *testing.T) {
 func TestClient_Keys(t *testing.T) {
 
 	conns := Connections{
-		{connectionString, ""},
+		connection(t),
 	}
 
 	client := NewClient(conns)
 
-	keys, err := client.Keys()
+	keys, err := client.Keys(ctx)
 
 	const key1 = "key1"
 	const key2 = "key2"
@@ -146,20 +156,20 @@ func TestClient_Keys(t *testing.T) {
 	}
 
 	// Insert key1
-	err = client.Set(key1, "value", 5)
+	err = client.Set(ctx, key1, "value", 5)
 
 	if err != nil {
 		t.Error("Failed to set the key1", err)
 	}
 
 	// Insert key2
-	err = client.Set(key2, "value", 5)
+	err = client.Set(ctx, key2, "value", 5)
 
 	if err != nil {
 		t.Error("Failed to set the key2", err)
 	}
 
-	keys, err = client.Keys()
+	keys, err = client.Keys(ctx)
 
 	if err != nil {
 		t.Error("Failed to get keys", err)
@@ -175,8 +185,8 @@ func TestClient_Keys(t *testing.T) {
 	}
 
 	// Tear down
-	client.Del(key1)
-	client.Del(key2)
+	client.Del(ctx, key1)
+	client.Del(ctx, key2)
 
 }
 
@@ -187,39 +197,90 @@ func TestClient_Update(t *testing.T) {
 	const updatedValue = "updated"
 
 	conns := Connections{
-		{connectionString, ""},
+		connection(t),
 	}
 
 	client := NewClient(conns)
 
-	err := client.Update(key, "value")
+	err := client.Update(ctx, key, "value")
 
 	if err == nil {
 		t.Error("Expected: key not found")
 	}
 
 	// Insert key
-	err = client.Set(key, "value", 5)
+	err = client.Set(ctx, key, "value", 5)
 
 	if err != nil {
 		t.Error("Failed to set the key", err)
 	}
 
-	err = client.Update(key, updatedValue)
+	err = client.Update(ctx, key, updatedValue)
 
 	if (err != nil) {
 		t.Error("Failed to update. Err = ", err)
 	}
 
-	value, err := client.Get(key)
+	value, err := client.Get(ctx, key)
 
 	if value != updatedValue {
 		t.Errorf("Update value '%s' does not equal to returned value '%s'", updatedValue, value)
 	}
 
 	// Tear down
-	client.Del(key)
+	client.Del(ctx, key)
+
+}
+
+func TestClient_Ttl(t *testing.T) {
+
+	const key = "key"
+
+	client := NewClient(Connections{connection(t)})
+
+	if _, err := client.Ttl(ctx, key); err != ErrKeyNotFound {
+		t.Errorf("Expected: key not found, actual %v", err)
+	}
+
+	if err := client.Set(ctx, key, "value", 5); err != nil {
+		t.Fatal("Failed to set the key", err)
+	}
+
+	ttl, err := client.Ttl(ctx, key)
+	if err != nil || ttl != 5 {
+		t.Errorf("Expected ttl 5 but actual %d %v", ttl, err)
+	}
+
+	client.LPush(ctx, "list", "value")
+	if _, err := client.Ttl(ctx, "list"); err != ErrWrongType {
+		t.Errorf("Expected: wrong type, actual %v", err)
+	}
+
+	// Tear down
+	client.Del(ctx, key)
+	client.Del(ctx, "list")
+}
+
+func TestClient_EmptyKey(t *testing.T) {
 
+	client := NewClient(Connections{connection(t)})
+
+	if err := client.Set(ctx, "key", "value", 5); err != nil {
+		t.Fatal("Failed to set the key", err)
+	}
+
+	// The empty key is not sent, its path would be the listing of the keys
+	if value, err := client.Get(ctx, ""); err != ErrEmptyKey {
+		t.Errorf("Expected: empty key, actual %q %v", value, err)
+	}
+
+	if err := client.Set(ctx, "", "value", 5); err != ErrEmptyKey {
+		t.Errorf("Expected: empty key, actual %v", err)
+	}
+
+	if err := client.HSet(ctx, "hash", "", "value"); err != ErrEmptyKey {
+		t.Errorf("Expected: empty key, actual %v", err)
+	}
 }
 
 func TestClient_UpdateWithTtl(t *testing.T) {
@@ -228,40 +289,40 @@ func TestClient_UpdateWithTtl(t *testing.T) {
 	const updatedValue = "updated"
 
 	conns := Connections{
-		{connectionString, ""},
+		connection(t),
 	}
 
 	client := NewClient(conns)
 
-	err := client.UpdateWithTtl(key, "value", 5)
+	err := client.UpdateWithTtl(ctx, key, "value", 5)
 
 	if err == nil {
 		t.Error("Expected: key not found")
 	}
 
 	// Insert key
-	err = client.Set(key, "value", 5)
+	err = client.Set(ctx, key, "value", 5)
 
 	if err != nil {
 		t.Error("Failed to set the key", err)
 	}
 
 	// Update
-	err = client.UpdateWithTtl(key, updatedValue, 25)
+	err = client.UpdateWithTtl(ctx, key, updatedValue, 25)
 
 	// Assertions
 	if (err != nil) {
 		t.Error("Failed to update. Err = ", err)
 	}
 
-	value, err := client.Get(key)
+	value, err := client.Get(ctx, key)
 
 	if value != updatedValue {
 		t.Errorf("Update value '%s' does not equal to returned value '%s'", updatedValue, value)
 	}
 
 	// Tear down
-	client.Del(key)
+	client.Del(ctx, key)
 
 }
 
@@ -272,18 +333,18 @@ func TestClient_HSet_HGET(t *testing.T) {
 	const value = "value"
 
 	conns := Connections{
-		{connectionString, ""},
+		connection(t),
 	}
 
 	client := NewClient(conns)
 
-	err := client.HSet(key, hashKey, value)
+	err := client.HSet(ctx, key, hashKey, value)
 
 	if err != nil {
 		t.Errorf("Failed to hset '%s' with hash key '%s' and value '%s'. Err = %s", key, hashKey, value, err)
 	}
 
-	returnedValue, err := client.HGet(key, hashKey)
+	returnedValue, err := client.HGet(ctx, key, hashKey)
 
 	if err != nil {
 		t.Error("Failed to get the key", err)
@@ -294,27 +355,27 @@ func TestClient_HSet_HGET(t *testing.T) {
 	}
 
 	// Tear down
-	client.Del(key)
+	client.Del(ctx, key)
 }
 
 func TestClient_LRange_LPUSH_LPOP(t *testing.T) {
 	const listKey = "rangelistKey"
 
 	conns := Connections{
-		{connectionString, ""},
+		connection(t),
 	}
 
 	client := NewClient(conns)
 
 	// LPUSH 10 items
 	for i := 0; i < 10; i++ {
-		err := client.LPush(listKey, strconv.Itoa(i))
+		err := client.LPush(ctx, listKey, strconv.Itoa(i))
 		if err != nil {
 			t.Errorf("Failed to lpush. ListKey = '%s'. Error = %s", listKey, err)
 		}
 	}
 
-	values, err := client.LRange(listKey, 2, 4)
+	values, err := client.LRange(ctx, listKey, 2, 4)
 
 	if err != nil {
 		t.Fatalf("LRange failed. Err = %s", err)
@@ -330,14 +391,14 @@ func TestClient_LRange_LPUSH_LPOP(t *testing.T) {
 
 	// Tear down
 	for i := 0; i < 10; i++ {
-		_, err := client.LPop(listKey)
+		_, err := client.LPop(ctx, listKey)
 		if err != nil {
 			t.Errorf("Failed to lpop. ListKey = '%s'. Error = %s", listKey, err)
 		}
 	}
 
 	// Tear down
-	client.Del(listKey)
+	client.Del(ctx, listKey)
 }
 
 func TestClient_RPush_RPop(t *testing.T) {
@@ -346,19 +407,19 @@ func TestClient_RPush_RPop(t *testing.T) {
 	const value = "value"
 
 	conns := Connections{
-		{connectionString, ""},
+		connection(t),
 	}
 
 	client := NewClient(conns)
 
 	// RPush
-	err := client.RPush(key, value)
+	err := client.RPush(ctx, key, value)
 	if err != nil {
 		t.Errorf("Failed to RPush. ListKey = '%s'. Error = %s", key, err)
 	}
 
 	// RPop
-	returnedValue, err := client.RPop(key)
+	returnedValue, err := client.RPop(ctx, key)
 	if err != nil {
 		t.Errorf("Failed to RPop. ListKey = '%s'. Error = %s", key, err)
 	}
@@ -368,8 +429,109 @@ func TestClient_RPush_RPop(t *testing.T) {
 	}
 
 	// Tear down
-	client.Del(key)
+	client.Del(ctx, key)
+
+}
+
+func TestClient_BinarySafe(t *testing.T) {
+
+	const key = "a b&c=d#e/f?g."
+	const value = "value & = # ? \x00\xff\r\n"
+
+	client := NewClient(Connections{
+		connection(t),
+	})
+
+	test_SetGetDel(client, key, value, t)
+
+	err := client.HSet(ctx, key, key, value)
+
+	if err != nil {
+		t.Fatal("Failed to hset", err)
+	}
+
+	returnedValue, err := client.HGet(ctx, key, key)
+
+	if err != nil || returnedValue != value {
+		t.Errorf("Expected %q but returned %q, err = %v", value, returnedValue, err)
+	}
+
+	client.Del(ctx, key)
+}
+
+func TestClient_WrongType(t *testing.T) {
+
+	const key = "wrongtypekey"
+
+	client := NewClient(Connections{
+		connection(t),
+	})
+
+	if err := client.Set(ctx, key, "value", 5); err != nil {
+		t.Fatal("Failed to set the key", err)
+	}
+
+	if err := client.LPush(ctx, key, "value"); err != ErrWrongType {
+		t.Error("Expected wrong type but actual", err)
+	}
+
+	if _, err := client.HGet(ctx, key, "hashKey"); err != ErrWrongType {
+		t.Error("Expected wrong type but actual", err)
+	}
+
+	client.Del(ctx, key)
+}
+
+func TestClient_Limits(t *testing.T) {
+
+	srv := gcachetest.NewServer(t)
+	srv.SetLimits(server.Limits{MaxValueSize: 4})
+	srv.Cache().SetMaxListLength(1)
+
+	client := NewClient(Connections{srv.Connection()})
+
+	if err := client.Set(ctx, "key", "12345", 60); !errors.Is(err, ErrTooLarge) {
+		t.Error("Expected the value to be too large but actual", err)
+	}
+
+	client.LPush(ctx, "list", "a")
+	if err := client.LPush(ctx, "list", "b"); !errors.Is(err, ErrTooLarge) {
+		t.Error("Expected the list to be full but actual", err)
+	}
 
+	srv.SetLimits(server.Limits{Rate: server.RateLimit{Rate: 0.001, Burst: 1}})
+	client.Get(ctx, "key")
+
+	if _, err := client.Get(ctx, "key"); err != ErrRateLimited {
+		t.Error("Expected the request to be rate limited but actual", err)
+	}
+}
+
+func TestClient_NewClientFromSeed(t *testing.T) {
+
+	member := gcachetest.NewServer(t)
+
+	members := []cluster.Member{
+		{Addr: member.URL, State: cluster.StateAlive},
+		{Addr: "http://localhost:8089", State: cluster.StateDead},
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		cluster.WriteMembers(w, members)
+	}))
+	defer ts.Close()
+
+	client, err := NewClientFromSeed(ctx, ts.URL, "")
+
+	if err != nil {
+		t.Fatal("Failed to create client from seed", err)
+	}
+
+	if stats := client.PoolStats(); len(stats) != 1 || stats[0].Addr != member.URL {
+		t.Fatalf("Expected the only shard %s but actual %v", member.URL, stats)
+	}
+
+	test_SetGetDel(client, "key", "value", t)
 }
 
 func contains(s []string, e string) bool {
@@ -380,3 +542,138 @@ func contains(s []string, e string) bool {
 	}
 	return false
 }
+
+func TestClient_UserConnection(t *testing.T) {
+
+	server := gcachetest.NewServerWithAuth(t, psw)
+	server.ACL().SetUser("reader", "on", ">secret", "~cache:*", "+@read")
+
+	admin := NewClient(Connections{server.Connection()})
+	if err := admin.Set(ctx, "cache:1", "value", 60); err != nil {
+		t.Fatal("Failed to set the key", err)
+	}
+
+	reader := NewClient(Connections{NewUserConnection(server.URL, "reader", "secret")})
+
+	if value, err := reader.Get(ctx, "cache:1"); err != nil || value != "value" {
+		t.Errorf("Expected %q but actual %q, err = %v", "value", value, err)
+	}
+
+	if err := reader.Set(ctx, "cache:1", "changed", 60); !errors.Is(err, ErrNoPerm) {
+		t.Error("Expected no permissions but actual", err)
+	}
+
+	if _, err := reader.Get(ctx, "other"); !errors.Is(err, ErrNoPerm) {
+		t.Error("Expected no permissions but actual", err)
+	}
+
+	wrong := NewClient(Connections{NewUserConnection(server.URL, "reader", "wrong")})
+	if _, err := wrong.Get(ctx, "cache:1"); err != ErrUnauthorized {
+		t.Error("Expected unauthorized but actual", err)
+	}
+}
+
+func TestClient_Database(t *testing.T) {
+
+	server := gcachetest.NewServer(t)
+	if _, err := server.AddDatabase("sessions", 0); err != nil {
+		t.Fatal("Failed to add the database", err)
+	}
+
+	defaultClient := NewClient(Connections{server.Connection()})
+	sessions := NewClient(Connections{server.Connection().WithDatabase("sessions")})
+
+	if err := defaultClient.Set(ctx, "key", "default", 60); err != nil {
+		t.Fatal("Failed to set the key", err)
+	}
+
+	if err := sessions.Set(ctx, "key", "session", 60); err != nil {
+		t.Fatal("Failed to set the key", err)
+	}
+
+	if value, err := defaultClient.Get(ctx, "key"); err != nil || value != "default" {
+		t.Errorf("Expected %q but actual %q, err = %v", "default", value, err)
+	}
+
+	if value, err := sessions.Get(ctx, "key"); err != nil || value != "session" {
+		t.Errorf("Expected %q but actual %q, err = %v", "session", value, err)
+	}
+
+	missing := NewClient(Connections{server.Connection().WithDatabase("missing")})
+	if _, err := missing.Get(ctx, "key"); err != ErrNoDatabase {
+		t.Error("Expected no database but actual", err)
+	}
+}
+
+func TestClient_Tracing(t *testing.T) {
+
+	mutex := sync.Mutex{}
+	spans := map[string]*trace.SpanData{}
+	tracer := trace.NewTracer(trace.ExporterFunc(func(span *trace.SpanData) {
+		mutex.Lock()
+		spans[span.Name] = span
+		mutex.Unlock()
+	}))
+
+	server := gcachetest.NewServer(t)
+	server.SetTracer(tracer)
+
+	client := NewClient(Connections{server.Connection()}, WithTracer(tracer))
+
+	if err := client.Set(ctx, "key", "value", 60); err != nil {
+		t.Fatal("Failed to set the key", err)
+	}
+
+	// The server span ends once the response is written
+	deadline := time.Now().Add(time.Second)
+	for {
+		mutex.Lock()
+		n := len(spans)
+		mutex.Unlock()
+
+		if n == 3 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	clientSpan := spans["gcache.client POST /v2/keys"]
+	serverSpan := spans["gcache.server /v2/keys/"]
+	cacheSpan := spans["gcache.cache set"]
+
+	if clientSpan == nil || serverSpan == nil || cacheSpan == nil {
+		t.Fatalf("Expected the client, the server and the cache spans but actual %v", spans)
+	}
+
+	if serverSpan.TraceID != clientSpan.TraceID || serverSpan.ParentID != clientSpan.SpanID || cacheSpan.ParentID != serverSpan.SpanID {
+		t.Error("Expected the spans to be of a single trace")
+	}
+
+	if clientSpan.Attributes["http.status_code"] != http.StatusOK {
+		t.Errorf("Unexpected client span %+v", clientSpan)
+	}
+}
+
+func TestClient_TraceContextPropagation(t *testing.T) {
+
+	var traceparent string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		traceparent = req.Header.Get(trace.HeaderTraceparent)
+	}))
+	defer ts.Close()
+
+	// The trace of the caller is propagated without a tracer
+	parent, _ := trace.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	client := NewClient(Connections{NewConnection(ts.URL, "")})
+
+	if err := client.Set(trace.ContextWithSpanContext(ctx, parent), "key", "value", 60); err != nil {
+		t.Fatal("Failed to set the key", err)
+	}
+
+	if traceparent != parent.Traceparent() {
+		t.Errorf("Expected %s but actual %s", parent.Traceparent(), traceparent)
+	}
+}
@@ -0,0 +1,323 @@
+package client
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+var ErrNotEncoded = errors.New("Value is not encoded by a codec")
+var ErrUnknownCodec = errors.New("Value is encoded by an unknown codec")
+var ErrWrongCodec = errors.New("Value is encoded by another codec")
+var ErrDecompressedTooLarge = errors.New("Decompressed value is over the size limit")
+
+// Compressed values decompressing to more bytes are not decoded, so that a small value can't exhaust memory
+const DefaultMaxDecompressedSize = 64 << 20
+
+// Encoded values start with the marker, the codec id and the flags
+const (
+	codecMarker0 byte = 0x00
+	codecMarker1 byte = 'G'
+	headerLength      = 4
+
+	flagCompressed byte = 1 << 0
+)
+
+// Ids of the built-in codecs. Ids from 128 are left for custom codecs
+const (
+	CodecIDJSON   byte = 1
+	CodecIDGob    byte = 2
+	CodecIDBinary byte = 3
+)
+
+// Codec converts values to bytes stored in the cache and back
+type Codec interface {
+	// Id written into the header of encoded values, so that readers pick the right codec
+	ID() byte
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	// Encode values as json
+	JSONCodec Codec = jsonCodec{}
+	// Encode values with encoding/gob. Types stored in interface values must be registered with gob
+	GobCodec Codec = gobCodec{}
+	// Store []byte, string and encoding.BinaryMarshaler values as they are
+	BinaryCodec Codec = binaryCodec{}
+)
+
+var codecsMutex sync.RWMutex
+var codecs = map[byte]Codec{
+	CodecIDJSON:   JSONCodec,
+	CodecIDGob:    GobCodec,
+	CodecIDBinary: BinaryCodec,
+}
+
+// Register a custom codec so that values encoded by it can be decoded
+func RegisterCodec(codec Codec) error {
+	codecsMutex.Lock()
+	defer codecsMutex.Unlock()
+
+	if _, exists := codecs[codec.ID()]; exists {
+		return fmt.Errorf("Codec id %d is already registered", codec.ID())
+	}
+
+	codecs[codec.ID()] = codec
+	return nil
+}
+
+func codecByID(id byte) (Codec, bool) {
+	codecsMutex.RLock()
+	defer codecsMutex.RUnlock()
+
+	codec, ok := codecs[id]
+	return codec, ok
+}
+
+// Compress values longer than threshold bytes with flate when writing them by codecs.
+// Zero disables compression
+func WithCompression(threshold int) Option {
+	return func(o *options) {
+		o.compressAbove = threshold
+	}
+}
+
+// Limit the size compressed values may decompress to when reading them by codecs, DefaultMaxDecompressedSize by default
+func WithMaxDecompressedSize(limit int) Option {
+	return func(o *options) {
+		o.maxDecompressedSize = limit
+	}
+}
+
+// Encode the value by the codec prefixing it with the header.
+// The value is compressed if it's longer than compressAbove bytes and compression pays off
+func Encode(codec Codec, v interface{}, compressAbove int) ([]byte, error) {
+
+	data, err := codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := byte(0)
+
+	if compressAbove > 0 && len(data) > compressAbove {
+		compressed, err := compress(data)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(compressed) < len(data) {
+			data = compressed
+			flags |= flagCompressed
+		}
+	}
+
+	encoded := make([]byte, headerLength+len(data))
+	encoded[0], encoded[1], encoded[2], encoded[3] = codecMarker0, codecMarker1, codec.ID(), flags
+	copy(encoded[headerLength:], data)
+
+	return encoded, nil
+}
+
+// Decode the value written by Encode into v by the codec named in the header.
+// Values without the header are ErrNotEncoded unless v is *string or *[]byte, which get them as they are.
+// Compressed values may decompress to DefaultMaxDecompressedSize bytes at most
+func Decode(data []byte, v interface{}) error {
+	return DecodeWithLimit(data, v, DefaultMaxDecompressedSize)
+}
+
+// Decode the value like Decode, compressed values may decompress to maxDecompressedSize bytes at most
+func DecodeWithLimit(data []byte, v interface{}, maxDecompressedSize int) error {
+
+	if !IsEncoded(data) {
+		switch out := v.(type) {
+		case *string:
+			*out = string(data)
+			return nil
+		case *[]byte:
+			*out = data
+			return nil
+		}
+
+		return ErrNotEncoded
+	}
+
+	codec, ok := codecByID(data[2])
+	if !ok {
+		return ErrUnknownCodec
+	}
+
+	flags := data[3]
+	data = data[headerLength:]
+
+	if flags&flagCompressed != 0 {
+		reader := io.LimitReader(flate.NewReader(bytes.NewReader(data)), int64(maxDecompressedSize)+1)
+		decompressed, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		if len(decompressed) > maxDecompressedSize {
+			return ErrDecompressedTooLarge
+		}
+		data = decompressed
+	}
+
+	return codec.Unmarshal(data, v)
+}
+
+// Check whether the value starts with the codec header
+func IsEncoded(data []byte) bool {
+	return len(data) >= headerLength && data[0] == codecMarker0 && data[1] == codecMarker1
+}
+
+func compress(data []byte) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+
+	writer, err := flate.NewWriter(buffer, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// Set key to hold the value encoded by the codec
+func SetValue(ctx context.Context, c *Client, codec Codec, key string, v interface{}, ttl int) error {
+
+	data, err := Encode(codec, v, c.compressAbove)
+	if err != nil {
+		return err
+	}
+
+	return c.Set(ctx, key, string(data), ttl)
+}
+
+// Get the value of key decoded into v. The codec is detected by the header of the value
+func GetValue(ctx context.Context, c *Client, key string, v interface{}) error {
+
+	value, err := c.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	return DecodeWithLimit([]byte(value), v, c.maxDecompressedSize)
+}
+
+// Get the value of key decoded into v by the codec. Values written by other codecs are ErrWrongCodec
+func getByCodec(ctx context.Context, c *Client, codec Codec, key string, v interface{}) error {
+
+	value, err := c.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	data := []byte(value)
+	if IsEncoded(data) && data[2] != codec.ID() {
+		return ErrWrongCodec
+	}
+
+	return DecodeWithLimit(data, v, c.maxDecompressedSize)
+}
+
+// Set key to hold the value encoded as json
+func SetJSON(ctx context.Context, c *Client, key string, v interface{}, ttl int) error {
+	return SetValue(ctx, c, JSONCodec, key, v, ttl)
+}
+
+// Get the value of key decoded into v from json. Values written by other codecs are ErrWrongCodec, GetValue detects the codec
+func GetJSON(ctx context.Context, c *Client, key string, v interface{}) error {
+	return getByCodec(ctx, c, JSONCodec, key, v)
+}
+
+// Set key to hold the value encoded by gob
+func SetGob(ctx context.Context, c *Client, key string, v interface{}, ttl int) error {
+	return SetValue(ctx, c, GobCodec, key, v, ttl)
+}
+
+// Get the value of key decoded into v by gob. Values written by other codecs are ErrWrongCodec, GetValue detects the codec
+func GetGob(ctx context.Context, c *Client, key string, v interface{}) error {
+	return getByCodec(ctx, c, GobCodec, key, v)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ID() byte {
+	return CodecIDJSON
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) ID() byte {
+	return CodecIDGob
+}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	if err := gob.NewEncoder(buffer).Encode(v); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+type binaryCodec struct{}
+
+func (binaryCodec) ID() byte {
+	return CodecIDBinary
+}
+
+func (binaryCodec) Marshal(v interface{}) ([]byte, error) {
+	switch value := v.(type) {
+	case []byte:
+		return value, nil
+	case string:
+		return []byte(value), nil
+	case encoding.BinaryMarshaler:
+		return value.MarshalBinary()
+	}
+
+	return nil, fmt.Errorf("Binary codec does not support %T", v)
+}
+
+func (binaryCodec) Unmarshal(data []byte, v interface{}) error {
+	switch out := v.(type) {
+	case *[]byte:
+		*out = append([]byte{}, data...)
+		return nil
+	case *string:
+		*out = string(data)
+		return nil
+	case encoding.BinaryUnmarshaler:
+		return out.UnmarshalBinary(data)
+	}
+
+	return fmt.Errorf("Binary codec does not support %T", v)
+}
@@ -0,0 +1,181 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"gcache"
+	"gcache/server/handlers"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type codecUser struct {
+	Name  string
+	Email string
+	Tags  []string
+}
+
+type point struct {
+	X, Y byte
+}
+
+func (p point) MarshalBinary() ([]byte, error) {
+	return []byte{p.X, p.Y}, nil
+}
+
+func (p *point) UnmarshalBinary(data []byte) error {
+	p.X, p.Y = data[0], data[1]
+	return nil
+}
+
+func TestCodec_EncodeDecode(t *testing.T) {
+
+	user := codecUser{Name: "name", Email: "name@example.com", Tags: []string{"a", "b"}}
+
+	for _, codec := range []Codec{JSONCodec, GobCodec} {
+		data, err := Encode(codec, user, 0)
+		if err != nil {
+			t.Fatal("Failed to encode", err)
+		}
+
+		if !IsEncoded(data) || data[2] != codec.ID() {
+			t.Errorf("Expected the header of codec %d but actual %q", codec.ID(), data[:headerLength])
+		}
+
+		decoded := codecUser{}
+		if err := Decode(data, &decoded); err != nil {
+			t.Fatal("Failed to decode", err)
+		}
+
+		if decoded.Name != user.Name || decoded.Email != user.Email || len(decoded.Tags) != 2 {
+			t.Errorf("Expected %+v but actual %+v", user, decoded)
+		}
+	}
+
+	data, err := Encode(BinaryCodec, point{1, 2}, 0)
+	if err != nil {
+		t.Fatal("Failed to encode", err)
+	}
+
+	p := point{}
+	if err := Decode(data, &p); err != nil || p.X != 1 || p.Y != 2 {
+		t.Errorf("Expected {1 2} but actual %+v, err = %v", p, err)
+	}
+}
+
+func TestCodec_Compression(t *testing.T) {
+
+	value := strings.Repeat("value", 1000)
+
+	data, err := Encode(JSONCodec, value, 100)
+	if err != nil {
+		t.Fatal("Failed to encode", err)
+	}
+
+	if data[3]&flagCompressed == 0 || len(data) >= len(value) {
+		t.Errorf("Expected the value to be compressed, length %d", len(data))
+	}
+
+	decoded := ""
+	if err := Decode(data, &decoded); err != nil || decoded != value {
+		t.Errorf("Failed to decode the compressed value, err = %v", err)
+	}
+
+	// Short values are not compressed
+	data, _ = Encode(JSONCodec, "short", 100)
+	if data[3]&flagCompressed != 0 {
+		t.Error("Expected a short value not to be compressed")
+	}
+
+	// Values decompressing over the limit are not decoded
+	data, _ = Encode(BinaryCodec, strings.Repeat("a", 10000), 100)
+
+	var raw []byte
+	if err := DecodeWithLimit(data, &raw, 9999); err != ErrDecompressedTooLarge {
+		t.Error("Expected the value to be over the limit but actual", err)
+	}
+
+	if err := DecodeWithLimit(data, &raw, 10000); err != nil || len(raw) != 10000 {
+		t.Errorf("Failed to decode the value at the limit, length %d, err = %v", len(raw), err)
+	}
+}
+
+func TestCodec_NotEncoded(t *testing.T) {
+
+	raw := []byte("plain")
+
+	s := ""
+	if err := Decode(raw, &s); err != nil || s != "plain" {
+		t.Errorf("Expected a plain value to be read into a string, actual %q, err = %v", s, err)
+	}
+
+	user := codecUser{}
+	if err := Decode(raw, &user); err != ErrNotEncoded {
+		t.Error("Expected not encoded but actual", err)
+	}
+
+	unknown := []byte{codecMarker0, codecMarker1, 200, 0}
+	if err := Decode(unknown, &user); err != ErrUnknownCodec {
+		t.Error("Expected unknown codec but actual", err)
+	}
+
+	if err := RegisterCodec(JSONCodec); err == nil {
+		t.Error("Expected an error registering a codec id twice")
+	}
+}
+
+func TestClient_SetGetJSON(t *testing.T) {
+
+	handler := new(handlers.KeysV2Handler).Init(gcache.NewCache())
+
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	client := NewClient(Connections{NewConnection(ts.URL, "")}, WithCompression(64))
+
+	user := codecUser{Name: "name", Email: "name@example.com", Tags: []string{strings.Repeat("tag", 100)}}
+
+	if err := SetJSON(ctx, client, "user", user, 10); err != nil {
+		t.Fatal("Failed to set json", err)
+	}
+
+	if err := SetGob(ctx, client, "user:gob", user, 10); err != nil {
+		t.Fatal("Failed to set gob", err)
+	}
+
+	// GetValue detects the codec, GetJSON and GetGob read their own codec only
+	for _, key := range []string{"user", "user:gob"} {
+		get := GetJSON
+		if key == "user:gob" {
+			get = GetGob
+		}
+
+		for _, get := range []func(context.Context, *Client, string, interface{}) error{GetValue, get} {
+			decoded := codecUser{}
+			if err := get(ctx, client, key, &decoded); err != nil {
+				t.Fatal("Failed to get", key, err)
+			}
+
+			if decoded.Name != user.Name || len(decoded.Tags) != 1 || decoded.Tags[0] != user.Tags[0] {
+				t.Errorf("Expected %+v but actual %+v", user, decoded)
+			}
+		}
+	}
+
+	if err := GetJSON(ctx, client, "user:gob", &codecUser{}); err != ErrWrongCodec {
+		t.Error("Expected a gob value to be the wrong codec for json but actual", err)
+	}
+	if err := GetGob(ctx, client, "user", &codecUser{}); err != ErrWrongCodec {
+		t.Error("Expected a json value to be the wrong codec for gob but actual", err)
+	}
+
+	raw, _ := client.Get(ctx, "user")
+	if !bytes.HasPrefix([]byte(raw), []byte{codecMarker0, codecMarker1, CodecIDJSON, flagCompressed}) {
+		t.Errorf("Expected a compressed json value but actual header %q", raw[:headerLength])
+	}
+
+	if err := GetJSON(ctx, client, "missing", &user); err != ErrKeyNotFound {
+		t.Error("Expected key not found but actual", err)
+	}
+}
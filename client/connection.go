@@ -1,15 +1,100 @@
 package client
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"gcache/protocol"
+	"gcache/trace"
 	"hash/crc32"
 	"io"
 	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync/atomic"
 )
 
 // Represent a connection to the cache server
-type Connection struct{
+type Connection struct {
 	addr string
-	psw string
+	psw  string
+	db   string
+	tls  *tls.Config
+	pool *pool
+}
+
+// Create a connection to the cache server at addr, e.g. http://localhost:8080.
+// psw is sent as the Authorization header if it is not empty
+func NewConnection(addr string, psw string) Connection {
+	return Connection{
+		addr: addr,
+		psw:  psw,
+	}
+}
+
+// Return the connection selecting the database of the server, the default database is used otherwise
+func (conn Connection) WithDatabase(name string) Connection {
+	conn.db = name
+	return conn
+}
+
+// Set the headers of the credentials and the database
+func (conn Connection) setHeaders(req *http.Request) {
+	if conn.psw != "" {
+		req.Header.Set(headerAuthorization, conn.psw)
+	}
+
+	if conn.db != "" {
+		req.Header.Set(protocol.HeaderDatabase, conn.db)
+	}
+}
+
+// Create a connection to the cache server at addr authenticated as the user of the server ACL
+func NewUserConnection(addr string, user string, password string) Connection {
+	credentials := base64.StdEncoding.EncodeToString([]byte(user + ":" + password))
+	return NewConnection(addr, "Basic "+credentials)
+}
+
+// Connection pool statistics of a shard
+type PoolStats struct {
+	Addr        string
+	Requests    uint64 // requests sent
+	Errors      uint64 // requests failed before a response was received
+	InFlight    int64  // requests waiting for a response
+	NewConns    uint64 // connections dialed
+	ReusedConns uint64 // requests sent over a kept alive connection
+	Rejected    uint64 // requests failed fast by the circuit breaker
+	Breaker     BreakerState
+}
+
+// Http client of a shard with its statistics and circuit breaker
+type pool struct {
+	httpClient *http.Client
+	breaker    *breaker
+	tracer     trace.Tracer
+	stats      PoolStats
+}
+
+func newPool(conn Connection, o *options) *pool {
+	return &pool{
+		httpClient: o.httpClient(conn.tls),
+		breaker:    newBreaker(conn.addr, o.breaker),
+		tracer:     o.tracer,
+		stats:      PoolStats{Addr: conn.addr},
+	}
+}
+
+func (p *pool) snapshot() PoolStats {
+	return PoolStats{
+		Addr:        p.stats.Addr,
+		Requests:    atomic.LoadUint64(&p.stats.Requests),
+		Errors:      atomic.LoadUint64(&p.stats.Errors),
+		InFlight:    atomic.LoadInt64(&p.stats.InFlight),
+		NewConns:    atomic.LoadUint64(&p.stats.NewConns),
+		ReusedConns: atomic.LoadUint64(&p.stats.ReusedConns),
+		Rejected:    atomic.LoadUint64(&p.stats.Rejected),
+		Breaker:     p.breaker.currentState(),
+	}
 }
 
 // Set of connections
@@ -17,24 +102,106 @@ type Connections []Connection
 
 // Get connection to the shard by the given key
 func (c Connections) getShard(key string) Connection {
+	return c[c.shardIndex(key)]
+}
+
+// Get index of the shard by the given key
+func (c Connections) shardIndex(key string) int {
 	hash := crc32.ChecksumIEEE([]byte(key))
-	n := hash % uint32(len(c))
-	return c[n]
+	return int(hash % uint32(len(c)))
+}
+
+func (conn Connection) doRequest(ctx context.Context, method, urlStr string, body io.Reader) (*http.Response, error) {
+	return conn.doContentRequest(ctx, method, urlStr, protocol.ContentTypeBinary, body)
+}
+
+func (conn Connection) doJSONRequest(ctx context.Context, method, urlStr string, body io.Reader) (*http.Response, error) {
+	return conn.doContentRequest(ctx, method, urlStr, protocol.ContentTypeJSON, body)
+}
+
+func (conn Connection) doContentRequest(ctx context.Context, method, urlStr string, contentType string, body io.Reader) (*http.Response, error) {
+	return conn.send(ctx, method, urlStr, contentType, acceptedTypes, body)
+}
+
+// Request a structured response, e.g. to get the ttl along with the value
+func (conn Connection) doStructuredRequest(ctx context.Context, method, urlStr string) (*http.Response, error) {
+	return conn.send(ctx, method, urlStr, "", protocol.ContentTypeJSON, nil)
 }
 
-func (conn Connection) doRequest(method, urlStr string, body io.Reader) (*http.Response, error) {
+func (conn Connection) send(ctx context.Context, method, urlStr string, contentType string, accept string, body io.Reader) (*http.Response, error) {
+
+	p := conn.pool
+
+	ctx, span := p.tracer.Start(ctx, "gcache.client "+method+" "+spanRoute(urlStr))
+	defer span.End()
+
+	span.SetAttribute("server.address", conn.addr)
+
+	clientTrace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddUint64(&p.stats.ReusedConns, 1)
+			} else {
+				atomic.AddUint64(&p.stats.NewConns, 1)
+			}
+		},
+	}
 
-	req, err := http.NewRequest(method, conn.addr + urlStr, body)
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, clientTrace), method, conn.addr+urlStr, body)
 	if err != nil {
 		return nil, err
 	}
 
-	// Set the authorization header if password is set
-	if conn.psw != "" {
-		req.Header.Set(headerAuthorization, conn.psw)
+	req.Header.Set("Accept", accept)
+
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
 	}
 
-	return http.DefaultClient.Do(req)
+	conn.setHeaders(req)
+	trace.Inject(ctx, req.Header)
+
+	// Fail fast if the shard is known to be down
+	if !p.breaker.allow() {
+		atomic.AddUint64(&p.stats.Rejected, 1)
+		span.SetError(ErrCircuitOpen)
+		return nil, ErrCircuitOpen
+	}
+
+	atomic.AddUint64(&p.stats.Requests, 1)
+	atomic.AddInt64(&p.stats.InFlight, 1)
+	resp, err := p.httpClient.Do(req)
+	atomic.AddInt64(&p.stats.InFlight, -1)
+
+	if err != nil {
+		atomic.AddUint64(&p.stats.Errors, 1)
+		span.SetError(err)
+	} else {
+		span.SetAttribute("http.status_code", resp.StatusCode)
+	}
+
+	// A request cancelled by the caller tells nothing about the shard
+	if ctx.Err() != nil {
+		p.breaker.release()
+	} else {
+		p.breaker.record(!isShardFailure(resp, err))
+	}
+
+	return resp, err
+}
+
+// Route of the request without the query and the keys, e.g. /v2/keys, so that span names stay few
+func spanRoute(urlStr string) string {
+	if i := strings.IndexByte(urlStr, '?'); i >= 0 {
+		urlStr = urlStr[:i]
+	}
+
+	segments := strings.SplitN(urlStr, "/", 4)
+	if len(segments) > 3 {
+		segments = segments[:3]
+	}
+
+	return strings.Join(segments, "/")
 }
 
 type httpResponse struct {
@@ -43,30 +210,21 @@ type httpResponse struct {
 	err      error
 }
 
-func (conns Connections) doParallelGetRequest(query string) []*httpResponse {
+func (conns Connections) doParallelGetRequest(ctx context.Context, query string) []*httpResponse {
 	ch := make(chan *httpResponse)
 	responses := []*httpResponse{}
 
 	for _, conn := range conns {
 		go func(url string, conn Connection) {
-			resp, err := conn.doRequest(http.MethodGet, url, nil)
+			resp, err := conn.doRequest(ctx, http.MethodGet, url, nil)
 			ch <- &httpResponse{url, resp, err}
-			if err != nil && resp != nil && resp.StatusCode == http.StatusOK {
-				resp.Body.Close()
-			}
 		}(query, conn)
 	}
 
 	// Wait to get all the responses
-	for {
-		select {
-		case r := <-ch:
-			responses = append(responses, r)
-			if len(responses) == len(conns) {
-				return responses
-			}
-		}
+	for len(responses) < len(conns) {
+		responses = append(responses, <-ch)
 	}
+
 	return responses
 }
-
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"gcache/protocol"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Serialize the value of the key with its ttl, so that it can be restored on any server
+func (client *Client) Dump(ctx context.Context, key string) ([]byte, error) {
+
+	if key == "" {
+		return nil, ErrEmptyKey
+	}
+
+	conn := client.conns.getShard(key)
+	resp, err := client.doIdempotentRequest(ctx, conn, http.MethodGet, dumpPath(key), nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if err := statusError(resp); err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// Restore the key from its dump. The ttl in seconds overrides the ttl of the dump unless it's 0.
+// ErrKeyExists is returned if the key exists and isn't to be replaced
+func (client *Client) Restore(ctx context.Context, key string, dump []byte, ttl int, replace bool) error {
+
+	if key == "" {
+		return ErrEmptyKey
+	}
+
+	url := fmt.Sprintf("%s/%s?ttl=%d&replace=%t", protocol.RestorePath, protocol.EscapeSegment(key), ttl, replace)
+
+	defer client.invalidate(key)
+
+	conn := client.conns.getShard(key)
+
+	// Replacing is idempotent, a retried restore of a new key would fail as it exists
+	var resp *http.Response
+	var err error
+	if replace {
+		resp, err = client.doIdempotentRequest(ctx, conn, http.MethodPost, url, dump)
+	} else {
+		resp, err = conn.doRequest(ctx, http.MethodPost, url, bytes.NewReader(dump))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	return statusError(resp)
+}
+
+// Scan the keys of the shards one after the other, count keys at most at a time.
+// A scan starts with an empty cursor and is over once the returned cursor is empty.
+// Keys which exist during the whole scan are returned once
+func (client *Client) Scan(ctx context.Context, cursor string, count int) ([]string, string, error) {
+
+	shard, shardCursor := 0, ""
+
+	if cursor != "" {
+		i := strings.IndexByte(cursor, ':')
+		if i < 0 {
+			return nil, "", ErrBadCursor
+		}
+
+		var err error
+		if shard, err = strconv.Atoi(cursor[:i]); err != nil || shard < 0 || shard >= len(client.conns) {
+			return nil, "", ErrBadCursor
+		}
+		shardCursor = cursor[i+1:]
+	}
+
+	query := url.Values{"cursor": {shardCursor}, "count": {strconv.Itoa(count)}}
+	resp, err := client.doIdempotentRequest(ctx, client.conns[shard], http.MethodGet, protocol.ScanPath+"?"+query.Encode(), nil)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer resp.Body.Close()
+
+	if err := statusError(resp); err != nil {
+		return nil, "", err
+	}
+
+	response := protocol.ScanResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, "", err
+	}
+
+	// Go on with the next shard once the shard is scanned
+	switch {
+	case response.Cursor != "":
+		cursor = strconv.Itoa(shard) + ":" + response.Cursor
+	case shard+1 < len(client.conns):
+		cursor = strconv.Itoa(shard+1) + ":"
+	default:
+		cursor = ""
+	}
+
+	return response.Keys, cursor, nil
+}
+
+func dumpPath(key string) string {
+	return protocol.DumpPath + "/" + protocol.EscapeSegment(key)
+}
@@ -0,0 +1,98 @@
+package client_test
+
+import (
+	. "gcache/client"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestClient_DumpRestore(t *testing.T) {
+
+	source := NewClient(Connections{connection(t)})
+	target := NewClient(Connections{connection(t), connectionAuth(t)})
+
+	if err := source.Set(ctx, "key", "value\x00", 60); err != nil {
+		t.Fatal("Failed to set", err)
+	}
+
+	dump, err := source.Dump(ctx, "key")
+	if err != nil {
+		t.Fatal("Failed to dump", err)
+	}
+
+	if err := target.Restore(ctx, "key", dump, 0, false); err != nil {
+		t.Fatal("Failed to restore", err)
+	}
+
+	if value, err := target.Get(ctx, "key"); err != nil || value != "value\x00" {
+		t.Errorf("Expected %q but actual %q, err = %v", "value\x00", value, err)
+	}
+
+	if ttl, _ := target.Ttl(ctx, "key"); ttl != 60 {
+		t.Error("Expected the ttl of the dump but actual", ttl)
+	}
+
+	if err := target.Restore(ctx, "key", dump, 0, false); err != ErrKeyExists {
+		t.Error("Expected the key to exist but actual", err)
+	}
+
+	if err := target.Restore(ctx, "key", dump, 120, true); err != nil {
+		t.Fatal("Failed to replace", err)
+	}
+
+	if ttl, _ := target.Ttl(ctx, "key"); ttl != 120 {
+		t.Error("Expected the given ttl but actual", ttl)
+	}
+
+	if _, err := source.Dump(ctx, "missing"); err != ErrKeyNotFound {
+		t.Error("Expected key not found but actual", err)
+	}
+}
+
+func TestClient_Scan_Sharded(t *testing.T) {
+
+	const n = 25
+
+	client := NewClient(Connections{connection(t), connectionAuth(t)})
+
+	expected := []string{}
+	for i := 0; i < n; i++ {
+		key := "scan" + strconv.Itoa(i)
+		if err := client.Set(ctx, key, "value", 60); err != nil {
+			t.Fatal("Failed to set", err)
+		}
+		expected = append(expected, key)
+	}
+
+	scanned := []string{}
+	cursor := ""
+	for {
+		keys, next, err := client.Scan(ctx, cursor, 4)
+		if err != nil {
+			t.Fatal("Failed to scan", err)
+		}
+
+		scanned = append(scanned, keys...)
+		if cursor = next; cursor == "" {
+			break
+		}
+	}
+
+	sort.Strings(expected)
+	sort.Strings(scanned)
+
+	if len(scanned) != n {
+		t.Fatalf("Expected %d keys but actual %d", n, len(scanned))
+	}
+
+	for i := range expected {
+		if scanned[i] != expected[i] {
+			t.Errorf("Expected %s but actual %s", expected[i], scanned[i])
+		}
+	}
+
+	if _, _, err := client.Scan(ctx, "bad", 4); err != ErrBadCursor {
+		t.Error("Expected a bad cursor but actual", err)
+	}
+}
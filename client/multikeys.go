@@ -0,0 +1,227 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"gcache/protocol"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Result of a key in a multi key read
+type KeyResult struct {
+	Key   string
+	Value string
+	// ErrKeyNotFound if the key does not exist, or the error of the key's shard
+	Err error
+}
+
+// Errors of the keys whose shards failed in a multi key operation
+type KeyErrors map[string]error
+
+func (e KeyErrors) Error() string {
+	keys := make([]string, 0, len(e))
+	for key := range e {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	messages := make([]string, len(keys))
+	for i, key := range keys {
+		messages[i] = fmt.Sprintf("%s: %s", key, e[key])
+	}
+
+	return fmt.Sprintf("%d keys failed: %s", len(keys), strings.Join(messages, "; "))
+}
+
+// Get values of the keys from all the shards concurrently.
+// Results are in the order of the keys. If some shards fail KeyErrors is returned
+// along with the results, and the results of the other shards are still valid
+func (client *Client) MGet(ctx context.Context, keys ...string) ([]KeyResult, error) {
+
+	results := make([]KeyResult, len(keys))
+	positions := make(map[string][]int)
+
+	for i, key := range keys {
+		results[i].Key = key
+		positions[key] = append(positions[key], i)
+	}
+
+	errs := client.fanOut(keys, func(conn Connection, shardKeys []string) error {
+
+		response := protocol.MGetResponse{}
+		if err := client.doJSONRequest(ctx, conn, protocol.MGetPath, protocol.KeysRequest{Keys: shardKeys}, &response); err != nil {
+			return err
+		}
+
+		if len(response.Values) != len(shardKeys) {
+			return unexpectedResultsError(len(shardKeys), len(response.Values))
+		}
+
+		// Every shard writes only the positions of its own keys
+		for i, key := range shardKeys {
+			for _, position := range positions[key] {
+				if response.Values[i] == nil {
+					results[position].Err = ErrKeyNotFound
+				} else {
+					results[position].Value = string(response.Values[i])
+				}
+			}
+		}
+
+		return nil
+	})
+
+	for key, err := range errs {
+		for _, position := range positions[key] {
+			results[position].Err = err
+		}
+	}
+
+	return results, errs.orNil()
+}
+
+// Set the keys on all the shards concurrently. Keys of a single shard are set atomically
+func (client *Client) MSet(ctx context.Context, items map[string]string, ttl int) error {
+	_, err := client.mSet(ctx, items, ttl, false)
+	return err
+}
+
+// Set the keys only if none of them exists. The check is atomic per shard only,
+// so the keys of the shards which succeeded stay set if another shard refuses them
+func (client *Client) MSetNX(ctx context.Context, items map[string]string, ttl int) (bool, error) {
+	return client.mSet(ctx, items, ttl, true)
+}
+
+func (client *Client) mSet(ctx context.Context, items map[string]string, ttl int, nx bool) (bool, error) {
+
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+
+	defer client.invalidate(keys...)
+
+	mutex := sync.Mutex{}
+	set := true
+
+	errs := client.fanOut(keys, func(conn Connection, shardKeys []string) error {
+
+		request := protocol.MSetRequest{Items: make(map[string][]byte, len(shardKeys)), Ttl: ttl, NX: nx}
+		for _, key := range shardKeys {
+			request.Items[key] = []byte(items[key])
+		}
+
+		response := protocol.OkResponse{}
+		if err := client.doJSONRequest(ctx, conn, protocol.MSetPath, request, &response); err != nil {
+			return err
+		}
+
+		mutex.Lock()
+		set = set && response.Ok
+		mutex.Unlock()
+
+		return nil
+	})
+
+	return set && len(errs) == 0, errs.orNil()
+}
+
+// Delete the keys from all the shards concurrently. Return the number of deleted keys
+func (client *Client) MDel(ctx context.Context, keys ...string) (int, error) {
+
+	defer client.invalidate(keys...)
+
+	mutex := sync.Mutex{}
+	deleted := 0
+
+	errs := client.fanOut(keys, func(conn Connection, shardKeys []string) error {
+
+		response := protocol.MDelResponse{}
+		if err := client.doJSONRequest(ctx, conn, protocol.MDelPath, protocol.KeysRequest{Keys: shardKeys}, &response); err != nil {
+			return err
+		}
+
+		mutex.Lock()
+		deleted += response.Deleted
+		mutex.Unlock()
+
+		return nil
+	})
+
+	return deleted, errs.orNil()
+}
+
+// Split distinct keys by shard and run do for every shard concurrently.
+// Return errors of the keys whose shards failed
+func (client *Client) fanOut(keys []string, do func(conn Connection, shardKeys []string) error) KeyErrors {
+
+	groups := make(map[int][]string)
+	seen := make(map[string]bool)
+
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		shard := client.conns.shardIndex(key)
+		groups[shard] = append(groups[shard], key)
+	}
+
+	errs := KeyErrors{}
+	mutex := sync.Mutex{}
+	wg := sync.WaitGroup{}
+
+	for shard, shardKeys := range groups {
+		wg.Add(1)
+		go func(conn Connection, shardKeys []string) {
+			defer wg.Done()
+
+			if err := do(conn, shardKeys); err != nil {
+				mutex.Lock()
+				for _, key := range shardKeys {
+					errs[key] = err
+				}
+				mutex.Unlock()
+			}
+		}(client.conns[shard], shardKeys)
+	}
+
+	wg.Wait()
+
+	return errs
+}
+
+func (e KeyErrors) orNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Post the request as json and decode the json response
+func (client *Client) doJSONRequest(ctx context.Context, conn Connection, path string, request interface{}, response interface{}) error {
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	resp, err := conn.doJSONRequest(ctx, http.MethodPost, path, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if err := statusError(resp); err != nil {
+		return err
+	}
+
+	return json.NewDecoder(resp.Body).Decode(response)
+}
@@ -0,0 +1,119 @@
+package client_test
+
+import (
+	. "gcache/client"
+	"gcache/gcachetest"
+	"strconv"
+	"testing"
+)
+
+func TestClient_MSetMGetMDel_Sharded(t *testing.T) {
+
+	const n = 20
+
+	// Two shards
+	client := NewClient(Connections{
+		connection(t),
+		connectionAuth(t),
+	})
+
+	items := map[string]string{}
+	keys := []string{}
+
+	for i := 0; i < n; i++ {
+		key := "multi" + strconv.Itoa(i)
+		items[key] = "value\x00" + strconv.Itoa(i)
+		keys = append(keys, key)
+	}
+
+	if err := client.MSet(ctx, items, 5); err != nil {
+		t.Fatal("Failed to mset", err)
+	}
+
+	results, err := client.MGet(ctx, append(keys, "multimissing", keys[0])...)
+
+	if err != nil {
+		t.Fatal("Failed to mget", err)
+	}
+
+	if len(results) != n+2 {
+		t.Fatalf("Expected %d results but actual %d", n+2, len(results))
+	}
+
+	for i, key := range keys {
+		if results[i].Key != key || results[i].Value != items[key] || results[i].Err != nil {
+			t.Errorf("Expected %s=%q but actual %+v", key, items[key], results[i])
+		}
+	}
+
+	if results[n].Err != ErrKeyNotFound {
+		t.Error("Expected key not found but actual", results[n].Err)
+	}
+
+	if results[n+1].Value != items[keys[0]] {
+		t.Errorf("Expected the duplicated key to have %q but actual %+v", items[keys[0]], results[n+1])
+	}
+
+	deleted, err := client.MDel(ctx, append(keys, "multimissing")...)
+
+	if err != nil || deleted != n {
+		t.Errorf("Expected %d deleted keys but actual %d, err = %v", n, deleted, err)
+	}
+}
+
+func TestClient_MSetNX(t *testing.T) {
+
+	client := NewClient(Connections{
+		connection(t),
+	})
+
+	set, err := client.MSetNX(ctx, map[string]string{"nx1": "value", "nx2": "value"}, 5)
+
+	if err != nil || !set {
+		t.Fatalf("Failed to set new keys, err = %v", err)
+	}
+
+	set, err = client.MSetNX(ctx, map[string]string{"nx2": "updated", "nx3": "value"}, 5)
+
+	if err != nil || set {
+		t.Errorf("Keys are set though nx2 exists, err = %v", err)
+	}
+
+	// Tear down
+	client.MDel(ctx, "nx1", "nx2", "nx3")
+}
+
+func TestClient_MGet_ShardFailure(t *testing.T) {
+
+	// The second shard is down
+	down := gcachetest.NewServer(t)
+	down.Close()
+
+	client := NewClient(Connections{
+		connection(t),
+		down.Connection(),
+	})
+
+	keys := []string{}
+	for i := 0; i < 10; i++ {
+		keys = append(keys, "failure"+strconv.Itoa(i))
+	}
+
+	results, err := client.MGet(ctx, keys...)
+
+	keyErrors, ok := err.(KeyErrors)
+
+	if !ok || len(keyErrors) == 0 || len(keyErrors) == len(keys) {
+		t.Fatalf("Expected errors of the keys of the failed shard but actual %v", err)
+	}
+
+	for _, result := range results {
+		if _, failed := keyErrors[result.Key]; failed && result.Err != keyErrors[result.Key] {
+			t.Errorf("Expected the shard error of %s but actual %v", result.Key, result.Err)
+		}
+
+		if _, failed := keyErrors[result.Key]; !failed && result.Err != ErrKeyNotFound {
+			t.Errorf("Expected key not found of %s but actual %v", result.Key, result.Err)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"gcache"
+	"gcache/protocol"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultNearCacheSize int           = 10000
+	DefaultNearCacheTtl  time.Duration = 1 * time.Second
+
+	// Delay before subscribing again after the invalidation stream of a shard is lost
+	nearCacheResubscribeDelay time.Duration = 1 * time.Second
+)
+
+// Cache values read by Get in process. At most size keys are kept for ttl each.
+// Every shard streams the keys changed on it, and a changed key is dropped from the near cache
+// right away. Values of a shard are cached only while its stream is connected, and all of them
+// are dropped once it is lost, so a value is stale for no longer than the network delay.
+// The ttl bounds staleness of keys expired on the server, which are not streamed
+func WithNearCache(size int, ttl time.Duration) Option {
+	return func(o *options) {
+		o.nearCacheSize = size
+		o.nearCacheTtl = ttl
+	}
+}
+
+// In process cache of the values read by Get
+type nearCache struct {
+	cache *gcache.Cache
+	ttl   time.Duration
+
+	mutex sync.Mutex
+	// Incremented on every invalidation, so that a value read concurrently with a change is not cached
+	epoch uint64
+	// Whether the invalidation stream of the shard is connected
+	subscribed []bool
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newNearCache(size int, ttl time.Duration, conns Connections) *nearCache {
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	n := &nearCache{
+		cache:      gcache.NewCacheWithLimit(size),
+		ttl:        ttl,
+		subscribed: make([]bool, len(conns)),
+		cancel:     cancel,
+	}
+
+	for shard, conn := range conns {
+		n.wg.Add(1)
+		go n.follow(ctx, shard, conn)
+	}
+
+	return n
+}
+
+// Get the cached value of the key
+func (n *nearCache) get(shard int, key string) (string, bool) {
+	n.mutex.Lock()
+	subscribed := n.subscribed[shard]
+	n.mutex.Unlock()
+
+	if !subscribed {
+		return "", false
+	}
+
+	value, err := n.cache.Get(key)
+	if err != nil {
+		return "", false
+	}
+
+	return value.(string), true
+}
+
+// Get the epoch to pass to set the value read afterwards
+func (n *nearCache) currentEpoch() uint64 {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return n.epoch
+}
+
+// Cache the value read from the shard unless anything has been invalidated since the epoch
+func (n *nearCache) set(shard int, key string, value string, epoch uint64) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.subscribed[shard] && n.epoch == epoch {
+		n.cache.Set(key, value, n.ttl)
+	}
+}
+
+// Drop the cached values of the keys
+func (n *nearCache) invalidate(keys ...string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.epoch++
+	n.cache.MDel(keys...)
+}
+
+// Drop all the cached values
+func (n *nearCache) flush() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.epoch++
+	n.cache.Flush()
+}
+
+// Mark the shard as subscribed or not. All values are dropped when a shard's stream is lost,
+// as the changes made meanwhile are unknown
+func (n *nearCache) setSubscribed(shard int, subscribed bool) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.subscribed[shard] = subscribed
+
+	if !subscribed {
+		n.epoch++
+		n.cache.MDel(n.cache.Keys()...)
+	}
+}
+
+// Keep the shard's invalidation stream connected until the context is cancelled
+func (n *nearCache) follow(ctx context.Context, shard int, conn Connection) {
+	defer n.wg.Done()
+
+	for {
+		n.subscribe(ctx, shard, conn)
+		n.setSubscribed(shard, false)
+
+		select {
+		case <-time.After(nearCacheResubscribeDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Read the shard's invalidation stream until it is lost
+func (n *nearCache) subscribe(ctx context.Context, shard int, conn Connection) {
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, conn.addr+protocol.InvalidationsPath, nil)
+	if err != nil {
+		return
+	}
+
+	req.Header.Set("Accept", protocol.ContentTypeValues)
+
+	conn.setHeaders(req)
+
+	// The stream is long lived, so the total request timeout does not apply
+	streamClient := &http.Client{Transport: conn.pool.httpClient.Transport}
+
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		return
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return
+	}
+
+	n.setSubscribed(shard, true)
+
+	reader := bufio.NewReader(resp.Body)
+	for {
+		key, err := protocol.ReadValue(reader)
+		if err != nil {
+			return
+		}
+
+		if key == protocol.InvalidateAll {
+			n.flush()
+			continue
+		}
+		n.invalidate(key)
+	}
+}
+
+// Stop following the invalidation streams
+func (n *nearCache) close() {
+	n.cancel()
+	n.wg.Wait()
+	n.cache.StopEviction()
+}
@@ -0,0 +1,219 @@
+package client
+
+import (
+	"gcache"
+	"gcache/protocol"
+	"gcache/server/handlers"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Start a server of keys and invalidations counting the key reads
+func nearCacheServer(cache *gcache.Cache, reads *int64) *httptest.Server {
+
+	keysHandler := new(handlers.KeysV2Handler).Init(cache)
+	invalidationsHandler := new(handlers.InvalidationsHandler).Init(cache)
+
+	mux := http.NewServeMux()
+	mux.Handle(protocol.KeysPath+"/", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet {
+			atomic.AddInt64(reads, 1)
+		}
+		keysHandler.ServeHTTP(w, req)
+	}))
+	mux.Handle(protocol.InvalidationsPath, invalidationsHandler)
+
+	return httptest.NewServer(mux)
+}
+
+// Wait until the near cache of the client follows all the shards
+func waitSubscribed(t *testing.T, client *Client) {
+	deadline := time.Now().Add(5 * time.Second)
+
+	for time.Now().Before(deadline) {
+		client.near.mutex.Lock()
+		subscribed := true
+		for _, s := range client.near.subscribed {
+			subscribed = subscribed && s
+		}
+		client.near.mutex.Unlock()
+
+		if subscribed {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("The near cache has not subscribed to the invalidations")
+}
+
+func TestClient_NearCache(t *testing.T) {
+
+	cache := gcache.NewCache()
+	reads := int64(0)
+
+	ts := nearCacheServer(cache, &reads)
+	defer ts.Close()
+
+	// Set before subscribing, so that no invalidation races the first read
+	cache.Set("key", "value", time.Minute)
+
+	client := NewClient(Connections{NewConnection(ts.URL, "")}, WithNearCache(100, time.Minute))
+	defer client.Close()
+
+	waitSubscribed(t, client)
+
+	for i := 0; i < 5; i++ {
+		value, err := client.Get(ctx, "key")
+
+		if err != nil || value != "value" {
+			t.Fatalf("Expected %q but actual %q, err = %v", "value", value, err)
+		}
+	}
+
+	if n := atomic.LoadInt64(&reads); n != 1 {
+		t.Errorf("Expected the key to be read from the server once but actual %d", n)
+	}
+
+	// A change on the server is streamed to the client
+	cache.Set("key", "changed", time.Minute)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		value, err := client.Get(ctx, "key")
+
+		if err == nil && value == "changed" {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("The near cache has not been invalidated, value %q, err = %v", value, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClient_NearCacheFlush(t *testing.T) {
+
+	cache := gcache.NewCache()
+	reads := int64(0)
+
+	ts := nearCacheServer(cache, &reads)
+	defer ts.Close()
+
+	cache.Set("key", "value", time.Minute)
+
+	client := NewClient(Connections{NewConnection(ts.URL, "")}, WithNearCache(100, time.Minute))
+	defer client.Close()
+
+	waitSubscribed(t, client)
+
+	if value, err := client.Get(ctx, "key"); err != nil || value != "value" {
+		t.Fatalf("Expected %q but actual %q, err = %v", "value", value, err)
+	}
+
+	// Flushing the server invalidates every key of the near cache
+	cache.Flush()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err := client.Get(ctx, "key")
+
+		if err == ErrKeyNotFound {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("The near cache has not been flushed, err =", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClient_NearCacheOwnWrites(t *testing.T) {
+
+	cache := gcache.NewCache()
+	reads := int64(0)
+
+	ts := nearCacheServer(cache, &reads)
+	defer ts.Close()
+
+	client := NewClient(Connections{NewConnection(ts.URL, "")}, WithNearCache(100, time.Minute))
+	defer client.Close()
+
+	waitSubscribed(t, client)
+
+	if err := client.Set(ctx, "key", "value", 60); err != nil {
+		t.Fatal("Failed to set the key", err)
+	}
+
+	client.Get(ctx, "key")
+
+	// Own writes are visible right away
+	if err := client.Set(ctx, "key", "changed", 60); err != nil {
+		t.Fatal("Failed to set the key", err)
+	}
+
+	if value, err := client.Get(ctx, "key"); err != nil || value != "changed" {
+		t.Errorf("Expected %q but actual %q, err = %v", "changed", value, err)
+	}
+
+	if err := client.Del(ctx, "key"); err != nil {
+		t.Fatal("Failed to delete the key", err)
+	}
+
+	if _, err := client.Get(ctx, "key"); err != ErrKeyNotFound {
+		t.Error("Expected key not found but actual", err)
+	}
+}
+
+func TestClient_NearCacheLostStream(t *testing.T) {
+
+	cache := gcache.NewCache()
+	reads := int64(0)
+
+	ts := nearCacheServer(cache, &reads)
+	defer ts.Close()
+
+	client := NewClient(Connections{NewConnection(ts.URL, "")}, WithNearCache(100, time.Minute))
+	defer client.Close()
+
+	waitSubscribed(t, client)
+
+	cache.Set("key", "value", time.Minute)
+	client.Get(ctx, "key")
+
+	// Changes made while the stream is lost are unknown, so nothing cached is trusted
+	client.near.setSubscribed(0, false)
+
+	if _, ok := client.near.get(0, "key"); ok {
+		t.Error("Expected nothing to be served from the near cache of an unsubscribed shard")
+	}
+
+	if client.near.cache.Count() != 0 {
+		t.Error("Expected the near cache to be flushed once the stream is lost")
+	}
+}
+
+func TestClient_NearCacheClose(t *testing.T) {
+
+	before := runtime.NumGoroutine()
+
+	// Nothing listens on the address, the streams are retried until the client is closed
+	for i := 0; i < 20; i++ {
+		client := NewClient(Connections{NewConnection("http://127.0.0.1:1", "")}, WithNearCache(100, time.Minute))
+		client.Close()
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before+5 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected closed clients to stop their goroutines, %d before and %d after", before, runtime.NumGoroutine())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,128 @@
+package client
+
+import (
+	"crypto/tls"
+	"gcache/trace"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	DefaultDialTimeout          time.Duration = 5 * time.Second
+	DefaultReadTimeout          time.Duration = 10 * time.Second
+	DefaultTimeout              time.Duration = 30 * time.Second
+	DefaultMaxIdleConnsPerShard int           = 16
+	DefaultIdleConnTimeout      time.Duration = 90 * time.Second
+)
+
+// Client option
+type Option func(o *options)
+
+type options struct {
+	transport            *http.Transport
+	dialTimeout          time.Duration
+	readTimeout          time.Duration
+	timeout              time.Duration
+	maxIdleConnsPerShard int
+	retry                RetryPolicy
+	breaker              BreakerSettings
+	nearCacheSize        int
+	nearCacheTtl         time.Duration
+	compressAbove        int
+	maxDecompressedSize  int
+	tracer               trace.Tracer
+}
+
+func defaultOptions() *options {
+	return &options{
+		dialTimeout:          DefaultDialTimeout,
+		readTimeout:          DefaultReadTimeout,
+		timeout:              DefaultTimeout,
+		maxIdleConnsPerShard: DefaultMaxIdleConnsPerShard,
+		breaker:              DefaultBreakerSettings,
+		maxDecompressedSize:  DefaultMaxDecompressedSize,
+		tracer:               trace.Noop,
+	}
+}
+
+// Use the given transport as a template. It is cloned per shard,
+// and the timeouts and limits set by the other options are applied to the clones
+func WithTransport(transport *http.Transport) Option {
+	return func(o *options) {
+		o.transport = transport
+	}
+}
+
+// Limit the time spent on establishing a connection
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.dialTimeout = timeout
+	}
+}
+
+// Limit the time spent waiting for the response headers once the request is written
+func WithReadTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.readTimeout = timeout
+	}
+}
+
+// Limit the total time of a request including reading the response body. Zero means no limit
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// Limit the number of idle (keep-alive) connections kept open to every shard
+func WithMaxIdleConnsPerShard(n int) Option {
+	return func(o *options) {
+		o.maxIdleConnsPerShard = n
+	}
+}
+
+// Record a span of every request sent to a shard. The trace context of the request context
+// is propagated to the server by the traceparent and tracestate headers even without a tracer
+func WithTracer(tracer trace.Tracer) Option {
+	return func(o *options) {
+		o.tracer = tracer
+	}
+}
+
+// Build an http client for a single shard. tlsConfig of the connection overrides the one of the transport
+func (o *options) httpClient(tlsConfig *tls.Config) *http.Client {
+
+	var transport *http.Transport
+
+	if o.transport != nil {
+		transport = o.transport.Clone()
+	} else {
+		transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			IdleConnTimeout: DefaultIdleConnTimeout,
+		}
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   o.dialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport.DialContext = dialer.DialContext
+
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig.Clone()
+	}
+	transport.ResponseHeaderTimeout = o.readTimeout
+	transport.MaxIdleConnsPerHost = o.maxIdleConnsPerShard
+
+	if transport.MaxIdleConns != 0 && transport.MaxIdleConns < o.maxIdleConnsPerShard {
+		transport.MaxIdleConns = o.maxIdleConnsPerShard
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   o.timeout,
+	}
+}
@@ -0,0 +1,86 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var ctx = context.Background()
+
+func TestClient_Timeout(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	client := NewClient(Connections{NewConnection(ts.URL, "")}, WithReadTimeout(50*time.Millisecond))
+
+	start := time.Now()
+	_, err := client.Get(ctx, "key")
+
+	if err == nil {
+		t.Fatal("Expected the request to time out")
+	}
+
+	if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+		t.Errorf("The request has not been timed out in time, elapsed %s", elapsed)
+	}
+}
+
+func TestClient_ContextCancel(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	client := NewClient(Connections{NewConnection(ts.URL, "")})
+
+	deadlineCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	_, err := client.Get(deadlineCtx, "key")
+
+	if err == nil || deadlineCtx.Err() != context.DeadlineExceeded {
+		t.Fatal("Expected the request to be cancelled by the context deadline, err =", err)
+	}
+}
+
+func TestClient_PoolStats(t *testing.T) {
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("value"))
+	}))
+	defer ts.Close()
+
+	client := NewClient(Connections{NewConnection(ts.URL, "")}, WithMaxIdleConnsPerShard(1))
+
+	const n = 5
+	for i := 0; i < n; i++ {
+		if _, err := client.Get(ctx, "key"); err != nil {
+			t.Fatal("Failed to get the key", err)
+		}
+	}
+
+	stats := client.PoolStats()
+
+	if len(stats) != 1 {
+		t.Fatalf("Expected stats of 1 shard but actual %d", len(stats))
+	}
+
+	if stats[0].Addr != ts.URL || stats[0].Requests != n {
+		t.Errorf("Expected %d requests to %s but actual %+v", n, ts.URL, stats[0])
+	}
+
+	if stats[0].NewConns != 1 || stats[0].ReusedConns != n-1 {
+		t.Errorf("Expected the connection to be reused, stats %+v", stats[0])
+	}
+
+	if stats[0].InFlight != 0 {
+		t.Errorf("Expected no requests in flight but actual %d", stats[0].InFlight)
+	}
+}
@@ -0,0 +1,219 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"gcache/protocol"
+	"net/http"
+	"sync"
+)
+
+// Pipeline queues commands and sends them with Exec in one round trip per shard, or per protocol.MaxBatchSize commands of a shard.
+// Shards are requested in parallel, and the results are returned in the order the commands were queued
+type Pipeline struct {
+	client   *Client
+	commands []protocol.Command
+	results  []*Result
+}
+
+// Result of a queued command. It's available once the pipeline is executed
+type Result struct {
+	value  string
+	values []string
+	err    error
+}
+
+// Return the value of get, pop and hget commands
+func (r *Result) Val() (string, error) {
+	return r.value, r.err
+}
+
+// Return the values of lrange commands
+func (r *Result) Vals() ([]string, error) {
+	return r.values, r.err
+}
+
+// Return the error of the command
+func (r *Result) Err() error {
+	return r.err
+}
+
+// Create a new pipeline
+func (client *Client) Pipeline() *Pipeline {
+	return &Pipeline{
+		client: client,
+	}
+}
+
+func (p *Pipeline) queue(command protocol.Command) *Result {
+	result := &Result{}
+	p.commands = append(p.commands, command)
+	p.results = append(p.results, result)
+	return result
+}
+
+// Number of queued commands
+func (p *Pipeline) Len() int {
+	return len(p.commands)
+}
+
+func (p *Pipeline) Get(key string) *Result {
+	return p.queue(protocol.Command{Op: protocol.OpGet, Key: key})
+}
+
+func (p *Pipeline) Set(key string, value string, ttl int) *Result {
+	return p.queue(protocol.Command{Op: protocol.OpSet, Key: key, Value: []byte(value), Ttl: &ttl})
+}
+
+func (p *Pipeline) Update(key string, value string) *Result {
+	return p.queue(protocol.Command{Op: protocol.OpUpdate, Key: key, Value: []byte(value)})
+}
+
+func (p *Pipeline) UpdateWithTtl(key string, value string, ttl int) *Result {
+	return p.queue(protocol.Command{Op: protocol.OpUpdate, Key: key, Value: []byte(value), Ttl: &ttl})
+}
+
+func (p *Pipeline) Del(key string) *Result {
+	return p.queue(protocol.Command{Op: protocol.OpDel, Key: key})
+}
+
+func (p *Pipeline) LPush(key string, value string) *Result {
+	return p.queue(protocol.Command{Op: protocol.OpLPush, Key: key, Value: []byte(value)})
+}
+
+func (p *Pipeline) RPush(key string, value string) *Result {
+	return p.queue(protocol.Command{Op: protocol.OpRPush, Key: key, Value: []byte(value)})
+}
+
+func (p *Pipeline) LPop(key string) *Result {
+	return p.queue(protocol.Command{Op: protocol.OpLPop, Key: key})
+}
+
+func (p *Pipeline) RPop(key string) *Result {
+	return p.queue(protocol.Command{Op: protocol.OpRPop, Key: key})
+}
+
+func (p *Pipeline) LRange(key string, from int, to int) *Result {
+	return p.queue(protocol.Command{Op: protocol.OpLRange, Key: key, From: from, To: to})
+}
+
+func (p *Pipeline) HGet(key string, hashKey string) *Result {
+	return p.queue(protocol.Command{Op: protocol.OpHGet, Key: key, HashKey: hashKey})
+}
+
+func (p *Pipeline) HSet(key string, hashKey string, value string) *Result {
+	return p.queue(protocol.Command{Op: protocol.OpHSet, Key: key, HashKey: hashKey, Value: []byte(value)})
+}
+
+// Send the queued commands and reset the pipeline. Results are returned in the queue order.
+// The returned error is the first failure of a shard request. Results of the commands of the failed
+// batch of a shard, and of the batches after it, hold that error, while the other results are still valid
+func (p *Pipeline) Exec(ctx context.Context) ([]*Result, error) {
+
+	commands, results := p.commands, p.results
+	p.commands, p.results = nil, nil
+
+	// Drop the written keys from the near cache
+	written := []string{}
+	for _, command := range commands {
+		if command.Op != protocol.OpGet && command.Op != protocol.OpLRange && command.Op != protocol.OpHGet {
+			written = append(written, command.Key)
+		}
+	}
+	defer p.client.invalidate(written...)
+
+	// Group command indexes per shard keeping the queue order
+	groups := make(map[int][]int)
+	for i, command := range commands {
+		shard := p.client.conns.shardIndex(command.Key)
+		groups[shard] = append(groups[shard], i)
+	}
+
+	errs := make(chan error, len(groups))
+	wg := sync.WaitGroup{}
+
+	for shard, indexes := range groups {
+		wg.Add(1)
+		go func(conn Connection, indexes []int) {
+			defer wg.Done()
+
+			// Batches of a shard are sent one after the other, so that its commands run in the queue order
+			for from := 0; from < len(indexes); from += protocol.MaxBatchSize {
+				to := from + protocol.MaxBatchSize
+				if to > len(indexes) {
+					to = len(indexes)
+				}
+
+				if err := p.execShard(ctx, conn, commands, results, indexes[from:to]); err != nil {
+					// The commands of the batches not sent fail as well
+					for _, i := range indexes[from:] {
+						results[i].err = err
+					}
+					errs <- err
+					return
+				}
+			}
+		}(p.client.conns[shard], indexes)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	return results, <-errs
+}
+
+func (p *Pipeline) execShard(ctx context.Context, conn Connection, commands []protocol.Command, results []*Result,
+	indexes []int) error {
+
+	batch := make([]protocol.Command, len(indexes))
+	for i, index := range indexes {
+		batch[i] = commands[index]
+	}
+
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+
+	resp, err := conn.doJSONRequest(ctx, http.MethodPost, protocol.BatchPath, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if err := statusError(resp); err != nil {
+		return err
+	}
+
+	shardResults := []protocol.Result{}
+	if err := json.NewDecoder(resp.Body).Decode(&shardResults); err != nil {
+		return err
+	}
+
+	if len(shardResults) != len(indexes) {
+		return unexpectedResultsError(len(indexes), len(shardResults))
+	}
+
+	for i, index := range indexes {
+		results[index].fill(shardResults[i])
+	}
+
+	return nil
+}
+
+func (r *Result) fill(result protocol.Result) {
+
+	if result.Error != nil {
+		r.err = codeError(http.StatusOK, *result.Error)
+		return
+	}
+
+	r.value = string(result.Value)
+
+	r.values = make([]string, len(result.Values))
+	for i, value := range result.Values {
+		r.values[i] = string(value)
+	}
+}
@@ -0,0 +1,133 @@
+package client_test
+
+import (
+	. "gcache/client"
+	"gcache/protocol"
+	"strconv"
+	"testing"
+)
+
+func TestPipeline_Sharded(t *testing.T) {
+
+	const n = 20
+
+	// Two shards
+	client := NewClient(Connections{
+		connection(t),
+		connectionAuth(t),
+	})
+
+	pipeline := client.Pipeline()
+
+	for i := 0; i < n; i++ {
+		pipeline.Set("pipeline"+strconv.Itoa(i), "value"+strconv.Itoa(i), 5)
+	}
+
+	gets := make([]*Result, n)
+	for i := 0; i < n; i++ {
+		gets[i] = pipeline.Get("pipeline" + strconv.Itoa(i))
+	}
+
+	missing := pipeline.Get("pipelinemissing")
+
+	if pipeline.Len() != 2*n+1 {
+		t.Errorf("Expected %d queued commands but actual %d", 2*n+1, pipeline.Len())
+	}
+
+	results, err := pipeline.Exec(ctx)
+
+	if err != nil {
+		t.Fatal("Failed to execute the pipeline", err)
+	}
+
+	if len(results) != 2*n+1 || pipeline.Len() != 0 {
+		t.Fatalf("Expected %d results but actual %d", 2*n+1, len(results))
+	}
+
+	// Results are in the call order
+	for i := 0; i < n; i++ {
+		value, err := gets[i].Val()
+
+		if err != nil {
+			t.Error("Failed to get the key", err)
+		}
+
+		if expected := "value" + strconv.Itoa(i); value != expected || results[n+i] != gets[i] {
+			t.Errorf("Expected %s but actual %s", expected, value)
+		}
+	}
+
+	if _, err := missing.Val(); err != ErrKeyNotFound {
+		t.Error("Expected key not found but actual", err)
+	}
+
+	// Tear down
+	for i := 0; i < n; i++ {
+		pipeline.Del("pipeline" + strconv.Itoa(i))
+	}
+
+	pipeline.Exec(ctx)
+}
+
+func TestPipeline_Lists(t *testing.T) {
+
+	const key = "pipelinelist"
+
+	client := NewClient(Connections{
+		connection(t),
+	})
+
+	pipeline := client.Pipeline()
+	pipeline.LPush(key, "a")
+	pipeline.LPush(key, "b")
+	lrange := pipeline.LRange(key, 0, 10)
+	pop := pipeline.LPop(key)
+	pipeline.Del(key)
+
+	if _, err := pipeline.Exec(ctx); err != nil {
+		t.Fatal("Failed to execute the pipeline", err)
+	}
+
+	values, err := lrange.Vals()
+
+	if err != nil || len(values) != 2 || values[0] != "a" || values[1] != "b" {
+		t.Errorf("Expected [a b] but actual %v, err = %v", values, err)
+	}
+
+	if value, _ := pop.Val(); value != "b" {
+		t.Errorf("Expected b but actual %s", value)
+	}
+}
+
+func TestPipeline_OverMaxBatchSize(t *testing.T) {
+
+	client := NewClient(Connections{connection(t)})
+
+	// The commands of the shard are sent in several batches, in the queue order
+	const n = protocol.MaxBatchSize + 10
+
+	pipeline := client.Pipeline()
+	for i := 0; i < n; i++ {
+		pipeline.Set("batches"+strconv.Itoa(i%100), strconv.Itoa(i), 5)
+	}
+	last := pipeline.Get("batches" + strconv.Itoa((n-1)%100))
+
+	results, err := pipeline.Exec(ctx)
+	if err != nil {
+		t.Fatal("Failed to execute the pipeline", err)
+	}
+
+	if len(results) != n+1 {
+		t.Fatalf("Expected %d results but actual %d", n+1, len(results))
+	}
+
+	for i, result := range results[:n] {
+		if result.Err() != nil {
+			t.Fatalf("Expected the command %d to succeed but actual %v", i, result.Err())
+		}
+	}
+
+	if value, err := last.Val(); err != nil || value != strconv.Itoa(n-1) {
+		t.Errorf("Expected the value of the last set %d but actual %s, err = %v", n-1, value, err)
+	}
+}
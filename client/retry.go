@@ -0,0 +1,84 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// Retry policy of idempotent operations (Get, Set, Del, HGet, LRange).
+// Requests are retried on connection errors and 502, 503 and 504 responses
+// with exponential backoff and full jitter
+type RetryPolicy struct {
+	// Number of attempts including the first one. Values less than 2 disable retries
+	MaxAttempts int
+	// Delay before the first retry, doubled on every next one
+	BaseDelay time.Duration
+	// Upper bound of the delay
+	MaxDelay time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   50 * time.Millisecond,
+	MaxDelay:    1 * time.Second,
+}
+
+// Retry idempotent operations according to the policy. Operations are not retried by default
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(o *options) {
+		o.retry = policy
+	}
+}
+
+// Return a random delay before the given retry (counting from 1)
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < retry && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+// Send an idempotent request retrying transient failures
+func (client *Client) doIdempotentRequest(ctx context.Context, conn Connection, method, urlStr string, body []byte) (*http.Response, error) {
+
+	for attempt := 1; ; attempt++ {
+
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+
+		resp, err := conn.doRequest(ctx, method, urlStr, reader)
+
+		if attempt >= client.retry.MaxAttempts || err == ErrCircuitOpen || ctx.Err() != nil ||
+			!isShardFailure(resp, err) {
+			return resp, err
+		}
+
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-time.After(client.retry.backoff(attempt)):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClient_RetryPolicy(t *testing.T) {
+
+	const value = "value"
+
+	var requests int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// Fail the first two attempts
+		if atomic.AddInt32(&requests, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(value))
+	}))
+	defer ts.Close()
+
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+	client := NewClient(Connections{NewConnection(ts.URL, "")}, WithRetryPolicy(policy))
+
+	returnedValue, err := client.Get(ctx, "key")
+
+	if err != nil {
+		t.Fatal("Failed to get the key", err)
+	}
+
+	if returnedValue != value {
+		t.Error("Value", value, "is not equal to returned value", returnedValue)
+	}
+
+	if requests != 3 {
+		t.Errorf("Expected 3 attempts but actual %d", requests)
+	}
+}
+
+func TestClient_NoRetryByDefault(t *testing.T) {
+
+	var requests int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	client := NewClient(Connections{NewConnection(ts.URL, "")})
+
+	if _, err := client.Get(ctx, "key"); err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	if requests != 1 {
+		t.Errorf("Expected 1 attempt but actual %d", requests)
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+
+	for retry := 1; retry < 10; retry++ {
+		for i := 0; i < 100; i++ {
+			delay := policy.backoff(retry)
+			if delay < 0 || delay > policy.MaxDelay {
+				t.Fatalf("Delay %s of retry %d is out of bounds", delay, retry)
+			}
+		}
+	}
+
+	if delay := (RetryPolicy{}).backoff(1); delay != 0 {
+		t.Errorf("Expected no delay but actual %s", delay)
+	}
+}
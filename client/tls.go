@@ -0,0 +1,69 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+)
+
+var ErrNoCACertificates = errors.New("No CA certificates found")
+
+// TLS settings of a connection
+type TLSConfig struct {
+	// PEM file of the root CAs verifying the server certificate. The system roots are used if empty
+	CAFile string
+	// PEM files of the client certificate and its key, required by servers verifying clients
+	CertFile string
+	KeyFile  string
+	// Name the server certificate is verified against, the host of the address by default
+	ServerName string
+}
+
+// Create a connection to the cache server over TLS, e.g. at https://localhost:8443.
+// The certificates are loaded right away
+func NewTLSConnection(addr string, psw string, config TLSConfig) (Connection, error) {
+
+	tlsConfig, err := config.build()
+	if err != nil {
+		return Connection{}, err
+	}
+
+	conn := NewConnection(addr, psw)
+	conn.tls = tlsConfig
+
+	return conn, nil
+}
+
+func (config TLSConfig) build() (*tls.Config, error) {
+
+	tlsConfig := &tls.Config{
+		ServerName: config.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if config.CAFile != "" {
+		pem, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, ErrNoCACertificates
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.CertFile != "" || config.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
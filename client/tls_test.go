@@ -0,0 +1,130 @@
+package client_test
+
+import (
+	"crypto/tls"
+	. "gcache/client"
+	"gcache/gcachetest"
+	"gcache/server"
+	"gcache/server/cluster"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClient_TLS(t *testing.T) {
+
+	certs := gcachetest.NewCerts(t)
+	srv := gcachetest.NewTLSServer(t, psw, server.TLSConfig{
+		CertFile: certs.ServerCertFile,
+		KeyFile:  certs.ServerKeyFile,
+	})
+
+	conn, err := NewTLSConnection(srv.URL, psw, TLSConfig{CAFile: certs.CAFile})
+	if err != nil {
+		t.Fatal("Failed to create the connection", err)
+	}
+
+	test_SetGetDel(NewClient(Connections{conn}), "key", "value", t)
+
+	// The server certificate is not trusted by the system roots
+	untrusted := NewClient(Connections{NewConnection(srv.URL, psw)})
+	if _, err := untrusted.Get(ctx, "key"); err == nil {
+		t.Error("Expected the server certificate to be rejected")
+	}
+
+	// The certificate is not valid for another name
+	conn, _ = NewTLSConnection(srv.URL, psw, TLSConfig{CAFile: certs.CAFile, ServerName: "other"})
+	if _, err := NewClient(Connections{conn}).Get(ctx, "key"); err == nil {
+		t.Error("Expected the server name to be verified")
+	}
+}
+
+func TestClient_MutualTLS(t *testing.T) {
+
+	certs := gcachetest.NewCerts(t)
+	srv := gcachetest.NewTLSServer(t, "", server.TLSConfig{
+		CertFile:     certs.ServerCertFile,
+		KeyFile:      certs.ServerKeyFile,
+		ClientCAFile: certs.CAFile,
+	})
+
+	conn, err := NewTLSConnection(srv.URL, "", TLSConfig{
+		CAFile:   certs.CAFile,
+		CertFile: certs.ClientCertFile,
+		KeyFile:  certs.ClientKeyFile,
+	})
+	if err != nil {
+		t.Fatal("Failed to create the connection", err)
+	}
+
+	test_SetGetDel(NewClient(Connections{conn}), "key", "value", t)
+
+	// A client without a certificate is rejected
+	conn, _ = NewTLSConnection(srv.URL, "", TLSConfig{CAFile: certs.CAFile})
+	if _, err := NewClient(Connections{conn}).Get(ctx, "key"); err == nil {
+		t.Error("Expected the client without a certificate to be rejected")
+	}
+}
+
+func TestClient_NewClientFromSeedConnection(t *testing.T) {
+
+	certs := gcachetest.NewCerts(t)
+	member := gcachetest.NewTLSServer(t, psw, server.TLSConfig{
+		CertFile: certs.ServerCertFile,
+		KeyFile:  certs.ServerKeyFile,
+	})
+
+	sessions, err := member.AddDatabase("sessions", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seed := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		cluster.WriteMembers(w, []cluster.Member{{Addr: member.URL, State: cluster.StateAlive}})
+	}))
+
+	cert, err := tls.LoadX509KeyPair(certs.ServerCertFile, certs.ServerKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	seed.StartTLS()
+	defer seed.Close()
+
+	conn, err := NewTLSConnection(seed.URL, psw, TLSConfig{CAFile: certs.CAFile})
+	if err != nil {
+		t.Fatal("Failed to create the connection", err)
+	}
+
+	// The member is reached over the TLS of the seed, with its password and database
+	client, err := NewClientFromSeedConnection(ctx, conn.WithDatabase("sessions"))
+	if err != nil {
+		t.Fatal("Failed to create client from seed", err)
+	}
+	defer client.Close()
+
+	if err := client.Set(ctx, "key", "value", 60); err != nil {
+		t.Fatal("Failed to set", err)
+	}
+
+	if value, err := sessions.Get("key"); err != nil || value != "value" {
+		t.Errorf("Expected the key in the database of the seed connection but actual %v, err = %v", value, err)
+	}
+	if _, err := member.Cache().Get("key"); err == nil {
+		t.Error("Expected the key not to be in the default database")
+	}
+}
+
+func TestClient_TLSBadFiles(t *testing.T) {
+
+	if _, err := NewTLSConnection("https://localhost", "", TLSConfig{CAFile: "missing.pem"}); err == nil {
+		t.Error("Expected an error loading a missing CA file")
+	}
+
+	certs := gcachetest.NewCerts(t)
+
+	// A key is not a CA certificate
+	if _, err := NewTLSConnection("https://localhost", "", TLSConfig{CAFile: certs.ClientKeyFile}); err != ErrNoCACertificates {
+		t.Error("Expected no CA certificates but actual", err)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"gcache/client"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+func main() {
+
+	addr := flag.String("addr", "http://localhost:8080", "comma separated addresses of the servers, keys are sharded between them")
+	user := flag.String("user", "", "user of the server ACL")
+	psw := flag.String("psw", "", "authentication password, or the password of the user")
+	db := flag.String("db", "", "database of the servers, the default one if empty")
+	clients := flag.Int("clients", 50, "number of concurrent clients, each sends one request at a time")
+	requests := flag.Int("requests", 0, "total number of requests, 0 runs for -duration")
+	duration := flag.Duration("duration", 10*time.Second, "duration of the run if -requests is 0")
+	mix := flag.String("mix", "get=80,set=20", "weights of the operations, of get, set, del, mget, mset, lpush, rpush, lpop, rpop, lrange, hget and hset")
+	keyspace := flag.Int("keyspace", 100000, "number of distinct keys of every kind")
+	zipf := flag.Float64("zipf", 0, "exponent of the zipfian distribution of the keys, greater than 1, e.g. 1.1. Keys are uniform if 0")
+	valueSize := flag.String("value-size", "128", "size of the values in bytes, or min-max for uniformly distributed sizes")
+	fields := flag.Int("fields", 16, "number of distinct fields of every hash")
+	batch := flag.Int("batch", 10, "number of keys of mget and mset, and of elements of lrange")
+	ttl := flag.Int("ttl", 3600, "ttl in seconds of the keys set")
+	prefix := flag.String("prefix", "bench:", "prefix of the keys")
+	populate := flag.Bool("populate", false, "set every key before the run, so that reads hit")
+	timeout := flag.Duration("timeout", 5*time.Second, "timeout of a request")
+	format := flag.String("format", "text", "report format, text or json")
+
+	flag.Parse()
+
+	wl, err := newWorkload(*mix, *valueSize, *keyspace, *zipf, *fields, *batch, *ttl, *prefix)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	write, ok := reporters[*format]
+	if !ok || *clients <= 0 || *requests < 0 || (*requests == 0 && *duration <= 0) {
+		fmt.Fprintln(os.Stderr, "Invalid -format, -clients, -requests or -duration")
+		os.Exit(2)
+	}
+
+	authorization := *psw
+	if *user != "" {
+		authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(*user+":"+*psw))
+	}
+
+	conns := client.Connections{}
+	for _, a := range strings.Split(*addr, ",") {
+		conns = append(conns, client.NewConnection(strings.TrimSpace(a), authorization).WithDatabase(*db))
+	}
+
+	c := client.NewClient(conns, client.WithMaxIdleConnsPerShard(*clients), client.WithTimeout(*timeout))
+	defer c.Close()
+
+	// Stop early on Ctrl+C and still report
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	if *populate {
+		if err := populateKeys(ctx, c, wl, *clients); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to populate the keys:", err)
+			os.Exit(1)
+		}
+	}
+
+	r := run(ctx, c, wl, *clients, *requests, *duration)
+	r.Settings = settings{
+		Addrs:     len(conns),
+		Clients:   *clients,
+		Mix:       *mix,
+		Keyspace:  *keyspace,
+		Zipf:      *zipf,
+		ValueSize: *valueSize,
+	}
+
+	if err := write(os.Stdout, r); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func newWorkload(mix string, valueSize string, keyspace int, zipf float64, fields int, batch int, ttl int, prefix string) (*workload, error) {
+	ops, err := parseMix(mix)
+	if err != nil {
+		return nil, err
+	}
+
+	sizes, err := parseSizes(valueSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if keyspace <= 0 || fields <= 0 || batch <= 0 {
+		return nil, fmt.Errorf("-keyspace, -fields and -batch must be positive")
+	}
+	if zipf != 0 && zipf <= 1 {
+		return nil, fmt.Errorf("-zipf must be greater than 1")
+	}
+
+	wl := &workload{
+		mix:      ops,
+		prefix:   prefix,
+		keyspace: keyspace,
+		zipf:     zipf,
+		sizes:    sizes,
+		fields:   fields,
+		batch:    batch,
+		ttl:      ttl,
+		// Values are slices of the data at random offsets
+		data: randomData(sizes.max + 1<<16),
+	}
+
+	for _, op := range ops {
+		wl.total += op.weight
+	}
+
+	return wl, nil
+}
+
+// Set every key of the key space, split between the clients
+func populateKeys(ctx context.Context, c *client.Client, wl *workload, clients int) error {
+	var next int64 = -1
+	var failed atomic.Value
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+
+			w := newWorker(c, wl, seed)
+			for {
+				n := atomic.AddInt64(&next, 1)
+				if n >= int64(wl.keyspace) || ctx.Err() != nil {
+					return
+				}
+
+				key := fmt.Sprintf("%skey:%d", wl.prefix, n)
+				if err := c.Set(ctx, key, w.value(), wl.ttl); err != nil {
+					failed.Store(err)
+					return
+				}
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+
+	if err, ok := failed.Load().(error); ok {
+		return err
+	}
+	return ctx.Err()
+}
+
+// Run the clients until the requests are sent, the duration is over or the context is done.
+// Requests in flight at the end of the duration complete, so that they are not counted as failed
+func run(ctx context.Context, c *client.Client, wl *workload, clients int, requests int, duration time.Duration) *report {
+	var sent int64
+	workers := make([]*worker, clients)
+
+	wg := sync.WaitGroup{}
+	start := time.Now()
+	deadline := start.Add(duration)
+
+	for i := range workers {
+		workers[i] = newWorker(c, wl, time.Now().UnixNano()+int64(i))
+
+		wg.Add(1)
+		go func(w *worker) {
+			defer wg.Done()
+
+			for ctx.Err() == nil {
+				if requests > 0 && atomic.AddInt64(&sent, 1) > int64(requests) {
+					return
+				}
+				if requests == 0 && time.Now().After(deadline) {
+					return
+				}
+				w.step(ctx)
+			}
+		}(workers[i])
+	}
+
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	stats := make(map[string]*opStats)
+	for _, op := range wl.mix {
+		stats[op.name] = newOpStats()
+		for _, w := range workers {
+			stats[op.name].merge(w.stats[op.name])
+		}
+	}
+
+	return newReport(wl, stats, elapsed)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Writers of the report in the formats
+var reporters = map[string]func(w io.Writer, r *report) error{
+	"text": writeText,
+	"json": writeJSON,
+}
+
+type settings struct {
+	Addrs     int     `json:"addrs"`
+	Clients   int     `json:"clients"`
+	Mix       string  `json:"mix"`
+	Keyspace  int     `json:"keyspace"`
+	Zipf      float64 `json:"zipf,omitempty"`
+	ValueSize string  `json:"valueSize"`
+}
+
+// Latencies of the report in milliseconds
+type latencies struct {
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P99  float64 `json:"p99"`
+	P999 float64 `json:"p999"`
+	Max  float64 `json:"max"`
+}
+
+type opReport struct {
+	Op         string            `json:"op"`
+	Requests   uint64            `json:"requests"`
+	Throughput float64           `json:"throughput"`
+	Misses     uint64            `json:"misses"`
+	Errors     uint64            `json:"errors"`
+	ErrorKinds map[string]uint64 `json:"errorKinds,omitempty"`
+	LatencyMs  latencies         `json:"latencyMs"`
+}
+
+// Outcome of a run, throughputs are requests per second
+type report struct {
+	Settings   settings   `json:"settings"`
+	Duration   float64    `json:"durationSeconds"`
+	Requests   uint64     `json:"requests"`
+	Throughput float64    `json:"throughput"`
+	Errors     uint64     `json:"errors"`
+	LatencyMs  latencies  `json:"latencyMs"`
+	Ops        []opReport `json:"ops"`
+}
+
+func newReport(wl *workload, stats map[string]*opStats, elapsed time.Duration) *report {
+	r := &report{Duration: elapsed.Seconds()}
+
+	all := &histogram{}
+	for _, op := range wl.mix {
+		s := stats[op.name]
+		all.merge(&s.latency)
+
+		o := opReport{
+			Op:         op.name,
+			Requests:   s.latency.count,
+			Throughput: float64(s.latency.count) / elapsed.Seconds(),
+			Misses:     s.misses,
+			Errors:     s.errorCount(),
+			LatencyMs:  latenciesOf(&s.latency),
+		}
+		if len(s.errors) > 0 {
+			o.ErrorKinds = s.errors
+		}
+
+		r.Ops = append(r.Ops, o)
+		r.Errors += o.Errors
+	}
+
+	sort.Slice(r.Ops, func(i, j int) bool { return r.Ops[i].Op < r.Ops[j].Op })
+
+	r.Requests = all.count
+	r.Throughput = float64(all.count) / elapsed.Seconds()
+	r.LatencyMs = latenciesOf(all)
+
+	return r
+}
+
+func latenciesOf(h *histogram) latencies {
+	return latencies{
+		Mean: ms(h.mean()),
+		P50:  ms(h.percentile(50)),
+		P99:  ms(h.percentile(99)),
+		P999: ms(h.percentile(99.9)),
+		Max:  ms(time.Duration(h.max) * time.Microsecond),
+	}
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func writeJSON(w io.Writer, r *report) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+func writeText(w io.Writer, r *report) error {
+	s := r.Settings
+	fmt.Fprintf(w, "%d clients, %d shards, mix %s, %d keys", s.Clients, s.Addrs, s.Mix, s.Keyspace)
+	if s.Zipf > 0 {
+		fmt.Fprintf(w, " zipf %g", s.Zipf)
+	}
+	fmt.Fprintf(w, ", values of %s bytes\n", s.ValueSize)
+	fmt.Fprintf(w, "%d requests in %.2fs, %.0f requests/s, %d errors\n\n", r.Requests, r.Duration, r.Throughput, r.Errors)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "op\trequests\treq/s\tmisses\terrors\tmean ms\tp50 ms\tp99 ms\tp999 ms\tmax ms\t")
+
+	row := func(name string, requests uint64, throughput float64, misses string, errors uint64, l latencies) {
+		fmt.Fprintf(tw, "%s\t%d\t%.0f\t%s\t%d\t%.3f\t%.3f\t%.3f\t%.3f\t%.3f\t\n",
+			name, requests, throughput, misses, errors, l.Mean, l.P50, l.P99, l.P999, l.Max)
+	}
+
+	for _, o := range r.Ops {
+		row(o.Op, o.Requests, o.Throughput, fmt.Sprint(o.Misses), o.Errors, o.LatencyMs)
+	}
+	row("all", r.Requests, r.Throughput, "", r.Errors, r.LatencyMs)
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, o := range r.Ops {
+		kinds := make([]string, 0, len(o.ErrorKinds))
+		for kind, n := range o.ErrorKinds {
+			kinds = append(kinds, fmt.Sprintf("%s: %d", kind, n))
+		}
+		sort.Strings(kinds)
+
+		if len(kinds) > 0 {
+			fmt.Fprintf(w, "\n%s errors: %s", o.Op, strings.Join(kinds, ", "))
+		}
+	}
+	if r.Errors > 0 {
+		fmt.Fprintln(w)
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"gcache/client"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// Latencies are recorded in microseconds, exactly up to subBuckets and with an error
+// of less than 1/subBuckets above
+const (
+	subBuckets = 64
+	// Buckets cover latencies up to 2^40 microseconds
+	histogramBuckets = subBuckets + (40-6)*subBuckets
+)
+
+// Histogram of latencies, log-linear buckets keep the memory fixed however many requests are recorded
+type histogram struct {
+	counts [histogramBuckets]uint64
+	count  uint64
+	sum    uint64
+	max    uint64
+}
+
+func bucketOf(v uint64) int {
+	if v < subBuckets {
+		return int(v)
+	}
+
+	shift := bits.Len64(v) - 7
+	i := subBuckets + shift*subBuckets + int(v>>uint(shift)) - subBuckets
+	if i >= histogramBuckets {
+		return histogramBuckets - 1
+	}
+	return i
+}
+
+// Highest latency of the bucket
+func bucketMax(i int) uint64 {
+	if i < subBuckets {
+		return uint64(i)
+	}
+
+	shift := uint((i - subBuckets) / subBuckets)
+	mantissa := uint64((i-subBuckets)%subBuckets + subBuckets)
+	return (mantissa+1)<<shift - 1
+}
+
+func (h *histogram) record(d time.Duration) {
+	v := uint64(d / time.Microsecond)
+
+	h.counts[bucketOf(v)]++
+	h.count++
+	h.sum += v
+	if v > h.max {
+		h.max = v
+	}
+}
+
+func (h *histogram) merge(other *histogram) {
+	for i, n := range other.counts {
+		h.counts[i] += n
+	}
+	h.count += other.count
+	h.sum += other.sum
+	if other.max > h.max {
+		h.max = other.max
+	}
+}
+
+// Latency at the percentile of the recorded ones, e.g. 99.9
+func (h *histogram) percentile(p float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(p / 100 * float64(h.count)))
+	if rank == 0 {
+		rank = 1
+	}
+
+	seen := uint64(0)
+	for i, n := range h.counts {
+		seen += n
+		if seen >= rank {
+			v := bucketMax(i)
+			if v > h.max {
+				v = h.max
+			}
+			return time.Duration(v) * time.Microsecond
+		}
+	}
+
+	return time.Duration(h.max) * time.Microsecond
+}
+
+func (h *histogram) mean() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	return time.Duration(h.sum/h.count) * time.Microsecond
+}
+
+// Outcomes of the requests of an operation
+type opStats struct {
+	latency histogram
+	// Reads of missing keys, they are not errors
+	misses uint64
+	errors map[string]uint64
+}
+
+func newOpStats() *opStats {
+	return &opStats{errors: make(map[string]uint64)}
+}
+
+func (s *opStats) record(d time.Duration, err error) {
+	switch err {
+	case nil:
+	case client.ErrKeyNotFound:
+		s.misses++
+	default:
+		s.errors[err.Error()]++
+	}
+
+	s.latency.record(d)
+}
+
+func (s *opStats) merge(other *opStats) {
+	s.latency.merge(&other.latency)
+	s.misses += other.misses
+	for err, n := range other.errors {
+		s.errors[err] += n
+	}
+}
+
+func (s *opStats) errorCount() uint64 {
+	n := uint64(0)
+	for _, count := range s.errors {
+		n += count
+	}
+	return n
+}
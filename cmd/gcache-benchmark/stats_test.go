@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"gcache/client"
+	"testing"
+	"time"
+)
+
+func TestHistogram_Buckets(t *testing.T) {
+
+	cases := []struct {
+		value  uint64
+		bucket int
+		max    uint64
+	}{
+		{0, 0, 0},
+		{1, 1, 1},
+		{63, 63, 63},
+		{64, 64, 64},
+		{127, 127, 127},
+		{128, 128, 129},
+		{129, 128, 129},
+		{130, 129, 131},
+		{255, 191, 255},
+		{256, 192, 259},
+		{1000, 317, 1007},
+		{1 << 20, 960, 1<<20 + 1<<14 - 1},
+		{1<<40 - 1, histogramBuckets - 1, 1<<40 - 1},
+		// Latencies over the range are counted in the last bucket
+		{1 << 40, histogramBuckets - 1, 1<<40 - 1},
+		{1<<64 - 1, histogramBuckets - 1, 1<<40 - 1},
+	}
+
+	for _, c := range cases {
+		bucket := bucketOf(c.value)
+		if bucket != c.bucket {
+			t.Errorf("Expected %d in the bucket %d but actual %d", c.value, c.bucket, bucket)
+		}
+		if max := bucketMax(bucket); max != c.max {
+			t.Errorf("Expected the highest latency %d of the bucket of %d but actual %d", c.max, c.value, max)
+		}
+	}
+
+	// Buckets are contiguous, and a latency is over the highest one of the previous bucket
+	// by less than 1/subBuckets of it
+	for i := 1; i < histogramBuckets; i++ {
+		first := bucketMax(i-1) + 1
+		if bucketOf(first) != i || bucketOf(bucketMax(i)) != i {
+			t.Fatalf("Expected the bucket %d to cover %d to %d", i, first, bucketMax(i))
+		}
+		if width := bucketMax(i) - first + 1; width > 1 && width > first/subBuckets {
+			t.Fatalf("Expected the bucket %d of %d to be narrower than %d but actual %d", i, first, first/subBuckets, width)
+		}
+	}
+}
+
+func TestHistogram_Percentile(t *testing.T) {
+
+	h := &histogram{}
+	if h.percentile(50) != 0 || h.mean() != 0 {
+		t.Error("Expected no latencies of an empty histogram")
+	}
+
+	// 1 to 100 milliseconds
+	for i := 1; i <= 100; i++ {
+		h.record(time.Duration(i) * time.Millisecond)
+	}
+
+	cases := []struct {
+		percentile float64
+		expected   time.Duration
+	}{
+		{0, time.Millisecond},
+		{1, time.Millisecond},
+		{50, 50 * time.Millisecond},
+		{90, 90 * time.Millisecond},
+		{99, 99 * time.Millisecond},
+		{99.9, 100 * time.Millisecond},
+		{100, 100 * time.Millisecond},
+	}
+
+	for _, c := range cases {
+		actual := h.percentile(c.percentile)
+		// Latencies of the bucket are reported as its highest one
+		if actual < c.expected || actual > c.expected+c.expected/subBuckets {
+			t.Errorf("Expected the percentile %v to be %s but actual %s", c.percentile, c.expected, actual)
+		}
+	}
+
+	if h.mean() != 50500*time.Microsecond {
+		t.Errorf("Expected the mean of 50.5ms but actual %s", h.mean())
+	}
+
+	// Never over the highest latency recorded
+	single := &histogram{}
+	single.record(1000 * time.Microsecond)
+
+	if p := single.percentile(100); p != 1000*time.Microsecond {
+		t.Errorf("Expected the percentile of the only latency 1ms but actual %s", p)
+	}
+}
+
+func TestOpStats_Merge(t *testing.T) {
+
+	first, second := newOpStats(), newOpStats()
+
+	first.record(time.Millisecond, nil)
+	first.record(2*time.Millisecond, client.ErrKeyNotFound)
+	second.record(3*time.Millisecond, errors.New("timeout"))
+	second.record(4*time.Millisecond, errors.New("timeout"))
+
+	first.merge(second)
+
+	if first.latency.count != 4 || first.latency.max != 4000 || first.misses != 1 || first.errorCount() != 2 || first.errors["timeout"] != 2 {
+		t.Errorf("Unexpected merged stats %+v", first)
+	}
+}
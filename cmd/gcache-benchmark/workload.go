@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"gcache/client"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Operations of the mix
+var operations = map[string]func(w *worker, ctx context.Context) error{
+	"get": func(w *worker, ctx context.Context) error {
+		_, err := w.client.Get(ctx, w.key("key:"))
+		return err
+	},
+	"set": func(w *worker, ctx context.Context) error {
+		return w.client.Set(ctx, w.key("key:"), w.value(), w.workload.ttl)
+	},
+	"del": func(w *worker, ctx context.Context) error {
+		return w.client.Del(ctx, w.key("key:"))
+	},
+	"mget": func(w *worker, ctx context.Context) error {
+		_, err := w.client.MGet(ctx, w.keys("key:")...)
+		return err
+	},
+	"mset": func(w *worker, ctx context.Context) error {
+		items := map[string]string{}
+		for _, key := range w.keys("key:") {
+			items[key] = w.value()
+		}
+		return w.client.MSet(ctx, items, w.workload.ttl)
+	},
+	"lpush": func(w *worker, ctx context.Context) error {
+		return w.client.LPush(ctx, w.key("list:"), w.value())
+	},
+	"rpush": func(w *worker, ctx context.Context) error {
+		return w.client.RPush(ctx, w.key("list:"), w.value())
+	},
+	"lpop": func(w *worker, ctx context.Context) error {
+		_, err := w.client.LPop(ctx, w.key("list:"))
+		return err
+	},
+	"rpop": func(w *worker, ctx context.Context) error {
+		_, err := w.client.RPop(ctx, w.key("list:"))
+		return err
+	},
+	"lrange": func(w *worker, ctx context.Context) error {
+		_, err := w.client.LRange(ctx, w.key("list:"), 0, w.workload.batch-1)
+		return err
+	},
+	"hget": func(w *worker, ctx context.Context) error {
+		_, err := w.client.HGet(ctx, w.key("hash:"), w.field())
+		return err
+	},
+	"hset": func(w *worker, ctx context.Context) error {
+		return w.client.HSet(ctx, w.key("hash:"), w.field(), w.value())
+	},
+}
+
+type weighted struct {
+	name   string
+	weight int
+}
+
+// Parse the mix of the operations of the form op=weight,..., e.g. get=80,set=20
+func parseMix(value string) ([]weighted, error) {
+	mix := []weighted{}
+
+	for _, op := range strings.Split(value, ",") {
+		if op = strings.TrimSpace(op); op == "" {
+			continue
+		}
+
+		name, weight := op, 1
+		if i := strings.IndexByte(op, '='); i >= 0 {
+			var err error
+			name = op[:i]
+			if weight, err = strconv.Atoi(op[i+1:]); err != nil || weight < 0 {
+				return nil, fmt.Errorf("Invalid weight of '%s'", op)
+			}
+		}
+
+		if _, ok := operations[name]; !ok {
+			return nil, fmt.Errorf("Unknown operation '%s'", name)
+		}
+		for _, other := range mix {
+			if other.name == name {
+				return nil, fmt.Errorf("Operation '%s' is repeated", name)
+			}
+		}
+
+		if weight > 0 {
+			mix = append(mix, weighted{name, weight})
+		}
+	}
+
+	if len(mix) == 0 {
+		return nil, fmt.Errorf("No operations in the mix '%s'", value)
+	}
+	return mix, nil
+}
+
+// Sizes of the values, fixed or uniformly distributed between min and max
+type sizes struct {
+	min, max int
+}
+
+// Parse the size of the values of the form size or min-max, e.g. 128 or 64-4096
+func parseSizes(value string) (sizes, error) {
+	bounds := strings.SplitN(value, "-", 2)
+
+	min, err := strconv.Atoi(bounds[0])
+	if err != nil || min < 0 {
+		return sizes{}, fmt.Errorf("Invalid value size '%s'", value)
+	}
+
+	max := min
+	if len(bounds) > 1 {
+		if max, err = strconv.Atoi(bounds[1]); err != nil || max < min {
+			return sizes{}, fmt.Errorf("Invalid value size '%s'", value)
+		}
+	}
+
+	return sizes{min, max}, nil
+}
+
+// Settings of the generated requests
+type workload struct {
+	mix      []weighted
+	total    int
+	prefix   string
+	keyspace int
+	// Exponent of the zipfian distribution of the keys, uniform if zero
+	zipf   float64
+	sizes  sizes
+	fields int
+	// Keys of mget and mset, elements of lrange
+	batch int
+	ttl   int
+	// Random bytes values are sliced from
+	data string
+}
+
+func (wl *workload) pick(r *rand.Rand) string {
+	n := r.Intn(wl.total)
+	for _, op := range wl.mix {
+		if n < op.weight {
+			return op.name
+		}
+		n -= op.weight
+	}
+	return wl.mix[len(wl.mix)-1].name
+}
+
+// Client sending requests one at a time, with its own random source and statistics
+type worker struct {
+	client   *client.Client
+	workload *workload
+	rand     *rand.Rand
+	zipf     *rand.Zipf
+	stats    map[string]*opStats
+}
+
+func newWorker(c *client.Client, wl *workload, seed int64) *worker {
+	w := &worker{
+		client:   c,
+		workload: wl,
+		rand:     rand.New(rand.NewSource(seed)),
+		stats:    make(map[string]*opStats),
+	}
+
+	// Hot keys are the lowest numbers, they are spread between the shards by hashing anyway
+	if wl.zipf > 0 {
+		w.zipf = rand.NewZipf(w.rand, wl.zipf, 1, uint64(wl.keyspace-1))
+	}
+
+	for _, op := range wl.mix {
+		w.stats[op.name] = newOpStats()
+	}
+
+	return w
+}
+
+// Send a request of the mix and record its outcome
+func (w *worker) step(ctx context.Context) {
+	name := w.workload.pick(w.rand)
+	stats := w.stats[name]
+
+	start := time.Now()
+	err := operations[name](w, ctx)
+
+	// Requests interrupted by stopping the run tell nothing
+	if ctx.Err() == nil {
+		stats.record(time.Since(start), err)
+	}
+}
+
+func (w *worker) key(kind string) string {
+	var n uint64
+	if w.zipf != nil {
+		n = w.zipf.Uint64()
+	} else {
+		n = uint64(w.rand.Intn(w.workload.keyspace))
+	}
+	return w.workload.prefix + kind + strconv.FormatUint(n, 10)
+}
+
+func (w *worker) keys(kind string) []string {
+	keys := make([]string, w.workload.batch)
+	for i := range keys {
+		keys[i] = w.key(kind)
+	}
+	return keys
+}
+
+func (w *worker) field() string {
+	return "field:" + strconv.Itoa(w.rand.Intn(w.workload.fields))
+}
+
+func (w *worker) value() string {
+	s := w.workload.sizes
+	size := s.min
+	if s.max > s.min {
+		size += w.rand.Intn(s.max - s.min + 1)
+	}
+
+	offset := w.rand.Intn(len(w.workload.data) - size + 1)
+	return w.workload.data[offset : offset+size]
+}
+
+// Random printable bytes of the given length
+func randomData(length int) string {
+	const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+	r := rand.New(rand.NewSource(1))
+	data := make([]byte, length)
+	for i := range data {
+		data[i] = alphabet[r.Intn(len(alphabet))]
+	}
+	return string(data)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMix(t *testing.T) {
+
+	cases := []struct {
+		value    string
+		expected []weighted
+	}{
+		{"get", []weighted{{"get", 1}}},
+		{"get=80,set=20", []weighted{{"get", 80}, {"set", 20}}},
+		{" get=3 , hset ,", []weighted{{"get", 3}, {"hset", 1}}},
+		// Operations of no weight are left out
+		{"get=1,del=0", []weighted{{"get", 1}}},
+	}
+
+	for _, c := range cases {
+		mix, err := parseMix(c.value)
+		if err != nil || !reflect.DeepEqual(mix, c.expected) {
+			t.Errorf("Expected %q to be %v but actual %v, err = %v", c.value, c.expected, mix, err)
+		}
+	}
+
+	for _, value := range []string{"", ",", "get=0", "scan", "get=x", "get=-1", "get=1,get=2", "get=1,get=0", "=1"} {
+		if mix, err := parseMix(value); err == nil {
+			t.Errorf("Expected %q to be invalid but actual %v", value, mix)
+		}
+	}
+}
+
+func TestParseSizes(t *testing.T) {
+
+	cases := []struct {
+		value    string
+		expected sizes
+	}{
+		{"0", sizes{0, 0}},
+		{"100", sizes{100, 100}},
+		{"10-1000", sizes{10, 1000}},
+		{"5-5", sizes{5, 5}},
+	}
+
+	for _, c := range cases {
+		s, err := parseSizes(c.value)
+		if err != nil || s != c.expected {
+			t.Errorf("Expected %q to be %v but actual %v, err = %v", c.value, c.expected, s, err)
+		}
+	}
+
+	for _, value := range []string{"", "-1", "x", "10-", "10-5", "1-2-3", "1kb"} {
+		if s, err := parseSizes(value); err == nil {
+			t.Errorf("Expected %q to be invalid but actual %v", value, s)
+		}
+	}
+}
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gcache/client"
+	"gcache/protocol"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var errUsage = errors.New("Wrong number of arguments")
+
+// Reply of a command succeeding without a value
+type ok struct{}
+
+// Reply of rows of fields, e.g. of INFO
+type table struct {
+	header []string
+	rows   [][]string
+}
+
+type command struct {
+	name string
+	args string
+	help string
+	// Number of arguments, max -1 means any number more than min
+	min, max int
+	run      func(s *session, ctx context.Context, args []string) (interface{}, error)
+}
+
+var commands = []command{
+	{"GET", "key", "get the value of the key", 1, 1, get},
+	{"SET", "key value [ttl]", "set the key to the value for ttl seconds, -ttl by default", 2, 3, set},
+	{"UPDATE", "key value [ttl]", "update the value of an existing key, and its ttl if given", 2, 3, update},
+	{"DEL", "key [key ...]", "delete the keys, reply the number of deleted keys", 1, -1, del},
+	{"KEYS", "[pattern]", "list the keys matching the pattern, e.g. user:*", 0, 1, keys},
+	{"TTL", "key", "get the ttl of the key in seconds", 1, 1, ttl},
+	{"MGET", "key [key ...]", "get the values of the keys", 1, -1, mget},
+	{"MSET", "key value [key value ...]", "set the keys to the values for -ttl seconds", 2, -1, mset},
+	{"LPUSH", "key value [value ...]", "push the values to the head of the list", 2, -1, push(true)},
+	{"RPUSH", "key value [value ...]", "push the values to the tail of the list", 2, -1, push(false)},
+	{"LPOP", "key", "pop the head of the list", 1, 1, pop(true)},
+	{"RPOP", "key", "pop the tail of the list", 1, 1, pop(false)},
+	{"LRANGE", "key from to", "get the elements of the list from the index to the index", 3, 3, lrange},
+	{"HGET", "key field", "get the field of the hash", 2, 2, hget},
+	{"HSET", "key field value", "set the field of the hash", 3, 3, hset},
+	{"DBSIZE", "", "number of keys of the database of all the shards", 0, 0, dbsize},
+	{"INFO", "", "information and statistics of every shard", 0, 0, info},
+	{"CONFIG", "GET pattern | SET name value", "get or set the settings of every shard", 2, 3, config},
+	{"SLOWLOG", "GET [count] | RESET", "get or reset the slow commands of every shard", 1, 2, slowlog},
+	{"SELECT", "db", "use the database of the servers", 1, 1, selectDB},
+	{"FLUSHDB", "", "delete the keys of the database", 0, 0, flushDB},
+	{"FLUSHALL", "", "delete the keys of all the databases", 0, 0, flushAll},
+	{"SAVE", "", "save the snapshot of every shard", 0, 0, save},
+}
+
+func init() {
+	// HELP describes the commands, so it's added once they are declared
+	commands = append(commands, command{"HELP", "[command]", "describe the commands", 0, 1, help})
+}
+
+// Subcommands completed after the command
+var subcommands = map[string][]string{
+	"CONFIG":  {"GET", "SET"},
+	"SLOWLOG": {"GET", "RESET"},
+}
+
+func findCommand(name string) (command, bool) {
+	name = strings.ToUpper(name)
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+// Run the command of the arguments, the first of them is the name of the command
+func (s *session) execute(args []string) (interface{}, error) {
+	c, found := findCommand(args[0])
+	if !found {
+		return nil, fmt.Errorf("Unknown command '%s', try HELP", args[0])
+	}
+
+	args = args[1:]
+	if len(args) < c.min || (c.max >= 0 && len(args) > c.max) {
+		return nil, fmt.Errorf("%s: usage %s %s", errUsage, c.name, c.args)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	return c.run(s, ctx, args)
+}
+
+// Missing values are replied as nil
+func value(v string, err error) (interface{}, error) {
+	if err == client.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func done(err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	return ok{}, nil
+}
+
+func get(s *session, ctx context.Context, args []string) (interface{}, error) {
+	return value(s.client.Get(ctx, args[0]))
+}
+
+func set(s *session, ctx context.Context, args []string) (interface{}, error) {
+	ttl := s.ttl
+	if len(args) > 2 {
+		var err error
+		if ttl, err = parseInt(args[2], "ttl"); err != nil {
+			return nil, err
+		}
+	}
+	return done(s.client.Set(ctx, args[0], args[1], ttl))
+}
+
+func update(s *session, ctx context.Context, args []string) (interface{}, error) {
+	if len(args) < 3 {
+		return done(s.client.Update(ctx, args[0], args[1]))
+	}
+
+	ttl, err := parseInt(args[2], "ttl")
+	if err != nil {
+		return nil, err
+	}
+	return done(s.client.UpdateWithTtl(ctx, args[0], args[1], ttl))
+}
+
+func del(s *session, ctx context.Context, args []string) (interface{}, error) {
+	if len(args) > 1 {
+		return s.client.MDel(ctx, args...)
+	}
+
+	err := s.client.Del(ctx, args[0])
+	if err == client.ErrKeyNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return 1, nil
+}
+
+func keys(s *session, ctx context.Context, args []string) (interface{}, error) {
+	all, err := s.client.Keys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pattern := "*"
+	if len(args) > 0 {
+		pattern = args[0]
+	}
+
+	matched := []string{}
+	for _, key := range all {
+		if protocol.MatchGlob(pattern, key) {
+			matched = append(matched, key)
+		}
+	}
+
+	sort.Strings(matched)
+	return matched, nil
+}
+
+func ttl(s *session, ctx context.Context, args []string) (interface{}, error) {
+	ttl, err := s.client.Ttl(ctx, args[0])
+	if err == client.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ttl, nil
+}
+
+func mget(s *session, ctx context.Context, args []string) (interface{}, error) {
+	results, err := s.client.MGet(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(results))
+	for i, result := range results {
+		if result.Err == nil {
+			values[i] = result.Value
+		}
+	}
+	return values, nil
+}
+
+func mset(s *session, ctx context.Context, args []string) (interface{}, error) {
+	if len(args)%2 != 0 {
+		return nil, fmt.Errorf("%s: usage MSET key value [key value ...]", errUsage)
+	}
+
+	items := make(map[string]string, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		items[args[i]] = args[i+1]
+	}
+	return done(s.client.MSet(ctx, items, s.ttl))
+}
+
+func push(head bool) func(s *session, ctx context.Context, args []string) (interface{}, error) {
+	return func(s *session, ctx context.Context, args []string) (interface{}, error) {
+		for _, v := range args[1:] {
+			var err error
+			if head {
+				err = s.client.LPush(ctx, args[0], v)
+			} else {
+				err = s.client.RPush(ctx, args[0], v)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		return ok{}, nil
+	}
+}
+
+func pop(head bool) func(s *session, ctx context.Context, args []string) (interface{}, error) {
+	return func(s *session, ctx context.Context, args []string) (interface{}, error) {
+		if head {
+			return value(s.client.LPop(ctx, args[0]))
+		}
+		return value(s.client.RPop(ctx, args[0]))
+	}
+}
+
+func lrange(s *session, ctx context.Context, args []string) (interface{}, error) {
+	from, err := parseInt(args[1], "from")
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseInt(args[2], "to")
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := s.client.LRange(ctx, args[0], from, to)
+	if err == client.ErrKeyNotFound {
+		return []string{}, nil
+	}
+	return values, err
+}
+
+func hget(s *session, ctx context.Context, args []string) (interface{}, error) {
+	return value(s.client.HGet(ctx, args[0], args[1]))
+}
+
+func hset(s *session, ctx context.Context, args []string) (interface{}, error) {
+	return done(s.client.HSet(ctx, args[0], args[1], args[2]))
+}
+
+func dbsize(s *session, ctx context.Context, args []string) (interface{}, error) {
+	return s.client.DBSize(ctx)
+}
+
+func info(s *session, ctx context.Context, args []string) (interface{}, error) {
+	infos, err := s.client.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	t := table{header: []string{"shard", "field", "value"}}
+	for i, info := range infos {
+		fields := make([]string, 0, len(info))
+		for field := range info {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		for _, field := range fields {
+			t.rows = append(t.rows, []string{s.shard(i), field, info[field]})
+		}
+	}
+	return t, nil
+}
+
+func config(s *session, ctx context.Context, args []string) (interface{}, error) {
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		if len(args) != 2 {
+			break
+		}
+
+		settings, err := s.client.ConfigGet(ctx, args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		t := table{header: []string{"shard", "name", "value"}}
+		for i, shard := range settings {
+			names := make([]string, 0, len(shard))
+			for name := range shard {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			for _, name := range names {
+				t.rows = append(t.rows, []string{s.shard(i), name, shard[name]})
+			}
+		}
+		return t, nil
+
+	case "SET":
+		if len(args) != 3 {
+			break
+		}
+		return done(s.client.ConfigSet(ctx, args[1], args[2]))
+	}
+
+	return nil, fmt.Errorf("%s: usage CONFIG GET pattern | SET name value", errUsage)
+}
+
+func slowlog(s *session, ctx context.Context, args []string) (interface{}, error) {
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		count := 10
+		if len(args) > 1 {
+			var err error
+			if count, err = parseInt(args[1], "count"); err != nil {
+				return nil, err
+			}
+		}
+
+		entries, err := s.client.SlowlogGet(ctx, count)
+		if err != nil {
+			return nil, err
+		}
+
+		t := table{header: []string{"id", "time", "duration_us", "command", "keys", "client"}}
+		for _, e := range entries {
+			t.rows = append(t.rows, []string{
+				strconv.FormatInt(e.ID, 10),
+				strconv.FormatInt(e.Time, 10),
+				strconv.FormatInt(e.Duration, 10),
+				e.Command,
+				strings.Join(e.Keys, " "),
+				e.Client,
+			})
+		}
+		return t, nil
+
+	case "RESET":
+		if len(args) == 1 {
+			return done(s.client.SlowlogReset(ctx))
+		}
+	}
+
+	return nil, fmt.Errorf("%s: usage SLOWLOG GET [count] | RESET", errUsage)
+}
+
+func selectDB(s *session, ctx context.Context, args []string) (interface{}, error) {
+	return done(s.selectDatabase(args[0]))
+}
+
+func flushDB(s *session, ctx context.Context, args []string) (interface{}, error) {
+	return done(s.client.FlushDB(ctx))
+}
+
+func flushAll(s *session, ctx context.Context, args []string) (interface{}, error) {
+	return done(s.client.FlushAll(ctx))
+}
+
+func save(s *session, ctx context.Context, args []string) (interface{}, error) {
+	return done(s.client.Save(ctx))
+}
+
+func help(s *session, ctx context.Context, args []string) (interface{}, error) {
+	t := table{header: []string{"command", "arguments", "description"}}
+	for _, c := range commands {
+		if len(args) == 0 || strings.EqualFold(args[0], c.name) {
+			t.rows = append(t.rows, []string{c.name, c.args, c.help})
+		}
+	}
+
+	if len(t.rows) == 0 {
+		return nil, fmt.Errorf("Unknown command '%s'", args[0])
+	}
+	return t, nil
+}
+
+func parseInt(arg string, name string) (int, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid %s '%s'", name, arg)
+	}
+	return n, nil
+}
+
+// Split the line into arguments. Arguments are separated by spaces and may be quoted,
+// double quotes support the escapes \", \\, \n and \t
+func splitArgs(line string) ([]string, error) {
+	args := []string{}
+	var arg strings.Builder
+	inArg := false
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch {
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+
+		case r == '\'':
+			inArg = true
+			end := indexRune(runes, i+1, '\'')
+			if end < 0 {
+				return nil, errors.New("Unbalanced quotes")
+			}
+			arg.WriteString(string(runes[i+1 : end]))
+			i = end
+
+		case r == '"':
+			inArg = true
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+					switch runes[i] {
+					case 'n':
+						arg.WriteRune('\n')
+					case 't':
+						arg.WriteRune('\t')
+					default:
+						arg.WriteRune(runes[i])
+					}
+					continue
+				}
+				arg.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, errors.New("Unbalanced quotes")
+			}
+
+		default:
+			inArg = true
+			arg.WriteRune(r)
+		}
+	}
+
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+func indexRune(runes []rune, from int, r rune) int {
+	for i := from; i < len(runes); i++ {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"gcache/client"
+	"gcache/gcachetest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitArgs(t *testing.T) {
+
+	cases := []struct {
+		line string
+		args []string
+	}{
+		{"", []string{}},
+		{"   ", []string{}},
+		{"GET key", []string{"GET", "key"}},
+		{"  SET\tkey   value  ", []string{"SET", "key", "value"}},
+		{`SET key "a value"`, []string{"SET", "key", "a value"}},
+		{`SET key 'a "value"'`, []string{"SET", "key", `a "value"`}},
+		{`SET key "a\"b\\c\nd\te"`, []string{"SET", "key", "a\"b\\c\nd\te"}},
+		{`SET key 'a\nb'`, []string{"SET", "key", `a\nb`}},
+		{`SET key ""`, []string{"SET", "key", ""}},
+		{`SET key pre"fix"post`, []string{"SET", "key", "prefixpost"}},
+		{"SET ключ значение", []string{"SET", "ключ", "значение"}},
+	}
+
+	for _, c := range cases {
+		args, err := splitArgs(c.line)
+		if err != nil || !reflect.DeepEqual(args, c.args) {
+			t.Errorf("Expected %q to be split into %q but actual %q, err = %v", c.line, c.args, args, err)
+		}
+	}
+
+	for _, line := range []string{`SET key "value`, `SET key 'value`, `SET key "value\"`} {
+		if _, err := splitArgs(line); err == nil {
+			t.Errorf("Expected the unbalanced quotes of %q to fail", line)
+		}
+	}
+}
+
+func newSession(t *testing.T) *session {
+	srv := gcachetest.NewServer(t)
+
+	s := &session{ttl: 60, timeout: 5 * time.Second, format: formatRaw}
+	if err := s.connect(srv.URL, "", "", client.TLSConfig{}, false); err != nil {
+		t.Fatal("Failed to connect", err)
+	}
+	t.Cleanup(s.client.Close)
+
+	return s
+}
+
+func TestExecute_ArgumentCounts(t *testing.T) {
+
+	s := newSession(t)
+
+	cases := []struct {
+		args  []string
+		usage bool
+	}{
+		{[]string{"GET"}, true},
+		{[]string{"GET", "a", "b"}, true},
+		{[]string{"get", "a"}, false},
+		{[]string{"SET", "a"}, true},
+		{[]string{"SET", "a", "1", "60", "x"}, true},
+		{[]string{"SET", "a", "1"}, false},
+		{[]string{"SET", "a", "1", "60"}, false},
+		{[]string{"DEL"}, true},
+		{[]string{"DEL", "a", "b", "c"}, false},
+		{[]string{"KEYS", "a", "b"}, true},
+		{[]string{"KEYS"}, false},
+		{[]string{"MSET", "a"}, true},
+		{[]string{"MSET", "a", "1", "b"}, true},
+		{[]string{"MSET", "a", "1", "b", "2"}, false},
+		{[]string{"LRANGE", "list", "0"}, true},
+		{[]string{"DBSIZE", "x"}, true},
+		{[]string{"CONFIG", "GET"}, true},
+		{[]string{"CONFIG", "GET", "a", "b"}, true},
+		{[]string{"CONFIG", "SET", "maxmemory"}, true},
+		{[]string{"SLOWLOG"}, true},
+		{[]string{"SLOWLOG", "RESET", "1"}, true},
+		{[]string{"SLOWLOG", "RESET"}, false},
+		{[]string{"HELP", "GET", "SET"}, true},
+		{[]string{"HELP", "get"}, false},
+	}
+
+	for _, c := range cases {
+		_, err := s.execute(c.args)
+		usage := err != nil && strings.HasPrefix(err.Error(), errUsage.Error())
+		if usage != c.usage {
+			t.Errorf("%q: expected the usage error %v but actual %v", c.args, c.usage, err)
+		}
+	}
+
+	if _, err := s.execute([]string{"NOSUCH"}); err == nil || !strings.Contains(err.Error(), "Unknown command") {
+		t.Error("Expected an unknown command but actual", err)
+	}
+}
+
+func TestExecute_Keys(t *testing.T) {
+
+	s := newSession(t)
+
+	ctx := context.Background()
+	for _, key := range []string{"user:1", "user:2", "user/admin/1", "session:1", "a*b"} {
+		if err := s.client.Set(ctx, key, "value", 60); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Patterns are globs of Redis, * matches / as well
+	cases := map[string][]string{
+		"*":         {"a*b", "session:1", "user/admin/1", "user:1", "user:2"},
+		"user*":     {"user/admin/1", "user:1", "user:2"},
+		"user/*":    {"user/admin/1"},
+		"*/1":       {"user/admin/1"},
+		"user:?":    {"user:1", "user:2"},
+		"user:[^1]": {"user:2"},
+		"a\\*b":     {"a*b"},
+		"[unclosed": {},
+		"nosuch:*":  {},
+	}
+
+	for pattern, expected := range cases {
+		reply, err := s.execute([]string{"KEYS", pattern})
+		if err != nil || !reflect.DeepEqual(reply, expected) {
+			t.Errorf("Expected %q to match %q but actual %q, err = %v", pattern, expected, reply, err)
+		}
+	}
+
+	if reply, err := s.execute([]string{"KEYS"}); err != nil || len(reply.([]string)) != 5 {
+		t.Errorf("Expected every key but actual %q, err = %v", reply, err)
+	}
+}
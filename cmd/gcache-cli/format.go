@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Writer of the replies in one of the output formats
+type formatter func(w io.Writer, reply interface{}) error
+
+var formatters = map[string]formatter{
+	"raw":  formatRaw,
+	"csv":  formatCSV,
+	"json": formatJSON,
+}
+
+// Values as they are one per line, missing ones as (nil), and table rows separated by tabs
+func formatRaw(w io.Writer, reply interface{}) error {
+	var err error
+
+	switch r := reply.(type) {
+	case nil:
+		_, err = fmt.Fprintln(w, "(nil)")
+	case ok:
+		_, err = fmt.Fprintln(w, "OK")
+	case string:
+		_, err = fmt.Fprintln(w, r)
+	case int:
+		_, err = fmt.Fprintln(w, r)
+	case []string:
+		for _, v := range r {
+			if _, err = fmt.Fprintln(w, v); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, v := range r {
+			if err = formatRaw(w, v); err != nil {
+				return err
+			}
+		}
+	case table:
+		for _, row := range r.rows {
+			if _, err = fmt.Fprintln(w, strings.Join(row, "\t")); err != nil {
+				return err
+			}
+		}
+	}
+
+	return err
+}
+
+// Values one per record, missing ones as empty fields, and tables with their header
+func formatCSV(w io.Writer, reply interface{}) error {
+	writer := csv.NewWriter(w)
+
+	switch r := reply.(type) {
+	case nil:
+		writer.Write([]string{""})
+	case ok:
+		writer.Write([]string{"OK"})
+	case string:
+		writer.Write([]string{r})
+	case int:
+		writer.Write([]string{strconv.Itoa(r)})
+	case []string:
+		for _, v := range r {
+			writer.Write([]string{v})
+		}
+	case []interface{}:
+		for _, v := range r {
+			s, _ := v.(string)
+			writer.Write([]string{s})
+		}
+	case table:
+		writer.Write(r.header)
+		writer.WriteAll(r.rows)
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// Replies as json, missing values as null and tables as arrays of objects by the header
+func formatJSON(w io.Writer, reply interface{}) error {
+	switch r := reply.(type) {
+	case ok:
+		reply = map[string]bool{"ok": true}
+	case table:
+		objects := make([]map[string]string, len(r.rows))
+		for i, row := range r.rows {
+			objects[i] = make(map[string]string, len(r.header))
+			for j, name := range r.header {
+				objects[i][name] = row[j]
+			}
+		}
+		reply = objects
+	}
+
+	line, err := json.Marshal(reply)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFormatters(t *testing.T) {
+
+	info := table{header: []string{"shard", "field"}, rows: [][]string{{"a", "1"}, {"b", "x,y"}}}
+
+	cases := []struct {
+		reply interface{}
+		raw   string
+		csv   string
+		json  string
+	}{
+		{nil, "(nil)\n", "\n", "null\n"},
+		{ok{}, "OK\n", "OK\n", `{"ok":true}` + "\n"},
+		{"a value", "a value\n", "a value\n", `"a value"` + "\n"},
+		{"a,\"b\"", "a,\"b\"\n", `"a,""b"""` + "\n", `"a,\"b\""` + "\n"},
+		{3, "3\n", "3\n", "3\n"},
+		{[]string{"a", "b"}, "a\nb\n", "a\nb\n", `["a","b"]` + "\n"},
+		{[]string{}, "", "", "[]\n"},
+		{[]interface{}{"a", nil}, "a\n(nil)\n", "a\n\n", `["a",null]` + "\n"},
+		{info, "a\t1\nb\tx,y\n", "shard,field\na,1\nb,\"x,y\"\n", `[{"field":"1","shard":"a"},{"field":"x,y","shard":"b"}]` + "\n"},
+	}
+
+	for _, c := range cases {
+		for name, expected := range map[string]string{"raw": c.raw, "csv": c.csv, "json": c.json} {
+			output := &bytes.Buffer{}
+			if err := formatters[name](output, c.reply); err != nil {
+				t.Fatal(err)
+			}
+
+			if output.String() != expected {
+				t.Errorf("Expected %#v formatted as %s to be %q but actual %q", c.reply, name, expected, output.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"gcache/client"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Connections and output of the commands run
+type session struct {
+	client *client.Client
+	// Connections of the shards without a database, nil if the shards come from a seed
+	conns   client.Connections
+	addrs   []string
+	db      string
+	ttl     int
+	timeout time.Duration
+	format  formatter
+}
+
+func main() {
+
+	addr := flag.String("addr", "http://localhost:8080", "comma separated addresses of the servers, keys are sharded between them")
+	seed := flag.String("seed", "", "address of a cluster node, the alive members of the cluster are the shards")
+	user := flag.String("user", "", "user of the server ACL")
+	psw := flag.String("psw", "", "authentication password, or the password of the user")
+	db := flag.String("db", "", "database of the servers, the default one if empty")
+	tlsCA := flag.String("tls-ca", "", "PEM file of the CAs verifying the server certificates, enables TLS")
+	tlsCert := flag.String("tls-cert", "", "PEM file of the client certificate, enables TLS")
+	tlsKey := flag.String("tls-key", "", "PEM file of the client certificate key")
+	tlsServerName := flag.String("tls-server-name", "", "name the server certificates are verified against")
+	format := flag.String("format", "raw", "output format, raw, csv or json")
+	ttl := flag.Int("ttl", 3600, "ttl in seconds of SET and MSET without one")
+	timeout := flag.Duration("timeout", 5*time.Second, "timeout of a command")
+	history := flag.String("history", defaultHistoryFile(), "file of the history of the interactive mode, empty disables it")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [command [args ...]]\n\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "Runs the command and exits, runs the commands of the lines of stdin if it is not a terminal, "+
+			"and runs an interactive shell otherwise.")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	formatter, ok := formatters[*format]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown format '%s'\n", *format)
+		os.Exit(2)
+	}
+
+	authorization := *psw
+	if *user != "" {
+		authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(*user+":"+*psw))
+	}
+
+	s := &session{db: *db, ttl: *ttl, timeout: *timeout, format: formatter}
+
+	tlsConfig := client.TLSConfig{CAFile: *tlsCA, CertFile: *tlsCert, KeyFile: *tlsKey, ServerName: *tlsServerName}
+	useTLS := *tlsCA != "" || *tlsCert != "" || *tlsServerName != ""
+
+	if err := s.connect(*addr, *seed, authorization, tlsConfig, useTLS); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to connect:", err)
+		os.Exit(1)
+	}
+
+	var code int
+	switch {
+	case flag.NArg() > 0:
+		code = s.runOnce(flag.Args())
+	case !isTerminal():
+		code = s.runScript(os.Stdin)
+	default:
+		code = s.runShell(*history)
+	}
+
+	s.client.Close()
+	os.Exit(code)
+}
+
+// Connect to the shards of the addresses, or to the members of the cluster of the seed.
+// The members are reached with the TLS settings and the database of the seed
+func (s *session) connect(addrs string, seed string, authorization string, tlsConfig client.TLSConfig, useTLS bool) error {
+	connection := func(addr string) (client.Connection, error) {
+		if useTLS {
+			return client.NewTLSConnection(addr, authorization, tlsConfig)
+		}
+		return client.NewConnection(addr, authorization), nil
+	}
+
+	if seed != "" {
+		conn, err := connection(strings.TrimRight(seed, "/"))
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+		defer cancel()
+
+		c, err := client.NewClientFromSeedConnection(ctx, conn.WithDatabase(s.db))
+		if err != nil {
+			return err
+		}
+
+		s.client = c
+		for _, stats := range c.PoolStats() {
+			s.addrs = append(s.addrs, stats.Addr)
+		}
+		return nil
+	}
+
+	for _, addr := range strings.Split(addrs, ",") {
+		addr = strings.TrimRight(strings.TrimSpace(addr), "/")
+
+		conn, err := connection(addr)
+		if err != nil {
+			return err
+		}
+
+		s.conns = append(s.conns, conn)
+		s.addrs = append(s.addrs, addr)
+	}
+
+	return s.selectDatabase(s.db)
+}
+
+// Use the database of the shards, the client is created again
+func (s *session) selectDatabase(db string) error {
+	if s.conns == nil {
+		return errors.New("SELECT is not supported with -seed")
+	}
+
+	conns := make(client.Connections, len(s.conns))
+	for i, conn := range s.conns {
+		conns[i] = conn.WithDatabase(db)
+	}
+
+	if s.client != nil {
+		s.client.Close()
+	}
+
+	s.client = client.NewClient(conns)
+	s.db = db
+	return nil
+}
+
+// Name of the shard in replies of every shard
+func (s *session) shard(i int) string {
+	if i < len(s.addrs) {
+		return s.addrs[i]
+	}
+	return fmt.Sprint(i)
+}
+
+// Run the command and write its reply, errors are written to stderr. Return whether it succeeded
+func (s *session) run(args []string) bool {
+	reply, err := s.execute(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "(error)", err)
+		return false
+	}
+
+	if err := s.format(os.Stdout, reply); err != nil {
+		fmt.Fprintln(os.Stderr, "(error)", err)
+		return false
+	}
+	return true
+}
+
+// Run the command of the arguments, exit with 1 if it fails
+func (s *session) runOnce(args []string) int {
+	if !s.run(args) {
+		return 1
+	}
+	return 0
+}
+
+// Run the commands of the lines, empty lines and lines starting with # are skipped.
+// Every command is run, exit with 1 if any of them fails
+func (s *session) runScript(r io.Reader) int {
+	code := 0
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		args, err := splitArgs(line)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "(error)", err)
+			code = 1
+			continue
+		}
+
+		if !s.run(args) {
+			code = 1
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, "(error)", err)
+		return 1
+	}
+
+	return code
+}
+
+// Run the commands typed until QUIT, EXIT or Ctrl+D
+func (s *session) runShell(historyFile string) int {
+	editor := newLineEditor(historyFile)
+
+	for {
+		line, err := editor.readLine(s.prompt())
+		if err == errInterrupted {
+			continue
+		}
+		if err == io.EOF {
+			return 0
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "(error)", err)
+			return 1
+		}
+
+		editor.remember(line)
+
+		args, err := splitArgs(line)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "(error)", err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		if name := strings.ToUpper(args[0]); name == "QUIT" || name == "EXIT" {
+			return 0
+		}
+
+		s.run(args)
+	}
+}
+
+func (s *session) prompt() string {
+	prompt := s.addrs[0]
+	if len(s.addrs) > 1 {
+		prompt += fmt.Sprintf(" (+%d)", len(s.addrs)-1)
+	}
+	if s.db != "" {
+		prompt += "[" + s.db + "]"
+	}
+	return prompt + "> "
+}
+
+func defaultHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".gcache_cli_history")
+}
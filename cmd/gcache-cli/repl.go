@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Entries of the history kept in memory and in the history file
+const maxHistory = 1000
+
+var errInterrupted = errors.New("Interrupted")
+
+// Line editor of the terminal with history and completion of the commands
+type lineEditor struct {
+	in      *bufio.Reader
+	out     io.Writer
+	history []string
+	file    string
+}
+
+func newLineEditor(historyFile string) *lineEditor {
+	e := &lineEditor{in: bufio.NewReader(os.Stdin), out: os.Stdout, file: historyFile}
+
+	if historyFile != "" {
+		if content, err := ioutil.ReadFile(historyFile); err == nil {
+			for _, line := range strings.Split(string(content), "\n") {
+				if line != "" {
+					e.history = append(e.history, line)
+				}
+			}
+		}
+	}
+
+	return e
+}
+
+// Whether stdin is a terminal
+func isTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Put the terminal into raw mode by stty, return the function restoring it
+func rawMode() (func(), error) {
+	state, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, err
+	}
+
+	return func() { stty(strings.TrimSpace(state)) }, nil
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+// Add the line to the history, repeated lines are added once
+func (e *lineEditor) remember(line string) {
+	if strings.TrimSpace(line) == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+
+	if e.file != "" {
+		ioutil.WriteFile(e.file, []byte(strings.Join(e.history, "\n")+"\n"), 0600)
+	}
+}
+
+// Read a line. Return io.EOF on Ctrl+D of an empty line and errInterrupted on Ctrl+C.
+// Falls back to reading plain lines if the terminal can't be put into raw mode
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	restore, err := rawMode()
+	if err != nil {
+		fmt.Fprint(e.out, prompt)
+		line, err := e.in.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		return strings.TrimRight(line, "\r\n"), err
+	}
+	defer restore()
+
+	line := []rune{}
+	cursor := 0
+	// Position in the history, len(history) is the line being edited
+	entry := len(e.history)
+	edited := ""
+
+	redraw := func() {
+		fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(line))
+		if back := len(line) - cursor; back > 0 {
+			fmt.Fprintf(e.out, "\x1b[%dD", back)
+		}
+	}
+
+	recall := func(i int) {
+		if entry == len(e.history) {
+			edited = string(line)
+		}
+		entry = i
+		if entry == len(e.history) {
+			line = []rune(edited)
+		} else {
+			line = []rune(e.history[entry])
+		}
+		cursor = len(line)
+	}
+
+	redraw()
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(line), nil
+
+		case 3: // Ctrl+C
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupted
+
+		case 4: // Ctrl+D
+			if len(line) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if cursor < len(line) {
+				line = append(line[:cursor], line[cursor+1:]...)
+			}
+
+		case 127, 8: // Backspace
+			if cursor > 0 {
+				line = append(line[:cursor-1], line[cursor:]...)
+				cursor--
+			}
+
+		case 1: // Ctrl+A
+			cursor = 0
+
+		case 5: // Ctrl+E
+			cursor = len(line)
+
+		case 21: // Ctrl+U
+			line = line[:0]
+			cursor = 0
+
+		case '\t':
+			line, cursor = e.complete(prompt, line, cursor)
+
+		case 27: // Escape sequences of the arrows, home, end and delete
+			if next, _, _ := e.in.ReadRune(); next != '[' && next != 'O' {
+				continue
+			}
+
+			key, _, _ := e.in.ReadRune()
+			switch key {
+			case 'A':
+				if entry > 0 {
+					recall(entry - 1)
+				}
+			case 'B':
+				if entry < len(e.history) {
+					recall(entry + 1)
+				}
+			case 'C':
+				if cursor < len(line) {
+					cursor++
+				}
+			case 'D':
+				if cursor > 0 {
+					cursor--
+				}
+			case 'H':
+				cursor = 0
+			case 'F':
+				cursor = len(line)
+			case '3':
+				if tilde, _, _ := e.in.ReadRune(); tilde == '~' && cursor < len(line) {
+					line = append(line[:cursor], line[cursor+1:]...)
+				}
+			}
+
+		default:
+			if unicode.IsPrint(r) {
+				line = append(line[:cursor], append([]rune{r}, line[cursor:]...)...)
+				cursor++
+			}
+		}
+
+		redraw()
+	}
+}
+
+// Complete the command or the subcommand before the cursor. A single candidate is completed,
+// several ones are completed up to their common prefix and listed if there is nothing to complete
+func (e *lineEditor) complete(prompt string, line []rune, cursor int) ([]rune, int) {
+	before := string(line[:cursor])
+	words := strings.Fields(before)
+	if strings.HasSuffix(before, " ") || len(words) == 0 {
+		words = append(words, "")
+	}
+
+	var options []string
+	switch len(words) {
+	case 1:
+		for _, c := range commands {
+			options = append(options, c.name)
+		}
+	case 2:
+		options = subcommands[strings.ToUpper(words[0])]
+	}
+
+	word := words[len(words)-1]
+	candidates := []string{}
+	for _, option := range options {
+		if strings.HasPrefix(option, strings.ToUpper(word)) {
+			candidates = append(candidates, option)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return line, cursor
+	}
+
+	completion := candidates[0]
+	if len(candidates) == 1 {
+		completion += " "
+	} else {
+		completion = commonPrefix(candidates)
+	}
+
+	if len(completion) <= len(word) {
+		sort.Strings(candidates)
+		fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+		return line, cursor
+	}
+
+	insert := []rune(completion[len(word):])
+	if strings.ToLower(word) == word {
+		insert = []rune(strings.ToLower(string(insert)))
+	}
+
+	line = append(line[:cursor], append(insert, line[cursor:]...)...)
+	return line, cursor + len(insert)
+}
+
+func commonPrefix(values []string) string {
+	prefix := values[0]
+	for _, v := range values[1:] {
+		for !strings.HasPrefix(v, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLineEditor_Complete(t *testing.T) {
+
+	cases := []struct {
+		line      string
+		cursor    int
+		completed string
+		listed    string
+	}{
+		// A single candidate is completed with the case of the word
+		{"g", 1, "get ", ""},
+		{"GE", 2, "GET ", ""},
+		{"config g", 8, "config get ", ""},
+		{"SLOWLOG R", 9, "SLOWLOG RESET ", ""},
+		// Before the cursor only
+		{"g key", 1, "get  key", ""},
+		// Several candidates are completed up to their common prefix, or listed
+		{"FL", 2, "FLUSH", ""},
+		{"S", 1, "S", "SAVE  SELECT  SET  SLOWLOG"},
+		{"config ", 7, "config ", "GET  SET"},
+		// Nothing to complete
+		{"x", 1, "x", ""},
+		{"GET k", 5, "GET k", ""},
+		{"GET key a", 9, "GET key a", ""},
+	}
+
+	for _, c := range cases {
+		output := &bytes.Buffer{}
+		e := &lineEditor{out: output}
+
+		line, cursor := e.complete("> ", []rune(c.line), c.cursor)
+
+		expectedCursor := c.cursor + len(c.completed) - len(c.line)
+		if string(line) != c.completed || cursor != expectedCursor {
+			t.Errorf("Expected %q to be completed to %q at %d but actual %q at %d", c.line, c.completed, expectedCursor, string(line), cursor)
+		}
+
+		if listed := string(bytes.TrimSpace(output.Bytes())); listed != c.listed {
+			t.Errorf("Expected %q to list %q but actual %q", c.line, c.listed, listed)
+		}
+	}
+}
+
+func TestCommonPrefix(t *testing.T) {
+
+	cases := []struct {
+		values []string
+		prefix string
+	}{
+		{[]string{"GET"}, "GET"},
+		{[]string{"FLUSHDB", "FLUSHALL"}, "FLUSH"},
+		{[]string{"SET", "SELECT", "SAVE"}, "S"},
+		{[]string{"GET", "SET"}, ""},
+		{[]string{"HGET", "HGET"}, "HGET"},
+		{[]string{"HSET", "H"}, "H"},
+	}
+
+	for _, c := range cases {
+		if prefix := commonPrefix(c.values); prefix != c.prefix {
+			t.Errorf("Expected the common prefix of %q to be %q but actual %q", c.values, c.prefix, prefix)
+		}
+	}
+}
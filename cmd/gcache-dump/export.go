@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"gcache/client"
+	"gcache/protocol"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func runExport(args []string) int {
+
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	t := &target{}
+	t.register(flags)
+	output := flags.String("o", "-", "dump file, - is stdout. It's compressed with gzip if the name ends with .gz")
+	match := flags.String("match", "", "glob pattern of the keys to export in the style of Redis, e.g. user:*, every key if empty")
+	count := flags.Int("count", 1000, "number of keys scanned at a time")
+
+	flags.Parse(args)
+
+	if *count <= 0 {
+		fmt.Fprintln(os.Stderr, "Invalid -count")
+		return 2
+	}
+
+	c, err := t.connect()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to connect:", err)
+		return 2
+	}
+	defer c.Close()
+
+	w, err := createFile(*output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to create the dump file:", err)
+		return 1
+	}
+
+	ctx, stop := interruptible()
+	defer stop()
+
+	start := time.Now()
+	exported, gone, err := export(ctx, c, w, *match, *count, t.concurrency)
+
+	if closeErr := w.close(); err == nil {
+		err = closeErr
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d keys in %s, %d keys expired or were deleted meanwhile\n",
+		exported, time.Since(start).Round(time.Millisecond), gone)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to export:", err)
+		return 1
+	}
+	return 0
+}
+
+// Scan the keys matching the pattern, dump them concurrently and write them to the file.
+// Return the number of keys exported and of keys gone between the scan and the dump
+func export(ctx context.Context, c *client.Client, w *fileWriter, match string, count int, concurrency int) (int64, int64, error) {
+	var exported, gone int64
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The first error stops the export
+	errs := make(chan error, 1)
+	fail := func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+		cancel()
+	}
+
+	keys := make(chan string, count)
+	go func() {
+		defer close(keys)
+
+		cursor := ""
+		for {
+			page, next, err := c.Scan(ctx, cursor, count)
+			if err != nil {
+				fail(fmt.Errorf("Failed to scan: %w", err))
+				return
+			}
+
+			for _, key := range page {
+				if match != "" && !protocol.MatchGlob(match, key) {
+					continue
+				}
+
+				select {
+				case keys <- key:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			if cursor = next; cursor == "" {
+				return
+			}
+		}
+	}()
+
+	entries := make(chan entry, concurrency)
+	wg := sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for key := range keys {
+				dump, err := c.Dump(ctx, key)
+				if err == client.ErrKeyNotFound {
+					atomic.AddInt64(&gone, 1)
+					continue
+				}
+				if err != nil {
+					fail(fmt.Errorf("Failed to dump '%s': %w", key, err))
+					return
+				}
+
+				select {
+				case entries <- entry{Key: key, Dump: dump}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(entries)
+	}()
+
+	for e := range entries {
+		if err := w.write(e); err != nil {
+			fail(err)
+			break
+		}
+		exported++
+	}
+
+	select {
+	case err := <-errs:
+		return exported, gone, err
+	default:
+	}
+	return exported, gone, ctx.Err()
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"gcache/client"
+	"gcache/gcachetest"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+
+	ctx := context.Background()
+
+	source := gcachetest.NewServer(t)
+	sourceClient := client.NewClient(client.Connections{source.Connection()})
+	defer sourceClient.Close()
+
+	const keys = 50
+	for i := 0; i < keys; i++ {
+		if err := sourceClient.Set(ctx, fmt.Sprintf("key:%d", i), fmt.Sprintf("value\x00%d", i), 3600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sourceClient.LPush(ctx, "list", "a")
+	sourceClient.LPush(ctx, "list", "b")
+	sourceClient.HSet(ctx, "hash", "field", "value")
+
+	path := filepath.Join(t.TempDir(), "keys.dump.gz")
+
+	w, err := createFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Pages of the scan are smaller than the key space
+	exported, gone, err := export(ctx, sourceClient, w, "", 7, 4)
+	if err != nil {
+		t.Fatal("Failed to export", err)
+	}
+	if err := w.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if exported != keys+2 || gone != 0 {
+		t.Errorf("Expected %d keys exported but actual %d, %d gone", keys+2, exported, gone)
+	}
+
+	// Keys are restored on their shards of the target
+	targets := gcachetest.NewServers(t, 2, "")
+	targetClient := client.NewClient(targets.Connections())
+	defer targetClient.Close()
+
+	importFile := func(replace bool) (int64, int64) {
+		r, err := openFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.close()
+
+		restored, existing, err := restore(ctx, targetClient, r, 0, replace, 4)
+		if err != nil {
+			t.Fatal("Failed to import", err)
+		}
+		return restored, existing
+	}
+
+	if restored, existing := importFile(false); restored != keys+2 || existing != 0 {
+		t.Errorf("Expected %d keys restored but actual %d, %d existing", keys+2, restored, existing)
+	}
+
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("key:%d", i)
+		if value, err := targetClient.Get(ctx, key); err != nil || value != fmt.Sprintf("value\x00%d", i) {
+			t.Errorf("Expected the value of %s but actual %q, err = %v", key, value, err)
+		}
+	}
+
+	if ttl, err := targetClient.Ttl(ctx, "key:0"); err != nil || ttl <= 0 {
+		t.Errorf("Expected the ttl to be kept but actual %d, err = %v", ttl, err)
+	}
+
+	// Lists keep their order
+	list, _ := sourceClient.LRange(ctx, "list", 0, 10)
+	if values, err := targetClient.LRange(ctx, "list", 0, 10); err != nil || !reflect.DeepEqual(values, list) {
+		t.Errorf("Expected the list %v but actual %v, err = %v", list, values, err)
+	}
+
+	if value, err := targetClient.HGet(ctx, "hash", "field"); err != nil || value != "value" {
+		t.Errorf("Expected the hash value but actual %q, err = %v", value, err)
+	}
+
+	total := 0
+	for _, target := range targets {
+		n := len(target.Cache().Keys())
+		if n == 0 {
+			t.Error("Expected keys on every shard of the target")
+		}
+		total += n
+	}
+	if total != keys+2 {
+		t.Errorf("Expected %d keys on the shards but actual %d", keys+2, total)
+	}
+
+	// Existing keys are skipped unless replaced
+	if restored, existing := importFile(false); restored != 0 || existing != keys+2 {
+		t.Errorf("Expected the existing keys to be skipped but actual %d restored, %d existing", restored, existing)
+	}
+
+	if restored, existing := importFile(true); restored != keys+2 || existing != 0 {
+		t.Errorf("Expected the keys to be replaced but actual %d restored, %d existing", restored, existing)
+	}
+}
+
+func TestExport_Match(t *testing.T) {
+
+	ctx := context.Background()
+
+	source := gcachetest.NewServer(t)
+	c := client.NewClient(client.Connections{source.Connection()})
+	defer c.Close()
+
+	c.Set(ctx, "user:1", "a", 60)
+	c.Set(ctx, "user:2", "b", 60)
+	c.Set(ctx, "session:1", "c", 60)
+	c.Set(ctx, "user/admin/1", "d", 60)
+
+	path := filepath.Join(t.TempDir(), "users.dump")
+
+	w, err := createFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Patterns are globs of Redis, * matches / as well
+	exported, _, err := export(ctx, c, w, "user*", 100, 2)
+	w.close()
+
+	if err != nil || exported != 3 {
+		t.Fatalf("Expected 3 keys exported but actual %d, err = %v", exported, err)
+	}
+
+	r, err := openFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.close()
+
+	keys := map[string]bool{}
+	for {
+		e, err := r.read()
+		if err != nil {
+			break
+		}
+		keys[e.Key] = true
+	}
+
+	if len(keys) != 3 || !keys["user:1"] || !keys["user:2"] || !keys["user/admin/1"] {
+		t.Errorf("Expected the keys of the users but actual %v", keys)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Dump files are json lines, a header and then an entry per key.
+// Dumps are opaque to the tool, they are restored by the servers as they were dumped
+const (
+	fileFormat  = "gcache-dump"
+	fileVersion = 1
+)
+
+type header struct {
+	Format  string    `json:"format"`
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+}
+
+type entry struct {
+	Key  string `json:"key"`
+	Dump []byte `json:"dump"`
+}
+
+var errBadHeader = errors.New("Not a gcache dump file or an unsupported version")
+
+// Writer of a dump file, compressed if its name ends with .gz
+type fileWriter struct {
+	file    *os.File
+	gzip    *gzip.Writer
+	buffer  *bufio.Writer
+	encoder *json.Encoder
+}
+
+// Create the dump file and write its header, - is stdout
+func createFile(name string) (*fileWriter, error) {
+	w := &fileWriter{file: os.Stdout}
+
+	if name != "-" {
+		var err error
+		if w.file, err = os.Create(name); err != nil {
+			return nil, err
+		}
+	}
+
+	var out io.Writer = w.file
+	if strings.HasSuffix(name, ".gz") {
+		w.gzip = gzip.NewWriter(out)
+		out = w.gzip
+	}
+
+	w.buffer = bufio.NewWriter(out)
+	w.encoder = json.NewEncoder(w.buffer)
+
+	if err := w.encoder.Encode(header{Format: fileFormat, Version: fileVersion, Created: time.Now().UTC()}); err != nil {
+		w.file.Close()
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *fileWriter) write(e entry) error {
+	return w.encoder.Encode(e)
+}
+
+// Flush the entries and close the file
+func (w *fileWriter) close() error {
+	err := w.buffer.Flush()
+
+	if w.gzip != nil {
+		if gzipErr := w.gzip.Close(); err == nil {
+			err = gzipErr
+		}
+	}
+
+	if w.file != os.Stdout {
+		if closeErr := w.file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+// Reader of a dump file, decompressed if its name ends with .gz
+type fileReader struct {
+	file    *os.File
+	decoder *json.Decoder
+	header  header
+}
+
+// Open the dump file and check its header, - is stdin
+func openFile(name string) (*fileReader, error) {
+	r := &fileReader{file: os.Stdin}
+
+	if name != "-" {
+		var err error
+		if r.file, err = os.Open(name); err != nil {
+			return nil, err
+		}
+	}
+
+	var in io.Reader = bufio.NewReader(r.file)
+	if strings.HasSuffix(name, ".gz") {
+		gz, err := gzip.NewReader(in)
+		if err != nil {
+			r.close()
+			return nil, err
+		}
+		in = gz
+	}
+
+	r.decoder = json.NewDecoder(in)
+
+	if err := r.decoder.Decode(&r.header); err != nil || r.header.Format != fileFormat || r.header.Version != fileVersion {
+		r.close()
+		return nil, errBadHeader
+	}
+
+	return r, nil
+}
+
+// Read the next entry, io.EOF at the end of the file
+func (r *fileReader) read() (entry, error) {
+	e := entry{}
+	if err := r.decoder.Decode(&e); err != nil {
+		if err != io.EOF {
+			err = fmt.Errorf("Invalid entry: %w", err)
+		}
+		return e, err
+	}
+
+	if e.Key == "" || len(e.Dump) == 0 {
+		return e, errors.New("Invalid entry: the key or the dump is missing")
+	}
+	return e, nil
+}
+
+func (r *fileReader) close() {
+	if r.file != os.Stdin {
+		r.file.Close()
+	}
+}
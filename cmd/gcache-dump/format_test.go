@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFile_WriteRead(t *testing.T) {
+
+	for _, name := range []string{"keys.dump", "keys.dump.gz"} {
+		path := filepath.Join(t.TempDir(), name)
+
+		w, err := createFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entries := []entry{{Key: "a", Dump: []byte{0, 1, 2}}, {Key: "b b", Dump: []byte("dump")}}
+		for _, e := range entries {
+			if err := w.write(e); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Only names ending with .gz are compressed
+		content, _ := ioutil.ReadFile(path)
+		if compressed := bytes.HasPrefix(content, []byte{0x1f, 0x8b}); compressed != strings.HasSuffix(name, ".gz") {
+			t.Errorf("%s: unexpected compression %v", name, compressed)
+		}
+
+		r, err := openFile(path)
+		if err != nil {
+			t.Fatalf("%s: failed to open %v", name, err)
+		}
+
+		if r.header.Format != fileFormat || r.header.Version != fileVersion || r.header.Created.IsZero() {
+			t.Errorf("%s: unexpected header %+v", name, r.header)
+		}
+
+		for _, expected := range entries {
+			e, err := r.read()
+			if err != nil || e.Key != expected.Key || !bytes.Equal(e.Dump, expected.Dump) {
+				t.Errorf("%s: expected the entry %+v but actual %+v, err = %v", name, expected, e, err)
+			}
+		}
+
+		if _, err := r.read(); err != io.EOF {
+			t.Errorf("%s: expected the end of the file but actual %v", name, err)
+		}
+		r.close()
+	}
+}
+
+func writeDumpFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFile_BadHeader(t *testing.T) {
+
+	cases := []struct {
+		name    string
+		content string
+	}{
+		{"empty.dump", ""},
+		{"text.dump", "not json\n"},
+		{"format.dump", `{"format":"other","version":1}` + "\n"},
+		{"version.dump", `{"format":"gcache-dump","version":2}` + "\n"},
+		{"entry.dump", `{"key":"a","dump":"AAE="}` + "\n"},
+		// Not compressed
+		{"plain.dump.gz", `{"format":"gcache-dump","version":1}` + "\n"},
+	}
+
+	for _, c := range cases {
+		if _, err := openFile(writeDumpFile(t, c.name, c.content)); err == nil {
+			t.Errorf("%s: expected the file to be rejected", c.name)
+		}
+	}
+
+	if _, err := openFile(filepath.Join(t.TempDir(), "missing.dump")); err == nil {
+		t.Error("Expected a missing file to fail")
+	}
+
+	// Compressed files are opened by their name only
+	compressed := &bytes.Buffer{}
+	gz := gzip.NewWriter(compressed)
+	gz.Write([]byte(`{"format":"gcache-dump","version":1}` + "\n"))
+	gz.Close()
+
+	if _, err := openFile(writeDumpFile(t, "compressed.dump", compressed.String())); err != errBadHeader {
+		t.Error("Expected a compressed file of another name to be rejected but actual", err)
+	}
+
+	r, err := openFile(writeDumpFile(t, "compressed.dump.gz", compressed.String()))
+	if err != nil {
+		t.Fatal("Failed to open the compressed file", err)
+	}
+	r.close()
+}
+
+func TestFile_InvalidEntries(t *testing.T) {
+
+	const header = `{"format":"gcache-dump","version":1,"created":"2024-01-02T03:04:05Z"}` + "\n"
+
+	for _, content := range []string{
+		`{"key":"","dump":"AAE="}`,
+		`{"key":"a"}`,
+		`{"key":"a","dump":""}`,
+		`{"key":"a","dump":"not base64"}`,
+		`{"key":"a","dump":"AAE="`,
+		`["a"]`,
+	} {
+		r, err := openFile(writeDumpFile(t, "keys.dump", header+content+"\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := r.read(); err == nil || err == io.EOF || !strings.HasPrefix(err.Error(), "Invalid entry") {
+			t.Errorf("Expected %s to be an invalid entry but actual %v", content, err)
+		}
+		r.close()
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"gcache/client"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func runImport(args []string) int {
+
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	t := &target{}
+	t.register(flags)
+	input := flags.String("i", "-", "dump file, - is stdin. It's decompressed with gzip if the name ends with .gz")
+	replace := flags.Bool("replace", false, "replace existing keys, they are skipped otherwise")
+	ttl := flags.Int("ttl", 0, "ttl in seconds of the restored keys, 0 keeps the ttl remaining at the export")
+
+	flags.Parse(args)
+
+	if *ttl < 0 {
+		fmt.Fprintln(os.Stderr, "Invalid -ttl")
+		return 2
+	}
+
+	c, err := t.connect()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to connect:", err)
+		return 2
+	}
+	defer c.Close()
+
+	r, err := openFile(*input)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to open the dump file:", err)
+		return 1
+	}
+	defer r.close()
+
+	ctx, stop := interruptible()
+	defer stop()
+
+	start := time.Now()
+	restored, existing, err := restore(ctx, c, r, *ttl, *replace, t.concurrency)
+
+	fmt.Fprintf(os.Stderr, "Restored %d keys of the dump of %s in %s, %d existing keys were skipped\n",
+		restored, r.header.Created.Format(time.RFC3339), time.Since(start).Round(time.Millisecond), existing)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to import:", err)
+		return 1
+	}
+	return 0
+}
+
+// Restore the keys of the file concurrently, every key on its shard of the client.
+// Return the number of keys restored and of existing keys skipped
+func restore(ctx context.Context, c *client.Client, r *fileReader, ttl int, replace bool, concurrency int) (int64, int64, error) {
+	var restored, existing int64
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The first error stops the import
+	errs := make(chan error, 1)
+	fail := func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+		cancel()
+	}
+
+	entries := make(chan entry, concurrency)
+	go func() {
+		defer close(entries)
+
+		for {
+			e, err := r.read()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				fail(err)
+				return
+			}
+
+			select {
+			case entries <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for e := range entries {
+				err := c.Restore(ctx, e.Key, e.Dump, ttl, replace)
+				if err == client.ErrKeyExists {
+					atomic.AddInt64(&existing, 1)
+					continue
+				}
+				if err != nil {
+					fail(fmt.Errorf("Failed to restore '%s': %w", e.Key, err))
+					return
+				}
+				atomic.AddInt64(&restored, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return restored, existing, err
+	default:
+	}
+	return restored, existing, ctx.Err()
+}
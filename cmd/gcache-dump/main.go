@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"gcache/client"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Settings of the servers shared by export and import
+type target struct {
+	addr          string
+	user          string
+	psw           string
+	db            string
+	tlsCA         string
+	tlsCert       string
+	tlsKey        string
+	tlsServerName string
+	timeout       time.Duration
+	concurrency   int
+}
+
+func (t *target) register(flags *flag.FlagSet) {
+	flags.StringVar(&t.addr, "addr", "http://localhost:8080", "comma separated addresses of the servers, keys are sharded between them")
+	flags.StringVar(&t.user, "user", "", "user of the server ACL")
+	flags.StringVar(&t.psw, "psw", "", "authentication password, or the password of the user")
+	flags.StringVar(&t.db, "db", "", "database of the servers, the default one if empty")
+	flags.StringVar(&t.tlsCA, "tls-ca", "", "PEM file of the CAs verifying the server certificates, enables TLS")
+	flags.StringVar(&t.tlsCert, "tls-cert", "", "PEM file of the client certificate, enables TLS")
+	flags.StringVar(&t.tlsKey, "tls-key", "", "PEM file of the client certificate key")
+	flags.StringVar(&t.tlsServerName, "tls-server-name", "", "name the server certificates are verified against")
+	flags.DurationVar(&t.timeout, "timeout", 10*time.Second, "timeout of a request")
+	flags.IntVar(&t.concurrency, "concurrency", 8, "number of keys dumped or restored at a time")
+}
+
+// Client of the servers. Keys are sharded between the addresses the same way as by any other client
+func (t *target) connect() (*client.Client, error) {
+	if t.concurrency <= 0 {
+		return nil, fmt.Errorf("-concurrency must be positive")
+	}
+
+	authorization := t.psw
+	if t.user != "" {
+		authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(t.user+":"+t.psw))
+	}
+
+	tlsConfig := client.TLSConfig{CAFile: t.tlsCA, CertFile: t.tlsCert, KeyFile: t.tlsKey, ServerName: t.tlsServerName}
+	useTLS := t.tlsCA != "" || t.tlsCert != "" || t.tlsServerName != ""
+
+	conns := client.Connections{}
+	for _, addr := range strings.Split(t.addr, ",") {
+		addr = strings.TrimRight(strings.TrimSpace(addr), "/")
+
+		conn := client.NewConnection(addr, authorization)
+		if useTLS {
+			var err error
+			if conn, err = client.NewTLSConnection(addr, authorization, tlsConfig); err != nil {
+				return nil, err
+			}
+		}
+
+		conns = append(conns, conn.WithDatabase(t.db))
+	}
+
+	return client.NewClient(conns, client.WithMaxIdleConnsPerShard(t.concurrency), client.WithTimeout(t.timeout)), nil
+}
+
+// Context done on Ctrl+C, the stats are still reported
+func interruptible() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s export|import [flags]\n\n", os.Args[0])
+	fmt.Fprintln(os.Stderr, "export writes every key of the servers with its ttl to a dump file, "+
+		"import restores the keys of a dump file into the servers.")
+	fmt.Fprintf(os.Stderr, "Run %s export -h or %s import -h for the flags.\n", os.Args[0], os.Args[0])
+}
+
+func main() {
+
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var code int
+	switch os.Args[1] {
+	case "export":
+		code = runExport(os.Args[2:])
+	case "import":
+		code = runImport(os.Args[2:])
+	case "-h", "-help", "--help", "help":
+		usage()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command '%s'\n", os.Args[1])
+		usage()
+		code = 2
+	}
+
+	os.Exit(code)
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"gcache"
+	"gcache/protocol"
+	"gcache/server"
+	"gcache/server/cluster"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Prefix of the environment variables of the settings, e.g. GCACHE_MAX_BODY_SIZE for -max-body-size
+const envPrefix = "GCACHE_"
+
+// Flags which are not settings, they are never read from the config file or the environment
+var commandFlags = map[string]bool{"config": true, "print-config": true}
+
+// Settings printed redacted
+var secretFlags = map[string]bool{"psw": true}
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Settings of the server. Every setting is a flag, which may be set in the config file
+// under the name of the flag and in the environment as GCACHE_<NAME>
+type config struct {
+	flags *flag.FlagSet
+
+	configFile  string
+	printConfig bool
+
+	psw               string
+	pswFile           string
+	addr              string
+	advertise         string
+	join              string
+	probeInterval     time.Duration
+	suspicionTimeout  time.Duration
+	tlsCert           string
+	tlsKey            string
+	tlsClientCA       string
+	tlsMinVersion     string
+	tlsPeerCA         string
+	tlsPeerCert       string
+	tlsPeerKey        string
+	aclFile           string
+	maxMemory         string
+	evictionInterval  time.Duration
+	accessLog         bool
+	accessLogHashKeys bool
+	accessLogSample   int
+	slowlogSlowerThan time.Duration
+	slowlogMaxLen     int
+	rateLimit         string
+	routeRateLimits   string
+	maxBodySize       string
+	maxKeySize        string
+	maxValueSize      string
+	maxListLength     int
+	maxHashLength     int
+	snapshot          string
+	shutdownTimeout   time.Duration
+	logLevel          string
+	databases         string
+
+	// Parsed by validate
+	memory     int64
+	limits     server.Limits
+	tlsVersion uint16
+	level      int
+	dbs        []database
+}
+
+type database struct {
+	name     string
+	maxItems int
+}
+
+func newConfig() *config {
+	c := &config{flags: flag.NewFlagSet(os.Args[0], flag.ContinueOnError)}
+	f := c.flags
+
+	f.StringVar(&c.configFile, "config", "", "JSON file of the settings by the names of the flags, GCACHE_CONFIG as well. Flags take precedence over the environment, which takes precedence over the file")
+	f.BoolVar(&c.printConfig, "print-config", false, "print the settings in the format of the config file and exit")
+
+	f.StringVar(&c.psw, "psw", "", "authentication password")
+	f.StringVar(&c.pswFile, "psw-file", "", "file of the authentication password, reloaded on SIGHUP")
+	f.StringVar(&c.addr, "addr", ":8080", "server address")
+	f.StringVar(&c.advertise, "advertise", "", "address other cluster nodes reach this server at, e.g. http://10.0.0.1:8080")
+	f.StringVar(&c.join, "join", "", "comma separated addresses of cluster nodes to join")
+	f.DurationVar(&c.probeInterval, "probe-interval", cluster.DefaultProbeInterval, "interval a random cluster member is probed on")
+	f.DurationVar(&c.suspicionTimeout, "suspicion-timeout", cluster.DefaultSuspicionTimeout, "time a suspected cluster member has to refute the suspicion before it's declared dead")
+	f.StringVar(&c.tlsCert, "tls-cert", "", "PEM file of the server certificate, enables TLS")
+	f.StringVar(&c.tlsKey, "tls-key", "", "PEM file of the server certificate key")
+	f.StringVar(&c.tlsClientCA, "tls-client-ca", "", "PEM file of the CAs verifying client certificates, enables mutual TLS")
+	f.StringVar(&c.tlsMinVersion, "tls-min-version", "1.2", "minimal TLS version, 1.2 or 1.3")
+	f.StringVar(&c.tlsPeerCA, "tls-peer-ca", "", "PEM file of the CAs verifying the certificates of the other cluster nodes, tls-client-ca by default")
+	f.StringVar(&c.tlsPeerCert, "tls-peer-cert", "", "PEM file of the client certificate presented to the other cluster nodes")
+	f.StringVar(&c.tlsPeerKey, "tls-peer-key", "", "PEM file of the client certificate key presented to the other cluster nodes")
+	f.StringVar(&c.aclFile, "aclfile", "", "file of users and their permissions, lines of 'user <name> <rules>'")
+	f.StringVar(&c.maxMemory, "maxmemory", "0", "approximate memory limit of every database, e.g. 512mb, 0 means no limit")
+	f.DurationVar(&c.evictionInterval, "eviction-interval", gcache.DefaultEvictionInterval, "interval expired keys are evicted on")
+	f.BoolVar(&c.accessLog, "access-log", true, "log requests as JSON lines to stdout")
+	f.BoolVar(&c.accessLogHashKeys, "access-log-hash-keys", false, "log hashes of the keys instead of the keys")
+	f.IntVar(&c.accessLogSample, "access-log-sample", 1, "log one of every n requests, server errors are always logged")
+	f.DurationVar(&c.slowlogSlowerThan, "slowlog-slower-than", server.DefaultSlowlogSlowerThan, "record commands taking at least the duration in the slow log, 0 disables it")
+	f.IntVar(&c.slowlogMaxLen, "slowlog-max-len", server.DefaultSlowlogMaxLen, "number of the latest slow commands kept")
+	f.StringVar(&c.rateLimit, "rate-limit", "0", "requests per second of every client, rate[:burst], 0 means no limit")
+	f.StringVar(&c.routeRateLimits, "route-rate-limits", "", "requests per second of every client per route, e.g. /v2/lists/=100:200,/batch=10")
+	f.StringVar(&c.maxBodySize, "max-body-size", "0", "size limit of a request body, e.g. 16mb, 0 means no limit")
+	f.StringVar(&c.maxKeySize, "max-key-size", "0", "size limit of a key, e.g. 1kb, 0 means no limit")
+	f.StringVar(&c.maxValueSize, "max-value-size", "0", "size limit of a value, e.g. 1mb, 0 means no limit")
+	f.IntVar(&c.maxListLength, "max-list-length", 0, "maximum number of elements of a list, 0 means no limit")
+	f.IntVar(&c.maxHashLength, "max-hash-length", 0, "maximum number of fields of a hash, 0 means no limit")
+	f.StringVar(&c.snapshot, "snapshot", "", "file the data is loaded from on start and saved to on shutdown")
+	f.DurationVar(&c.shutdownTimeout, "shutdown-timeout", 30*time.Second, "time requests in flight are given to complete on shutdown")
+	f.StringVar(&c.logLevel, "log-level", "info", "level of the messages logged, info, warn or error. Requests are logged at info")
+	f.StringVar(&c.databases, "databases", "", "comma separated databases besides the default one, name[:maxItems], e.g. 1,sessions:10000")
+
+	return c
+}
+
+// Errors of the settings, all of them are reported at once
+type configErrors []error
+
+func (e configErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return "Invalid settings:\n  " + strings.Join(lines, "\n  ")
+}
+
+// Load the settings of the arguments, the environment and the config file, and validate them
+func loadConfig(args []string) (*config, error) {
+	c := newConfig()
+	if err := c.flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	set := map[string]bool{}
+	c.flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	errs := configErrors{}
+
+	if !set["config"] {
+		c.configFile = os.Getenv(envPrefix + "CONFIG")
+	}
+
+	if c.configFile != "" {
+		values, err := readConfigFile(c.configFile)
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		for _, name := range sortedKeys(values) {
+			if err := c.setFrom(name, values[name], set); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s", c.configFile, err))
+			}
+		}
+	}
+
+	for _, env := range os.Environ() {
+		i := strings.IndexByte(env, '=')
+		if i < 0 || !strings.HasPrefix(env[:i], envPrefix) || env[:i] == envPrefix+"CONFIG" {
+			continue
+		}
+
+		// Other programs may share the prefix, so unknown variables are not fatal
+		name := strings.ToLower(strings.Replace(env[len(envPrefix):i], "_", "-", -1))
+		if c.flags.Lookup(name) == nil || commandFlags[name] {
+			logf(levelWarn, "Ignoring %s, there is no setting %s", env[:i], name)
+			continue
+		}
+
+		if err := c.setFrom(name, env[i+1:], set); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s", env[:i], err))
+		}
+	}
+
+	errs = append(errs, c.validate()...)
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return c, nil
+}
+
+// Set the setting unless it's set by a flag, the environment is applied after the config file
+func (c *config) setFrom(name string, value string, set map[string]bool) error {
+	f := c.flags.Lookup(name)
+	if f == nil || commandFlags[name] {
+		return fmt.Errorf("Unknown setting '%s'", name)
+	}
+
+	if set[name] {
+		return nil
+	}
+
+	if err := f.Value.Set(value); err != nil {
+		// Flags may be left zero by a failed parse
+		f.Value.Set(f.DefValue)
+		return fmt.Errorf("Invalid value '%s' of %s", value, name)
+	}
+	return nil
+}
+
+// Read the settings of the config file, a JSON object of strings, numbers and booleans
+func readConfigFile(path string) (map[string]string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+
+	raw := map[string]interface{}{}
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	values := make(map[string]string, len(raw))
+	for name, value := range raw {
+		switch v := value.(type) {
+		case string:
+			values[name] = v
+		case json.Number:
+			values[name] = v.String()
+		case bool:
+			values[name] = strconv.FormatBool(v)
+		default:
+			return nil, fmt.Errorf("%s: %s must be a string, number or boolean", path, name)
+		}
+	}
+
+	return values, nil
+}
+
+// Validate the settings and parse the ones which are not flags of their own type
+func (c *config) validate() []error {
+	errs := []error{}
+
+	var err error
+
+	if c.memory, err = server.ParseBytes(c.maxMemory); err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.limits, err = parseLimits(c.rateLimit, c.routeRateLimits, c.maxBodySize, c.maxKeySize, c.maxValueSize); err != nil {
+		errs = append(errs, err)
+	}
+
+	level, ok := logLevels[c.logLevel]
+	if !ok {
+		errs = append(errs, fmt.Errorf("Unknown log level '%s'", c.logLevel))
+	}
+	c.level = level
+
+	if c.tlsVersion, ok = tlsVersions[c.tlsMinVersion]; !ok {
+		errs = append(errs, fmt.Errorf("Unsupported TLS version %s", c.tlsMinVersion))
+	}
+
+	if (c.tlsCert == "") != (c.tlsKey == "") {
+		errs = append(errs, fmt.Errorf("tls-cert and tls-key must be set together"))
+	}
+	if c.tlsClientCA != "" && c.tlsCert == "" {
+		errs = append(errs, fmt.Errorf("tls-client-ca requires tls-cert"))
+	}
+	if (c.tlsPeerCert == "") != (c.tlsPeerKey == "") {
+		errs = append(errs, fmt.Errorf("tls-peer-cert and tls-peer-key must be set together"))
+	}
+	if (c.tlsPeerCA != "" || c.tlsPeerCert != "") && c.tlsCert == "" {
+		errs = append(errs, fmt.Errorf("tls-peer-ca and tls-peer-cert require tls-cert"))
+	}
+
+	if c.evictionInterval <= 0 {
+		errs = append(errs, fmt.Errorf("eviction-interval must be positive"))
+	}
+	if c.probeInterval <= 0 {
+		errs = append(errs, fmt.Errorf("probe-interval: %s", cluster.ErrBadProbeInterval))
+	}
+	if c.suspicionTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("suspicion-timeout must be positive"))
+	}
+	if c.shutdownTimeout < 0 {
+		errs = append(errs, fmt.Errorf("shutdown-timeout must not be negative"))
+	}
+	if c.accessLogSample < 0 || c.slowlogMaxLen < 0 || c.maxListLength < 0 || c.maxHashLength < 0 {
+		errs = append(errs, fmt.Errorf("access-log-sample, slowlog-max-len, max-list-length and max-hash-length must not be negative"))
+	}
+
+	c.dbs = nil
+	if c.databases != "" {
+		names := map[string]bool{protocol.DefaultDatabase: true}
+
+		for _, db := range strings.Split(c.databases, ",") {
+			name, maxItems, err := parseDatabase(db)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			if names[name] {
+				errs = append(errs, fmt.Errorf("Database %s is listed twice or is the default one", name))
+				continue
+			}
+			names[name] = true
+
+			c.dbs = append(c.dbs, database{name, maxItems})
+		}
+	}
+
+	return errs
+}
+
+// Print the settings in the format of the config file, secrets are redacted
+func (c *config) print(w io.Writer) error {
+	values := map[string]interface{}{}
+
+	c.flags.VisitAll(func(f *flag.Flag) {
+		if commandFlags[f.Name] {
+			return
+		}
+
+		value := f.Value.(flag.Getter).Get()
+		switch v := value.(type) {
+		case time.Duration:
+			value = v.String()
+		case string:
+			if secretFlags[f.Name] && v != "" {
+				value = "REDACTED"
+			}
+		}
+		values[f.Name] = value
+	})
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(values)
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
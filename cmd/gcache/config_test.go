@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "gcache.json")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfig_Precedence(t *testing.T) {
+
+	path := writeConfigFile(t, `{"addr": ":7070", "maxmemory": "1mb", "log-level": "error", "access-log": false, "slowlog-max-len": 5}`)
+
+	t.Setenv("GCACHE_CONFIG", path)
+	t.Setenv("GCACHE_MAXMEMORY", "2mb")
+	t.Setenv("GCACHE_LOG_LEVEL", "warn")
+
+	c, err := loadConfig([]string{"-log-level", "info"})
+	if err != nil {
+		t.Fatal("Failed to load", err)
+	}
+
+	// Flag over the environment over the file over the default
+	if c.level != levelInfo {
+		t.Errorf("Expected the flag to take precedence but actual level %d", c.level)
+	}
+	if c.memory != 2<<20 {
+		t.Errorf("Expected the environment to take precedence over the file but actual %d", c.memory)
+	}
+	if c.addr != ":7070" || c.accessLog || c.slowlogMaxLen != 5 {
+		t.Errorf("Expected the settings of the file but actual %s %v %d", c.addr, c.accessLog, c.slowlogMaxLen)
+	}
+	if c.evictionInterval != newConfig().evictionInterval {
+		t.Errorf("Expected the default eviction interval but actual %s", c.evictionInterval)
+	}
+
+	// The config flag takes precedence over GCACHE_CONFIG
+	other := writeConfigFile(t, `{"addr": ":6060"}`)
+
+	if c, err = loadConfig([]string{"-config", other}); err != nil {
+		t.Fatal("Failed to load", err)
+	}
+	if c.addr != ":6060" {
+		t.Errorf("Expected the config file of the flag but actual %s", c.addr)
+	}
+}
+
+func TestConfig_Environment(t *testing.T) {
+
+	t.Setenv("GCACHE_MAX_BODY_SIZE", "16kb")
+	t.Setenv("GCACHE_EVICTION_INTERVAL", "3s")
+	t.Setenv("GCACHE_ACCESS_LOG_HASH_KEYS", "true")
+	t.Setenv("GCACHE_TLS_MIN_VERSION", "1.3")
+
+	c, err := loadConfig(nil)
+	if err != nil {
+		t.Fatal("Failed to load", err)
+	}
+
+	if c.limits.MaxBodySize != 16<<10 || c.evictionInterval != 3*time.Second || !c.accessLogHashKeys || c.tlsVersion != 0x0304 {
+		t.Errorf("Expected the settings of the environment but actual %d %s %v %x",
+			c.limits.MaxBodySize, c.evictionInterval, c.accessLogHashKeys, c.tlsVersion)
+	}
+}
+
+func TestConfig_UnknownEnvironment(t *testing.T) {
+
+	output := &bytes.Buffer{}
+	log.SetOutput(output)
+	defer log.SetOutput(os.Stderr)
+
+	t.Setenv("GCACHE_NO_SUCH_SETTING", "1")
+	t.Setenv("GCACHE_PRINT_CONFIG", "true")
+
+	c, err := loadConfig(nil)
+	if err != nil {
+		t.Fatal("Expected unknown variables not to fail but actual", err)
+	}
+
+	if c.printConfig {
+		t.Error("Expected -print-config not to be set by the environment")
+	}
+
+	for _, name := range []string{"GCACHE_NO_SUCH_SETTING", "GCACHE_PRINT_CONFIG"} {
+		if !strings.Contains(output.String(), name) {
+			t.Errorf("Expected a warning about %s but actual %q", name, output.String())
+		}
+	}
+
+	// Unknown settings of the file are errors
+	if _, err := loadConfig([]string{"-config", writeConfigFile(t, `{"no-such-setting": 1}`)}); err == nil {
+		t.Error("Expected an unknown setting of the file to fail")
+	}
+}
+
+func TestConfig_Validation(t *testing.T) {
+
+	path := writeConfigFile(t, `{"maxmemory": "lots"}`)
+
+	t.Setenv("GCACHE_EVICTION_INTERVAL", "soon")
+
+	_, err := loadConfig([]string{"-config", path, "-log-level", "debug", "-tls-key", "key.pem", "-databases", "1,sessions:x,1", "-probe-interval", "0s", "-suspicion-timeout", "-1s"})
+
+	errs, ok := err.(configErrors)
+	if !ok {
+		t.Fatalf("Expected the errors of the settings but actual %v", err)
+	}
+
+	// Every invalid setting is reported at once
+	for _, expected := range []string{"GCACHE_EVICTION_INTERVAL", "lots", "debug", "tls-cert and tls-key", "sessions:x", "Database 1 is listed twice", "probe-interval", "suspicion-timeout"} {
+		if !strings.Contains(errs.Error(), expected) {
+			t.Errorf("Expected an error of %s but actual %s", expected, errs)
+		}
+	}
+
+	if len(errs) != 8 {
+		t.Errorf("Expected 8 errors but actual %d: %s", len(errs), errs)
+	}
+
+	t.Setenv("GCACHE_EVICTION_INTERVAL", "1s")
+
+	// The default database is there already
+	if _, err := loadConfig([]string{"-databases", "0"}); err == nil {
+		t.Error("Expected the default database to be rejected")
+	}
+
+	c, err := loadConfig([]string{"-databases", "1,sessions:10"})
+	if err != nil {
+		t.Fatal("Failed to load", err)
+	}
+	if len(c.dbs) != 2 || c.dbs[1] != (database{"sessions", 10}) {
+		t.Errorf("Expected the databases 1 and sessions but actual %+v", c.dbs)
+	}
+}
+
+func TestConfig_Print(t *testing.T) {
+
+	c, err := loadConfig([]string{"-psw", "secret", "-maxmemory", "1gb", "-shutdown-timeout", "5s", "-access-log=false"})
+	if err != nil {
+		t.Fatal("Failed to load", err)
+	}
+
+	output := &bytes.Buffer{}
+	if err := c.print(output); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(output.String(), "secret") {
+		t.Errorf("Expected the password to be redacted but actual %s", output)
+	}
+
+	// The printed settings load as a config file
+	printed := map[string]interface{}{}
+	if err := json.Unmarshal(output.Bytes(), &printed); err != nil {
+		t.Fatal(err)
+	}
+
+	if printed["psw"] != "REDACTED" || printed["maxmemory"] != "1gb" || printed["shutdown-timeout"] != "5s" || printed["access-log"] != false {
+		t.Errorf("Unexpected settings %v", printed)
+	}
+	if _, ok := printed["config"]; ok {
+		t.Error("Expected -config not to be printed")
+	}
+
+	delete(printed, "psw")
+	content, _ := json.Marshal(printed)
+
+	loaded, err := loadConfig([]string{"-config", writeConfigFile(t, string(content))})
+	if err != nil {
+		t.Fatal("Failed to load the printed settings", err)
+	}
+	if loaded.memory != 1<<30 || loaded.shutdownTimeout != 5*time.Second || loaded.accessLog {
+		t.Errorf("Expected the printed settings but actual %d %s %v", loaded.memory, loaded.shutdownTimeout, loaded.accessLog)
+	}
+
+	// No password is printed as it is
+	if c, err = loadConfig(nil); err != nil {
+		t.Fatal(err)
+	}
+	output.Reset()
+	c.print(output)
+
+	if !strings.Contains(output.String(), `"psw": ""`) {
+		t.Errorf("Expected an empty password but actual %s", output)
+	}
+}
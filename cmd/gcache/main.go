@@ -2,28 +2,145 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"gcache/server"
+	"log"
 	"os"
-	"os/signal"
-	"syscall"
+	"strconv"
+	"strings"
 )
 
 func main() {
 
-	psw := flag.String("psw", "", "authentication password")
-	addr := flag.String("addr", ":8080", "server address")
+	c, err := loadConfig(os.Args[1:])
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
-	flag.Parse()
+	if c.printConfig {
+		if err := c.print(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	// Exit on Ctrl+C
-	c := make(chan os.Signal, 2)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		<-c
-		os.Exit(1)
-	}()
+	settings, err := loadReloadable(c)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	server := server.NewServerWithAuth(*psw)
-	server.SetUrlLogging(true)
-	server.Run(*addr)
+	srv := server.NewServerWithAuth(settings.psw)
+	settings.apply(srv)
+	srv.SetSlowlogSlowerThan(c.slowlogSlowerThan)
+	srv.SetSlowlogMaxLen(c.slowlogMaxLen)
+
+	if c.aclFile != "" {
+		if err := srv.LoadACLFile(c.aclFile); err != nil {
+			log.Fatal("Failed to load the ACL file: ", err)
+		}
+	}
+
+	if c.snapshot != "" {
+		srv.SetSnapshotPath(c.snapshot)
+	}
+
+	for _, db := range c.dbs {
+		if _, err := srv.AddDatabase(db.name, db.maxItems); err != nil {
+			log.Fatalf("Failed to add database %s: %s", db.name, err)
+		}
+	}
+
+	for _, name := range srv.Databases() {
+		db, _ := srv.Database(name)
+		db.SetMaxMemory(c.memory)
+		db.SetMaxListLength(c.maxListLength)
+		db.SetMaxHashLength(c.maxHashLength)
+		db.SetEvictionInterval(c.evictionInterval)
+	}
+
+	srv.SetLimits(c.limits)
+
+	if c.tlsCert != "" {
+		err := srv.SetTLS(server.TLSConfig{
+			CertFile:     c.tlsCert,
+			KeyFile:      c.tlsKey,
+			MinVersion:   c.tlsVersion,
+			ClientCAFile: c.tlsClientCA,
+			PeerCAFile:   c.tlsPeerCA,
+			PeerCertFile: c.tlsPeerCert,
+			PeerKeyFile:  c.tlsPeerKey,
+		})
+		if err != nil {
+			log.Fatal("Failed to set TLS: ", err)
+		}
+	}
+
+	if c.advertise != "" || c.join != "" {
+		self := c.advertise
+		if self == "" && c.tlsCert != "" {
+			self = "https://localhost" + c.addr
+		} else if self == "" {
+			self = "http://localhost" + c.addr
+		}
+
+		seeds := []string{}
+		if c.join != "" {
+			seeds = strings.Split(c.join, ",")
+		}
+
+		membership := srv.EnableCluster(self, seeds)
+		if err := membership.SetProbeInterval(c.probeInterval); err != nil {
+			log.Fatal("Failed to set the probe interval: ", err)
+		}
+		membership.SetSuspicionTimeout(c.suspicionTimeout)
+	}
+
+	os.Exit(run(srv, c, os.Args[1:]))
+}
+
+// Parse the flags of the limits of requests
+func parseLimits(rate string, routeRates string, maxBodySize string, maxKeySize string, maxValueSize string) (server.Limits, error) {
+	limits := server.Limits{}
+
+	var err error
+
+	if limits.Rate, err = server.ParseRateLimit(rate); err != nil {
+		return limits, err
+	}
+	if limits.RouteRates, err = server.ParseRouteRates(routeRates); err != nil {
+		return limits, err
+	}
+	if limits.MaxBodySize, err = server.ParseBytes(maxBodySize); err != nil {
+		return limits, err
+	}
+	if limits.MaxValueSize, err = server.ParseBytes(maxValueSize); err != nil {
+		return limits, err
+	}
+
+	keySize, err := server.ParseBytes(maxKeySize)
+	if err != nil {
+		return limits, err
+	}
+	limits.MaxKeySize = int(keySize)
+
+	return limits, nil
+}
+
+// Parse the database flag of name[:maxItems]
+func parseDatabase(db string) (string, int, error) {
+	i := strings.LastIndex(db, ":")
+	if i < 0 {
+		return db, 0, nil
+	}
+
+	maxItems, err := strconv.Atoi(db[i+1:])
+	if err != nil || maxItems < 0 {
+		return "", 0, fmt.Errorf("Bad max items of database %s", db)
+	}
+
+	return db[:i], maxItems, nil
 }
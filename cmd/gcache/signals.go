@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"gcache/server"
+	"gcache/server/acl"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Levels of the messages logged by the server
+const (
+	levelInfo = iota
+	levelWarn
+	levelError
+)
+
+var logLevels = map[string]int{"info": levelInfo, "warn": levelWarn, "error": levelError}
+
+// Level of the messages logged, changed by reloading
+var currentLevel = levelInfo
+
+func logf(level int, format string, args ...interface{}) {
+	if level >= currentLevel {
+		log.Printf(format, args...)
+	}
+}
+
+// Settings which are changed without restarting the server
+type reloadable struct {
+	psw       string
+	logLevel  int
+	accessLog bool
+	// Hashing and sampling of the access log
+	accessLogConfig server.AccessLogConfig
+}
+
+// Get the reloadable settings of the config, the password file takes precedence over the password
+func loadReloadable(c *config) (reloadable, error) {
+
+	settings := reloadable{
+		psw:             c.psw,
+		logLevel:        c.level,
+		accessLog:       c.accessLog,
+		accessLogConfig: server.AccessLogConfig{HashKeys: c.accessLogHashKeys, Sample: c.accessLogSample},
+	}
+
+	if c.pswFile != "" {
+		content, err := ioutil.ReadFile(c.pswFile)
+		if err != nil {
+			return settings, fmt.Errorf("Failed to read the password file: %s", err)
+		}
+		settings.psw = strings.TrimSpace(string(content))
+	}
+
+	return settings, nil
+}
+
+// Apply the log settings. The password is applied on reload, a new server gets it on creation
+func (settings reloadable) apply(srv *server.Server) {
+	currentLevel = settings.logLevel
+	srv.SetAccessLog(settings.accessLogConfig)
+	srv.SetAccessLogging(settings.accessLog && settings.logLevel <= levelInfo)
+}
+
+// Load the settings of the arguments, the environment and the config file again, and apply
+// the ones which change while serving: the password, the ACL file, logging, the slow log and the limits.
+// The listener, TLS, the cluster, the snapshot and the databases with their settings, which CONFIG SET
+// may have changed meanwhile, take a restart. Nothing changes if any of the settings fails to load
+func reload(srv *server.Server, args []string) error {
+
+	c, err := loadConfig(args)
+	if err != nil {
+		return err
+	}
+
+	settings, err := loadReloadable(c)
+	if err != nil {
+		return err
+	}
+
+	if c.aclFile != "" {
+		if err := srv.LoadACLFile(c.aclFile); err != nil {
+			return fmt.Errorf("Failed to reload the ACL file: %s", err)
+		}
+	}
+
+	// The default user of the ACL file keeps its password unless one is set
+	if settings.psw != "" || c.aclFile == "" || !srv.ACL().Loaded(acl.DefaultUser) {
+		srv.SetPassword(settings.psw)
+	}
+	settings.apply(srv)
+	srv.SetSlowlogSlowerThan(c.slowlogSlowerThan)
+	srv.SetSlowlogMaxLen(c.slowlogMaxLen)
+	srv.SetLimits(c.limits)
+
+	return nil
+}
+
+// Serve until SIGINT or SIGTERM, then shut down gracefully: stop accepting connections,
+// wait for the requests in flight up to the timeout and save the snapshot.
+// SIGHUP reloads the settings of the arguments. Return the exit code
+func run(srv *server.Server, c *config, args []string) int {
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.Run(c.addr)
+	}()
+
+	for {
+		select {
+		case err := <-errs:
+			if err != nil {
+				logf(levelError, "Failed to serve: %s", err)
+				return 1
+			}
+			return 0
+
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				if err := reload(srv, args); err != nil {
+					logf(levelError, "Failed to reload the settings, keeping the current ones: %s", err)
+				} else {
+					logf(levelInfo, "Reloaded the settings")
+				}
+				continue
+			}
+
+			return shutdown(srv, c.shutdownTimeout, signals, errs)
+		}
+	}
+}
+
+// Shut down the server. Another SIGINT or SIGTERM exits right away
+func shutdown(srv *server.Server, timeout time.Duration, signals chan os.Signal, errs chan error) int {
+
+	logf(levelInfo, "Shutting down, waiting up to %s for requests in flight", timeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Shutdown(ctx)
+	}()
+
+	for {
+		select {
+		case err := <-done:
+			// Serve returns once the listener is closed
+			<-errs
+
+			if err != nil {
+				logf(levelError, "Failed to shut down gracefully: %s", err)
+				return 1
+			}
+
+			logf(levelInfo, "Shut down")
+			return 0
+
+		case sig := <-signals:
+			if sig != syscall.SIGHUP {
+				logf(levelError, "Exiting without waiting for the shutdown")
+				return 1
+			}
+		}
+	}
+}
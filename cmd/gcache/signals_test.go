@@ -0,0 +1,75 @@
+package main
+
+import (
+	"gcache/server"
+	"gcache/server/acl"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestReload_ACLFileDefaultUser(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "users.acl")
+	if err := ioutil.WriteFile(path, []byte("user default on >secret ~* +@all\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := server.NewServer()
+	if err := srv.LoadACLFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// No password is set, the password of the file is kept
+	if err := reload(srv, []string{"-aclfile", path}); err != nil {
+		t.Fatal("Failed to reload", err)
+	}
+
+	if _, err := srv.ACL().Authenticate(acl.DefaultUser, "secret"); err != nil {
+		t.Error("Expected the password of the ACL file to be kept but actual", err)
+	}
+	if _, err := srv.ACL().Authenticate(acl.DefaultUser, ""); err == nil {
+		t.Error("Expected the default user to require the password of the ACL file")
+	}
+
+	// A password which is set applies
+	if err := reload(srv, []string{"-aclfile", path, "-psw", "other"}); err != nil {
+		t.Fatal("Failed to reload", err)
+	}
+
+	if _, err := srv.ACL().Authenticate(acl.DefaultUser, "other"); err != nil {
+		t.Error("Expected the password to apply but actual", err)
+	}
+
+	// The default user is not defined by the file, no password disables auth
+	if err := ioutil.WriteFile(path, []byte("user reader on >reader ~* +@read\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := reload(srv, []string{"-aclfile", path}); err != nil {
+		t.Fatal("Failed to reload", err)
+	}
+
+	if _, err := srv.ACL().Authenticate(acl.DefaultUser, ""); err != nil {
+		t.Error("Expected the default user without a password but actual", err)
+	}
+}
+
+func TestReload_AccessLog(t *testing.T) {
+
+	srv := server.NewServer()
+
+	if err := reload(srv, []string{"-access-log=false", "-access-log-sample", "10", "-access-log-hash-keys"}); err != nil {
+		t.Fatal("Failed to reload", err)
+	}
+
+	rr := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/config?name=access-log-*", nil))
+
+	expected := "access-log-hash-keys true\naccess-log-sample 10\n"
+	if rr.Code != http.StatusOK || rr.Body.String() != expected {
+		t.Errorf("Expected the reloaded access log settings %q but actual %d %q", expected, rr.Code, rr.Body.String())
+	}
+}
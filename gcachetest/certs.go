@@ -0,0 +1,117 @@
+package gcachetest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// PEM files of certificates generated for a test
+type Certs struct {
+	// CA signing the server and the client certificates
+	CAFile string
+	// Certificate of the server valid for localhost and 127.0.0.1
+	ServerCertFile string
+	ServerKeyFile  string
+	// Certificate of a client
+	ClientCertFile string
+	ClientKeyFile  string
+}
+
+// Generate a CA with server and client certificates in a temporary directory removed when the test finishes
+func NewCerts(tb testing.TB) Certs {
+	tb.Helper()
+
+	dir := tb.TempDir()
+
+	caKey := generateKey(tb)
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gcachetest CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	if err != nil {
+		tb.Fatal("Failed to create the CA certificate", err)
+	}
+
+	certs := Certs{
+		CAFile:         filepath.Join(dir, "ca.pem"),
+		ServerCertFile: filepath.Join(dir, "server.pem"),
+		ServerKeyFile:  filepath.Join(dir, "server-key.pem"),
+		ClientCertFile: filepath.Join(dir, "client.pem"),
+		ClientKeyFile:  filepath.Join(dir, "client-key.pem"),
+	}
+
+	writePEM(tb, certs.CAFile, "CERTIFICATE", caDER)
+
+	server := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	signCert(tb, server, ca, caKey, certs.ServerCertFile, certs.ServerKeyFile)
+
+	client := &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "client"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	signCert(tb, client, ca, caKey, certs.ClientCertFile, certs.ClientKeyFile)
+
+	return certs
+}
+
+func generateKey(tb testing.TB) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		tb.Fatal("Failed to generate a key", err)
+	}
+	return key
+}
+
+// Sign the certificate by the CA and write it with its new key
+func signCert(tb testing.TB, cert *x509.Certificate, ca *x509.Certificate, caKey *ecdsa.PrivateKey,
+	certFile string, keyFile string) {
+
+	cert.NotBefore = time.Now().Add(-time.Hour)
+	cert.NotAfter = time.Now().Add(24 * time.Hour)
+	cert.KeyUsage = x509.KeyUsageDigitalSignature
+
+	key := generateKey(tb)
+
+	der, err := x509.CreateCertificate(rand.Reader, cert, ca, &key.PublicKey, caKey)
+	if err != nil {
+		tb.Fatal("Failed to create a certificate", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		tb.Fatal("Failed to marshal a key", err)
+	}
+
+	writePEM(tb, certFile, "CERTIFICATE", der)
+	writePEM(tb, keyFile, "EC PRIVATE KEY", keyDER)
+}
+
+func writePEM(tb testing.TB, file string, blockType string, der []byte) {
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		tb.Fatal("Failed to write", file, err)
+	}
+}
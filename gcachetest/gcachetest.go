@@ -0,0 +1,108 @@
+// Package gcachetest runs cache servers in process on ephemeral ports for tests
+package gcachetest
+
+import (
+	"context"
+	"gcache/client"
+	"gcache/server"
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+// Cache server running in process
+type Server struct {
+	*server.Server
+
+	// Base url of the server, e.g. http://127.0.0.1:54321
+	URL string
+	// Password of the server, empty if auth is disabled
+	Psw string
+
+	close func()
+}
+
+// Start a server without auth. The server is closed when the test finishes
+func NewServer(tb testing.TB) *Server {
+	return NewServerWithAuth(tb, "")
+}
+
+// Start a server with auth. The server is closed when the test finishes
+func NewServerWithAuth(tb testing.TB, psw string) *Server {
+	tb.Helper()
+
+	s := server.NewServerWithAuth(psw)
+	ts := httptest.NewServer(s.Handler())
+
+	tb.Cleanup(ts.Close)
+
+	return &Server{
+		Server: s,
+		URL:    ts.URL,
+		Psw:    psw,
+		close:  ts.Close,
+	}
+}
+
+// Start a server with auth serving over TLS by Serve. The server is shut down when the test finishes
+func NewTLSServer(tb testing.TB, psw string, config server.TLSConfig) *Server {
+	tb.Helper()
+
+	s := server.NewServerWithAuth(psw)
+	if err := s.SetTLS(config); err != nil {
+		tb.Fatal("Failed to set TLS", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal("Failed to listen", err)
+	}
+
+	go s.Serve(listener)
+
+	shutdown := func() {
+		s.Shutdown(context.Background())
+	}
+	tb.Cleanup(shutdown)
+
+	return &Server{
+		Server: s,
+		URL:    "https://" + listener.Addr().String(),
+		Psw:    psw,
+		close:  shutdown,
+	}
+}
+
+// Create a connection to the server
+func (s *Server) Connection() client.Connection {
+	return client.NewConnection(s.URL, s.Psw)
+}
+
+// Close the server before the test finishes, e.g. to test a shard failure
+func (s *Server) Close() {
+	s.close()
+}
+
+// Servers sharing the key space
+type Servers []*Server
+
+// Start n servers sharing the password, empty for no auth
+func NewServers(tb testing.TB, n int, psw string) Servers {
+	tb.Helper()
+
+	servers := make(Servers, n)
+	for i := range servers {
+		servers[i] = NewServerWithAuth(tb, psw)
+	}
+
+	return servers
+}
+
+// Create connections to the servers, one shard per server
+func (servers Servers) Connections() client.Connections {
+	conns := make(client.Connections, len(servers))
+	for i, s := range servers {
+		conns[i] = s.Connection()
+	}
+	return conns
+}
@@ -0,0 +1,34 @@
+package gcachetest
+
+import (
+	"context"
+	"gcache/client"
+	"testing"
+)
+
+func TestServers(t *testing.T) {
+
+	ctx := context.Background()
+
+	servers := NewServers(t, 2, "psw")
+	c := client.NewClient(servers.Connections())
+
+	if err := c.Set(ctx, "key", "value", 10); err != nil {
+		t.Fatal("Failed to set the key", err)
+	}
+
+	if value, err := c.Get(ctx, "key"); err != nil || value != "value" {
+		t.Errorf("Expected %q but actual %q, err = %v", "value", value, err)
+	}
+
+	// Values are visible in the cache of the shard
+	if servers[0].Cache().Count()+servers[1].Cache().Count() != 1 {
+		t.Error("Expected the key to be stored by one of the servers")
+	}
+
+	// Auth is enforced
+	noAuth := client.NewClient(client.Connections{client.NewConnection(servers[0].URL, "")})
+	if _, err := noAuth.Get(ctx, "key"); err == nil {
+		t.Error("Expected the request without the password to fail")
+	}
+}
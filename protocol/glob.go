@@ -0,0 +1,108 @@
+package protocol
+
+// Match the string against the glob pattern in the style of Redis, e.g. of the key patterns of the ACL and KEYS:
+// * matches any sequence, / included, ? matches a single character, [abc], [a-z] and [^a] match classes,
+// and \ escapes the next character
+func MatchGlob(pattern string, s string) bool {
+
+	for len(pattern) > 0 {
+		switch pattern[0] {
+
+		case '*':
+			// Collapse consecutive stars
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if MatchGlob(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			matched, rest, ok := matchClass(pattern[1:], s[0])
+			if !ok {
+				// Unterminated class matches '[' literally
+				if s[0] != '[' {
+					return false
+				}
+				pattern, s = pattern[1:], s[1:]
+				continue
+			}
+			if !matched {
+				return false
+			}
+			pattern, s = rest, s[1:]
+
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+
+		default:
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		}
+	}
+
+	return len(s) == 0
+}
+
+// Match the character against the class following '['.
+// Return the pattern after the class and whether the class is terminated
+func matchClass(pattern string, c byte) (bool, string, bool) {
+
+	negated := false
+	if len(pattern) > 0 && pattern[0] == '^' {
+		negated = true
+		pattern = pattern[1:]
+	}
+
+	matched := false
+
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case pattern[i] == ']':
+			return matched != negated, pattern[i+1:], true
+
+		case pattern[i] == '\\' && i+1 < len(pattern):
+			i++
+			if pattern[i] == c {
+				matched = true
+			}
+
+		case i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']':
+			from, to := pattern[i], pattern[i+2]
+			if from > to {
+				from, to = to, from
+			}
+			if c >= from && c <= to {
+				matched = true
+			}
+			i += 2
+
+		default:
+			if pattern[i] == c {
+				matched = true
+			}
+		}
+	}
+
+	return false, "", false
+}
@@ -0,0 +1,37 @@
+package protocol
+
+import "testing"
+
+func TestGlob_Match(t *testing.T) {
+
+	cases := []struct {
+		pattern string
+		s       string
+		matched bool
+	}{
+		{"*", "", true},
+		{"*", "any/key", true},
+		{"cache:*", "cache:1", true},
+		{"cache:*", "cache", false},
+		{"*:user", "a:b:user", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"key[0-9]", "key5", true},
+		{"key[0-9]", "keyx", false},
+		{"a\\*b", "a*b", true},
+		{"a\\*b", "axb", false},
+		{"[abc", "[abc", true},
+		{"exact", "exact", true},
+		{"exact", "exactly", false},
+	}
+
+	for _, c := range cases {
+		if matched := MatchGlob(c.pattern, c.s); matched != c.matched {
+			t.Errorf("Pattern %q on %q: expected %v but actual %v", c.pattern, c.s, c.matched, matched)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package protocol
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// Routes of the v2 REST API. Keys are path segments and values travel as raw bodies
+const (
+	KeysPath   = "/v2/keys"
+	ListsPath  = "/v2/lists"
+	HashesPath = "/v2/hashes"
+	BatchPath  = "/batch"
+	MGetPath   = "/v2/mget"
+	MSetPath   = "/v2/mset"
+	MDelPath   = "/v2/mdel"
+	// Serialized values with their ttl, to move keys between servers
+	DumpPath    = "/v2/dump"
+	RestorePath = "/v2/restore"
+	// Iteration over the keys in pages
+	ScanPath = "/v2/scan"
+	// Stream of changed keys used to invalidate client side caches, see InvalidateAll
+	InvalidationsPath = "/v2/invalidations"
+	// Prefix of the routes of a database, e.g. /db/sessions/v2/keys/{key}
+	DatabasePath = "/db"
+)
+
+// Routes of the administration
+const (
+	InfoPath     = "/admin/info"
+	FlushAllPath = "/admin/flushall"
+	SavePath     = "/admin/save"
+	SlowlogPath  = "/admin/slowlog"
+	// Routes of the selected database
+	FlushDBPath = "/admin/flushdb"
+	DBSizePath  = "/admin/dbsize"
+	ConfigPath  = "/admin/config"
+)
+
+const (
+	// Header selecting the database of a request, the path prefix takes precedence
+	HeaderDatabase = "X-Gcache-Db"
+	// Database of requests selecting none
+	DefaultDatabase = "0"
+)
+
+const (
+	// Content type of a single raw value
+	ContentTypeBinary = "application/octet-stream"
+	// Content type of a sequence of values, each prefixed with its length as uvarint
+	ContentTypeValues = "application/vnd.gcache.values"
+	// Content type of structured responses and errors
+	ContentTypeJSON = "application/json"
+)
+
+// Error codes of structured error responses
+const (
+	CodeNotFound   = "NOT_FOUND"
+	CodeWrongType  = "WRONGTYPE"
+	CodeBadRequest = "BAD_REQUEST"
+	CodeInternal   = "INTERNAL"
+	CodeNoPerm     = "NOPERM"
+	CodeNoDatabase = "NO_DATABASE"
+	// The client sends more requests than its rate limit allows, retry after the Retry-After seconds
+	CodeRateLimited = "RATE_LIMITED"
+	// A body, key or value is over its size limit, or a list or hash is at its maximum length
+	CodeTooLarge = "TOO_LARGE"
+	// The key to restore exists and isn't to be replaced
+	CodeKeyExists = "KEY_EXISTS"
+)
+
+// Structured error response
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+type ErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Structured response of a single value. Ttl in seconds is set for keys only.
+// Values are base64 encoded, so that binary values survive json
+type ValueResponse struct {
+	Value []byte `json:"value"`
+	Ttl   *int64 `json:"ttl,omitempty"`
+}
+
+// Structured response of multiple values, base64 encoded
+type ValuesResponse struct {
+	Values [][]byte `json:"values"`
+}
+
+// Structured response of keys
+type KeysResponse struct {
+	Keys []string `json:"keys"`
+}
+
+// Structured response of a page of keys. Cursor of the next page is empty once the keys are scanned
+type ScanResponse struct {
+	Cursor string   `json:"cursor"`
+	Keys   []string `json:"keys"`
+}
+
+// Structured response of a dumped key, the dump is base64 encoded
+type DumpResponse struct {
+	Dump []byte `json:"dump"`
+}
+
+// Structured response of a successful command
+type OkResponse struct {
+	Ok bool `json:"ok"`
+}
+
+const maxValueLength = 1 << 30
+
+var ErrBadPath = errors.New("Bad path")
+var ErrValueTooLong = errors.New("Value is too long")
+
+// Escape a key to be used as a single path segment.
+// Dots are escaped as well so that '.' and '..' keys survive path cleaning
+func EscapeSegment(segment string) string {
+	return strings.Replace(url.PathEscape(segment), ".", "%2E", -1)
+}
+
+// Split the escaped path after the prefix into unescaped segments.
+// The path equal to the prefix has no segments, the prefix followed by '/' has a single empty one
+func SplitPath(escapedPath string, prefix string) ([]string, error) {
+	if !strings.HasPrefix(escapedPath, prefix) {
+		return nil, ErrBadPath
+	}
+
+	rest := escapedPath[len(prefix):]
+
+	if rest == "" {
+		return []string{}, nil
+	}
+
+	if rest[0] != '/' {
+		return nil, ErrBadPath
+	}
+
+	segments := strings.Split(rest[1:], "/")
+	for i, segment := range segments {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, err
+		}
+		segments[i] = unescaped
+	}
+
+	return segments, nil
+}
+
+// Key of the invalidation stream standing for every key, e.g. of a flushed database.
+// Keys are never empty, so it's streamed to every subscriber whatever the prefixes of the subscription
+const InvalidateAll = ""
+
+// Write values each prefixed with its length
+func WriteValues(w io.Writer, values []string) error {
+	buffer := make([]byte, binary.MaxVarintLen64)
+
+	for _, value := range values {
+		n := binary.PutUvarint(buffer, uint64(len(value)))
+		if _, err := w.Write(buffer[:n]); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Read values written by WriteValues
+func ReadValues(r io.Reader) ([]string, error) {
+	reader := bufio.NewReader(r)
+	values := []string{}
+
+	for {
+		value, err := ReadValue(reader)
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, value)
+	}
+}
+
+// Read a single value written by WriteValues. io.EOF is returned at the end of the stream only
+func ReadValue(reader *bufio.Reader) (string, error) {
+	length, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return "", err
+	}
+
+	if length > maxValueLength {
+		return "", ErrValueTooLong
+	}
+
+	value := make([]byte, length)
+	if _, err := io.ReadFull(reader, value); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+
+	return string(value), nil
+}
+
+// Operations of batch commands
+const (
+	OpGet    = "get"
+	OpSet    = "set"
+	OpUpdate = "update"
+	OpDel    = "del"
+	OpLPush  = "lpush"
+	OpRPush  = "rpush"
+	OpLPop   = "lpop"
+	OpRPop   = "rpop"
+	OpLRange = "lrange"
+	OpHGet   = "hget"
+	OpHSet   = "hset"
+)
+
+// Maximum number of commands in a single batch
+const MaxBatchSize = 10000
+
+// Command of a batch. Values are []byte so that they are base64 encoded in json and stay binary safe
+type Command struct {
+	Op      string `json:"op"`
+	Key     string `json:"key"`
+	HashKey string `json:"hashKey,omitempty"`
+	Value   []byte `json:"value,omitempty"`
+	Ttl     *int   `json:"ttl,omitempty"`
+	From    int    `json:"from,omitempty"`
+	To      int    `json:"to,omitempty"`
+}
+
+// Result of a batch command. Results are returned in the order of the commands
+type Result struct {
+	Value  []byte     `json:"value,omitempty"`
+	Values [][]byte   `json:"values,omitempty"`
+	Error  *ErrorBody `json:"error,omitempty"`
+}
+
+// Request of multi key get and delete
+type KeysRequest struct {
+	Keys []string `json:"keys"`
+}
+
+// Response of multi key get. Values are in the order of the keys, missing keys have null values
+type MGetResponse struct {
+	Values [][]byte `json:"values"`
+}
+
+// Request of multi key set. If NX is set the keys are set only if none of them exists
+type MSetRequest struct {
+	Items map[string][]byte `json:"items"`
+	Ttl   int               `json:"ttl"`
+	NX    bool              `json:"nx,omitempty"`
+}
+
+// Response of multi key delete
+type MDelResponse struct {
+	Deleted int `json:"deleted"`
+}
+
+// Command recorded by the slow log. Keys are hashed if the access log hashes keys
+type SlowlogEntry struct {
+	ID int64 `json:"id"`
+	// Start of the command in unix microseconds
+	Time int64 `json:"time"`
+	// Duration of the command in microseconds
+	Duration int64    `json:"duration"`
+	Command  string   `json:"command"`
+	Keys     []string `json:"keys,omitempty"`
+	// Number of keys of the command, more than Keys if they are too many to record
+	KeyCount int    `json:"keyCount"`
+	Client   string `json:"client"`
+}
@@ -0,0 +1,84 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestProtocol_EscapeSplit(t *testing.T) {
+
+	keys := []string{"key", "a/b", ".", "..", "a b&c=d#e?f", "%", "\xff\x00"}
+
+	for _, key := range keys {
+		path := KeysPath + "/" + EscapeSegment(key) + "/" + EscapeSegment(key)
+
+		segments, err := SplitPath(path, KeysPath)
+
+		if err != nil {
+			t.Fatalf("Failed to split %s: %s", path, err)
+		}
+
+		if len(segments) != 2 || segments[0] != key || segments[1] != key {
+			t.Errorf("Expected [%q %q] but actual %q", key, key, segments)
+		}
+	}
+}
+
+func TestProtocol_SplitPath(t *testing.T) {
+
+	segments, err := SplitPath(KeysPath, KeysPath)
+
+	if err != nil || len(segments) != 0 {
+		t.Errorf("Expected no segments but actual %q, err = %v", segments, err)
+	}
+
+	segments, err = SplitPath(KeysPath+"/", KeysPath)
+
+	if err != nil || len(segments) != 1 || segments[0] != "" {
+		t.Errorf("Expected an empty segment but actual %q, err = %v", segments, err)
+	}
+
+	if _, err := SplitPath("/v2/keysx", KeysPath); err != ErrBadPath {
+		t.Error("Expected bad path but actual", err)
+	}
+
+	if _, err := SplitPath("/keys", KeysPath); err != ErrBadPath {
+		t.Error("Expected bad path but actual", err)
+	}
+}
+
+func TestProtocol_WriteReadValues(t *testing.T) {
+
+	values := []string{"", "value", "a,b\r\n\"c\"", "\x00\xff\xfe", string(make([]byte, 1000))}
+
+	buffer := &bytes.Buffer{}
+
+	if err := WriteValues(buffer, values); err != nil {
+		t.Fatal("Failed to write values", err)
+	}
+
+	read, err := ReadValues(buffer)
+
+	if err != nil {
+		t.Fatal("Failed to read values", err)
+	}
+
+	if len(read) != len(values) {
+		t.Fatalf("Expected %d values but actual %d", len(values), len(read))
+	}
+
+	for i := range values {
+		if read[i] != values[i] {
+			t.Errorf("Expected %q but actual %q", values[i], read[i])
+		}
+	}
+
+	// Truncated input
+	buffer.Reset()
+	WriteValues(buffer, []string{"value"})
+	truncated := buffer.Bytes()[:3]
+
+	if _, err := ReadValues(bytes.NewReader(truncated)); err == nil {
+		t.Error("Expected an error reading truncated values")
+	}
+}
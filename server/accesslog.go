@@ -0,0 +1,291 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"gcache/server/acl"
+	"gcache/trace"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Query parameters logged as they are, the values of any other are redacted
+var loggedParams = map[string]bool{"op": true, "ttl": true, "from": true, "to": true, "section": true, "name": true, "count": true, "replace": true}
+
+const redacted = "REDACTED"
+
+// Options of the access log
+type AccessLogConfig struct {
+	// Writer of the log lines, os.Stdout by default
+	Output io.Writer
+	// Log a hash of the keys instead of the keys
+	HashKeys bool
+	// Log one of every Sample requests, zero or one logs every request. Server errors are always logged
+	Sample int
+}
+
+// Line of the access log, values of keys and passwords are never logged
+type accessLogEntry struct {
+	Time      string  `json:"time"`
+	Method    string  `json:"method"`
+	Route     string  `json:"route"`
+	Command   string  `json:"command,omitempty"`
+	Key       string  `json:"key,omitempty"`
+	Keys      int     `json:"keys,omitempty"`
+	Query     string  `json:"query,omitempty"`
+	Status    int     `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Bytes     int64   `json:"bytes"`
+	Client    string  `json:"client"`
+	TraceID   string  `json:"trace_id,omitempty"`
+	SpanID    string  `json:"span_id,omitempty"`
+}
+
+type accessLog struct {
+	enabled int32
+	// Requests seen while enabled, for sampling
+	requests uint64
+
+	mutex  sync.Mutex
+	config AccessLogConfig
+}
+
+func (l *accessLog) configuration() AccessLogConfig {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.config
+}
+
+// Whether the request is logged, one of every Sample requests and every server error
+func (l *accessLog) sampled(config AccessLogConfig, status int) bool {
+	n := atomic.AddUint64(&l.requests, 1)
+	return config.Sample <= 1 || status >= http.StatusInternalServerError || n%uint64(config.Sample) == 1
+}
+
+func (l *accessLog) update(change func(config *AccessLogConfig)) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	change(&l.config)
+}
+
+func (l *accessLog) write(config AccessLogConfig, entry accessLogEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	output := config.Output
+	if output == nil {
+		output = os.Stdout
+	}
+
+	l.mutex.Lock()
+	output.Write(append(line, '\n'))
+	l.mutex.Unlock()
+}
+
+// Configure and enable the access log, it may be changed while serving
+func (s *Server) SetAccessLog(config AccessLogConfig) {
+	s.accessLog.mutex.Lock()
+	s.accessLog.config = config
+	s.accessLog.mutex.Unlock()
+
+	s.SetAccessLogging(true)
+}
+
+// Enable or disable the access log, it may be changed while serving
+func (s *Server) SetAccessLogging(enabled bool) {
+	value := int32(0)
+	if enabled {
+		value = 1
+	}
+	atomic.StoreInt32(&s.accessLog.enabled, value)
+}
+
+// Whether requests are logged
+func (s *Server) AccessLogging() bool {
+	return atomic.LoadInt32(&s.accessLog.enabled) == 1
+}
+
+// Enable or disable the access log.
+//
+// Deprecated: urls are not logged anymore, use SetAccessLogging
+func (s *Server) SetUrlLogging(enabled bool) {
+	s.SetAccessLogging(enabled)
+}
+
+// Whether requests are logged.
+//
+// Deprecated: use AccessLogging
+func (s *Server) UrlLogging() bool {
+	return s.AccessLogging()
+}
+
+type commandKey struct{}
+
+// Command of a request observed by the observing handler. It's classified once the user is authenticated,
+// so that the bodies of unauthenticated requests are not read
+type observedCommand struct {
+	wanted     bool
+	classified bool
+	command    acl.Command
+}
+
+// Get the command classified for the observing handler, so that a request is classified once
+func commandFrom(ctx context.Context) (acl.Command, bool) {
+	observed, ok := ctx.Value(commandKey{}).(*observedCommand)
+	if !ok || !observed.classified {
+		return acl.Command{}, false
+	}
+	return observed.command, true
+}
+
+// Classify the command of an authenticated request if it's needed, or if the observing handler wants it.
+// The command is recorded for the observing handler and the handlers after
+func classifyOnce(r *http.Request, classify classifier, needed bool) (acl.Command, bool) {
+	observed, ok := r.Context().Value(commandKey{}).(*observedCommand)
+	if ok && observed.classified {
+		return observed.command, true
+	}
+
+	if !needed && (!ok || !observed.wanted) {
+		return acl.Command{}, false
+	}
+
+	command := classify(r)
+	if ok {
+		observed.command = command
+		observed.classified = true
+	}
+	return command, true
+}
+
+// Observing handler. Measures the latency of requests for the metrics, records the span of the request,
+// writes the access log and records slow commands
+func (s *Server) observeHandler(route string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		// Spans of the cache commands are started by the tracer of the context
+		ctx := trace.ContextWithTracer(r.Context(), s.tracer)
+		if parent, ok := trace.Extract(r.Header); ok {
+			ctx = trace.ContextWithSpanContext(ctx, parent)
+		}
+
+		ctx, span := s.tracer.Start(ctx, "gcache.server "+route)
+		r = r.WithContext(ctx)
+
+		// Bodies are limited before anything reads them
+		s.limitBody(w, r)
+
+		logging := s.AccessLogging()
+		slowlogged := s.slowlog.slowerThan() > 0 && !streamRoutes[route]
+		traced := s.tracer != trace.Noop
+
+		// Bodies are read by the handler, so the command is classified before by the auth handler.
+		// Commands of unauthenticated requests are unknown
+		observed := &observedCommand{wanted: logging || slowlogged || traced}
+		r = r.WithContext(context.WithValue(r.Context(), commandKey{}, observed))
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		start := time.Now()
+
+		h.ServeHTTP(recorder, r)
+
+		latency := time.Since(start)
+		command := observed.command
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		s.metrics.observe(route, status, latency)
+
+		if command.Name != "" {
+			span.SetAttribute("gcache.command", command.Name)
+		}
+		span.SetAttribute("http.status_code", status)
+		span.End()
+
+		var config AccessLogConfig
+		if logging || slowlogged {
+			config = s.accessLog.configuration()
+		}
+
+		if slowlogged && latency >= s.slowlog.slowerThan() {
+			s.slowlog.add(start, latency, command.Name, hashKeys(config, command.Keys), r.RemoteAddr)
+		}
+
+		if logging && s.accessLog.sampled(config, status) {
+			entry := accessLogEntry{
+				Time:      start.UTC().Format(time.RFC3339Nano),
+				Method:    r.Method,
+				Route:     route,
+				Command:   command.Name,
+				Query:     redactQuery(r.URL.RawQuery),
+				Status:    status,
+				LatencyMs: float64(latency.Microseconds()) / 1000,
+				Bytes:     recorder.bytes,
+				Client:    r.RemoteAddr,
+			}
+
+			if len(command.Keys) > 0 {
+				entry.Key = hashKey(config, command.Keys[0])
+			}
+			if len(command.Keys) > 1 {
+				entry.Keys = len(command.Keys)
+			}
+
+			if sc := span.SpanContext(); sc.IsValid() {
+				entry.TraceID = sc.TraceID.String()
+				entry.SpanID = sc.SpanID.String()
+			}
+
+			s.accessLog.write(config, entry)
+		}
+	})
+}
+
+func hashKey(config AccessLogConfig, key string) string {
+	if !config.HashKeys {
+		return key
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+func hashKeys(config AccessLogConfig, keys []string) []string {
+	hashed := make([]string, len(keys))
+	for i, key := range keys {
+		hashed[i] = hashKey(config, key)
+	}
+	return hashed
+}
+
+// Keep the parameters which are not values, keys or secrets
+func redactQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return redacted
+	}
+
+	for name, values := range query {
+		if !loggedParams[name] {
+			for i := range values {
+				values[i] = redacted
+			}
+		}
+	}
+
+	return query.Encode()
+}
@@ -0,0 +1,220 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"gcache/protocol"
+	"gcache/trace"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_AccessLog(t *testing.T) {
+
+	s := NewServer()
+	output := &bytes.Buffer{}
+	s.SetAccessLog(AccessLogConfig{Output: output})
+
+	serveAs(s, "", http.MethodPost, protocol.KeysPath+"/user:1?ttl=10", "secret value")
+	serveAs(s, "", http.MethodGet, "/keys?key=user:1", "")
+	serveAs(s, "", http.MethodGet, protocol.KeysPath+"/missing", "")
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 lines but actual %d: %s", len(lines), output.String())
+	}
+
+	if strings.Contains(output.String(), "secret") {
+		t.Error("Expected the values not to be logged", output.String())
+	}
+
+	entry := accessLogEntry{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal("Failed to decode the line", err)
+	}
+
+	if entry.Method != http.MethodPost || entry.Route != protocol.KeysPath+"/" || entry.Command != protocol.OpSet ||
+		entry.Key != "user:1" || entry.Query != "ttl=10" || entry.Status != http.StatusOK || entry.Client == "" {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+
+	// Keys in the query are logged as the key only
+	json.Unmarshal([]byte(lines[1]), &entry)
+	if entry.Key != "user:1" || entry.Query != "key="+redacted || entry.Bytes != int64(len("secret value")) {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+
+	json.Unmarshal([]byte(lines[2]), &entry)
+	if entry.Status != http.StatusNotFound {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+
+	// Disabled
+	s.SetAccessLogging(false)
+	output.Reset()
+	serveAs(s, "", http.MethodGet, protocol.KeysPath+"/missing", "")
+
+	if output.Len() != 0 {
+		t.Error("Expected nothing to be logged", output.String())
+	}
+}
+
+func TestServer_AccessLogHashSample(t *testing.T) {
+
+	s := NewServer()
+	output := &bytes.Buffer{}
+	s.SetAccessLog(AccessLogConfig{Output: output, HashKeys: true, Sample: 3})
+
+	for i := 0; i < 6; i++ {
+		serveAs(s, "", http.MethodGet, protocol.KeysPath+"/user:1", "")
+	}
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected one of every 3 requests to be logged but actual %d lines", len(lines))
+	}
+
+	entry := accessLogEntry{}
+	json.Unmarshal([]byte(lines[0]), &entry)
+	if entry.Key == "" || entry.Key == "user:1" || entry.Key != hashKey(AccessLogConfig{HashKeys: true}, "user:1") {
+		t.Errorf("Expected the key to be hashed but actual %q", entry.Key)
+	}
+
+	// Multiple keys are counted
+	output.Reset()
+	s.SetAccessLog(AccessLogConfig{Output: output})
+	serveAs(s, "", http.MethodPost, protocol.MGetPath, `{"keys":["a","b","c"]}`)
+
+	json.Unmarshal(output.Bytes(), &entry)
+	if entry.Key != "a" || entry.Keys != 3 {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+}
+
+func TestRedactQuery(t *testing.T) {
+
+	cases := map[string]string{
+		"":                         "",
+		"ttl=10":                   "ttl=10",
+		"key=a&value=secret":       "key=REDACTED&value=REDACTED",
+		"op=range&from=0&to=-1":    "from=0&op=range&to=-1",
+		"name=maxmemory&value=1mb": "name=maxmemory&value=REDACTED",
+		"%zz":                      "REDACTED",
+	}
+
+	for query, expected := range cases {
+		if actual := redactQuery(query); actual != expected {
+			t.Errorf("Expected %q to be %q but actual %q", query, expected, actual)
+		}
+	}
+}
+
+func TestServer_ClassifiedOnce(t *testing.T) {
+
+	s := NewServer()
+	s.SetAccessLog(AccessLogConfig{Output: &bytes.Buffer{}})
+	s.ACL().SetUser("reader", "on", ">reader", "~cache:*", "+@read")
+	s.Cache().Set("cache:1", "value", time.Minute)
+
+	// The batch body is read once for the permissions and the log, and still served
+	rr := serveAs(s, basicAuth("reader", "reader"), http.MethodPost, protocol.BatchPath, `[{"op":"get","key":"cache:1"}]`)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "value") {
+		t.Errorf("Unexpected response %v %s", rr.Code, rr.Body.String())
+	}
+}
+
+// Body failing the test if it's read
+type unreadBody struct {
+	t *testing.T
+}
+
+func (b unreadBody) Read(p []byte) (int, error) {
+	b.t.Error("Expected the body not to be read")
+	return 0, io.EOF
+}
+
+func TestServer_UnauthenticatedBody(t *testing.T) {
+
+	s := NewServerWithAuth("admin")
+	output := &bytes.Buffer{}
+	s.SetAccessLog(AccessLogConfig{Output: output})
+
+	// Bodies of unauthenticated requests are not read, neither for the permissions nor for the log
+	for _, path := range []string{protocol.BatchPath, protocol.MGetPath, protocol.MSetPath, protocol.MDelPath} {
+		req := httptest.NewRequest(http.MethodPost, path, unreadBody{t})
+		req.Header.Set(headerAuthorization, "wrong")
+		rr := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401 but actual %d", path, rr.Code)
+		}
+	}
+
+	entry := accessLogEntry{}
+	json.Unmarshal([]byte(strings.Split(output.String(), "\n")[0]), &entry)
+	if entry.Status != http.StatusUnauthorized || entry.Command != "" {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+
+	// Authenticated requests are logged with their commands
+	output.Reset()
+	serveAs(s, "admin", http.MethodPost, protocol.MGetPath, `{"keys":["a","b"]}`)
+
+	json.Unmarshal(output.Bytes(), &entry)
+	if entry.Status != http.StatusOK || entry.Command != "mget" || entry.Key != "a" || entry.Keys != 2 {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+}
+
+func TestServer_Tracing(t *testing.T) {
+
+	spans := []*trace.SpanData{}
+	s := NewServer()
+	s.SetTracer(trace.NewTracer(trace.ExporterFunc(func(span *trace.SpanData) {
+		spans = append(spans, span)
+	})))
+
+	output := &bytes.Buffer{}
+	s.SetAccessLog(AccessLogConfig{Output: output})
+
+	req := httptest.NewRequest(http.MethodGet, protocol.KeysPath+"/missing", nil)
+	req.Header.Set(trace.HeaderTraceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	s.Handler().ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(spans) != 2 {
+		t.Fatalf("Expected the cache and the server spans but actual %d", len(spans))
+	}
+
+	cacheSpan, serverSpan := spans[0], spans[1]
+
+	if serverSpan.Name != "gcache.server "+protocol.KeysPath+"/" || serverSpan.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" ||
+		serverSpan.ParentID.String() != "00f067aa0ba902b7" || serverSpan.Attributes["gcache.command"] != protocol.OpGet ||
+		serverSpan.Attributes["http.status_code"] != http.StatusNotFound {
+		t.Errorf("Unexpected server span %+v", serverSpan)
+	}
+
+	if cacheSpan.Name != "gcache.cache get" || cacheSpan.TraceID != serverSpan.TraceID || cacheSpan.ParentID != serverSpan.SpanID {
+		t.Errorf("Unexpected cache span %+v", cacheSpan)
+	}
+
+	entry := accessLogEntry{}
+	json.Unmarshal(output.Bytes(), &entry)
+	if entry.TraceID != serverSpan.TraceID.String() || entry.SpanID != serverSpan.SpanID.String() {
+		t.Errorf("Expected the trace of the server span to be logged but actual %+v", entry)
+	}
+
+	// Trace ids of the incoming requests are logged without a tracer
+	s.SetTracer(trace.Noop)
+	output.Reset()
+	s.Handler().ServeHTTP(httptest.NewRecorder(), req)
+
+	json.Unmarshal(output.Bytes(), &entry)
+	if entry.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected the incoming trace to be logged but actual %+v", entry)
+	}
+}
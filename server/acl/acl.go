@@ -0,0 +1,584 @@
+// Package acl implements users with permissions per command category and key pattern,
+// following the semantics of Redis ACLs
+package acl
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gcache/protocol"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Name of the user requests without a user name are authenticated as
+const DefaultUser = "default"
+
+var ErrAuthFailed = errors.New("Invalid username-password pair or user is disabled")
+var ErrNoPerm = errors.New("No permissions to run the command")
+var ErrUserNotFound = errors.New("User not found")
+var ErrDefaultUser = errors.New("The default user can not be deleted")
+var ErrNoFile = errors.New("ACL is not loaded from a file")
+
+// Category of commands
+type Category uint
+
+const (
+	// Commands reading keys
+	CategoryRead Category = 1 << iota
+	// Commands writing keys
+	CategoryWrite
+	// Commands on the whole key space, e.g. listing keys
+	CategoryKeyspace
+	// Commands on lists
+	CategoryList
+	// Commands on hashes
+	CategoryHash
+	// Administrative commands, e.g. managing users and cluster membership
+	CategoryAdmin
+
+	CategoryAll = CategoryRead | CategoryWrite | CategoryKeyspace | CategoryList | CategoryHash | CategoryAdmin
+)
+
+var categoryNames = []struct {
+	name     string
+	category Category
+}{
+	{"read", CategoryRead},
+	{"write", CategoryWrite},
+	{"keyspace", CategoryKeyspace},
+	{"list", CategoryList},
+	{"hash", CategoryHash},
+	{"admin", CategoryAdmin},
+}
+
+func parseCategory(name string) (Category, error) {
+	if name == "all" {
+		return CategoryAll, nil
+	}
+
+	for _, c := range categoryNames {
+		if c.name == name {
+			return c.category, nil
+		}
+	}
+
+	return 0, fmt.Errorf("Unknown category '%s'", name)
+}
+
+// Return the names of the categories
+func (c Category) Names() []string {
+	if c == CategoryAll {
+		return []string{"all"}
+	}
+
+	names := []string{}
+	for _, n := range categoryNames {
+		if c&n.category != 0 {
+			names = append(names, n.name)
+		}
+	}
+	return names
+}
+
+// Command run by a request: the categories it belongs to and the keys it accesses
+type Command struct {
+	Name       string
+	Categories Category
+	Keys       []string
+}
+
+// Error of a command the user may not run, it is ErrNoPerm.
+// Either the categories the user misses or the key it may not access is set
+type PermissionError struct {
+	User       string
+	Command    string
+	Categories Category
+	Key        string
+}
+
+func (e *PermissionError) Error() string {
+	if e.Categories != 0 {
+		return fmt.Sprintf("User %s has no permissions to run the '%s' command (@%s)",
+			e.User, e.Command, strings.Join(e.Categories.Names(), ", @"))
+	}
+	return fmt.Sprintf("User %s has no permissions to access the '%s' key", e.User, e.Key)
+}
+
+func (e *PermissionError) Is(target error) bool {
+	return target == ErrNoPerm
+}
+
+// User with its permissions
+type User struct {
+	Name    string
+	Enabled bool
+	// Any password is accepted
+	NoPass bool
+	// Sha256 hashes of the passwords, hex encoded
+	Passwords []string
+	// Categories of commands the user may run
+	Categories Category
+	// Glob patterns of keys the user may access
+	KeyPatterns []string
+}
+
+// Whether the user may run any command on any key
+func (u *User) Unrestricted() bool {
+	return u.Categories == CategoryAll && u.allKeys()
+}
+
+func (u *User) allKeys() bool {
+	for _, pattern := range u.KeyPatterns {
+		if pattern == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// Check whether the user may run the command. The user must have all the categories
+// of the command, and every key must match one of the key patterns
+func (u *User) Check(command Command) error {
+
+	if missing := command.Categories &^ u.Categories; missing != 0 {
+		return &PermissionError{User: u.Name, Command: command.Name, Categories: missing}
+	}
+
+	for _, key := range command.Keys {
+		if !u.mayAccess(key) {
+			return &PermissionError{User: u.Name, Command: command.Name, Key: key}
+		}
+	}
+
+	return nil
+}
+
+func (u *User) mayAccess(key string) bool {
+	for _, pattern := range u.KeyPatterns {
+		if protocol.MatchGlob(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *User) checkPassword(password string) bool {
+	if u.NoPass {
+		return true
+	}
+
+	hash := hashPassword(password)
+	for _, h := range u.Passwords {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// Describe the user by rules which recreate it, passwords are hashed
+func (u *User) Rules() string {
+	rules := []string{}
+
+	if u.Enabled {
+		rules = append(rules, "on")
+	} else {
+		rules = append(rules, "off")
+	}
+
+	if u.NoPass {
+		rules = append(rules, "nopass")
+	}
+
+	for _, hash := range u.Passwords {
+		rules = append(rules, "#"+hash)
+	}
+
+	for _, pattern := range u.KeyPatterns {
+		rules = append(rules, "~"+pattern)
+	}
+
+	if u.Categories == 0 {
+		rules = append(rules, "-@all")
+	}
+
+	for _, name := range u.Categories.Names() {
+		rules = append(rules, "+@"+name)
+	}
+
+	return strings.Join(rules, " ")
+}
+
+// Apply a rule:
+//
+//	on, off           enable or disable the user
+//	>password         add the password
+//	<password         remove the password
+//	#hash             add the sha256 hash of a password
+//	nopass            accept any password
+//	resetpass         forget the passwords and require one
+//	+@category        allow the commands of the category, +@all allows all commands
+//	-@category        disallow the commands of the category
+//	allcommands       the same as +@all
+//	nocommands        the same as -@all
+//	~pattern          allow the keys matching the glob pattern
+//	allkeys           the same as ~*
+//	resetkeys         forget the key patterns
+//	reset             reset the user to a disabled one with no passwords and permissions
+func (u *User) apply(rule string) error {
+
+	switch rule {
+	case "on":
+		u.Enabled = true
+		return nil
+	case "off":
+		u.Enabled = false
+		return nil
+	case "nopass":
+		u.NoPass = true
+		u.Passwords = nil
+		return nil
+	case "resetpass":
+		u.NoPass = false
+		u.Passwords = nil
+		return nil
+	case "allcommands":
+		u.Categories = CategoryAll
+		return nil
+	case "nocommands":
+		u.Categories = 0
+		return nil
+	case "allkeys":
+		u.KeyPatterns = []string{"*"}
+		return nil
+	case "resetkeys":
+		u.KeyPatterns = nil
+		return nil
+	case "reset":
+		*u = User{Name: u.Name}
+		return nil
+	}
+
+	if rule == "" {
+		return fmt.Errorf("Empty rule")
+	}
+
+	switch rule[0] {
+	case '>':
+		u.addPassword(hashPassword(rule[1:]))
+		return nil
+
+	case '<':
+		u.removePassword(hashPassword(rule[1:]))
+		return nil
+
+	case '#':
+		hash := strings.ToLower(rule[1:])
+		if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size {
+			return fmt.Errorf("Password hash must be a hex encoded sha256")
+		}
+		u.addPassword(hash)
+		return nil
+
+	case '~':
+		u.KeyPatterns = append(u.KeyPatterns, rule[1:])
+		return nil
+
+	case '+', '-':
+		if !strings.HasPrefix(rule[1:], "@") {
+			return fmt.Errorf("Rule '%s' must name a category, e.g. +@read", rule)
+		}
+
+		category, err := parseCategory(rule[2:])
+		if err != nil {
+			return err
+		}
+
+		if rule[0] == '+' {
+			u.Categories |= category
+		} else {
+			u.Categories &^= category
+		}
+		return nil
+	}
+
+	return fmt.Errorf("Syntax error in rule '%s'", rule)
+}
+
+func (u *User) addPassword(hash string) {
+	u.NoPass = false
+	for _, h := range u.Passwords {
+		if h == hash {
+			return
+		}
+	}
+	u.Passwords = append(u.Passwords, hash)
+}
+
+func (u *User) removePassword(hash string) {
+	passwords := []string{}
+	for _, h := range u.Passwords {
+		if h != hash {
+			passwords = append(passwords, h)
+		}
+	}
+	u.Passwords = passwords
+}
+
+func (u *User) clone() *User {
+	c := *u
+	c.Passwords = append([]string{}, u.Passwords...)
+	c.KeyPatterns = append([]string{}, u.KeyPatterns...)
+	return &c
+}
+
+func hashPassword(password string) string {
+	hash := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(hash[:])
+}
+
+// Users of a server
+type ACL struct {
+	mutex sync.RWMutex
+	users map[string]*User
+	// File the users are loaded from and saved to
+	file string
+	// Users defined by the last load
+	loaded map[string]bool
+}
+
+// Create an ACL with the default user which may run any command without a password
+func New() *ACL {
+	a := &ACL{users: make(map[string]*User)}
+	a.users[DefaultUser] = newDefaultUser()
+	return a
+}
+
+func newDefaultUser() *User {
+	return &User{
+		Name:        DefaultUser,
+		Enabled:     true,
+		NoPass:      true,
+		Categories:  CategoryAll,
+		KeyPatterns: []string{"*"},
+	}
+}
+
+// Create the user or modify the existing one by the rules. A new user is disabled
+// and has no permissions until the rules grant them. Nothing changes if a rule is invalid
+func (a *ACL) SetUser(name string, rules ...string) error {
+
+	if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+		return fmt.Errorf("Invalid user name '%s'", name)
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	user, exists := a.users[name]
+	if exists {
+		user = user.clone()
+	} else {
+		user = &User{Name: name}
+	}
+
+	for _, rule := range rules {
+		if err := user.apply(rule); err != nil {
+			return err
+		}
+	}
+
+	a.users[name] = user
+	return nil
+}
+
+// Delete the user
+func (a *ACL) DelUser(name string) error {
+	if name == DefaultUser {
+		return ErrDefaultUser
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if _, exists := a.users[name]; !exists {
+		return ErrUserNotFound
+	}
+
+	delete(a.users, name)
+	return nil
+}
+
+// Get a copy of the user
+func (a *ACL) User(name string) (*User, bool) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	user, ok := a.users[name]
+	if !ok {
+		return nil, false
+	}
+	return user.clone(), true
+}
+
+// Get copies of all the users sorted by name
+func (a *ACL) Users() []*User {
+	a.mutex.RLock()
+	users := make([]*User, 0, len(a.users))
+	for _, user := range a.users {
+		users = append(users, user.clone())
+	}
+	a.mutex.RUnlock()
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Name < users[j].Name
+	})
+
+	return users
+}
+
+// Authenticate the user by the password. Return a copy of the user,
+// so that its permissions stay the same during a request
+func (a *ACL) Authenticate(name string, password string) (*User, error) {
+	user, ok := a.User(name)
+
+	if !ok || !user.Enabled || !user.checkPassword(password) {
+		return nil, ErrAuthFailed
+	}
+
+	return user, nil
+}
+
+// Replace the users by the ones read from the file and remember the file to save the users to.
+// The default user is kept as it is unless the file defines it
+func (a *ACL) LoadFile(path string) error {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	if err := a.Load(file); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	a.mutex.Lock()
+	a.file = path
+	a.mutex.Unlock()
+
+	return nil
+}
+
+// Load the file the users have been loaded from again
+func (a *ACL) Reload() error {
+	a.mutex.RLock()
+	file := a.file
+	a.mutex.RUnlock()
+
+	if file == "" {
+		return ErrNoFile
+	}
+
+	return a.LoadFile(file)
+}
+
+// Replace the users by the ones read in the format of Write.
+// The default user is kept as it is unless it is defined. Nothing changes if a line is invalid
+func (a *ACL) Load(r io.Reader) error {
+
+	loaded := New()
+
+	a.mutex.RLock()
+	loaded.users[DefaultUser] = a.users[DefaultUser].clone()
+	a.mutex.RUnlock()
+
+	defined := map[string]bool{}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+
+		// Skip empty lines and comments
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		if fields[0] != "user" || len(fields) < 2 {
+			return fmt.Errorf("line %d: expected 'user <name> <rules>'", line)
+		}
+
+		// Users are defined from scratch rather than modified
+		rules := append([]string{"reset"}, fields[2:]...)
+
+		if err := loaded.SetUser(fields[1], rules...); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		defined[fields[1]] = true
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	a.mutex.Lock()
+	a.users = loaded.users
+	a.loaded = defined
+	a.mutex.Unlock()
+
+	return nil
+}
+
+// Whether the user is defined by the users last loaded, rather than kept as it was like the default user
+func (a *ACL) Loaded(name string) bool {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return a.loaded[name]
+}
+
+// Write the users as lines of 'user <name> <rules>'
+func (a *ACL) Write(w io.Writer) error {
+	for _, user := range a.Users() {
+		if _, err := fmt.Fprintf(w, "user %s %s\n", user.Name, user.Rules()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Save the users into the file they have been loaded from
+func (a *ACL) Save() error {
+	a.mutex.RLock()
+	path := a.file
+	a.mutex.RUnlock()
+
+	if path == "" {
+		return ErrNoFile
+	}
+
+	tmpPath := path + ".tmp"
+
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err := a.Write(file); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
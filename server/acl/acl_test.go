@@ -0,0 +1,221 @@
+package acl
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestACL_DefaultUser(t *testing.T) {
+
+	a := New()
+
+	user, err := a.Authenticate(DefaultUser, "anything")
+	if err != nil {
+		t.Fatal("Expected the default user to need no password but actual", err)
+	}
+
+	if !user.Unrestricted() {
+		t.Error("Expected the default user to be unrestricted, rules", user.Rules())
+	}
+
+	if err := a.DelUser(DefaultUser); err != ErrDefaultUser {
+		t.Error("Expected the default user not to be deleted but actual", err)
+	}
+}
+
+func TestACL_SetUser(t *testing.T) {
+
+	a := New()
+
+	if err := a.SetUser("alice", "on", ">secret", "~cache:*", "+@read"); err != nil {
+		t.Fatal("Failed to set the user", err)
+	}
+
+	if _, err := a.Authenticate("alice", "wrong"); err != ErrAuthFailed {
+		t.Error("Expected a wrong password to fail but actual", err)
+	}
+
+	if _, err := a.Authenticate("bob", "secret"); err != ErrAuthFailed {
+		t.Error("Expected an unknown user to fail but actual", err)
+	}
+
+	user, err := a.Authenticate("alice", "secret")
+	if err != nil {
+		t.Fatal("Failed to authenticate", err)
+	}
+
+	cases := []struct {
+		command Command
+		allowed bool
+	}{
+		{Command{Name: "get", Categories: CategoryRead, Keys: []string{"cache:1"}}, true},
+		{Command{Name: "get", Categories: CategoryRead, Keys: []string{"other"}}, false},
+		{Command{Name: "set", Categories: CategoryWrite, Keys: []string{"cache:1"}}, false},
+		{Command{Name: "lrange", Categories: CategoryList | CategoryRead, Keys: []string{"cache:1"}}, false},
+		{Command{Name: "whoami"}, true},
+	}
+
+	for _, c := range cases {
+		err := user.Check(c.command)
+
+		if c.allowed && err != nil {
+			t.Errorf("Expected %+v to be allowed but actual %v", c.command, err)
+		}
+
+		if !c.allowed && !errors.Is(err, ErrNoPerm) {
+			t.Errorf("Expected %+v to be denied but actual %v", c.command, err)
+		}
+	}
+
+	// Rules modify the existing user, an invalid rule changes nothing
+	if err := a.SetUser("alice", "+@write", "+@nothing"); err == nil {
+		t.Error("Expected an unknown category to fail")
+	}
+
+	if err := a.SetUser("alice", "off"); err != nil {
+		t.Fatal("Failed to set the user", err)
+	}
+
+	if _, err := a.Authenticate("alice", "secret"); err != ErrAuthFailed {
+		t.Error("Expected a disabled user to fail but actual", err)
+	}
+
+	user, _ = a.User("alice")
+	if rules := user.Rules(); strings.Contains(rules, "secret") || !strings.Contains(rules, "+@read") || strings.Contains(rules, "+@write") {
+		t.Errorf("Unexpected rules %q", rules)
+	}
+}
+
+func TestACL_NewUserIsDisabled(t *testing.T) {
+
+	a := New()
+	a.SetUser("bob", "nopass")
+
+	if _, err := a.Authenticate("bob", ""); err != ErrAuthFailed {
+		t.Error("Expected a new user to be disabled but actual", err)
+	}
+
+	a.SetUser("bob", "on")
+	user, err := a.Authenticate("bob", "")
+	if err != nil {
+		t.Fatal("Failed to authenticate", err)
+	}
+
+	if err := user.Check(Command{Name: "get", Categories: CategoryRead, Keys: []string{"key"}}); err == nil {
+		t.Error("Expected a new user to have no permissions")
+	}
+}
+
+func TestACL_Rules(t *testing.T) {
+
+	hash := hashPassword("secret")
+
+	user := &User{Name: "alice"}
+	for _, rule := range []string{"on", "#" + hash, "allkeys", "allcommands", "-@admin"} {
+		if err := user.apply(rule); err != nil {
+			t.Fatal("Failed to apply", rule, err)
+		}
+	}
+
+	if !user.checkPassword("secret") || user.checkPassword("other") {
+		t.Error("Expected the password to be checked by its hash")
+	}
+
+	if user.Unrestricted() || user.Categories != CategoryAll&^CategoryAdmin {
+		t.Errorf("Unexpected categories %v", user.Categories.Names())
+	}
+
+	user.apply("<secret")
+	if user.checkPassword("secret") {
+		t.Error("Expected the password to be removed")
+	}
+
+	for _, rule := range []string{"", "#abc", "+read", "-@unknown", "unknown"} {
+		if err := user.apply(rule); err == nil {
+			t.Errorf("Expected rule %q to fail", rule)
+		}
+	}
+
+	user.apply("reset")
+	if user.Enabled || user.Categories != 0 || len(user.KeyPatterns) != 0 {
+		t.Errorf("Expected reset to clear the user but actual %q", user.Rules())
+	}
+}
+
+func TestACL_File(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "users.acl")
+
+	content := "# users\n" +
+		"user alice on >secret ~cache:* +@read +@write\n" +
+		"\n" +
+		"user reader on nopass allkeys +@read\n"
+
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	a := New()
+	a.SetUser(DefaultUser, "resetpass", ">admin")
+	a.SetUser("removed", "on", "nopass")
+
+	if err := a.LoadFile(path); err != nil {
+		t.Fatal("Failed to load", err)
+	}
+
+	if _, ok := a.User("removed"); ok {
+		t.Error("Expected the users to be replaced by the file")
+	}
+
+	// The default user is kept unless the file defines it
+	if _, err := a.Authenticate(DefaultUser, "admin"); err != nil {
+		t.Error("Expected the default user to be kept but actual", err)
+	}
+
+	if a.Loaded(DefaultUser) || !a.Loaded("alice") {
+		t.Error("Expected only the users of the file to be loaded")
+	}
+
+	if _, err := a.Authenticate("alice", "secret"); err != nil {
+		t.Error("Failed to authenticate a user of the file", err)
+	}
+
+	// Saved users are loaded the same
+	a.SetUser("bob", "on", ">bob", "~bob:*", "+@hash")
+
+	if err := a.Save(); err != nil {
+		t.Fatal("Failed to save", err)
+	}
+
+	loaded := New()
+	if err := loaded.LoadFile(path); err != nil {
+		t.Fatal("Failed to load the saved file", err)
+	}
+
+	for _, user := range a.Users() {
+		loadedUser, ok := loaded.User(user.Name)
+		if !ok || loadedUser.Rules() != user.Rules() {
+			t.Errorf("Expected user %s %q to be saved but actual %+v", user.Name, user.Rules(), loadedUser)
+		}
+	}
+
+	if _, err := loaded.Authenticate("bob", "bob"); err != nil {
+		t.Error("Expected the hashed password to be saved but actual", err)
+	}
+
+	// A bad line changes nothing
+	if err := loaded.Load(strings.NewReader("user carol on\nuser dave +@unknown\n")); err == nil {
+		t.Error("Expected a bad line to fail")
+	}
+
+	if _, ok := loaded.User("carol"); ok {
+		t.Error("Expected the users not to change on failure")
+	}
+
+	if err := New().Save(); err != ErrNoFile {
+		t.Error("Expected no file but actual", err)
+	}
+}
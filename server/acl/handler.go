@@ -0,0 +1,114 @@
+package acl
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+type contextKey struct{}
+
+// Return the context carrying the authenticated user
+func WithUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, contextKey{}, user)
+}
+
+// Get the authenticated user of the context
+func UserFrom(ctx context.Context) (*User, bool) {
+	user, ok := ctx.Value(contextKey{}).(*User)
+	return user, ok
+}
+
+// Serve the ACL administration:
+//
+//	GET  ?op=whoami               name of the authenticated user
+//	GET                           users as lines of 'user <name> <rules>'
+//	POST ?op=setuser&name=<name>  create or modify the user by the rules in the body separated by spaces
+//	POST ?op=deluser&name=<name>  delete the user
+//	POST ?op=load                 load the users from the ACL file again
+//	POST ?op=save                 save the users into the ACL file
+//
+// Operations are read from the query only, so that rules like +@read survive form decoding
+func (a *ACL) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	query := req.URL.Query()
+	operation := query.Get("op")
+
+	switch req.Method {
+	case http.MethodGet:
+		if operation == "" {
+			a.usersQuery(w, req)
+			return
+		} else if operation == "whoami" {
+			a.whoAmIQuery(w, req)
+			return
+		}
+
+	case http.MethodPost:
+		if operation == "setuser" {
+			a.setUserCommand(w, req, query.Get("name"))
+			return
+		} else if operation == "deluser" {
+			a.delUserCommand(w, req, query.Get("name"))
+			return
+		} else if operation == "load" {
+			a.writeResult(w, a.Reload())
+			return
+		} else if operation == "save" {
+			a.writeResult(w, a.Save())
+			return
+		}
+	}
+
+	// Nothing matched, return bad request
+	http.Error(w, "Unsupported operation '"+operation+"' for method "+req.Method, http.StatusBadRequest)
+}
+
+func (a *ACL) usersQuery(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	if err := a.Write(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (a *ACL) whoAmIQuery(w http.ResponseWriter, req *http.Request) {
+	name := DefaultUser
+	if user, ok := UserFrom(req.Context()); ok {
+		name = user.Name
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(name))
+}
+
+func (a *ACL) setUserCommand(w http.ResponseWriter, req *http.Request, name string) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := a.SetUser(name, strings.Fields(string(body))...); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+func (a *ACL) delUserCommand(w http.ResponseWriter, req *http.Request, name string) {
+	err := a.DelUser(name)
+
+	if err == ErrUserNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	a.writeResult(w, err)
+}
+
+func (a *ACL) writeResult(w http.ResponseWriter, err error) {
+	if err == ErrNoFile || err == ErrDefaultUser {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
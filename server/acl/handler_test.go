@@ -0,0 +1,95 @@
+package acl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func serveACL(a *ACL, method string, target string, body string, user *User) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if user != nil {
+		req = req.WithContext(WithUser(req.Context(), user))
+	}
+
+	rr := httptest.NewRecorder()
+	a.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestACLHandler(t *testing.T) {
+
+	a := New()
+
+	rr := serveACL(a, http.MethodPost, "/acl?op=setuser&name=alice", "on >secret ~cache:* +@read", nil)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	if _, err := a.Authenticate("alice", "secret"); err != nil {
+		t.Error("Expected the user to be set but actual", err)
+	}
+
+	rr = serveACL(a, http.MethodGet, "/acl", "", nil)
+	if !strings.Contains(rr.Body.String(), "user alice on #") || !strings.Contains(rr.Body.String(), "user default on nopass") {
+		t.Errorf("Unexpected users %q", rr.Body.String())
+	}
+
+	user, _ := a.User("alice")
+	rr = serveACL(a, http.MethodGet, "/acl?op=whoami", "", user)
+	if rr.Body.String() != "alice" {
+		t.Errorf("Expected alice but actual %q", rr.Body.String())
+	}
+
+	rr = serveACL(a, http.MethodPost, "/acl?op=setuser&name=alice", "+@unknown", nil)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+
+	rr = serveACL(a, http.MethodPost, "/acl?op=deluser&name=alice", "", nil)
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	rr = serveACL(a, http.MethodPost, "/acl?op=deluser&name=alice", "", nil)
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+	}
+
+	// Saving needs a file
+	rr = serveACL(a, http.MethodPost, "/acl?op=save", "", nil)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+
+	rr = serveACL(a, http.MethodDelete, "/acl", "", nil)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+}
+
+func TestACLHandler_SaveLoad(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "users.acl")
+
+	a := New()
+	a.file = path
+
+	serveACL(a, http.MethodPost, "/acl?op=setuser&name=bob", "on nopass allkeys +@read", nil)
+
+	if rr := serveACL(a, http.MethodPost, "/acl?op=save", "", nil); rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	a.DelUser("bob")
+
+	if rr := serveACL(a, http.MethodPost, "/acl?op=load", "", nil); rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	if _, ok := a.User("bob"); !ok {
+		t.Error("Expected the saved user to be loaded")
+	}
+}
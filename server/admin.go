@@ -0,0 +1,478 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"gcache/protocol"
+	"gcache/server/handlers"
+	"math"
+	"net"
+	"net/http"
+	"path"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Version of the server reported by INFO, set at build time by -ldflags "-X gcache/server.Version=..."
+var Version = "dev"
+
+// Sections of INFO in the order they are written
+var infoSections = []string{"server", "clients", "memory", "persistence", "stats", "keyspace"}
+
+// Count the open connections when serving by Serve
+func (s *Server) countConnections(conn net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		atomic.AddInt64(&s.connections, 1)
+	case http.StateClosed, http.StateHijacked:
+		atomic.AddInt64(&s.connections, -1)
+	}
+}
+
+// Serve INFO, all the sections or the one of the section parameter.
+// Each section starts with a "# Section" line followed by "field:value" lines
+func (s *Server) infoQuery(w http.ResponseWriter, req *http.Request) {
+
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	sections := infoSections
+
+	if section := strings.ToLower(req.URL.Query().Get("section")); section != "" {
+		if !contains(infoSections, section) {
+			handlers.WriteError(w, req, http.StatusBadRequest, protocol.CodeBadRequest, "Unknown section '"+section+"'")
+			return
+		}
+		sections = []string{section}
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+
+	writer := bufio.NewWriter(w)
+	for i, section := range sections {
+		if i > 0 {
+			writer.WriteString("\n")
+		}
+		s.writeInfo(writer, section)
+	}
+	writer.Flush()
+}
+
+func (s *Server) writeInfo(w *bufio.Writer, section string) {
+
+	fmt.Fprintf(w, "# %s\n", strings.Title(section))
+
+	field := func(name string, value interface{}) {
+		fmt.Fprintf(w, "%s:%v\n", name, value)
+	}
+
+	dbs := s.databaseList()
+
+	switch section {
+	case "server":
+		field("version", Version)
+		field("go_version", runtime.Version())
+		field("uptime_in_seconds", int64(time.Since(s.startedAt).Seconds()))
+
+	case "clients":
+		subscribers := 0
+		for _, db := range dbs {
+			subscribers += db.invalidations.Subscribers()
+		}
+		field("connected_clients", atomic.LoadInt64(&s.connections))
+		field("invalidation_subscribers", subscribers)
+
+	case "memory":
+		used := int64(0)
+		for _, db := range dbs {
+			used += db.cache.Stats().Bytes
+		}
+
+		memStats := runtime.MemStats{}
+		runtime.ReadMemStats(&memStats)
+
+		field("used_memory", used)
+		field("heap_alloc", memStats.HeapAlloc)
+
+	case "persistence":
+		s.saveMutex.Lock()
+		lastSave, lastSaveErr := s.lastSave, s.lastSaveErr
+		s.saveMutex.Unlock()
+
+		status := "ok"
+		if lastSaveErr != nil {
+			status = "err"
+		}
+
+		lastSaveTime := int64(0)
+		if !lastSave.IsZero() {
+			lastSaveTime = lastSave.Unix()
+		}
+
+		field("snapshot_path", s.snapshotPath)
+		field("last_save_time", lastSaveTime)
+		field("last_save_status", status)
+
+	case "stats":
+		var hits, misses, expirations, evictions uint64
+		for _, db := range dbs {
+			stats := db.cache.Stats()
+			hits += stats.Hits
+			misses += stats.Misses
+			expirations += stats.Expirations
+			evictions += stats.Evictions
+		}
+
+		field("keyspace_hits", hits)
+		field("keyspace_misses", misses)
+		field("expired_keys", expirations)
+		field("evicted_keys", evictions)
+
+	case "keyspace":
+		for _, db := range dbs {
+			stats := db.cache.Stats()
+			field("db_"+db.name, fmt.Sprintf("keys=%d,lists=%d,hashes=%d,bytes=%d",
+				stats.Items(), stats.Lists, stats.Hashes, stats.Bytes))
+		}
+	}
+}
+
+// Delete the keys of all the databases, respond the number of deleted keys
+func (s *Server) flushAllCommand(w http.ResponseWriter, req *http.Request) {
+
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	flushed := 0
+	for _, db := range s.databaseList() {
+		flushed += db.cache.Flush()
+	}
+
+	fmt.Fprint(w, flushed)
+}
+
+// Save the snapshot now
+func (s *Server) saveCommand(w http.ResponseWriter, req *http.Request) {
+
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.snapshotPath == "" {
+		handlers.WriteError(w, req, http.StatusBadRequest, protocol.CodeBadRequest, "Snapshot path is not set")
+		return
+	}
+
+	if err := s.saveSnapshot(); err != nil {
+		handlers.WriteError(w, req, http.StatusInternalServerError, protocol.CodeInternal, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// Delete the keys of the database, respond the number of deleted keys
+func (s *Server) flushDBCommand(db *database) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+
+		if req.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		fmt.Fprint(w, db.cache.Flush())
+	})
+}
+
+// Respond the number of keys of the database
+func (s *Server) dbSizeQuery(db *database) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+
+		if req.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		fmt.Fprint(w, db.cache.Count())
+	})
+}
+
+// Setting tunable at runtime
+type setting struct {
+	get func() string
+	set func(value string) error
+}
+
+// Settings of the database, the ones of the logs and the limits of requests apply to the whole server
+func (s *Server) settings(db *database) map[string]setting {
+	return map[string]setting{
+		"maxitems": {
+			get: func() string { return strconv.Itoa(db.cache.MaxItems()) },
+			set: func(value string) error {
+				maxItems, err := strconv.Atoi(value)
+				if err != nil || maxItems < 0 {
+					return fmt.Errorf("Invalid number of keys '%s'", value)
+				}
+				db.cache.SetMaxItems(maxItems)
+				return nil
+			},
+		},
+		"maxmemory": {
+			get: func() string { return strconv.FormatInt(db.cache.MaxMemory(), 10) },
+			set: func(value string) error {
+				bytes, err := ParseBytes(value)
+				if err != nil {
+					return err
+				}
+				db.cache.SetMaxMemory(bytes)
+				return nil
+			},
+		},
+		"max-list-length": {
+			get: func() string { return strconv.Itoa(db.cache.MaxListLength()) },
+			set: func(value string) error {
+				length, err := strconv.Atoi(value)
+				if err != nil || length < 0 {
+					return fmt.Errorf("Invalid length '%s'", value)
+				}
+				db.cache.SetMaxListLength(length)
+				return nil
+			},
+		},
+		"max-hash-length": {
+			get: func() string { return strconv.Itoa(db.cache.MaxHashLength()) },
+			set: func(value string) error {
+				length, err := strconv.Atoi(value)
+				if err != nil || length < 0 {
+					return fmt.Errorf("Invalid length '%s'", value)
+				}
+				db.cache.SetMaxHashLength(length)
+				return nil
+			},
+		},
+		"eviction-interval": {
+			get: func() string { return db.cache.EvictionInterval().String() },
+			set: func(value string) error {
+				interval, err := time.ParseDuration(value)
+				if err != nil {
+					return fmt.Errorf("Invalid interval '%s'", value)
+				}
+				return db.cache.SetEvictionInterval(interval)
+			},
+		},
+		"access-log": {
+			get: func() string { return strconv.FormatBool(s.AccessLogging()) },
+			set: func(value string) error {
+				enabled, err := strconv.ParseBool(value)
+				if err != nil {
+					return fmt.Errorf("Invalid boolean '%s'", value)
+				}
+				s.SetAccessLogging(enabled)
+				return nil
+			},
+		},
+		"access-log-sample": {
+			get: func() string { return strconv.Itoa(s.accessLog.configuration().Sample) },
+			set: func(value string) error {
+				sample, err := strconv.Atoi(value)
+				if err != nil || sample < 0 {
+					return fmt.Errorf("Invalid sample '%s'", value)
+				}
+				s.accessLog.update(func(config *AccessLogConfig) { config.Sample = sample })
+				return nil
+			},
+		},
+		"access-log-hash-keys": {
+			get: func() string { return strconv.FormatBool(s.accessLog.configuration().HashKeys) },
+			set: func(value string) error {
+				hashKeys, err := strconv.ParseBool(value)
+				if err != nil {
+					return fmt.Errorf("Invalid boolean '%s'", value)
+				}
+				s.accessLog.update(func(config *AccessLogConfig) { config.HashKeys = hashKeys })
+				return nil
+			},
+		},
+		"rate-limit": {
+			get: func() string { return s.Limits().Rate.String() },
+			set: func(value string) error {
+				limit, err := ParseRateLimit(value)
+				if err != nil {
+					return err
+				}
+				s.limiter.update(func(limits *Limits) { limits.Rate = limit })
+				return nil
+			},
+		},
+		"route-rate-limits": {
+			get: func() string { return formatRouteRates(s.Limits().RouteRates) },
+			set: func(value string) error {
+				rates, err := ParseRouteRates(value)
+				if err != nil {
+					return err
+				}
+				s.limiter.update(func(limits *Limits) { limits.RouteRates = rates })
+				return nil
+			},
+		},
+		"max-body-size": {
+			get: func() string { return strconv.FormatInt(s.Limits().MaxBodySize, 10) },
+			set: func(value string) error {
+				bytes, err := ParseBytes(value)
+				if err != nil {
+					return err
+				}
+				s.limiter.update(func(limits *Limits) { limits.MaxBodySize = bytes })
+				return nil
+			},
+		},
+		"max-key-size": {
+			get: func() string { return strconv.Itoa(s.Limits().MaxKeySize) },
+			set: func(value string) error {
+				bytes, err := ParseBytes(value)
+				if err != nil {
+					return err
+				}
+				s.limiter.update(func(limits *Limits) { limits.MaxKeySize = int(bytes) })
+				return nil
+			},
+		},
+		"max-value-size": {
+			get: func() string { return strconv.FormatInt(s.Limits().MaxValueSize, 10) },
+			set: func(value string) error {
+				bytes, err := ParseBytes(value)
+				if err != nil {
+					return err
+				}
+				s.limiter.update(func(limits *Limits) { limits.MaxValueSize = bytes })
+				return nil
+			},
+		},
+		"slowlog-slower-than": {
+			get: func() string { return s.slowlog.slowerThan().String() },
+			set: func(value string) error {
+				duration, err := time.ParseDuration(value)
+				if err != nil || duration < 0 {
+					return fmt.Errorf("Invalid duration '%s'", value)
+				}
+				s.SetSlowlogSlowerThan(duration)
+				return nil
+			},
+		},
+		"slowlog-max-len": {
+			get: func() string { return strconv.Itoa(s.slowlog.length()) },
+			set: func(value string) error {
+				maxLen, err := strconv.Atoi(value)
+				if err != nil || maxLen < 0 {
+					return fmt.Errorf("Invalid length '%s'", value)
+				}
+				s.SetSlowlogMaxLen(maxLen)
+				return nil
+			},
+		},
+	}
+}
+
+// CONFIG GET responds "name value" lines of the settings matching the name pattern, all by default.
+// CONFIG SET sets the named setting to the value
+func (s *Server) configHandler(db *database) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+
+		settings := s.settings(db)
+		query := req.URL.Query()
+
+		switch req.Method {
+		case http.MethodGet:
+			pattern := query.Get("name")
+			if pattern == "" {
+				pattern = "*"
+			}
+
+			if _, err := path.Match(pattern, ""); err != nil {
+				handlers.WriteError(w, req, http.StatusBadRequest, protocol.CodeBadRequest, "Bad pattern '"+pattern+"'")
+				return
+			}
+
+			names := []string{}
+			for name := range settings {
+				if matched, _ := path.Match(pattern, name); matched {
+					names = append(names, name)
+				}
+			}
+			sort.Strings(names)
+
+			w.Header().Set("Content-Type", "text/plain")
+			for _, name := range names {
+				fmt.Fprintf(w, "%s %s\n", name, settings[name].get())
+			}
+
+		case http.MethodPost:
+			name := query.Get("name")
+
+			setting, ok := settings[name]
+			if !ok {
+				handlers.WriteError(w, req, http.StatusBadRequest, protocol.CodeBadRequest, "Unknown setting '"+name+"'")
+				return
+			}
+
+			if err := setting.set(query.Get("value")); err != nil {
+				handlers.WriteError(w, req, http.StatusBadRequest, protocol.CodeBadRequest, err.Error())
+				return
+			}
+
+			w.WriteHeader(http.StatusOK)
+
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// Parse a number of bytes with an optional kb, mb or gb suffix, e.g. 512mb
+func ParseBytes(value string) (int64, error) {
+
+	units := []struct {
+		suffix     string
+		multiplier int64
+	}{{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30}, {"b", 1}}
+
+	number := strings.ToLower(strings.TrimSpace(value))
+	multiplier := int64(1)
+
+	for _, unit := range units {
+		if strings.HasSuffix(number, unit.suffix) {
+			number = strings.TrimSuffix(number, unit.suffix)
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	bytes, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || bytes < 0 {
+		return 0, fmt.Errorf("Invalid number of bytes '%s'", value)
+	}
+
+	if bytes > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("Number of bytes '%s' is too large", value)
+	}
+
+	return bytes * multiplier, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"gcache/protocol"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_Info(t *testing.T) {
+
+	s := NewServer()
+	s.AddDatabase("sessions", 0)
+
+	s.Cache().Set("key", "value", time.Minute)
+	s.Cache().LPush("list", "a")
+
+	rr := serveAs(s, "", http.MethodGet, protocol.InfoPath, "")
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	body := rr.Body.String()
+
+	for _, expected := range []string{
+		"# Server\nversion:dev\n",
+		"uptime_in_seconds:",
+		"# Clients\nconnected_clients:0\ninvalidation_subscribers:0\n",
+		"# Memory\nused_memory:",
+		"# Persistence\nsnapshot_path:\nlast_save_time:0\nlast_save_status:ok\n",
+		"# Stats\n",
+		"# Keyspace\ndb_0:keys=2,lists=1,hashes=0,bytes=",
+		"db_sessions:keys=0,lists=0,hashes=0,bytes=0\n",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected the info to contain %q", expected)
+		}
+	}
+
+	if t.Failed() {
+		t.Log(body)
+	}
+
+	// A single section
+	rr = serveAs(s, "", http.MethodGet, protocol.InfoPath+"?section=keyspace", "")
+	if body := rr.Body.String(); !strings.HasPrefix(body, "# Keyspace\n") || strings.Contains(body, "# Server") {
+		t.Errorf("Unexpected section %q", body)
+	}
+
+	if rr := serveAs(s, "", http.MethodGet, protocol.InfoPath+"?section=unknown", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestServer_FlushDBAndDBSize(t *testing.T) {
+
+	s := NewServer()
+	sessions, _ := s.AddDatabase("sessions", 0)
+
+	s.Cache().Set("a", "value", time.Minute)
+	s.Cache().Set("b", "value", time.Minute)
+	sessions.Set("a", "value", time.Minute)
+
+	rr := serveAs(s, "", http.MethodGet, protocol.DBSizePath, "")
+	if rr.Code != http.StatusOK || rr.Body.String() != "2" {
+		t.Errorf("Unexpected dbsize %v %q", rr.Code, rr.Body.String())
+	}
+
+	rr = serveAs(s, "", http.MethodPost, protocol.FlushDBPath, "")
+	if rr.Code != http.StatusOK || rr.Body.String() != "2" {
+		t.Errorf("Unexpected flushdb %v %q", rr.Code, rr.Body.String())
+	}
+
+	// Other databases are kept
+	if s.Cache().Count() != 0 || sessions.Count() != 1 {
+		t.Errorf("Expected only the default database flushed, %d and %d keys", s.Cache().Count(), sessions.Count())
+	}
+
+	rr = serveAs(s, "", http.MethodPost, protocol.FlushAllPath, "")
+	if rr.Code != http.StatusOK || rr.Body.String() != "1" {
+		t.Errorf("Unexpected flushall %v %q", rr.Code, rr.Body.String())
+	}
+
+	if sessions.Count() != 0 {
+		t.Errorf("Expected all the databases flushed, %d keys", sessions.Count())
+	}
+
+	if rr := serveAs(s, "", http.MethodGet, protocol.FlushAllPath, ""); rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestServer_Config(t *testing.T) {
+
+	s := NewServer()
+	sessions, _ := s.AddDatabase("sessions", 0)
+
+	rr := serveAs(s, "", http.MethodGet, protocol.ConfigPath, "")
+	expected := "access-log false\naccess-log-hash-keys false\naccess-log-sample 0\neviction-interval 1s\n" +
+		"max-body-size 0\nmax-hash-length 0\nmax-key-size 0\nmax-list-length 0\nmax-value-size 0\n" +
+		"maxitems 0\nmaxmemory 0\nrate-limit 0:0\nroute-rate-limits \nslowlog-max-len 128\nslowlog-slower-than 10ms\n"
+	if rr.Code != http.StatusOK || rr.Body.String() != expected {
+		t.Errorf("Unexpected config %v %q", rr.Code, rr.Body.String())
+	}
+
+	rr = serveAs(s, "", http.MethodGet, protocol.ConfigPath+"?name=maxm*", "")
+	if rr.Body.String() != "maxmemory 0\n" {
+		t.Errorf("Unexpected config %q", rr.Body.String())
+	}
+
+	// Settings of the selected database
+	for _, c := range []struct {
+		name  string
+		value string
+	}{{"maxmemory", "1mb"}, {"maxitems", "10"}, {"eviction-interval", "50ms"}, {"access-log", "true"}} {
+		rr := serveAs(s, "", http.MethodPost, protocol.DatabasePath+"/sessions"+protocol.ConfigPath+"?name="+c.name+"&value="+c.value, "")
+		if rr.Code != http.StatusOK {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+	}
+
+	if sessions.MaxMemory() != 1<<20 || sessions.MaxItems() != 10 || sessions.EvictionInterval() != 50*time.Millisecond {
+		t.Errorf("Unexpected settings %d %d %v", sessions.MaxMemory(), sessions.MaxItems(), sessions.EvictionInterval())
+	}
+
+	if s.Cache().MaxItems() != 0 || !s.AccessLogging() {
+		t.Error("Expected the default database unchanged and the access log enabled")
+	}
+
+	for _, query := range []string{"?name=unknown&value=1", "?name=maxmemory&value=lots", "?name=eviction-interval&value=0s"} {
+		if rr := serveAs(s, "", http.MethodPost, protocol.ConfigPath+query, ""); rr.Code != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code for %s: got %v want %v", query, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestServer_AdminSave(t *testing.T) {
+
+	s := NewServer()
+
+	if rr := serveAs(s, "", http.MethodPost, protocol.SavePath, ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	path := filepath.Join(t.TempDir(), "gcache.snapshot")
+	s.SetSnapshotPath(path)
+	s.Cache().Set("key", "value", time.Minute)
+
+	if rr := serveAs(s, "", http.MethodPost, protocol.SavePath, ""); rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		t.Error("Expected the snapshot to be saved", err)
+	}
+
+	rr := serveAs(s, "", http.MethodGet, protocol.InfoPath+"?section=persistence", "")
+	if strings.Contains(rr.Body.String(), "last_save_time:0\n") || !strings.Contains(rr.Body.String(), "last_save_status:ok") {
+		t.Errorf("Unexpected persistence %q", rr.Body.String())
+	}
+}
+
+func TestServer_AdminPermissions(t *testing.T) {
+
+	s := NewServer()
+	s.ACL().SetUser("reader", "on", ">reader", "allkeys", "+@read", "+@keyspace")
+
+	for _, c := range []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodGet, protocol.InfoPath, http.StatusForbidden},
+		{http.MethodPost, protocol.FlushAllPath, http.StatusForbidden},
+		{http.MethodPost, protocol.FlushDBPath, http.StatusForbidden},
+		{http.MethodGet, protocol.ConfigPath, http.StatusForbidden},
+		{http.MethodGet, protocol.DBSizePath, http.StatusOK},
+	} {
+		if rr := serveAs(s, basicAuth("reader", "reader"), c.method, c.path, ""); rr.Code != c.status {
+			t.Errorf("handler returned wrong status code for %s: got %v want %v", c.path, rr.Code, c.status)
+		}
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+
+	for value, expected := range map[string]int64{"0": 0, "100": 100, "10b": 10, "2kb": 2048, "1MB": 1 << 20, "3gb": 3 << 30,
+		"8589934591gb": 8589934591 << 30, "9223372036854775807b": math.MaxInt64} {
+		if bytes, err := ParseBytes(value); err != nil || bytes != expected {
+			t.Errorf("Expected %s to be %d but actual %d, err = %v", value, expected, bytes, err)
+		}
+	}
+
+	for _, value := range []string{"", "mb", "-1", "1tb", "9223372036854775807kb", "8589934592gb", "99999999999999999999"} {
+		if _, err := ParseBytes(value); err == nil {
+			t.Errorf("Expected %q to be invalid", value)
+		}
+	}
+}
@@ -0,0 +1,613 @@
+package cluster
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const headerAuthorization = "Authorization"
+
+const (
+	DefaultProbeInterval    time.Duration = 1 * time.Second
+	DefaultSuspicionTimeout time.Duration = 5 * time.Second
+	DefaultDeadTimeout      time.Duration = 1 * time.Minute
+
+	// Number of members asked to probe a target indirectly
+	indirectProbes = 3
+)
+
+var (
+	ErrNoSeedReachable  = errors.New("None of the seeds is reachable")
+	ErrBadProbeInterval = errors.New("Probe interval must be positive")
+)
+
+// State of a member as seen by the local node
+type State int
+
+const (
+	StateAlive State = iota
+	StateSuspect
+	StateDead
+)
+
+var stateNames = []string{"alive", "suspect", "dead"}
+
+func (s State) String() string {
+	if s < StateAlive || s > StateDead {
+		return "unknown"
+	}
+	return stateNames[s]
+}
+
+func parseState(s string) (State, error) {
+	for i, name := range stateNames {
+		if name == s {
+			return State(i), nil
+		}
+	}
+	return StateAlive, fmt.Errorf("Unknown member state '%s'", s)
+}
+
+// A node of the cluster
+type Member struct {
+	Addr        string
+	State       State
+	Incarnation uint64
+
+	changedAt time.Time // when the state has been changed locally
+}
+
+// Membership keeps the local view of the cluster and runs
+// the SWIM-style failure detector over HTTP
+type Membership struct {
+	self    string
+	psw     string
+	members map[string]*Member
+	// Incarnations of the members forgotten after they died, by when they were forgotten
+	forgotten map[string]forgottenMember
+	// Guards the members and the settings, which may change while probing
+	mutex sync.RWMutex
+
+	probeInterval    time.Duration
+	suspicionTimeout time.Duration
+	deadTimeout      time.Duration
+
+	// Replaced rather than changed, requests in flight keep the client they started with
+	httpClient *http.Client
+	stop       chan bool
+}
+
+type forgottenMember struct {
+	incarnation uint64
+	at          time.Time
+}
+
+// Create a new membership. self is the address other nodes reach this node at,
+// psw is the password sent to the other nodes
+func NewMembership(self string, psw string) *Membership {
+	m := &Membership{
+		self:             self,
+		psw:              psw,
+		members:          make(map[string]*Member),
+		forgotten:        make(map[string]forgottenMember),
+		probeInterval:    DefaultProbeInterval,
+		suspicionTimeout: DefaultSuspicionTimeout,
+		deadTimeout:      DefaultDeadTimeout,
+		httpClient:       &http.Client{Timeout: DefaultProbeInterval / 2},
+	}
+
+	m.members[self] = &Member{Addr: self, State: StateAlive, changedAt: time.Now()}
+
+	return m
+}
+
+// Set how often a random member is probed, the interval must be positive
+func (m *Membership) SetProbeInterval(interval time.Duration) error {
+	if interval <= 0 {
+		return ErrBadProbeInterval
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.probeInterval = interval
+	m.httpClient = &http.Client{Timeout: interval / 2, Transport: m.httpClient.Transport}
+	return nil
+}
+
+// Reach the other nodes over TLS with the configuration, e.g. the CAs of their certificates
+// and a client certificate if they verify clients
+func (m *Membership) SetTLSConfig(config *tls.Config) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.httpClient = &http.Client{
+		Timeout: m.httpClient.Timeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: config,
+		},
+	}
+}
+
+// Set how long a member stays suspected before it is declared dead
+func (m *Membership) SetSuspicionTimeout(timeout time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.suspicionTimeout = timeout
+}
+
+// Address of the local node
+func (m *Membership) Self() string {
+	return m.self
+}
+
+// Return the membership view sorted by address
+func (m *Membership) Members() []Member {
+	m.mutex.RLock()
+	members := make([]Member, 0, len(m.members))
+	for _, member := range m.members {
+		members = append(members, *member)
+	}
+	m.mutex.RUnlock()
+
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].Addr < members[j].Addr
+	})
+
+	return members
+}
+
+// Return addresses of the members which are not known to be dead
+func (m *Membership) Alive() []string {
+	addrs := []string{}
+	for _, member := range m.Members() {
+		if member.State != StateDead {
+			addrs = append(addrs, member.Addr)
+		}
+	}
+	return addrs
+}
+
+// Join the cluster through the given seeds.
+// It's enough that one of the seeds responds
+func (m *Membership) Join(seeds []string) error {
+	if len(seeds) == 0 {
+		return nil
+	}
+
+	joined := false
+	for _, seed := range seeds {
+		if seed == m.self {
+			continue
+		}
+
+		if err := m.ping(seed); err != nil {
+			log.Printf("Failed to join through seed %s: %s", seed, err)
+			continue
+		}
+
+		joined = true
+	}
+
+	if !joined {
+		return ErrNoSeedReachable
+	}
+
+	return nil
+}
+
+// Start probing members on the probe interval.
+// Seeds are retried until one of them responds
+func (m *Membership) Start(seeds []string) {
+	stop := make(chan bool)
+
+	m.mutex.Lock()
+	m.stop = stop
+	m.mutex.Unlock()
+
+	go func() {
+		joined := m.Join(seeds) == nil
+
+		for {
+			m.mutex.RLock()
+			interval := m.probeInterval
+			m.mutex.RUnlock()
+
+			select {
+			case <-time.After(interval):
+			case <-stop:
+				return
+			}
+
+			if !joined {
+				joined = m.Join(seeds) == nil
+			}
+
+			m.probe()
+			m.reap()
+		}
+	}()
+}
+
+// Stop probing
+func (m *Membership) Stop() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+}
+
+// Change the password sent to the other nodes
+func (m *Membership) SetPassword(psw string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.psw = psw
+}
+
+// Probe a random member. If it does not respond directly other members
+// are asked to probe it, and if they fail too the member becomes suspected
+func (m *Membership) probe() {
+	target, ok := m.randomMember("")
+	if !ok {
+		return
+	}
+
+	if err := m.ping(target.Addr); err == nil {
+		return
+	}
+
+	if m.indirectPing(target.Addr) {
+		return
+	}
+
+	m.suspect(target.Addr, target.Incarnation)
+}
+
+func (m *Membership) indirectPing(target string) bool {
+	results := make(chan bool)
+	n := 0
+
+	for _, member := range m.randomMembers(target, indirectProbes) {
+		n++
+		go func(addr string) {
+			query := fmt.Sprintf("%s/cluster?op=ping-req&target=%s", addr, url.QueryEscape(target))
+			resp, err := m.doRequest(http.MethodPost, query, nil)
+			if err != nil {
+				results <- false
+				return
+			}
+			resp.Body.Close()
+			results <- resp.StatusCode == http.StatusOK
+		}(member.Addr)
+	}
+
+	acked := false
+	for i := 0; i < n; i++ {
+		if <-results {
+			acked = true
+		}
+	}
+
+	return acked
+}
+
+// Ping the member at the given address, exchanging membership views
+func (m *Membership) ping(addr string) error {
+	body, err := m.serialize()
+	if err != nil {
+		return err
+	}
+
+	resp, err := m.doRequest(http.MethodPost, addr+"/cluster?op=ping", bytes.NewBufferString(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unexpected status %d", resp.StatusCode)
+	}
+
+	members, err := ReadMembers(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	m.merge(members)
+
+	return nil
+}
+
+func (m *Membership) doRequest(method, url string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mutex.RLock()
+	psw := m.psw
+	httpClient := m.httpClient
+	m.mutex.RUnlock()
+
+	if psw != "" {
+		req.Header.Set(headerAuthorization, psw)
+	}
+
+	return httpClient.Do(req)
+}
+
+// Pick a random member which is not dead, not the local node and not the excluded one
+func (m *Membership) randomMember(exclude string) (Member, bool) {
+	members := m.randomMembers(exclude, 1)
+	if len(members) == 0 {
+		return Member{}, false
+	}
+	return members[0], true
+}
+
+func (m *Membership) randomMembers(exclude string, n int) []Member {
+	candidates := []Member{}
+
+	m.mutex.RLock()
+	for addr, member := range m.members {
+		if addr != m.self && addr != exclude && member.State != StateDead {
+			candidates = append(candidates, *member)
+		}
+	}
+	m.mutex.RUnlock()
+
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+
+	return candidates
+}
+
+func (m *Membership) suspect(addr string, incarnation uint64) {
+	m.merge([]Member{{Addr: addr, State: StateSuspect, Incarnation: incarnation}})
+}
+
+// Declare dead the members suspected for too long and forget the long dead ones.
+// The incarnations of forgotten members are kept as long again, for the merge to tell stale rumours about them
+func (m *Membership) reap() {
+	now := time.Now()
+
+	m.mutex.Lock()
+	for addr, forgotten := range m.forgotten {
+		if now.Sub(forgotten.at) > m.deadTimeout {
+			delete(m.forgotten, addr)
+		}
+	}
+
+	for addr, member := range m.members {
+		switch member.State {
+		case StateSuspect:
+			if now.Sub(member.changedAt) > m.suspicionTimeout {
+				log.Printf("Cluster member %s is dead", addr)
+				member.State = StateDead
+				member.changedAt = now
+			}
+		case StateDead:
+			if now.Sub(member.changedAt) > m.deadTimeout {
+				delete(m.members, addr)
+				m.forgotten[addr] = forgottenMember{incarnation: member.Incarnation, at: now}
+			}
+		}
+	}
+	m.mutex.Unlock()
+}
+
+// Merge the received members into the local view following SWIM precedence rules:
+// a newer incarnation wins, and for the same incarnation dead > suspect > alive.
+// Unknown members are added only if they are alive, at an incarnation newer than the one they were forgotten at.
+// Members of addresses which are not http or https URLs are ignored
+func (m *Membership) merge(members []Member) {
+	now := time.Now()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, received := range members {
+
+		if !validAddr(received.Addr) {
+			continue
+		}
+
+		local, exists := m.members[received.Addr]
+
+		// Refute the rumour about the local node being suspected or dead
+		if received.Addr == m.self {
+			if received.State != StateAlive && received.Incarnation >= local.Incarnation {
+				local.Incarnation = received.Incarnation + 1
+			}
+			continue
+		}
+
+		if !exists {
+			// Rumours about unknown members are stale views of members already forgotten,
+			// adding them back would keep dead members around forever
+			if received.State != StateAlive {
+				continue
+			}
+
+			// Rumours of the incarnation a member died at are stale too
+			if forgotten, ok := m.forgotten[received.Addr]; ok {
+				if received.Incarnation <= forgotten.incarnation {
+					continue
+				}
+				delete(m.forgotten, received.Addr)
+			}
+
+			member := received
+			member.changedAt = now
+			m.members[received.Addr] = &member
+			continue
+		}
+
+		overrides := received.Incarnation > local.Incarnation ||
+			(received.Incarnation == local.Incarnation && received.State > local.State)
+
+		if !overrides {
+			continue
+		}
+
+		if local.State != received.State {
+			local.changedAt = now
+		}
+
+		local.State = received.State
+		local.Incarnation = received.Incarnation
+	}
+}
+
+// Whether the address is an http or https URL of a host, which members are reached at
+func validAddr(addr string) bool {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return false
+	}
+
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.User == nil &&
+		u.Path == "" && u.RawQuery == "" && u.Fragment == ""
+}
+
+// Whether the address is of a member of the view other than the local node
+func (m *Membership) isMember(addr string) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	_, ok := m.members[addr]
+	return ok && addr != m.self
+}
+
+func (m *Membership) serialize() (string, error) {
+	buffer := &bytes.Buffer{}
+	if err := WriteMembers(buffer, m.Members()); err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
+
+// ServeHTTP exposes the membership view and receives probes from other nodes
+func (m *Membership) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	if err := req.ParseForm(); err != nil {
+		log.Printf("Error parsing form: %s", err)
+		return
+	}
+
+	operation := req.Form.Get("op")
+
+	switch req.Method {
+	case http.MethodGet:
+		if operation == "" {
+			m.membersQuery(w, req)
+			return
+		}
+
+	case http.MethodPost:
+		if operation == "ping" {
+			m.pingCommand(w, req)
+			return
+		} else if operation == "ping-req" {
+			m.pingReqCommand(w, req)
+			return
+		}
+	}
+
+	// Nothing matched, return bad request
+	w.WriteHeader(http.StatusBadRequest)
+}
+
+func (m *Membership) membersQuery(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/csv")
+	if err := WriteMembers(w, m.Members()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (m *Membership) pingCommand(w http.ResponseWriter, req *http.Request) {
+	members, err := ReadMembers(req.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	m.merge(members)
+	m.membersQuery(w, req)
+}
+
+func (m *Membership) pingReqCommand(w http.ResponseWriter, req *http.Request) {
+	// Only members are probed on behalf of other nodes, the password is not sent anywhere else
+	target := req.Form.Get("target")
+	if !m.isMember(target) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := m.ping(target); err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+}
+
+// Write members as csv rows of address, state and incarnation
+func WriteMembers(w io.Writer, members []Member) error {
+	writer := csv.NewWriter(w)
+	for _, member := range members {
+		row := []string{member.Addr, member.State.String(), strconv.FormatUint(member.Incarnation, 10)}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Read members written by WriteMembers
+func ReadMembers(r io.Reader) ([]Member, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 3
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]Member, 0, len(rows))
+	for _, row := range rows {
+		state, err := parseState(row[1])
+		if err != nil {
+			return nil, err
+		}
+
+		incarnation, err := strconv.ParseUint(row[2], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		members = append(members, Member{Addr: row[0], State: state, Incarnation: incarnation})
+	}
+
+	return members, nil
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"gcache/protocol"
+	"gcache/server/acl"
+	"gcache/server/handlers"
+	"net/http"
+)
+
+// Classifier tells the command a request runs, so that it's checked against the permissions of the user
+type classifier func(r *http.Request) acl.Command
+
+func command(name string, categories acl.Category, keys ...string) acl.Command {
+	return acl.Command{Name: name, Categories: categories, Keys: keys}
+}
+
+// Classify a request of the form based keys API
+func classifyKeys(r *http.Request) acl.Command {
+	r.ParseForm()
+
+	if len(r.Form) == 0 && r.Method == http.MethodGet {
+		return command("keys", acl.CategoryKeyspace|acl.CategoryRead)
+	}
+
+	return keyCommand(r.Method, r.Form.Get("key"))
+}
+
+// Classify a request of the binary safe keys API
+func classifyKeysV2(r *http.Request) acl.Command {
+	key, ok := pathKey(r, protocol.KeysPath)
+
+	if !ok && r.Method == http.MethodGet {
+		return command("keys", acl.CategoryKeyspace|acl.CategoryRead)
+	}
+
+	return keyCommand(r.Method, key)
+}
+
+func keyCommand(method string, key string) acl.Command {
+	switch method {
+	case http.MethodGet:
+		return command(protocol.OpGet, acl.CategoryRead, key)
+	case http.MethodPost:
+		return command(protocol.OpSet, acl.CategoryWrite, key)
+	case http.MethodPatch:
+		return command(protocol.OpUpdate, acl.CategoryWrite, key)
+	}
+	return command(protocol.OpDel, acl.CategoryWrite, key)
+}
+
+// Classify a request of the form based lists API
+func classifyLists(r *http.Request) acl.Command {
+	r.ParseForm()
+	return listCommand(r.Method, r.Form.Get("op"), r.Form.Get("key"))
+}
+
+// Classify a request of the binary safe lists API
+func classifyListsV2(r *http.Request) acl.Command {
+	key, _ := pathKey(r, protocol.ListsPath)
+	return listCommand(r.Method, r.URL.Query().Get("op"), key)
+}
+
+func listCommand(method string, operation string, key string) acl.Command {
+	if method == http.MethodGet {
+		return command(protocol.OpLRange, acl.CategoryList|acl.CategoryRead, key)
+	}
+	return command(operation, acl.CategoryList|acl.CategoryWrite, key)
+}
+
+// Classify a request of the form based hashes API
+func classifyHashes(r *http.Request) acl.Command {
+	r.ParseForm()
+	return hashCommand(r.Method, r.Form.Get("key"))
+}
+
+// Classify a request of the binary safe hashes API
+func classifyHashesV2(r *http.Request) acl.Command {
+	key, _ := pathKey(r, protocol.HashesPath)
+	return hashCommand(r.Method, key)
+}
+
+func hashCommand(method string, key string) acl.Command {
+	if method == http.MethodGet {
+		return command(protocol.OpHGet, acl.CategoryHash|acl.CategoryRead, key)
+	}
+	return command(protocol.OpHSet, acl.CategoryHash|acl.CategoryWrite, key)
+}
+
+// Get the single key in the path after the prefix
+func pathKey(r *http.Request, prefix string) (string, bool) {
+	segments, err := protocol.SplitPath(r.URL.EscapedPath(), prefix)
+	if err != nil || len(segments) == 0 {
+		return "", false
+	}
+	return segments[0], true
+}
+
+// Classify a multi key request by the keys in the body
+func classifyMultiKeys(r *http.Request) acl.Command {
+	switch r.URL.Path {
+	case protocol.MGetPath, protocol.MDelPath:
+		request := protocol.KeysRequest{}
+		handlers.DecodeBody(r, &request)
+
+		if r.URL.Path == protocol.MGetPath {
+			return command("mget", acl.CategoryRead, request.Keys...)
+		}
+		return command("mdel", acl.CategoryWrite, request.Keys...)
+	}
+
+	request := protocol.MSetRequest{}
+	handlers.DecodeBody(r, &request)
+
+	keys := make([]string, 0, len(request.Items))
+	for key := range request.Items {
+		keys = append(keys, key)
+	}
+	return command("mset", acl.CategoryWrite, keys...)
+}
+
+// Classify a dump or a restore of the key in the path, or a scan of the key space
+func classifyDump(r *http.Request) acl.Command {
+	if key, ok := pathKey(r, protocol.RestorePath); ok {
+		return command("restore", acl.CategoryWrite, key)
+	}
+	if key, ok := pathKey(r, protocol.DumpPath); ok {
+		return command("dump", acl.CategoryRead, key)
+	}
+	return command("scan", acl.CategoryKeyspace|acl.CategoryRead)
+}
+
+// Classify a batch by all of its commands, so that a batch runs only if every command may run
+func classifyBatch(r *http.Request) acl.Command {
+	commands := []protocol.Command{}
+	handlers.DecodeBody(r, &commands)
+
+	batch := command("batch", 0)
+
+	for _, c := range commands {
+		var categories acl.Category
+
+		switch c.Op {
+		case protocol.OpGet:
+			categories = acl.CategoryRead
+		case protocol.OpSet, protocol.OpUpdate, protocol.OpDel:
+			categories = acl.CategoryWrite
+		case protocol.OpLRange:
+			categories = acl.CategoryList | acl.CategoryRead
+		case protocol.OpLPush, protocol.OpRPush, protocol.OpLPop, protocol.OpRPop:
+			categories = acl.CategoryList | acl.CategoryWrite
+		case protocol.OpHGet:
+			categories = acl.CategoryHash | acl.CategoryRead
+		case protocol.OpHSet:
+			categories = acl.CategoryHash | acl.CategoryWrite
+		}
+
+		batch.Categories |= categories
+		batch.Keys = append(batch.Keys, c.Key)
+	}
+
+	return batch
+}
+
+// Decode the json body of the routes taking one. The request returned carries the body
+// decoded once for the classifier, the limits and the handler
+func decodeBody(route string, r *http.Request) *http.Request {
+	var body interface{}
+
+	switch route {
+	case protocol.BatchPath:
+		body = &[]protocol.Command{}
+	case protocol.MGetPath, protocol.MDelPath:
+		body = &protocol.KeysRequest{}
+	case protocol.MSetPath:
+		body = &protocol.MSetRequest{}
+	default:
+		return r
+	}
+
+	r, _ = handlers.DecodeBody(r, body)
+	return r
+}
+
+// Classify a subscription to the invalidations, which streams changes of any key
+func classifyInvalidations(r *http.Request) acl.Command {
+	return command("invalidations", acl.CategoryKeyspace|acl.CategoryRead)
+}
+
+// Classify a request of the cluster membership
+func classifyCluster(r *http.Request) acl.Command {
+	return command("cluster", acl.CategoryAdmin)
+}
+
+// Classify a request of the administration
+func classifyAdmin(name string) classifier {
+	return func(r *http.Request) acl.Command {
+		return command(name, acl.CategoryAdmin)
+	}
+}
+
+// Classify a request of the number of keys, which reads the key space like listing keys
+func classifyDBSize(r *http.Request) acl.Command {
+	return command("dbsize", acl.CategoryKeyspace|acl.CategoryRead)
+}
+
+// Classify a request of the metrics
+func classifyMetrics(r *http.Request) acl.Command {
+	return command("metrics", acl.CategoryAdmin)
+}
+
+// Classify a request of the ACL administration. Anyone may ask who they are
+func classifyACL(r *http.Request) acl.Command {
+	if r.Method == http.MethodGet && r.URL.Query().Get("op") == "whoami" {
+		return command("acl whoami", 0)
+	}
+	return command("acl", acl.CategoryAdmin)
+}
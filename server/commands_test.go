@@ -0,0 +1,121 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"gcache/protocol"
+	"gcache/server/acl"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func basicAuth(user string, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+}
+
+func serveAs(s *Server, authorization string, method string, target string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Accept", protocol.ContentTypeJSON)
+	if authorization != "" {
+		req.Header.Set(headerAuthorization, authorization)
+	}
+
+	rr := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rr, req)
+	return rr
+}
+
+func TestServer_ACL(t *testing.T) {
+
+	s := NewServerWithAuth("admin")
+	s.ACL().SetUser("reader", "on", ">reader", "~cache:*", "+@read")
+	s.ACL().SetUser("writer", "on", ">writer", "~cache:*", "+@read", "+@write", "+@list")
+
+	reader := basicAuth("reader", "reader")
+	writer := basicAuth("writer", "writer")
+
+	cases := []struct {
+		authorization string
+		method        string
+		target        string
+		body          string
+		status        int
+	}{
+		// The password of the default user works as before
+		{"admin", http.MethodPost, protocol.KeysPath + "/cache:1?ttl=10", "value", http.StatusOK},
+		{"", http.MethodGet, protocol.KeysPath + "/cache:1", "", http.StatusUnauthorized},
+		{basicAuth("reader", "wrong"), http.MethodGet, protocol.KeysPath + "/cache:1", "", http.StatusUnauthorized},
+
+		{reader, http.MethodGet, protocol.KeysPath + "/cache:1", "", http.StatusOK},
+		{reader, http.MethodGet, "/keys?key=cache:1", "", http.StatusOK},
+		{reader, http.MethodGet, protocol.KeysPath + "/other", "", http.StatusForbidden},
+		{reader, http.MethodPost, protocol.KeysPath + "/cache:1", "value", http.StatusForbidden},
+		{reader, http.MethodGet, protocol.KeysPath, "", http.StatusForbidden},
+		{reader, http.MethodGet, protocol.ListsPath + "/cache:list?op=range&from=0&to=-1", "", http.StatusForbidden},
+		{reader, http.MethodGet, "/acl", "", http.StatusForbidden},
+		{reader, http.MethodGet, "/acl?op=whoami", "", http.StatusOK},
+		{reader, http.MethodGet, protocol.DumpPath + "/cache:1", "", http.StatusOK},
+		{reader, http.MethodGet, protocol.DumpPath + "/other", "", http.StatusForbidden},
+		{reader, http.MethodGet, protocol.ScanPath, "", http.StatusForbidden},
+
+		{writer, http.MethodPost, "/lists?op=lpush&key=cache:list&value=a", "", http.StatusOK},
+		{writer, http.MethodPost, "/lists?op=lpush&key=other&value=a", "", http.StatusForbidden},
+		{writer, http.MethodPost, protocol.MSetPath, `{"items":{"cache:2":"dg=="},"ttl":10}`, http.StatusOK},
+		{writer, http.MethodPost, protocol.MSetPath, `{"items":{"cache:2":"dg==","other":"dg=="},"ttl":10}`, http.StatusForbidden},
+		{writer, http.MethodPost, protocol.BatchPath, `[{"op":"get","key":"cache:1"},{"op":"hget","key":"cache:h","hashKey":"a"}]`, http.StatusForbidden},
+		{writer, http.MethodPost, protocol.BatchPath, `[{"op":"get","key":"cache:1"},{"op":"del","key":"cache:2"}]`, http.StatusOK},
+		// Bodies are checked as they are executed, data after the json is not ignored
+		{writer, http.MethodPost, protocol.BatchPath, `[{"op":"get","key":"other"}]x`, http.StatusBadRequest},
+		{writer, http.MethodPost, protocol.BatchPath, `[{"op":"get","key":"other"}] `, http.StatusForbidden},
+		{writer, http.MethodPost, protocol.MSetPath, `{"items":{"other":"dg=="},"ttl":10}x`, http.StatusBadRequest},
+		{writer, http.MethodPost, protocol.MGetPath, `{"keys":["other"]}{}`, http.StatusBadRequest},
+		{writer, http.MethodGet, protocol.InvalidationsPath, "", http.StatusForbidden},
+		{writer, http.MethodPost, protocol.RestorePath + "/other", "", http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		rr := serveAs(s, c.authorization, c.method, c.target, c.body)
+
+		if status := rr.Code; status != c.status {
+			t.Errorf("%s %s: handler returned wrong status code: got %v want %v", c.method, c.target, status, c.status)
+		}
+	}
+
+	// Denied commands are structured errors
+	rr := serveAs(s, reader, http.MethodGet, protocol.KeysPath+"/other", "")
+
+	response := protocol.ErrorResponse{}
+	json.NewDecoder(rr.Body).Decode(&response)
+
+	if response.Error.Code != protocol.CodeNoPerm || !strings.Contains(response.Error.Message, "'other'") {
+		t.Errorf("Unexpected error %+v", response.Error)
+	}
+}
+
+func TestServer_ACLAdmin(t *testing.T) {
+
+	s := NewServer()
+
+	rr := serveAs(s, "", http.MethodPost, "/acl?op=setuser&name=bob", "on >bob allkeys +@read")
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	rr = serveAs(s, basicAuth("bob", "bob"), http.MethodGet, "/acl?op=whoami", "")
+	if body, _ := ioutil.ReadAll(rr.Body); string(body) != "bob" {
+		t.Errorf("Expected bob but actual %q", body)
+	}
+
+	if _, ok := s.ACL().User("bob"); !ok {
+		t.Error("Expected the user to be set")
+	}
+
+	// Without a password the default user is any request without a user name
+	rr = serveAs(s, "anything", http.MethodGet, "/acl?op=whoami", "")
+	if body, _ := ioutil.ReadAll(rr.Body); string(body) != acl.DefaultUser {
+		t.Errorf("Expected the default user but actual %q", body)
+	}
+}
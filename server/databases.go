@@ -0,0 +1,198 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"gcache"
+	"gcache/protocol"
+	"gcache/server/handlers"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+var ErrDatabaseExists = errors.New("Database already exists")
+
+// Database is a key space of its own, served by its own handlers
+type database struct {
+	name          string
+	cache         *gcache.Cache
+	router        *handlers.Router
+	invalidations *handlers.InvalidationsHandler
+}
+
+func (s *Server) newDatabase(name string, cache *gcache.Cache) *database {
+
+	db := &database{
+		name:   name,
+		cache:  cache,
+		router: handlers.NewRouter(),
+	}
+
+	keysHandler := new(handlers.KeysHandler).Init(cache)
+	listsHandler := new(handlers.ListsHandler).Init(cache)
+	hashesHandler := new(handlers.HashesHandler).Init(cache)
+
+	s.middleware(db.router, "/keys", keysHandler, classifyKeys)
+	s.middleware(db.router, "/lists", listsHandler, classifyLists)
+	s.middleware(db.router, "/hashes", hashesHandler, classifyHashes)
+
+	// Binary safe API
+	keysV2Handler := new(handlers.KeysV2Handler).Init(cache)
+	listsV2Handler := new(handlers.ListsV2Handler).Init(cache)
+	hashesV2Handler := new(handlers.HashesV2Handler).Init(cache)
+
+	s.middleware(db.router, protocol.KeysPath, keysV2Handler, classifyKeysV2)
+	s.middleware(db.router, protocol.KeysPath+"/", keysV2Handler, classifyKeysV2)
+	s.middleware(db.router, protocol.ListsPath+"/", listsV2Handler, classifyListsV2)
+	s.middleware(db.router, protocol.HashesPath+"/", hashesV2Handler, classifyHashesV2)
+
+	// Multi key commands
+	multiKeysHandler := new(handlers.MultiKeysHandler).Init(cache)
+	s.middleware(db.router, protocol.MGetPath, multiKeysHandler, classifyMultiKeys)
+	s.middleware(db.router, protocol.MSetPath, multiKeysHandler, classifyMultiKeys)
+	s.middleware(db.router, protocol.MDelPath, multiKeysHandler, classifyMultiKeys)
+
+	// Dump and restore of keys, e.g. to move them between servers
+	dumpHandler := new(handlers.DumpHandler).Init(cache)
+	s.middleware(db.router, protocol.DumpPath+"/", dumpHandler, classifyDump)
+	s.middleware(db.router, protocol.RestorePath+"/", dumpHandler, classifyDump)
+	s.middleware(db.router, protocol.ScanPath, dumpHandler, classifyDump)
+
+	// Pipelined commands
+	batchHandler := new(handlers.BatchHandler).Init(cache)
+	s.middleware(db.router, protocol.BatchPath, batchHandler, classifyBatch)
+
+	// Invalidation of client side caches
+	db.invalidations = new(handlers.InvalidationsHandler).Init(cache).(*handlers.InvalidationsHandler)
+	s.middleware(db.router, protocol.InvalidationsPath, db.invalidations, classifyInvalidations)
+
+	// Administration of the database
+	s.middleware(db.router, protocol.FlushDBPath, s.flushDBCommand(db), classifyAdmin("flushdb"))
+	s.middleware(db.router, protocol.DBSizePath, s.dbSizeQuery(db), classifyDBSize)
+	s.middleware(db.router, protocol.ConfigPath, s.configHandler(db), classifyAdmin("config"))
+
+	return db
+}
+
+// Add the database with its own key space. maxItems bounds the number of its keys, zero means no bound.
+// Databases should be added before serving, so that their snapshots are loaded
+func (s *Server) AddDatabase(name string, maxItems int) (*gcache.Cache, error) {
+
+	if name == "" || strings.ContainsAny(name, "/ ") {
+		return nil, fmt.Errorf("Invalid database name '%s'", name)
+	}
+
+	s.databasesMutex.Lock()
+	defer s.databasesMutex.Unlock()
+
+	if _, exists := s.databases[name]; exists {
+		return nil, ErrDatabaseExists
+	}
+
+	cache := gcache.NewCacheWithLimit(maxItems)
+	s.databases[name] = s.newDatabase(name, cache)
+
+	return cache, nil
+}
+
+// Get the cache of the database
+func (s *Server) Database(name string) (*gcache.Cache, bool) {
+	db, ok := s.database(name)
+	if !ok {
+		return nil, false
+	}
+	return db.cache, true
+}
+
+// Get the names of the databases sorted
+func (s *Server) Databases() []string {
+	names := []string{}
+	for _, db := range s.databaseList() {
+		names = append(names, db.name)
+	}
+	return names
+}
+
+func (s *Server) database(name string) (*database, bool) {
+	s.databasesMutex.RLock()
+	defer s.databasesMutex.RUnlock()
+
+	db, ok := s.databases[name]
+	return db, ok
+}
+
+func (s *Server) databaseList() []*database {
+	s.databasesMutex.RLock()
+	dbs := make([]*database, 0, len(s.databases))
+	for _, db := range s.databases {
+		dbs = append(dbs, db)
+	}
+	s.databasesMutex.RUnlock()
+
+	sort.Slice(dbs, func(i, j int) bool {
+		return dbs[i].name < dbs[j].name
+	})
+
+	return dbs
+}
+
+// Close the invalidation streams of all the databases
+func (s *Server) closeStreams() {
+	for _, db := range s.databaseList() {
+		db.invalidations.Close()
+	}
+}
+
+// Serve the request by the database selected by the path prefix /db/{name} or by the database header.
+// Requests selecting no database are served by the default one
+func (s *Server) serveDatabase(w http.ResponseWriter, r *http.Request) {
+
+	name := r.Header.Get(protocol.HeaderDatabase)
+
+	if escapedPath := r.URL.EscapedPath(); strings.HasPrefix(escapedPath, protocol.DatabasePath+"/") {
+		rest := escapedPath[len(protocol.DatabasePath)+1:]
+
+		i := strings.IndexByte(rest, '/')
+		if i < 0 {
+			i = len(rest)
+		}
+
+		unescaped, err := url.PathUnescape(rest[:i])
+		if err != nil {
+			handlers.WriteError(w, r, http.StatusBadRequest, protocol.CodeBadRequest, "Bad database name in the path")
+			return
+		}
+
+		name = unescaped
+		r = withEscapedPath(r, rest[i:])
+	}
+
+	if name == "" {
+		name = protocol.DefaultDatabase
+	}
+
+	db, ok := s.database(name)
+	if !ok {
+		handlers.WriteError(w, r, http.StatusNotFound, protocol.CodeNoDatabase, "Database '"+name+"' does not exist")
+		return
+	}
+
+	db.router.ServeHTTP(w, r)
+}
+
+// Shallow copy of the request with the path replaced
+func withEscapedPath(r *http.Request, escapedPath string) *http.Request {
+	path, _ := url.PathUnescape(escapedPath)
+
+	u := *r.URL
+	u.Path = path
+	u.RawPath = escapedPath
+
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = &u
+
+	return r2
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"encoding/json"
+	"gcache/protocol"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func serveDatabaseRequest(s *Server, db string, method string, target string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Accept", protocol.ContentTypeJSON)
+	if db != "" {
+		req.Header.Set(protocol.HeaderDatabase, db)
+	}
+
+	rr := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rr, req)
+	return rr
+}
+
+func TestServer_Databases(t *testing.T) {
+
+	s := NewServer()
+
+	sessions, err := s.AddDatabase("sessions", 0)
+	if err != nil {
+		t.Fatal("Failed to add the database", err)
+	}
+
+	if _, err := s.AddDatabase("sessions", 0); err != ErrDatabaseExists {
+		t.Error("Expected the database to exist but actual", err)
+	}
+
+	if _, err := s.AddDatabase("a/b", 0); err == nil {
+		t.Error("Expected an invalid name to fail")
+	}
+
+	s.Cache().Set("key", "default", time.Minute)
+	sessions.Set("key", "session", time.Minute)
+
+	cases := []struct {
+		db     string
+		target string
+		value  string
+	}{
+		{"", protocol.KeysPath + "/key", "default"},
+		{protocol.DefaultDatabase, protocol.KeysPath + "/key", "default"},
+		{"sessions", protocol.KeysPath + "/key", "session"},
+		{"", "/db/sessions" + protocol.KeysPath + "/key", "session"},
+		// The path prefix takes precedence over the header
+		{"sessions", "/db/0" + protocol.KeysPath + "/key", "default"},
+	}
+
+	for _, c := range cases {
+		rr := serveDatabaseRequest(s, c.db, http.MethodGet, c.target, "")
+
+		response := protocol.ValueResponse{}
+		json.NewDecoder(rr.Body).Decode(&response)
+
+		if rr.Code != http.StatusOK || string(response.Value) != c.value {
+			t.Errorf("%s (db %q): expected %q but actual %q, status %v", c.target, c.db, c.value, response.Value, rr.Code)
+		}
+	}
+
+	// The form based API responds with raw values
+	rr := serveDatabaseRequest(s, "", http.MethodGet, "/db/sessions/keys?key=key", "")
+	if body := rr.Body.String(); rr.Code != http.StatusOK || body != "session" {
+		t.Errorf("Expected %q but actual %q, status %v", "session", body, rr.Code)
+	}
+
+	// Keys are counted per database
+	rr = serveDatabaseRequest(s, "sessions", http.MethodPost, protocol.KeysPath+"/other?ttl=10", "value")
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	if s.Cache().Count() != 1 || sessions.Count() != 2 {
+		t.Errorf("Expected the key spaces to be isolated, counts %d and %d", s.Cache().Count(), sessions.Count())
+	}
+
+	rr = serveDatabaseRequest(s, "missing", http.MethodGet, protocol.KeysPath+"/key", "")
+
+	response := protocol.ErrorResponse{}
+	json.NewDecoder(rr.Body).Decode(&response)
+
+	if rr.Code != http.StatusNotFound || response.Error.Code != protocol.CodeNoDatabase {
+		t.Errorf("Expected no database but actual %v %+v", rr.Code, response.Error)
+	}
+
+	if names := s.Databases(); len(names) != 2 || names[0] != "0" || names[1] != "sessions" {
+		t.Errorf("Unexpected databases %v", names)
+	}
+}
+
+func TestServer_DatabaseLimit(t *testing.T) {
+
+	s := NewServer()
+	small, _ := s.AddDatabase("small", 2)
+
+	for _, key := range []string{"a", "b", "c"} {
+		serveDatabaseRequest(s, "small", http.MethodPost, protocol.KeysPath+"/"+key+"?ttl=10", "value")
+		serveDatabaseRequest(s, "", http.MethodPost, protocol.KeysPath+"/"+key+"?ttl=10", "value")
+	}
+
+	if small.Count() != 2 || s.Cache().Count() != 3 {
+		t.Errorf("Expected the limit to apply to its database only, counts %d and %d", small.Count(), s.Cache().Count())
+	}
+}
+
+func TestServer_DatabaseSnapshots(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "snapshot")
+
+	s := NewServer()
+	s.SetSnapshotPath(path)
+	sessions, _ := s.AddDatabase("sessions", 0)
+
+	s.Cache().Set("key", "default", time.Minute)
+	sessions.Set("key", "session", time.Minute)
+
+	_, errs := serve(t, s)
+	shutdown(t, s, errs)
+
+	if _, err := ioutil.ReadFile(path + ".sessions"); err != nil {
+		t.Fatal("Expected the database to be saved into its own file", err)
+	}
+
+	restarted := NewServer()
+	restarted.SetSnapshotPath(path)
+	restartedSessions, _ := restarted.AddDatabase("sessions", 0)
+
+	_, errs = serve(t, restarted)
+	defer shutdown(t, restarted, errs)
+
+	// Serving starts once the snapshots are loaded, the default database is loaded first
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if value, err := restartedSessions.Get("key"); err == nil {
+			if value != "session" {
+				t.Errorf("Expected %q but actual %v", "session", value)
+			}
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("The snapshot has not been loaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if value, _ := restarted.Cache().Get("key"); value != "default" {
+		t.Errorf("Expected %q but actual %v", "default", value)
+	}
+}
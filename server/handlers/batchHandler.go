@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"gcache"
+	"gcache/protocol"
+	"net/http"
+	"strconv"
+)
+
+// Batch handler executes an ordered json array of commands in a single round trip
+// and returns the array of their results
+type BatchHandler struct {
+	Cache *gcache.Cache
+}
+
+func (handler *BatchHandler) Init(cache *gcache.Cache) Handler {
+	return &BatchHandler{
+		Cache: cache,
+	}
+}
+
+func (handler *BatchHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	if req.Method != http.MethodPost {
+		writeBadRequest(w, req, "Unsupported method "+req.Method)
+		return
+	}
+
+	commands := []protocol.Command{}
+
+	if _, err := DecodeBody(req, &commands); err != nil {
+		writeBadRequest(w, req, "Body must be a json array of commands: "+err.Error())
+		return
+	}
+
+	if len(commands) > protocol.MaxBatchSize {
+		writeBadRequest(w, req, "Batch is limited to "+strconv.Itoa(protocol.MaxBatchSize)+" commands")
+		return
+	}
+
+	results := make([]protocol.Result, len(commands))
+
+	span := cacheSpan(req, "batch")
+	span.SetAttribute("gcache.commands", len(commands))
+
+	for i, command := range commands {
+		results[i] = handler.execute(command)
+	}
+
+	span.End()
+
+	writeJSON(w, http.StatusOK, results)
+}
+
+func (handler *BatchHandler) execute(command protocol.Command) protocol.Result {
+
+	if command.Key == "" {
+		return badCommand("Key is empty")
+	}
+
+	var value interface{}
+	var values []interface{}
+	var err error
+
+	switch command.Op {
+
+	case protocol.OpGet:
+		value, err = handler.Cache.Get(command.Key)
+
+	case protocol.OpSet:
+		if command.Ttl == nil || *command.Ttl < 0 {
+			return badCommand("Ttl must be a non negative number of seconds")
+		}
+		handler.Cache.Set(command.Key, string(command.Value), convertIntToDurationInMinutes(*command.Ttl))
+
+	case protocol.OpUpdate:
+		if command.Ttl == nil {
+			err = handler.Cache.Update(command.Key, string(command.Value))
+		} else if *command.Ttl < 0 {
+			return badCommand("Ttl must be a non negative number of seconds")
+		} else {
+			err = handler.Cache.UpdateWithTll(command.Key, string(command.Value), convertIntToDurationInMinutes(*command.Ttl))
+		}
+
+	case protocol.OpDel:
+		err = handler.Cache.Del(command.Key)
+
+	case protocol.OpLPush:
+		err = handler.Cache.LPush(command.Key, string(command.Value))
+
+	case protocol.OpRPush:
+		err = handler.Cache.RPush(command.Key, string(command.Value))
+
+	case protocol.OpLPop:
+		value, err = handler.Cache.LPop(command.Key)
+
+	case protocol.OpRPop:
+		value, err = handler.Cache.RPop(command.Key)
+
+	case protocol.OpLRange:
+		values, err = handler.Cache.LRange(command.Key, command.From, command.To)
+
+	case protocol.OpHGet:
+		if command.HashKey == "" {
+			return badCommand("Hash key is empty")
+		}
+		value, err = handler.Cache.HGet(command.Key, command.HashKey)
+
+	case protocol.OpHSet:
+		if command.HashKey == "" {
+			return badCommand("Hash key is empty")
+		}
+		err = handler.Cache.HSet(command.Key, command.HashKey, string(command.Value))
+
+	default:
+		return badCommand("Unknown operation '" + command.Op + "'")
+	}
+
+	if err != nil {
+		return errorResult(err)
+	}
+
+	result := protocol.Result{}
+
+	if value != nil {
+		str, ok := value.(string)
+		if !ok {
+			return errorResult(gcache.ErrWrongType)
+		}
+		result.Value = []byte(str)
+	}
+
+	if values != nil {
+		strs, err := toStrings(values)
+		if err != nil {
+			return errorResult(err)
+		}
+
+		result.Values = make([][]byte, len(strs))
+		for i, str := range strs {
+			result.Values[i] = []byte(str)
+		}
+	}
+
+	return result
+}
+
+func errorResult(err error) protocol.Result {
+	_, body := cacheError(err)
+	return protocol.Result{Error: &body}
+}
+
+func badCommand(message string) protocol.Result {
+	return protocol.Result{Error: &protocol.ErrorBody{Code: protocol.CodeBadRequest, Message: message}}
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"gcache"
+	"gcache/protocol"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBatchHandler_Commands(t *testing.T) {
+
+	handler := new(BatchHandler).Init(gcache.NewCache())
+
+	ts := httptest.NewServer(http.HandlerFunc(handler.ServeHTTP))
+	defer ts.Close()
+
+	ttl := 5
+	commands := []protocol.Command{
+		{Op: protocol.OpSet, Key: "key", Value: []byte("\x00value"), Ttl: &ttl},
+		{Op: protocol.OpGet, Key: "key"},
+		{Op: protocol.OpLPush, Key: "key", Value: []byte("value")},
+		{Op: protocol.OpLPush, Key: "list", Value: []byte("a")},
+		{Op: protocol.OpLPush, Key: "list", Value: []byte("b")},
+		{Op: protocol.OpLRange, Key: "list", From: 0, To: 10},
+		{Op: protocol.OpHSet, Key: "hash", HashKey: "field", Value: []byte("value")},
+		{Op: protocol.OpHGet, Key: "hash", HashKey: "field"},
+		{Op: protocol.OpDel, Key: "missing"},
+		{Op: "unknown", Key: "key"},
+	}
+
+	body, _ := json.Marshal(commands)
+
+	rr, err := http.Post(ts.URL, protocol.ContentTypeJSON, bytes.NewBuffer(body))
+
+	if err != nil {
+		t.Fatalf("http.Post(%q) unexpected error: %v", ts.URL, err)
+	}
+
+	// Check the status code is what we expect.
+	if status := rr.StatusCode; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+
+	results := []protocol.Result{}
+	if err := json.NewDecoder(rr.Body).Decode(&results); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != len(commands) {
+		t.Fatalf("Expected %d results but received %d", len(commands), len(results))
+	}
+
+	if results[0].Error != nil {
+		t.Error("Failed to set", results[0].Error)
+	}
+
+	if string(results[1].Value) != "\x00value" {
+		t.Errorf("Expected %q but received %q", "\x00value", results[1].Value)
+	}
+
+	if results[2].Error == nil || results[2].Error.Code != protocol.CodeWrongType {
+		t.Errorf("Expected %s but received %+v", protocol.CodeWrongType, results[2].Error)
+	}
+
+	if len(results[5].Values) != 2 || string(results[5].Values[0]) != "a" || string(results[5].Values[1]) != "b" {
+		t.Errorf("Expected [a b] but received %q", results[5].Values)
+	}
+
+	if string(results[7].Value) != "value" {
+		t.Errorf("Expected %q but received %q", "value", results[7].Value)
+	}
+
+	if results[8].Error == nil || results[8].Error.Code != protocol.CodeNotFound {
+		t.Errorf("Expected %s but received %+v", protocol.CodeNotFound, results[8].Error)
+	}
+
+	if results[9].Error == nil || results[9].Error.Code != protocol.CodeBadRequest {
+		t.Errorf("Expected %s but received %+v", protocol.CodeBadRequest, results[9].Error)
+	}
+}
+
+func TestBatchHandler_BadRequest(t *testing.T) {
+
+	handler := new(BatchHandler).Init(gcache.NewCache())
+
+	ts := httptest.NewServer(http.HandlerFunc(handler.ServeHTTP))
+	defer ts.Close()
+
+	// Malformed, and followed by other data
+	for _, body := range []string{"{", `[{"op":"get","key":"key"}]x`, `[] []`} {
+		rr, err := http.Post(ts.URL, protocol.ContentTypeJSON, bytes.NewBufferString(body))
+
+		if err != nil {
+			t.Fatalf("http.Post(%q) unexpected error: %v", ts.URL, err)
+		}
+
+		// Check the status code is what we expect.
+		if status := rr.StatusCode; status != http.StatusBadRequest {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v",
+				body, status, http.StatusBadRequest)
+		}
+	}
+}
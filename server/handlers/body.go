@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+)
+
+var ErrTrailingData = errors.New("Json value is followed by other data")
+
+type bodyKey struct{}
+
+// Json body of a request decoded by DecodeBody
+type decodedBody struct {
+	value interface{}
+	err   error
+}
+
+// Decode the json body of the request into v, a pointer, and return the request carrying the outcome.
+// Nothing but white space may follow the json value. Decoding the body of the returned request
+// gets the same outcome without reading the body again, so that the command of the request is checked
+// against the body which is executed. The body is put back for the size limits, reading it fails with the same error
+func DecodeBody(req *http.Request, v interface{}) (*http.Request, error) {
+
+	if decoded, ok := req.Context().Value(bodyKey{}).(*decodedBody); ok {
+		if decoded.err == nil {
+			reflect.ValueOf(v).Elem().Set(reflect.ValueOf(decoded.value).Elem())
+		}
+		return req, decoded.err
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+
+	if err != nil {
+		req.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), errReader{err}))
+	} else {
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		err = decodeStrict(body, v)
+	}
+
+	decoded := &decodedBody{value: v, err: err}
+	return req.WithContext(context.WithValue(req.Context(), bodyKey{}, decoded)), err
+}
+
+// Get the error of decoding the body of the request by DecodeBody, nil if the body is not decoded
+func BodyError(req *http.Request) error {
+	if decoded, ok := req.Context().Value(bodyKey{}).(*decodedBody); ok {
+		return decoded.err
+	}
+	return nil
+}
+
+func decodeStrict(body []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return ErrTrailingData
+	}
+	return nil
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"gcache"
+	"gcache/protocol"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultScanCount = 100
+	maxScanCount     = 10000
+)
+
+// Dump handler serializes keys with their ttl and restores them, e.g. on another server.
+// Dumps are raw request and response bodies. Keys are scanned in pages to export them all
+type DumpHandler struct {
+	Cache *gcache.Cache
+}
+
+func (handler *DumpHandler) Init(cache *gcache.Cache) Handler {
+	return &DumpHandler{
+		Cache: cache,
+	}
+}
+
+func (handler *DumpHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	if req.URL.Path == protocol.ScanPath {
+		if req.Method != http.MethodGet {
+			writeBadRequest(w, req, "Unsupported method "+req.Method)
+			return
+		}
+
+		handler.scanQuery(w, req)
+		return
+	}
+
+	var prefix, method string
+	switch {
+	case strings.HasPrefix(req.URL.Path, protocol.DumpPath+"/"):
+		prefix, method = protocol.DumpPath, http.MethodGet
+	case strings.HasPrefix(req.URL.Path, protocol.RestorePath+"/"):
+		prefix, method = protocol.RestorePath, http.MethodPost
+	default:
+		writeBadRequest(w, req, "Unsupported path "+req.URL.Path)
+		return
+	}
+
+	segments, err := protocol.SplitPath(req.URL.EscapedPath(), prefix)
+
+	if err != nil || len(segments) != 1 || segments[0] == "" {
+		writeBadRequest(w, req, "Expected a single key in the path")
+		return
+	}
+
+	if req.Method != method {
+		writeBadRequest(w, req, "Unsupported method "+req.Method)
+		return
+	}
+
+	if prefix == protocol.DumpPath {
+		handler.dumpQuery(w, req, segments[0])
+		return
+	}
+
+	handler.restoreCommand(w, req, segments[0])
+}
+
+func (handler *DumpHandler) dumpQuery(w http.ResponseWriter, req *http.Request, key string) {
+
+	span := cacheSpan(req, "dump")
+	dump, err := handler.Cache.Dump(key)
+	span.End()
+
+	if err != nil {
+		writeCacheError(w, req, err)
+		return
+	}
+
+	if prefersJSON(req) {
+		writeJSON(w, http.StatusOK, protocol.DumpResponse{Dump: dump})
+		return
+	}
+
+	w.Header().Set("Content-Type", protocol.ContentTypeBinary)
+	w.Write(dump)
+}
+
+func (handler *DumpHandler) restoreCommand(w http.ResponseWriter, req *http.Request, key string) {
+
+	query := req.URL.Query()
+
+	// The ttl of the dump is kept unless one is given
+	ttl := 0
+	if strTtl := query.Get(formTtl); strTtl != "" {
+		var err error
+		if ttl, err = strconv.Atoi(strTtl); err != nil || ttl < 0 {
+			writeBadRequest(w, req, "Ttl must be a non negative number of seconds")
+			return
+		}
+	}
+
+	replace := false
+	if strReplace := query.Get("replace"); strReplace != "" {
+		var err error
+		if replace, err = strconv.ParseBool(strReplace); err != nil {
+			writeBadRequest(w, req, "Replace must be true or false")
+			return
+		}
+	}
+
+	dump, err := ioutil.ReadAll(req.Body)
+
+	if err != nil {
+		writeBadRequest(w, req, "Failed to read the dump")
+		return
+	}
+
+	span := cacheSpan(req, "restore")
+	err = handler.Cache.Restore(key, dump, time.Duration(ttl)*time.Second, replace)
+	span.End()
+
+	if err != nil {
+		writeCacheError(w, req, err)
+		return
+	}
+
+	writeOk(w, req)
+}
+
+// Scan a page of keys after the cursor, the response is always json since it has both the keys and the cursor
+func (handler *DumpHandler) scanQuery(w http.ResponseWriter, req *http.Request) {
+
+	query := req.URL.Query()
+
+	count := defaultScanCount
+	if strCount := query.Get("count"); strCount != "" {
+		var err error
+		if count, err = strconv.Atoi(strCount); err != nil || count <= 0 {
+			writeBadRequest(w, req, "Count must be a positive number")
+			return
+		}
+	}
+	if count > maxScanCount {
+		count = maxScanCount
+	}
+
+	span := cacheSpan(req, "scan")
+	keys, cursor := handler.Cache.Scan(query.Get("cursor"), count)
+	span.End()
+
+	writeJSON(w, http.StatusOK, protocol.ScanResponse{Cursor: cursor, Keys: keys})
+}
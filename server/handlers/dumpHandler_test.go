@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"gcache"
+	"gcache/protocol"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDumpHandler_DumpRestore(t *testing.T) {
+
+	source := gcache.NewCache()
+	source.Set("key", "value", time.Minute)
+
+	target := gcache.NewCache()
+
+	sourceServer := httptest.NewServer(new(DumpHandler).Init(source))
+	defer sourceServer.Close()
+
+	targetServer := httptest.NewServer(new(DumpHandler).Init(target))
+	defer targetServer.Close()
+
+	rr, err := http.Get(sourceServer.URL + protocol.DumpPath + "/key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status := rr.StatusCode; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	dump, _ := ioutil.ReadAll(rr.Body)
+	rr.Body.Close()
+
+	restore := func(query string) int {
+		rr, err := http.Post(targetServer.URL+protocol.RestorePath+"/key"+query, protocol.ContentTypeBinary, bytes.NewReader(dump))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr.Body.Close()
+		return rr.StatusCode
+	}
+
+	if status := restore(""); status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	if value, err := target.Get("key"); err != nil || value != "value" {
+		t.Errorf("Expected value but actual %v, err = %v", value, err)
+	}
+
+	// Existing keys are replaced only if asked to
+	if status := restore(""); status != http.StatusConflict {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusConflict)
+	}
+
+	if status := restore("?replace=true&ttl=3600"); status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	if ttl, _ := target.Ttl("key"); ttl != time.Hour {
+		t.Error("Expected the given ttl but actual", ttl)
+	}
+
+	dump = []byte("not a dump")
+	if status := restore("?replace=true"); status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+
+	// Values other than strings would fail the reads of the key
+	source.Set("number", int64(1), time.Minute)
+	dump, _ = source.Dump("number")
+
+	if status := restore("?replace=true"); status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+
+	if value, _ := target.Get("key"); value != "value" {
+		t.Error("Expected the key to be kept but actual", value)
+	}
+
+	rr, _ = http.Get(sourceServer.URL + protocol.DumpPath + "/missing")
+	if rr.StatusCode != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestDumpHandler_Scan(t *testing.T) {
+
+	cache := gcache.NewCache()
+	cache.Set("key1", "value", time.Minute)
+	cache.Set("key2", "value", time.Minute)
+	cache.Set("key3", "value", time.Minute)
+
+	ts := httptest.NewServer(new(DumpHandler).Init(cache))
+	defer ts.Close()
+
+	scan := func(cursor string) protocol.ScanResponse {
+		rr, err := http.Get(ts.URL + protocol.ScanPath + "?count=2&cursor=" + cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rr.Body.Close()
+
+		response := protocol.ScanResponse{}
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	first := scan("")
+	if len(first.Keys) != 2 || first.Keys[0] != "key1" || first.Keys[1] != "key2" || first.Cursor != "key2" {
+		t.Errorf("Expected [key1 key2] and cursor key2 but received %v and %q", first.Keys, first.Cursor)
+	}
+
+	second := scan(first.Cursor)
+	if len(second.Keys) != 1 || second.Keys[0] != "key3" || second.Cursor != "" {
+		t.Errorf("Expected [key3] and no cursor but received %v and %q", second.Keys, second.Cursor)
+	}
+}
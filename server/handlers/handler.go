@@ -3,8 +3,15 @@ package handlers
 import (
 	"bytes"
 	"encoding/csv"
+	"encoding/json"
 	"gcache"
+	"gcache/protocol"
+	"gcache/trace"
+	"io/ioutil"
+	"log"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -38,3 +45,204 @@ func serializeStrings(items []string) (string, error) {
 
 	return strings.Trim(buffer.String(), "\n"), nil
 }
+
+// Start the span of a cache command, it measures waiting for the lock of the cache and holding it.
+// The span is recorded by the tracer of the request context, if there is one
+func cacheSpan(req *http.Request, op string) trace.Span {
+	_, span := trace.StartSpan(req.Context(), "gcache.cache "+op)
+	return span
+}
+
+// Read the raw value from the request body
+func readValue(req *http.Request) (string, error) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+// Media types accepted by the client in order of preference. Types are ordered by their q weights,
+// types of the same weight keep their order, and types of weight 0 are not acceptable
+func acceptedTypes(req *http.Request) []string {
+	type weighted struct {
+		mediaType string
+		q         float64
+	}
+
+	accepted := []weighted{}
+	for _, accept := range req.Header["Accept"] {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			params := strings.Split(mediaRange, ";")
+			mediaType := strings.TrimSpace(params[0])
+			if mediaType == "" {
+				continue
+			}
+
+			q := 1.0
+			for _, param := range params[1:] {
+				name, value := param, ""
+				if i := strings.Index(param, "="); i >= 0 {
+					name, value = param[:i], param[i+1:]
+				}
+				if strings.TrimSpace(name) == "q" {
+					var err error
+					if q, err = strconv.ParseFloat(strings.TrimSpace(value), 64); err != nil {
+						q = 0
+					}
+				}
+			}
+
+			if q > 0 {
+				accepted = append(accepted, weighted{mediaType, q})
+			}
+		}
+	}
+
+	sort.SliceStable(accepted, func(i, j int) bool {
+		return accepted[i].q > accepted[j].q
+	})
+
+	types := make([]string, len(accepted))
+	for i, a := range accepted {
+		types[i] = a.mediaType
+	}
+	return types
+}
+
+// Successful responses are structured if json is the preferred media type
+func prefersJSON(req *http.Request) bool {
+	types := acceptedTypes(req)
+	return len(types) > 0 && types[0] == protocol.ContentTypeJSON
+}
+
+// Errors are structured if json is accepted at all
+func acceptsJSON(req *http.Request) bool {
+	for _, mediaType := range acceptedTypes(req) {
+		if mediaType == protocol.ContentTypeJSON {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, response interface{}) {
+	w.Header().Set("Content-Type", protocol.ContentTypeJSON)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to write json: %s", err)
+	}
+}
+
+// Write the error status with the typed code and the message,
+// as json if the client accepts it and as plain text otherwise
+func writeError(w http.ResponseWriter, req *http.Request, status int, code string, message string) {
+	if acceptsJSON(req) {
+		writeJSON(w, status, protocol.ErrorResponse{
+			Error: protocol.ErrorBody{Code: code, Message: message},
+		})
+		return
+	}
+
+	http.Error(w, message, status)
+}
+
+// Write the error for handlers outside of the package, e.g. middleware of the server
+func WriteError(w http.ResponseWriter, req *http.Request, status int, code string, message string) {
+	writeError(w, req, status, code, message)
+}
+
+// Map the error returned by the cache to the status and the typed code
+func cacheError(err error) (int, protocol.ErrorBody) {
+	switch err {
+	case gcache.ErrKeyNotFound, gcache.ErrHashKeyNotFound:
+		return http.StatusNotFound, protocol.ErrorBody{Code: protocol.CodeNotFound, Message: err.Error()}
+	case gcache.ErrWrongType:
+		return http.StatusConflict, protocol.ErrorBody{Code: protocol.CodeWrongType, Message: err.Error()}
+	case gcache.ErrTooLong:
+		return http.StatusRequestEntityTooLarge, protocol.ErrorBody{Code: protocol.CodeTooLarge, Message: err.Error()}
+	case gcache.ErrKeyExists:
+		return http.StatusConflict, protocol.ErrorBody{Code: protocol.CodeKeyExists, Message: err.Error()}
+	case gcache.ErrBadDump:
+		return http.StatusBadRequest, protocol.ErrorBody{Code: protocol.CodeBadRequest, Message: err.Error()}
+	}
+
+	return http.StatusInternalServerError, protocol.ErrorBody{Code: protocol.CodeInternal, Message: err.Error()}
+}
+
+// Write the error returned by the cache
+func writeCacheError(w http.ResponseWriter, req *http.Request, err error) {
+	status, body := cacheError(err)
+	writeError(w, req, status, body.Code, body.Message)
+}
+
+func writeBadRequest(w http.ResponseWriter, req *http.Request, message string) {
+	writeError(w, req, http.StatusBadRequest, protocol.CodeBadRequest, message)
+}
+
+// Write the successful outcome of a command
+func writeOk(w http.ResponseWriter, req *http.Request) {
+	if prefersJSON(req) {
+		writeJSON(w, http.StatusOK, protocol.OkResponse{Ok: true})
+	}
+}
+
+// Write the value as json or as the raw response body. ttl is optional
+func writeValue(w http.ResponseWriter, req *http.Request, value interface{}, ttl *int64) {
+	str, ok := value.(string)
+	if !ok {
+		writeCacheError(w, req, gcache.ErrWrongType)
+		return
+	}
+
+	if prefersJSON(req) {
+		writeJSON(w, http.StatusOK, protocol.ValueResponse{Value: []byte(str), Ttl: ttl})
+		return
+	}
+
+	w.Header().Set("Content-Type", protocol.ContentTypeBinary)
+	w.Write([]byte(str))
+}
+
+// Write values as json or as the response body each prefixed with its length
+func writeValues(w http.ResponseWriter, req *http.Request, values []string) {
+	if prefersJSON(req) {
+		response := protocol.ValuesResponse{Values: make([][]byte, len(values))}
+		for i, value := range values {
+			response.Values[i] = []byte(value)
+		}
+		writeJSON(w, http.StatusOK, response)
+		return
+	}
+
+	writeRawValues(w, values)
+}
+
+// Write keys as json or as the response body each prefixed with its length
+func writeKeys(w http.ResponseWriter, req *http.Request, keys []string) {
+	if prefersJSON(req) {
+		writeJSON(w, http.StatusOK, protocol.KeysResponse{Keys: keys})
+		return
+	}
+
+	writeRawValues(w, keys)
+}
+
+func writeRawValues(w http.ResponseWriter, values []string) {
+	w.Header().Set("Content-Type", protocol.ContentTypeValues)
+	if err := protocol.WriteValues(w, values); err != nil {
+		log.Printf("Failed to write values: %s", err)
+	}
+}
+
+func toStrings(items []interface{}) ([]string, error) {
+	casted := make([]string, len(items))
+	for i, value := range items {
+		str, ok := value.(string)
+		if !ok {
+			return nil, gcache.ErrWrongType
+		}
+		casted[i] = str
+	}
+	return casted, nil
+}
@@ -66,7 +66,9 @@ func (handler *HashesHandler) hSetCommand(w http.ResponseWriter, req *http.Reque
 
 	}
 
+	span := cacheSpan(req, "hset")
 	err := handler.Cache.HSet(key, hashKey, value)
+	span.End()
 
 	if (err != nil) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -89,7 +91,9 @@ func (handler *HashesHandler) hGetQuery(w http.ResponseWriter, req *http.Request
 		return
 	}
 
+	span := cacheSpan(req, "hget")
 	value, err := handler.Cache.HGet(key, hashKey)
+	span.End()
 
 	w.Header().Set("Content-Type", "text/plain")
 
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"gcache"
+	"gcache/protocol"
+	"net/http"
+)
+
+// Hashes handler of the v2 API. The path after /v2/hashes is the key and the hash key,
+// the value is the raw request or response body
+type HashesV2Handler struct {
+	Cache *gcache.Cache
+}
+
+func (handler *HashesV2Handler) Init(cache *gcache.Cache) Handler {
+	return &HashesV2Handler{
+		Cache: cache,
+	}
+}
+
+func (handler *HashesV2Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	segments, err := protocol.SplitPath(req.URL.EscapedPath(), protocol.HashesPath)
+
+	if err != nil || len(segments) != 2 || segments[0] == "" || segments[1] == "" {
+		writeBadRequest(w, req, "Expected a key and a hash key in the path")
+		return
+	}
+
+	key, hashKey := segments[0], segments[1]
+
+	// Router
+	switch req.Method {
+	case http.MethodGet:
+		handler.hGetQuery(w, req, key, hashKey)
+		return
+
+	case http.MethodPost:
+		handler.hSetCommand(w, req, key, hashKey)
+		return
+	}
+
+	// Nothing matched, return Bad request
+	writeBadRequest(w, req, "Unsupported method "+req.Method)
+}
+
+func (handler *HashesV2Handler) hSetCommand(w http.ResponseWriter, req *http.Request, key string, hashKey string) {
+
+	value, err := readValue(req)
+	if err != nil {
+		writeBadRequest(w, req, "Failed to read the value")
+		return
+	}
+
+	span := cacheSpan(req, "hset")
+	err = handler.Cache.HSet(key, hashKey, value)
+	span.End()
+
+	if err != nil {
+		writeCacheError(w, req, err)
+		return
+	}
+
+	writeOk(w, req)
+}
+
+func (handler *HashesV2Handler) hGetQuery(w http.ResponseWriter, req *http.Request, key string, hashKey string) {
+
+	span := cacheSpan(req, "hget")
+	value, err := handler.Cache.HGet(key, hashKey)
+	span.End()
+
+	if err != nil {
+		writeCacheError(w, req, err)
+		return
+	}
+
+	writeValue(w, req, value, nil)
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"bytes"
+	"gcache"
+	"gcache/protocol"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHashesV2Handler_HSetHGet(t *testing.T) {
+
+	const key = "hash/key"
+	const hashKey = "field&=#"
+	const value = "\x00value\xff"
+
+	handler := new(HashesV2Handler).Init(gcache.NewCache())
+
+	ts := httptest.NewServer(http.HandlerFunc(handler.ServeHTTP))
+	defer ts.Close()
+
+	url := ts.URL + protocol.HashesPath + "/" + protocol.EscapeSegment(key) + "/" + protocol.EscapeSegment(hashKey)
+
+	rr, err := http.Post(url, protocol.ContentTypeBinary, bytes.NewBufferString(value))
+
+	if err != nil {
+		t.Fatalf("http.Post(%q) unexpected error: %v", url, err)
+	}
+
+	// Check the status code is what we expect.
+	if status := rr.StatusCode; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+
+	rr, err = http.Get(url)
+
+	if err != nil {
+		t.Fatalf("http.Get(%q) unexpected error: %v", url, err)
+	}
+
+	actual, err := ioutil.ReadAll(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != string(actual) {
+		t.Errorf("Expected the value %q but received %q", value, string(actual))
+	}
+
+	// Missing hash key
+	rr, err = http.Get(ts.URL + protocol.HashesPath + "/" + protocol.EscapeSegment(key) + "/missing")
+
+	if err != nil {
+		t.Fatalf("http.Get(%q) unexpected error: %v", url, err)
+	}
+
+	if status := rr.StatusCode; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusNotFound)
+	}
+
+	// Hash key is missed in the path
+	rr, err = http.Get(ts.URL + protocol.HashesPath + "/" + protocol.EscapeSegment(key))
+
+	if err != nil {
+		t.Fatalf("http.Get(%q) unexpected error: %v", url, err)
+	}
+
+	if status := rr.StatusCode; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusBadRequest)
+	}
+}
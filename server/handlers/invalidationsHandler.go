@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"gcache"
+	"gcache/protocol"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Number of changed keys buffered per subscriber. A subscriber which falls behind is disconnected
+const invalidationsBufferSize = 1024
+
+// Invalidations handler streams keys changed on the server to subscribed clients,
+// which use them to invalidate their local caches. Keys are sent as length prefixed values.
+// Clients may subscribe to keys with the given prefixes only by ?prefix=a&prefix=b.
+// protocol.InvalidateAll, the empty key, invalidates every key
+type InvalidationsHandler struct {
+	Cache *gcache.Cache
+
+	mutex       sync.Mutex
+	subscribers map[*subscriber]bool
+}
+
+type subscriber struct {
+	prefixes []string
+	keys     chan string
+	// Closed when the subscriber is disconnected for falling behind
+	dropped chan struct{}
+}
+
+func (handler *InvalidationsHandler) Init(cache *gcache.Cache) Handler {
+	h := &InvalidationsHandler{
+		Cache:       cache,
+		subscribers: make(map[*subscriber]bool),
+	}
+
+	cache.OnChange(h.publish)
+
+	return h
+}
+
+func (handler *InvalidationsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	if req.Method != http.MethodGet {
+		writeBadRequest(w, req, "Unsupported method "+req.Method)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, req, http.StatusInternalServerError, protocol.CodeInternal, "Streaming is not supported")
+		return
+	}
+
+	s := &subscriber{
+		prefixes: req.URL.Query()["prefix"],
+		keys:     make(chan string, invalidationsBufferSize),
+		dropped:  make(chan struct{}),
+	}
+
+	handler.subscribe(s)
+	defer handler.unsubscribe(s)
+
+	// The subscription is active once the headers are received
+	w.Header().Set("Content-Type", protocol.ContentTypeValues)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case key := <-s.keys:
+			keys := []string{key}
+
+			// Send everything pending at once
+			for pending := true; pending; {
+				select {
+				case key := <-s.keys:
+					keys = append(keys, key)
+				default:
+					pending = false
+				}
+			}
+
+			if err := protocol.WriteValues(w, keys); err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case <-s.dropped:
+			return
+
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+func (handler *InvalidationsHandler) subscribe(s *subscriber) {
+	handler.mutex.Lock()
+	handler.subscribers[s] = true
+	handler.mutex.Unlock()
+}
+
+func (handler *InvalidationsHandler) unsubscribe(s *subscriber) {
+	handler.mutex.Lock()
+	delete(handler.subscribers, s)
+	handler.mutex.Unlock()
+}
+
+// Get the number of the subscribers
+func (handler *InvalidationsHandler) Subscribers() int {
+	handler.mutex.Lock()
+	defer handler.mutex.Unlock()
+	return len(handler.subscribers)
+}
+
+// Disconnect all the subscribers, e.g. on shutdown
+func (handler *InvalidationsHandler) Close() {
+	handler.mutex.Lock()
+	defer handler.mutex.Unlock()
+
+	for s := range handler.subscribers {
+		delete(handler.subscribers, s)
+		close(s.dropped)
+	}
+}
+
+// Send the changed key to the interested subscribers without blocking the writer
+func (handler *InvalidationsHandler) publish(key string) {
+	handler.mutex.Lock()
+	defer handler.mutex.Unlock()
+
+	for s := range handler.subscribers {
+		if !s.matches(key) {
+			continue
+		}
+
+		select {
+		case s.keys <- key:
+		default:
+			// The subscriber can no longer trust its cache, closing the stream tells it to flush
+			delete(handler.subscribers, s)
+			close(s.dropped)
+		}
+	}
+}
+
+func (s *subscriber) matches(key string) bool {
+	if len(s.prefixes) == 0 || key == protocol.InvalidateAll {
+		return true
+	}
+
+	for _, prefix := range s.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
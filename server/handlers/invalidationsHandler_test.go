@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"bufio"
+	"gcache"
+	"gcache/protocol"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestInvalidationsHandler_Stream(t *testing.T) {
+
+	cache := gcache.NewCache()
+	handler := new(InvalidationsHandler).Init(cache)
+
+	ts := httptest.NewServer(http.HandlerFunc(handler.ServeHTTP))
+	defer ts.Close()
+
+	rr, err := http.Get(ts.URL + protocol.InvalidationsPath + "?prefix=user:")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Body.Close()
+
+	// Check the status code is what we expect.
+	if status := rr.StatusCode; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+
+	cache.Set("other", "value", time.Second)
+	cache.Set("user:1", "value", time.Second)
+	cache.Del("user:1")
+
+	reader := bufio.NewReader(rr.Body)
+
+	for i := 0; i < 2; i++ {
+		key, err := protocol.ReadValue(reader)
+
+		if err != nil {
+			t.Fatal("Failed to read the invalidation", err)
+		}
+
+		if key != "user:1" {
+			t.Errorf("handler streamed unexpected key: got %q want %q", key, "user:1")
+		}
+	}
+}
+
+func TestInvalidationsHandler_InvalidateAll(t *testing.T) {
+
+	cache := gcache.NewCache()
+	handler := new(InvalidationsHandler).Init(cache).(*InvalidationsHandler)
+
+	ts := httptest.NewServer(http.HandlerFunc(handler.ServeHTTP))
+	defer ts.Close()
+
+	rr, err := http.Get(ts.URL + protocol.InvalidationsPath + "?prefix=user:")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Body.Close()
+
+	// Every key is invalidated whatever the prefixes
+	handler.publish(protocol.InvalidateAll)
+	cache.Set("user:1", "value", time.Second)
+
+	reader := bufio.NewReader(rr.Body)
+
+	for _, expected := range []string{protocol.InvalidateAll, "user:1"} {
+		key, err := protocol.ReadValue(reader)
+
+		if err != nil {
+			t.Fatal("Failed to read the invalidation", err)
+		}
+
+		if key != expected {
+			t.Errorf("handler streamed unexpected key: got %q want %q", key, expected)
+		}
+	}
+}
+
+func TestInvalidationsHandler_Flush(t *testing.T) {
+
+	cache := gcache.NewCache()
+	handler := new(InvalidationsHandler).Init(cache).(*InvalidationsHandler)
+
+	ts := httptest.NewServer(http.HandlerFunc(handler.ServeHTTP))
+	defer ts.Close()
+
+	rr, err := http.Get(ts.URL + protocol.InvalidationsPath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Body.Close()
+
+	reader := bufio.NewReader(rr.Body)
+
+	// More keys than the buffer of the subscriber are flushed by a single invalidation
+	for i := 0; i < 2*invalidationsBufferSize; i++ {
+		cache.Set("key"+strconv.Itoa(i), "value", time.Minute)
+		if _, err := protocol.ReadValue(reader); err != nil {
+			t.Fatal("Failed to read the invalidation", err)
+		}
+	}
+
+	cache.Flush()
+	cache.Set("key", "value", time.Minute)
+
+	for _, expected := range []string{protocol.InvalidateAll, "key"} {
+		key, err := protocol.ReadValue(reader)
+
+		if err != nil {
+			t.Fatal("Failed to read the invalidation", err)
+		}
+
+		if key != expected {
+			t.Errorf("handler streamed unexpected key: got %q want %q", key, expected)
+		}
+	}
+
+	if n := handler.Subscribers(); n != 1 {
+		t.Errorf("Expected the subscriber to be kept but actual %d subscribers", n)
+	}
+}
+
+func TestInvalidationsHandler_DropSlowSubscriber(t *testing.T) {
+
+	cache := gcache.NewCache()
+	handler := new(InvalidationsHandler).Init(cache)
+
+	ts := httptest.NewServer(http.HandlerFunc(handler.ServeHTTP))
+	defer ts.Close()
+
+	rr, err := http.Get(ts.URL + protocol.InvalidationsPath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Body.Close()
+
+	// Nobody reads the stream, so the buffers fill up and the subscriber is dropped
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000000; i++ {
+			cache.Set("key", "value", time.Second)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Writes are blocked by a slow subscriber")
+	}
+
+	reader := bufio.NewReader(rr.Body)
+	for {
+		if _, err := protocol.ReadValue(reader); err != nil {
+			break
+		}
+	}
+
+	h := handler.(*InvalidationsHandler)
+	h.mutex.Lock()
+	n := len(h.subscribers)
+	h.mutex.Unlock()
+
+	if n != 0 {
+		t.Errorf("Expected the slow subscriber to be dropped but %d subscribers left", n)
+	}
+}
@@ -65,7 +65,9 @@ func (handler *KeysHandler) ServeHTTP(w http.ResponseWriter, req *http.Request)
 
 func (handler *KeysHandler) keysQuery(w http.ResponseWriter, req *http.Request) {
 
+	span := cacheSpan(req, "keys")
 	keys := handler.Cache.Keys()
+	span.End()
 
 	// Serialize keys to string
 	serialized, err := serializeStrings(keys)
@@ -89,7 +91,9 @@ func (handler *KeysHandler) getKeyQuery(w http.ResponseWriter, req *http.Request
 		return
 	}
 
+	span := cacheSpan(req, "get")
 	value, err := handler.Cache.Get(key)
+	span.End()
 
 	if err == gcache.ErrKeyNotFound {
 		w.WriteHeader(http.StatusNotFound)
@@ -135,7 +139,9 @@ func (handler *KeysHandler) setKeyCommand(w http.ResponseWriter, req *http.Reque
 		return
 	}
 
+	span := cacheSpan(req, "set")
 	handler.Cache.Set(key, value, convertIntToDurationInMinutes(ttl))
+	span.End()
 }
 
 func (handler *KeysHandler) removeCommand(w http.ResponseWriter, req *http.Request) {
@@ -147,7 +153,9 @@ func (handler *KeysHandler) removeCommand(w http.ResponseWriter, req *http.Reque
 		return
 	}
 
+	span := cacheSpan(req, "del")
 	err := handler.Cache.Del(key)
+	span.End()
 
 	if err == gcache.ErrKeyNotFound {
 		http.NotFound(w, req)
@@ -178,7 +186,9 @@ func (handler *KeysHandler) updateCommand(w http.ResponseWriter, req *http.Reque
 
 
 	if req.Form.Get(formTtl) == "" {
+		span := cacheSpan(req, "update")
 		err := handler.Cache.Update(key, value)
+		span.End()
 
 		if err == gcache.ErrKeyNotFound {
 			w.WriteHeader(http.StatusNotFound)
@@ -197,7 +207,9 @@ func (handler *KeysHandler) updateCommand(w http.ResponseWriter, req *http.Reque
 			return
 		}
 
+		span := cacheSpan(req, "update")
 		err = handler.Cache.UpdateWithTll(key, value, convertIntToDurationInMinutes(ttl))
+		span.End()
 
 		if err == gcache.ErrKeyNotFound {
 			w.WriteHeader(http.StatusNotFound)
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"gcache"
+	"gcache/protocol"
+	"net/http"
+	"strconv"
+)
+
+// Keys handler of the v2 API. The key is the path segment after /v2/keys
+// and the value is the raw request or response body
+type KeysV2Handler struct {
+	Cache *gcache.Cache
+}
+
+func (handler *KeysV2Handler) Init(cache *gcache.Cache) Handler {
+	return &KeysV2Handler{
+		Cache: cache,
+	}
+}
+
+func (handler *KeysV2Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	segments, err := protocol.SplitPath(req.URL.EscapedPath(), protocol.KeysPath)
+
+	if err != nil || len(segments) > 1 {
+		writeBadRequest(w, req, "Expected a single key in the path")
+		return
+	}
+
+	// Keys
+	if len(segments) == 0 {
+		if req.Method == http.MethodGet {
+			handler.keysQuery(w, req)
+			return
+		}
+
+		writeBadRequest(w, req, "Key is missed in the path")
+		return
+	}
+
+	key := segments[0]
+
+	if key == "" {
+		writeBadRequest(w, req, "Key is empty")
+		return
+	}
+
+	switch req.Method {
+
+	// Get
+	case http.MethodGet:
+		handler.getKeyQuery(w, req, key)
+		return
+
+	// Set
+	case http.MethodPost:
+		handler.setKeyCommand(w, req, key)
+		return
+
+	// Update
+	case http.MethodPatch:
+		handler.updateCommand(w, req, key)
+		return
+
+	// Delete
+	case http.MethodDelete:
+		handler.removeCommand(w, req, key)
+		return
+	}
+
+	// Nothing matched, return bad request
+	writeBadRequest(w, req, "Unsupported method "+req.Method)
+}
+
+func (handler *KeysV2Handler) keysQuery(w http.ResponseWriter, req *http.Request) {
+	span := cacheSpan(req, "keys")
+	keys := handler.Cache.Keys()
+	span.End()
+
+	writeKeys(w, req, keys)
+}
+
+func (handler *KeysV2Handler) getKeyQuery(w http.ResponseWriter, req *http.Request, key string) {
+
+	span := cacheSpan(req, "get")
+	value, err := handler.Cache.Get(key)
+
+	if err != nil {
+		span.End()
+		writeCacheError(w, req, err)
+		return
+	}
+
+	var seconds *int64
+	if ttl, err := handler.Cache.Ttl(key); err == nil {
+		s := int64(ttl.Seconds())
+		seconds = &s
+	}
+	span.End()
+
+	writeValue(w, req, value, seconds)
+}
+
+func (handler *KeysV2Handler) setKeyCommand(w http.ResponseWriter, req *http.Request, key string) {
+
+	ttl, err := strconv.Atoi(req.URL.Query().Get(formTtl))
+
+	if err != nil || ttl < 0 {
+		writeBadRequest(w, req, "Ttl must be a non negative number of seconds")
+		return
+	}
+
+	value, err := readValue(req)
+
+	if err != nil {
+		writeBadRequest(w, req, "Failed to read the value")
+		return
+	}
+
+	span := cacheSpan(req, "set")
+	handler.Cache.Set(key, value, convertIntToDurationInMinutes(ttl))
+	span.End()
+	writeOk(w, req)
+}
+
+func (handler *KeysV2Handler) removeCommand(w http.ResponseWriter, req *http.Request, key string) {
+
+	span := cacheSpan(req, "del")
+	err := handler.Cache.Del(key)
+	span.End()
+
+	if err != nil {
+		writeCacheError(w, req, err)
+		return
+	}
+
+	writeOk(w, req)
+}
+
+func (handler *KeysV2Handler) updateCommand(w http.ResponseWriter, req *http.Request, key string) {
+
+	value, err := readValue(req)
+
+	if err != nil {
+		writeBadRequest(w, req, "Failed to read the value")
+		return
+	}
+
+	strTtl := req.URL.Query().Get(formTtl)
+
+	if strTtl == "" {
+		span := cacheSpan(req, "update")
+		err = handler.Cache.Update(key, value)
+		span.End()
+	} else {
+		ttl, convErr := strconv.Atoi(strTtl)
+		if convErr != nil || ttl < 0 {
+			writeBadRequest(w, req, "Ttl must be a non negative number of seconds")
+			return
+		}
+
+		span := cacheSpan(req, "update")
+		err = handler.Cache.UpdateWithTll(key, value, convertIntToDurationInMinutes(ttl))
+		span.End()
+	}
+
+	if err != nil {
+		writeCacheError(w, req, err)
+		return
+	}
+
+	writeOk(w, req)
+}
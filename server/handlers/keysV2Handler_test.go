@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"gcache"
+	"gcache/protocol"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestKeysV2Handler_BinarySafeSetGet(t *testing.T) {
+
+	const key = "a b&c=d#e/f?g"
+	const value = "value & = # \x00\xff\r\n"
+
+	handler := new(KeysV2Handler).Init(gcache.NewCache())
+
+	ts := httptest.NewServer(http.HandlerFunc(handler.ServeHTTP))
+	defer ts.Close()
+
+	url := ts.URL + protocol.KeysPath + "/" + protocol.EscapeSegment(key)
+
+	rr, err := http.Get(url)
+
+	if err != nil {
+		t.Fatalf("http.Get(%q) unexpected error: %v", url, err)
+	}
+
+	// Check the status code is what we expect.
+	if status := rr.StatusCode; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusNotFound)
+	}
+
+	rr, err = http.Post(url+"?ttl=5", protocol.ContentTypeBinary, bytes.NewBufferString(value))
+
+	if err != nil {
+		t.Fatalf("http.Post(%q) unexpected error: %v", url, err)
+	}
+
+	// Check the status code is what we expect.
+	if status := rr.StatusCode; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+
+	// Bad request. Ttl is missed
+	rr, err = http.Post(url, protocol.ContentTypeBinary, bytes.NewBufferString(value))
+
+	if err != nil {
+		t.Fatalf("http.Post(%q) unexpected error: %v", url, err)
+	}
+
+	// Check the status code is what we expect.
+	if status := rr.StatusCode; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusBadRequest)
+	}
+
+	rr, err = http.Get(url)
+
+	if err != nil {
+		t.Fatalf("http.Get(%q) unexpected error: %v", url, err)
+	}
+
+	if contentType := rr.Header.Get("Content-Type"); contentType != protocol.ContentTypeBinary {
+		t.Errorf("handler returned wrong content type: got %v want %v",
+			contentType, protocol.ContentTypeBinary)
+	}
+
+	actual, err := ioutil.ReadAll(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != string(actual) {
+		t.Errorf("Expected the value %q but received %q", value, string(actual))
+	}
+
+	// Keys
+	rr, err = http.Get(ts.URL + protocol.KeysPath)
+
+	if err != nil {
+		t.Fatalf("http.Get(%q) unexpected error: %v", url, err)
+	}
+
+	keys, err := protocol.ReadValues(rr.Body)
+
+	if err != nil || len(keys) != 1 || keys[0] != key {
+		t.Errorf("Expected the only key %q but received %q, err = %v", key, keys, err)
+	}
+}
+
+func TestKeysV2Handler_UpdateDel(t *testing.T) {
+
+	const key = "."
+	const value = "updated"
+
+	handler := new(KeysV2Handler).Init(gcache.NewCache())
+
+	ts := httptest.NewServer(http.HandlerFunc(handler.ServeHTTP))
+	defer ts.Close()
+
+	url := ts.URL + protocol.KeysPath + "/" + protocol.EscapeSegment(key)
+
+	// Not found
+	req, _ := http.NewRequest(http.MethodPatch, url, bytes.NewBufferString(value))
+	rr, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		t.Fatalf("http.Patch(%q) unexpected error: %v", url, err)
+	}
+
+	if status := rr.StatusCode; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusNotFound)
+	}
+
+	http.Post(url+"?ttl=5", protocol.ContentTypeBinary, bytes.NewBufferString("value"))
+
+	req, _ = http.NewRequest(http.MethodPatch, url+"?ttl=10", bytes.NewBufferString(value))
+	rr, err = http.DefaultClient.Do(req)
+
+	if err != nil {
+		t.Fatalf("http.Patch(%q) unexpected error: %v", url, err)
+	}
+
+	if status := rr.StatusCode; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+
+	if actual, _ := handler.(*KeysV2Handler).Cache.Get(key); actual != value {
+		t.Errorf("Expected the value %q but actual %q", value, actual)
+	}
+
+	req, _ = http.NewRequest(http.MethodDelete, url, nil)
+	rr, err = http.DefaultClient.Do(req)
+
+	if err != nil {
+		t.Fatalf("http.Delete(%q) unexpected error: %v", url, err)
+	}
+
+	if status := rr.StatusCode; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+}
+
+func TestKeysV2Handler_JSON(t *testing.T) {
+
+	const key = "key"
+	// Not UTF-8, json carries it base64 encoded
+	const value = "value\x00\xff\xfe"
+
+	handler := new(KeysV2Handler).Init(gcache.NewCache())
+
+	ts := httptest.NewServer(http.HandlerFunc(handler.ServeHTTP))
+	defer ts.Close()
+
+	url := ts.URL + protocol.KeysPath + "/" + key
+
+	get := func(accept string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		req.Header.Set("Accept", accept)
+		rr, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("http.Get(%q) unexpected error: %v", url, err)
+		}
+		return rr
+	}
+
+	// Structured error
+	rr := get(protocol.ContentTypeJSON)
+
+	if status := rr.StatusCode; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusNotFound)
+	}
+
+	errorResponse := protocol.ErrorResponse{}
+	if err := json.NewDecoder(rr.Body).Decode(&errorResponse); err != nil {
+		t.Fatal(err)
+	}
+
+	if errorResponse.Error.Code != protocol.CodeNotFound {
+		t.Errorf("Expected the error code %s but received %+v", protocol.CodeNotFound, errorResponse)
+	}
+
+	handler.(*KeysV2Handler).Cache.Set(key, value, 5*time.Second)
+
+	// Structured value with ttl
+	rr = get(protocol.ContentTypeJSON)
+
+	valueResponse := protocol.ValueResponse{}
+	if err := json.NewDecoder(rr.Body).Decode(&valueResponse); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(valueResponse.Value) != value || valueResponse.Ttl == nil || *valueResponse.Ttl != 5 {
+		t.Errorf("Expected the value %s with ttl 5 but received %+v", value, valueResponse)
+	}
+
+	// Raw value is preferred over json
+	rr = get(protocol.ContentTypeBinary + ", " + protocol.ContentTypeJSON)
+
+	actual, err := ioutil.ReadAll(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != string(actual) {
+		t.Errorf("Expected the value %q but received %q", value, string(actual))
+	}
+
+	// Json of weight 0 is not acceptable, and weights order the types
+	for _, accept := range []string{
+		protocol.ContentTypeJSON + ";q=0, */*",
+		protocol.ContentTypeJSON + ";q=0.5, " + protocol.ContentTypeBinary,
+	} {
+		rr = get(accept)
+		if contentType := rr.Header.Get("Content-Type"); contentType != protocol.ContentTypeBinary {
+			t.Errorf("%s: expected a raw value but received %s", accept, contentType)
+		}
+	}
+
+	rr = get(protocol.ContentTypeBinary + ";q=0.1, " + protocol.ContentTypeJSON)
+	if contentType := rr.Header.Get("Content-Type"); contentType != protocol.ContentTypeJSON {
+		t.Errorf("Expected json but received %s", contentType)
+	}
+
+	// Wrong type
+	handler.(*KeysV2Handler).Cache.LPush("list", value)
+	url = ts.URL + protocol.KeysPath + "/list"
+
+	rr = get(protocol.ContentTypeJSON)
+
+	if status := rr.StatusCode; status != http.StatusConflict {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusConflict)
+	}
+
+	errorResponse = protocol.ErrorResponse{}
+	json.NewDecoder(rr.Body).Decode(&errorResponse)
+
+	if errorResponse.Error.Code != protocol.CodeWrongType {
+		t.Errorf("Expected the error code %s but received %+v", protocol.CodeWrongType, errorResponse)
+	}
+}
+
+func TestKeysV2Handler_EmptyKey(t *testing.T) {
+
+	cache := gcache.NewCache()
+	cache.Set("key", "value", time.Minute)
+
+	handler := new(KeysV2Handler).Init(cache)
+
+	ts := httptest.NewServer(http.HandlerFunc(handler.ServeHTTP))
+	defer ts.Close()
+
+	// The empty key is not the listing of the keys
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodDelete} {
+		req, _ := http.NewRequest(method, ts.URL+protocol.KeysPath+"/?ttl=5", nil)
+
+		rr, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr.Body.Close()
+
+		if status := rr.StatusCode; status != http.StatusBadRequest {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", method, status, http.StatusBadRequest)
+		}
+	}
+}
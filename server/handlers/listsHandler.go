@@ -82,7 +82,9 @@ func (handler *ListsHandler) rangeQuery(w http.ResponseWriter, req *http.Request
 		return
 	}
 
+	span := cacheSpan(req, "lrange")
 	items, err := handler.Cache.LRange(key, from, to)
+	span.End()
 
 	if err != nil {
 
@@ -122,7 +124,9 @@ func (handler *ListsHandler) lPushCommand(w http.ResponseWriter, req *http.Reque
 		return
 	}
 
+	span := cacheSpan(req, "lpush")
 	err := handler.Cache.LPush(key, value)
+	span.End()
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -144,7 +148,9 @@ func (handler *ListsHandler) rPushCommand(w http.ResponseWriter, req *http.Reque
 		return
 	}
 
+	span := cacheSpan(req, "rpush")
 	err := handler.Cache.RPush(key, value)
+	span.End()
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -160,7 +166,9 @@ func (handler *ListsHandler) lPopCommand(w http.ResponseWriter, req *http.Reques
 		return
 	}
 
+	span := cacheSpan(req, "lpop")
 	value, err := handler.Cache.LPop(key)
+	span.End()
 
 	if err != nil {
 
@@ -184,7 +192,9 @@ func (handler *ListsHandler) rPopCommand(w http.ResponseWriter, req *http.Reques
 		return
 	}
 
+	span := cacheSpan(req, "rpop")
 	value, err := handler.Cache.RPop(key)
+	span.End()
 
 	if err != nil {
 
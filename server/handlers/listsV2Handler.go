@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"gcache"
+	"gcache/protocol"
+	"net/http"
+	"strconv"
+)
+
+// Lists handler of the v2 API. The list key is the path segment after /v2/lists,
+// pushed and popped values are raw request and response bodies
+type ListsV2Handler struct {
+	Cache *gcache.Cache
+}
+
+func (handler *ListsV2Handler) Init(cache *gcache.Cache) Handler {
+	return &ListsV2Handler{
+		Cache: cache,
+	}
+}
+
+func (handler *ListsV2Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	segments, err := protocol.SplitPath(req.URL.EscapedPath(), protocol.ListsPath)
+
+	if err != nil || len(segments) != 1 || segments[0] == "" {
+		writeBadRequest(w, req, "Expected a single list key in the path")
+		return
+	}
+
+	key := segments[0]
+	operation := req.URL.Query().Get(formOperation)
+
+	// Command-Query Router
+	switch req.Method {
+	case http.MethodGet:
+		if operation == "range" {
+			handler.rangeQuery(w, req, key)
+			return
+		}
+
+	case http.MethodPost:
+
+		if operation == "lpush" {
+			handler.pushCommand(w, req, key, handler.Cache.LPush)
+			return
+		} else if operation == "rpush" {
+			handler.pushCommand(w, req, key, handler.Cache.RPush)
+			return
+		} else if operation == "lpop" {
+			handler.popCommand(w, req, key, handler.Cache.LPop)
+			return
+		} else if operation == "rpop" {
+			handler.popCommand(w, req, key, handler.Cache.RPop)
+			return
+		}
+	}
+
+	// Nothing matched, return bad request
+	writeBadRequest(w, req, "Unsupported operation '"+operation+"' for method "+req.Method)
+}
+
+func (handler *ListsV2Handler) rangeQuery(w http.ResponseWriter, req *http.Request, key string) {
+
+	query := req.URL.Query()
+
+	from, err := strconv.Atoi(query.Get(formRangeFrom))
+	if err != nil {
+		writeBadRequest(w, req, "From must be a number")
+		return
+	}
+
+	to, err := strconv.Atoi(query.Get(formRangeTo))
+	if err != nil {
+		writeBadRequest(w, req, "To must be a number")
+		return
+	}
+
+	span := cacheSpan(req, "lrange")
+	items, err := handler.Cache.LRange(key, from, to)
+	span.End()
+
+	if err != nil {
+		writeCacheError(w, req, err)
+		return
+	}
+
+	values, err := toStrings(items)
+
+	if err != nil {
+		writeCacheError(w, req, err)
+		return
+	}
+
+	writeValues(w, req, values)
+}
+
+func (handler *ListsV2Handler) pushCommand(w http.ResponseWriter, req *http.Request, key string,
+	push func(key string, value interface{}) error) {
+
+	value, err := readValue(req)
+	if err != nil {
+		writeBadRequest(w, req, "Failed to read the value")
+		return
+	}
+
+	span := cacheSpan(req, "push")
+	err = push(key, value)
+	span.End()
+
+	if err != nil {
+		writeCacheError(w, req, err)
+		return
+	}
+
+	writeOk(w, req)
+}
+
+func (handler *ListsV2Handler) popCommand(w http.ResponseWriter, req *http.Request, key string,
+	pop func(key string) (interface{}, error)) {
+
+	span := cacheSpan(req, "pop")
+	value, err := pop(key)
+	span.End()
+
+	if err != nil {
+		writeCacheError(w, req, err)
+		return
+	}
+
+	writeValue(w, req, value, nil)
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"bytes"
+	"gcache"
+	"gcache/protocol"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestListsV2Handler_PushRangePop(t *testing.T) {
+
+	const key = "list/key"
+
+	values := []string{"a,b", "\x00\xff", "c\r\nd"}
+
+	handler := new(ListsV2Handler).Init(gcache.NewCache())
+
+	ts := httptest.NewServer(http.HandlerFunc(handler.ServeHTTP))
+	defer ts.Close()
+
+	url := ts.URL + protocol.ListsPath + "/" + protocol.EscapeSegment(key)
+
+	for _, value := range values {
+		rr, err := http.Post(url+"?op=lpush", protocol.ContentTypeBinary, bytes.NewBufferString(value))
+
+		if err != nil {
+			t.Fatalf("http.Post(%q) unexpected error: %v", url, err)
+		}
+
+		// Check the status code is what we expect.
+		if status := rr.StatusCode; status != http.StatusOK {
+			t.Errorf("handler returned wrong status code: got %v want %v",
+				status, http.StatusOK)
+		}
+	}
+
+	rr, err := http.Get(url + "?op=range&from=0&to=10")
+
+	if err != nil {
+		t.Fatalf("http.Get(%q) unexpected error: %v", url, err)
+	}
+
+	actual, err := protocol.ReadValues(rr.Body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(actual) != len(values) {
+		t.Fatalf("Expected %q but received %q", values, actual)
+	}
+
+	for i := range values {
+		if actual[i] != values[i] {
+			t.Errorf("Expected %q but received %q", values, actual)
+		}
+	}
+
+	rr, err = http.Post(url+"?op=lpop", "", nil)
+
+	if err != nil {
+		t.Fatalf("http.Post(%q) unexpected error: %v", url, err)
+	}
+
+	popped, err := ioutil.ReadAll(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(popped) != values[len(values)-1] {
+		t.Errorf("Expected %q but received %q", values[len(values)-1], popped)
+	}
+
+	// Missing list
+	rr, err = http.Post(ts.URL+protocol.ListsPath+"/missing?op=rpop", "", nil)
+
+	if err != nil {
+		t.Fatalf("http.Post(%q) unexpected error: %v", url, err)
+	}
+
+	if status := rr.StatusCode; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"gcache"
+	"gcache/protocol"
+	"net/http"
+)
+
+// Multi keys handler reads, writes and deletes several keys at once.
+// Requests and responses are json, values are base64 encoded
+type MultiKeysHandler struct {
+	Cache *gcache.Cache
+}
+
+func (handler *MultiKeysHandler) Init(cache *gcache.Cache) Handler {
+	return &MultiKeysHandler{
+		Cache: cache,
+	}
+}
+
+func (handler *MultiKeysHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+
+	if req.Method != http.MethodPost {
+		writeBadRequest(w, req, "Unsupported method "+req.Method)
+		return
+	}
+
+	switch req.URL.Path {
+	case protocol.MGetPath:
+		handler.mGetQuery(w, req)
+		return
+
+	case protocol.MSetPath:
+		handler.mSetCommand(w, req)
+		return
+
+	case protocol.MDelPath:
+		handler.mDelCommand(w, req)
+		return
+	}
+
+	// Nothing matched, return bad request
+	writeBadRequest(w, req, "Unsupported path "+req.URL.Path)
+}
+
+func (handler *MultiKeysHandler) mGetQuery(w http.ResponseWriter, req *http.Request) {
+
+	request := protocol.KeysRequest{}
+
+	if _, err := DecodeBody(req, &request); err != nil {
+		writeBadRequest(w, req, "Body must be a json object with keys: "+err.Error())
+		return
+	}
+
+	span := cacheSpan(req, "mget")
+	values := handler.Cache.MGet(request.Keys...)
+	span.End()
+
+	response := protocol.MGetResponse{Values: make([][]byte, len(values))}
+
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+
+		str, ok := value.(string)
+		if !ok {
+			writeCacheError(w, req, gcache.ErrWrongType)
+			return
+		}
+
+		response.Values[i] = []byte(str)
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (handler *MultiKeysHandler) mSetCommand(w http.ResponseWriter, req *http.Request) {
+
+	request := protocol.MSetRequest{}
+
+	if _, err := DecodeBody(req, &request); err != nil {
+		writeBadRequest(w, req, "Body must be a json object with items and ttl: "+err.Error())
+		return
+	}
+
+	if request.Ttl < 0 {
+		writeBadRequest(w, req, "Ttl must be a non negative number of seconds")
+		return
+	}
+
+	items := make(map[string]interface{}, len(request.Items))
+	for key, value := range request.Items {
+		if key == "" {
+			writeBadRequest(w, req, "Key is empty")
+			return
+		}
+		items[key] = string(value)
+	}
+
+	ttl := convertIntToDurationInMinutes(request.Ttl)
+
+	if request.NX {
+		span := cacheSpan(req, "msetnx")
+		ok := handler.Cache.MSetNX(items, ttl)
+		span.End()
+
+		writeJSON(w, http.StatusOK, protocol.OkResponse{Ok: ok})
+		return
+	}
+
+	span := cacheSpan(req, "mset")
+	handler.Cache.MSet(items, ttl)
+	span.End()
+	writeJSON(w, http.StatusOK, protocol.OkResponse{Ok: true})
+}
+
+func (handler *MultiKeysHandler) mDelCommand(w http.ResponseWriter, req *http.Request) {
+
+	request := protocol.KeysRequest{}
+
+	if _, err := DecodeBody(req, &request); err != nil {
+		writeBadRequest(w, req, "Body must be a json object with keys: "+err.Error())
+		return
+	}
+
+	span := cacheSpan(req, "mdel")
+	deleted := handler.Cache.MDel(request.Keys...)
+	span.End()
+
+	writeJSON(w, http.StatusOK, protocol.MDelResponse{Deleted: deleted})
+}
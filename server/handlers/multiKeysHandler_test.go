@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"gcache"
+	"gcache/protocol"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMultiKeysHandler_MSetMGetMDel(t *testing.T) {
+
+	handler := new(MultiKeysHandler).Init(gcache.NewCache())
+
+	ts := httptest.NewServer(http.HandlerFunc(handler.ServeHTTP))
+	defer ts.Close()
+
+	post := func(path string, request interface{}, response interface{}) {
+		body, _ := json.Marshal(request)
+
+		rr, err := http.Post(ts.URL+path, protocol.ContentTypeJSON, bytes.NewBuffer(body))
+
+		if err != nil {
+			t.Fatalf("http.Post(%q) unexpected error: %v", path, err)
+		}
+
+		// Check the status code is what we expect.
+		if status := rr.StatusCode; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v",
+				status, http.StatusOK)
+		}
+
+		if err := json.NewDecoder(rr.Body).Decode(response); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ok := protocol.OkResponse{}
+	post(protocol.MSetPath, protocol.MSetRequest{
+		Items: map[string][]byte{"key1": []byte("value1"), "key2": []byte("")},
+		Ttl:   5,
+	}, &ok)
+
+	if !ok.Ok {
+		t.Error("Failed to mset")
+	}
+
+	// Nothing is set if a key exists
+	ok = protocol.OkResponse{}
+	post(protocol.MSetPath, protocol.MSetRequest{
+		Items: map[string][]byte{"key2": []byte("updated"), "key3": []byte("value3")},
+		Ttl:   5,
+		NX:    true,
+	}, &ok)
+
+	if ok.Ok {
+		t.Error("Keys are set though key2 exists")
+	}
+
+	values := protocol.MGetResponse{}
+	post(protocol.MGetPath, protocol.KeysRequest{Keys: []string{"key1", "key3", "key2"}}, &values)
+
+	if len(values.Values) != 3 || string(values.Values[0]) != "value1" || values.Values[1] != nil ||
+		values.Values[2] == nil || len(values.Values[2]) != 0 {
+		t.Errorf("Expected [value1 <nil> \"\"] but received %q", values.Values)
+	}
+
+	deleted := protocol.MDelResponse{}
+	post(protocol.MDelPath, protocol.KeysRequest{Keys: []string{"key1", "key2", "key3"}}, &deleted)
+
+	if deleted.Deleted != 2 {
+		t.Errorf("Expected 2 deleted keys but received %d", deleted.Deleted)
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Router dispatches requests by route like http.ServeMux: a route ending with '/' matches
+// the paths it prefixes, the longest one wins, any other route matches the path exactly.
+// Unlike http.ServeMux it matches the escaped path and does not clean it,
+// so keys such as '.' and '..' or keys with escaped slashes reach the handlers
+type Router struct {
+	exact    map[string]http.Handler
+	prefixes map[string]http.Handler
+}
+
+func NewRouter() *Router {
+	return &Router{
+		exact:    make(map[string]http.Handler),
+		prefixes: make(map[string]http.Handler),
+	}
+}
+
+// Register the handler for the route
+func (router *Router) Handle(route string, handler http.Handler) {
+	if strings.HasSuffix(route, "/") {
+		router.prefixes[route] = handler
+	} else {
+		router.exact[route] = handler
+	}
+}
+
+func (router *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if handler := router.match(req.URL.EscapedPath()); handler != nil {
+		handler.ServeHTTP(w, req)
+		return
+	}
+
+	http.NotFound(w, req)
+}
+
+func (router *Router) match(path string) http.Handler {
+	if handler, ok := router.exact[path]; ok {
+		return handler
+	}
+
+	var handler http.Handler
+	longest := 0
+
+	for prefix, h := range router.prefixes {
+		if len(prefix) > longest && strings.HasPrefix(path, prefix) {
+			handler, longest = h, len(prefix)
+		}
+	}
+
+	return handler
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouter_Match(t *testing.T) {
+
+	route := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Write([]byte(name))
+		})
+	}
+
+	router := NewRouter()
+	router.Handle("/keys", route("keys"))
+	router.Handle("/v2/keys", route("v2 keys"))
+	router.Handle("/v2/keys/", route("v2 key"))
+	router.Handle("/v2/", route("v2"))
+
+	tests := []struct {
+		path     string
+		status   int
+		expected string
+	}{
+		{"/keys", http.StatusOK, "keys"},
+		{"/keys/key", http.StatusNotFound, ""},
+		{"/v2/keys", http.StatusOK, "v2 keys"},
+		{"/v2/keys/%2E%2E", http.StatusOK, "v2 key"},
+		{"/v2/keys/a%2Fb", http.StatusOK, "v2 key"},
+		{"/v2/lists/list", http.StatusOK, "v2"},
+		{"/other", http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest(http.MethodGet, test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		// Check the status code is what we expect.
+		if status := rr.Code; status != test.status {
+			t.Errorf("%s: router returned wrong status code: got %v want %v",
+				test.path, status, test.status)
+			continue
+		}
+
+		if test.status == http.StatusOK && rr.Body.String() != test.expected {
+			t.Errorf("%s: routed to %q want %q", test.path, rr.Body.String(), test.expected)
+		}
+	}
+}
@@ -0,0 +1,452 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gcache/protocol"
+	"gcache/server/acl"
+	"gcache/server/handlers"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Buckets are swept of the idle ones once there are more of them
+const limiterSweepSize = 4096
+
+// Token bucket rate of requests
+type RateLimit struct {
+	// Requests per second, zero means no limit
+	Rate float64
+	// Requests which may be sent at once, the rate rounded up if it is less than one
+	Burst int
+}
+
+// Parse the rate limit of the form rate[:burst], e.g. 100:200
+func ParseRateLimit(value string) (RateLimit, error) {
+	limit := RateLimit{}
+
+	rate := strings.TrimSpace(value)
+	if i := strings.IndexByte(rate, ':'); i >= 0 {
+		burst, err := strconv.Atoi(rate[i+1:])
+		if err != nil || burst < 0 {
+			return limit, fmt.Errorf("Invalid burst of rate limit '%s'", value)
+		}
+		limit.Burst = burst
+		rate = rate[:i]
+	}
+
+	r, err := strconv.ParseFloat(rate, 64)
+	if err != nil || r < 0 || math.IsInf(r, 0) {
+		return limit, fmt.Errorf("Invalid rate limit '%s'", value)
+	}
+	limit.Rate = r
+
+	return limit, nil
+}
+
+func (l RateLimit) String() string {
+	return formatFloat(l.Rate) + ":" + strconv.Itoa(l.burst())
+}
+
+func (l RateLimit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return int(math.Ceil(l.Rate))
+}
+
+// Limits of the requests of every client. A client is the authenticated user, or the ip of anonymous
+// requests and of requests of the default user. Failed authentications of an ip are limited apart,
+// an ip over the rate limits of them is rejected before it's authenticated. Zero values mean no limits
+type Limits struct {
+	// Rate of the requests of a client to any route
+	Rate RateLimit
+	// Rate of the requests of a client to the route, in addition to Rate, e.g. "/v2/lists/": {Rate: 100}
+	RouteRates map[string]RateLimit
+	// Size of a request body in bytes
+	MaxBodySize int64
+	// Length of a key in bytes
+	MaxKeySize int
+	// Size of a value in bytes
+	MaxValueSize int64
+}
+
+// Parse the route rate limits of the form route=rate[:burst],..., e.g. /v2/lists/=100,/batch=10:20
+func ParseRouteRates(value string) (map[string]RateLimit, error) {
+	rates := make(map[string]RateLimit)
+
+	for _, routeRate := range strings.Split(value, ",") {
+		if routeRate = strings.TrimSpace(routeRate); routeRate == "" {
+			continue
+		}
+
+		i := strings.LastIndexByte(routeRate, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("Invalid route rate limit '%s'", routeRate)
+		}
+
+		limit, err := ParseRateLimit(routeRate[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		rates[routeRate[:i]] = limit
+	}
+
+	return rates, nil
+}
+
+// Format the route rate limits as ParseRouteRates parses them, sorted by the route
+func formatRouteRates(rates map[string]RateLimit) string {
+	routes := make([]string, 0, len(rates))
+	for route := range rates {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+
+	formatted := make([]string, len(routes))
+	for i, route := range routes {
+		formatted[i] = route + "=" + rates[route].String()
+	}
+	return strings.Join(formatted, ",")
+}
+
+type bucketKey struct {
+	client string
+	// Empty for the bucket of all the routes
+	route string
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Refill the bucket by the time passed since it was last taken from
+func (b *bucket) refill(limit RateLimit, now time.Time) {
+	b.tokens = math.Min(float64(limit.burst()), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+}
+
+// Token buckets of the clients
+type limiter struct {
+	mutex   sync.Mutex
+	limits  Limits
+	buckets map[bucketKey]*bucket
+}
+
+func newLimiter() *limiter {
+	return &limiter{buckets: make(map[bucketKey]*bucket)}
+}
+
+func (l *limiter) configuration() Limits {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.limits
+}
+
+func (l *limiter) update(change func(limits *Limits)) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	change(&l.limits)
+}
+
+// Take a token of the client from the bucket of all the routes and from the one of the route.
+// Nothing is taken unless both have a token, the time to wait for the tokens is returned then
+func (l *limiter) take(client string, route string, now time.Time) (bool, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	buckets, wait := l.wait(client, route, now)
+	if wait > 0 {
+		return false, wait
+	}
+
+	for _, b := range buckets {
+		b.tokens--
+	}
+
+	return true, 0
+}
+
+// Whether the client has the tokens of the route, without taking them. The time to wait for them is returned otherwise
+func (l *limiter) available(client string, route string, now time.Time) (bool, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// The buckets which are not there yet are full
+	_, all := l.buckets[bucketKey{client: client}]
+	_, routed := l.buckets[bucketKey{client, route}]
+	if !all && !routed {
+		return true, 0
+	}
+
+	_, wait := l.wait(client, route, now)
+	return wait == 0, wait
+}
+
+// Refill the buckets of the client and the route, and get the time to wait for a token of each of them
+func (l *limiter) wait(client string, route string, now time.Time) ([]*bucket, time.Duration) {
+
+	type limited struct {
+		bucket *bucket
+		limit  RateLimit
+	}
+
+	buckets := make([]limited, 0, 2)
+	if l.limits.Rate.Rate > 0 {
+		buckets = append(buckets, limited{l.bucket(bucketKey{client: client}, l.limits.Rate, now), l.limits.Rate})
+	}
+	if limit := l.limits.RouteRates[route]; limit.Rate > 0 {
+		buckets = append(buckets, limited{l.bucket(bucketKey{client, route}, limit, now), limit})
+	}
+
+	wait := time.Duration(0)
+	refilled := make([]*bucket, len(buckets))
+	for i, b := range buckets {
+		b.bucket.refill(b.limit, now)
+		if b.bucket.tokens < 1 {
+			if w := time.Duration((1 - b.bucket.tokens) / b.limit.Rate * float64(time.Second)); w > wait {
+				wait = w
+			}
+		}
+		refilled[i] = b.bucket
+	}
+
+	return refilled, wait
+}
+
+// Get the bucket of the key, a new bucket is full
+func (l *limiter) bucket(key bucketKey, limit RateLimit, now time.Time) *bucket {
+	b, ok := l.buckets[key]
+	if ok {
+		return b
+	}
+
+	if len(l.buckets) >= limiterSweepSize {
+		l.sweep(now)
+	}
+
+	b = &bucket{tokens: float64(limit.burst()), last: now}
+	l.buckets[key] = b
+	return b
+}
+
+// Drop the buckets which would be full by now, they are the same as new ones
+func (l *limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		limit := l.limits.Rate
+		if key.route != "" {
+			limit = l.limits.RouteRates[key.route]
+		}
+
+		if limit.Rate <= 0 || b.tokens+now.Sub(b.last).Seconds()*limit.Rate >= float64(limit.burst()) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Set the limits of the requests, they may be changed while serving
+func (s *Server) SetLimits(limits Limits) {
+	s.limiter.update(func(l *Limits) { *l = limits })
+}
+
+// Get the limits of the requests
+func (s *Server) Limits() Limits {
+	return s.limiter.configuration()
+}
+
+// Limit the size of bodies before anything reads them. Reading a body over the limit fails
+func (s *Server) limitBody(w http.ResponseWriter, r *http.Request) {
+	if maxBodySize := s.limiter.configuration().MaxBodySize; maxBodySize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	}
+}
+
+// Limiting handler. Rejects the requests over the rate limits of the client with 429 and Retry-After,
+// and the requests with bodies, keys or values over the size limits with 413
+func (s *Server) limitHandler(route string, h http.Handler, classify classifier) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		limits := s.limiter.configuration()
+
+		if limits.rated(route) {
+			if ok, wait := s.limiter.take(clientIdentity(r), route, time.Now()); !ok {
+				tooManyRequests(w, r, wait)
+				return
+			}
+		}
+
+		if limits.MaxBodySize > 0 || limits.MaxValueSize > 0 {
+			size, err := bodySize(r)
+			if err != nil {
+				var maxBytesError *http.MaxBytesError
+				if errors.As(err, &maxBytesError) {
+					tooLarge(w, r, "Body is over "+strconv.FormatInt(limits.MaxBodySize, 10)+" bytes")
+					return
+				}
+				handlers.WriteError(w, r, http.StatusBadRequest, protocol.CodeBadRequest, "Failed to read the body")
+				return
+			}
+
+			if limits.MaxBodySize > 0 && size > limits.MaxBodySize {
+				tooLarge(w, r, "Body is over "+strconv.FormatInt(limits.MaxBodySize, 10)+" bytes")
+				return
+			}
+
+			if limits.MaxValueSize > 0 {
+				valueSize, err := valueSize(r, route, size)
+				if err != nil {
+					rejectBody(w, r, err)
+					return
+				}
+
+				if valueSize > limits.MaxValueSize {
+					tooLarge(w, r, "Value is over "+strconv.FormatInt(limits.MaxValueSize, 10)+" bytes")
+					return
+				}
+			}
+		}
+
+		if limits.MaxKeySize > 0 {
+			// Keys of a body which failed to decode are unknown
+			if err := handlers.BodyError(r); err != nil {
+				rejectBody(w, r, err)
+				return
+			}
+
+			command, ok := commandFrom(r.Context())
+			if !ok {
+				command = classify(r)
+			}
+
+			for _, key := range command.Keys {
+				if len(key) > limits.MaxKeySize {
+					tooLarge(w, r, "Key is over "+strconv.Itoa(limits.MaxKeySize)+" bytes")
+					return
+				}
+			}
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Whether the requests of the route are rate limited
+func (l Limits) rated(route string) bool {
+	return l.Rate.Rate > 0 || l.RouteRates[route].Rate > 0
+}
+
+func tooManyRequests(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	handlers.WriteError(w, r, http.StatusTooManyRequests, protocol.CodeRateLimited, "Rate limit exceeded")
+}
+
+func tooLarge(w http.ResponseWriter, r *http.Request, message string) {
+	handlers.WriteError(w, r, http.StatusRequestEntityTooLarge, protocol.CodeTooLarge, message)
+}
+
+// Reject the request whose json body failed to decode, with 413 if it's over the size limit
+func rejectBody(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		tooLarge(w, r, "Body is over "+strconv.FormatInt(maxBytesError.Limit, 10)+" bytes")
+		return
+	}
+	handlers.WriteError(w, r, http.StatusBadRequest, protocol.CodeBadRequest, "Invalid json body: "+err.Error())
+}
+
+// Identity of the client the rate limits apply to: the name of the user, or the ip of the default one
+func clientIdentity(r *http.Request) string {
+	if user, ok := acl.UserFrom(r.Context()); ok && user.Name != acl.DefaultUser {
+		return "user:" + user.Name
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// Client of the failed authentications of the ip of the request, which are limited apart from its requests
+func authFailuresClient(r *http.Request) string {
+	return "auth-failures:" + clientIdentity(r)
+}
+
+// Get the size of the body. A body of unknown length is read and put back for the handler
+func bodySize(r *http.Request) (int64, error) {
+	if r.ContentLength >= 0 {
+		return r.ContentLength, nil
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return int64(len(body)), nil
+}
+
+// Get the size of the largest value written by the request. Json bodies which fail to decode are an error
+func valueSize(r *http.Request, route string, bodySize int64) (int64, error) {
+	switch route {
+	// Raw values of the binary safe API
+	case protocol.KeysPath + "/", protocol.ListsPath + "/", protocol.HashesPath + "/", protocol.RestorePath + "/":
+		if r.Method == http.MethodGet {
+			return 0, nil
+		}
+		return bodySize, nil
+
+	// Form values
+	case "/keys", "/lists", "/hashes":
+		r.ParseForm()
+		size := int64(0)
+		for _, value := range r.Form["value"] {
+			size = maxInt64(size, int64(len(value)))
+		}
+		return size, nil
+
+	case protocol.BatchPath:
+		commands := []protocol.Command{}
+		if _, err := handlers.DecodeBody(r, &commands); err != nil {
+			return 0, err
+		}
+
+		size := int64(0)
+		for _, command := range commands {
+			size = maxInt64(size, int64(len(command.Value)))
+		}
+		return size, nil
+
+	case protocol.MSetPath:
+		request := protocol.MSetRequest{}
+		if _, err := handlers.DecodeBody(r, &request); err != nil {
+			return 0, err
+		}
+
+		size := int64(0)
+		for _, value := range request.Items {
+			size = maxInt64(size, int64(len(value)))
+		}
+		return size, nil
+	}
+
+	return 0, nil
+}
+
+func maxInt64(a int64, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
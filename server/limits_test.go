@@ -0,0 +1,226 @@
+package server
+
+import (
+	"gcache/protocol"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_RateLimit(t *testing.T) {
+
+	s := NewServerWithAuth("admin")
+	s.ACL().SetUser("reader", "on", ">reader", "allkeys", "+@all")
+	s.SetLimits(Limits{
+		Rate:       RateLimit{Rate: 0.001, Burst: 2},
+		RouteRates: map[string]RateLimit{protocol.ListsPath + "/": {Rate: 0.001}},
+	})
+
+	for i := 0; i < 2; i++ {
+		if rr := serveAs(s, "admin", http.MethodGet, protocol.KeysPath+"/missing", ""); rr.Code != http.StatusNotFound {
+			t.Fatalf("Expected the request within the burst to be served but actual %d", rr.Code)
+		}
+	}
+
+	rr := serveAs(s, "admin", http.MethodGet, protocol.KeysPath+"/missing", "")
+	if rr.Code != http.StatusTooManyRequests || !strings.Contains(rr.Body.String(), protocol.CodeRateLimited) {
+		t.Errorf("Expected the request over the limit to be rejected but actual %d %s", rr.Code, rr.Body.String())
+	}
+
+	if retryAfter := rr.Header().Get("Retry-After"); retryAfter == "" || retryAfter == "0" {
+		t.Errorf("Expected Retry-After but actual %q", retryAfter)
+	}
+
+	// Another ip of the default user is another client
+	req := httptest.NewRequest(http.MethodGet, protocol.KeysPath+"/missing", nil)
+	req.Header.Set(headerAuthorization, "admin")
+	req.RemoteAddr = "192.0.2.2:1234"
+	rr = httptest.NewRecorder()
+	s.Handler().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected another client to be served but actual %d", rr.Code)
+	}
+
+	// A named user is a client of its own, limited per route as well
+	reader := basicAuth("reader", "reader")
+	if rr := serveAs(s, reader, http.MethodGet, protocol.ListsPath+"/list?op=range&from=0&to=1", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected the user to be served but actual %d", rr.Code)
+	}
+	if rr := serveAs(s, reader, http.MethodGet, protocol.ListsPath+"/list?op=range&from=0&to=1", ""); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the route limit to reject the request but actual %d", rr.Code)
+	}
+	if rr := serveAs(s, reader, http.MethodGet, protocol.KeysPath+"/missing", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected the rejected request not to take a token but actual %d", rr.Code)
+	}
+}
+
+func TestServer_RateLimitAuth(t *testing.T) {
+
+	s := NewServerWithAuth("admin")
+	s.ACL().SetUser("reader", "on", ">reader", "allkeys", "+@all")
+	s.SetLimits(Limits{Rate: RateLimit{Rate: 0.001, Burst: 2}})
+
+	// Requests of the ip do not take the tokens of its failed attempts
+	if rr := serveAs(s, "admin", http.MethodGet, protocol.KeysPath+"/missing", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("Expected the request to be served but actual %d", rr.Code)
+	}
+
+	// Failed attempts of the ip are limited apart
+	for i := 0; i < 2; i++ {
+		if rr := serveAs(s, "wrong", http.MethodGet, protocol.KeysPath+"/missing", ""); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected the attempt within the burst to be unauthorized but actual %d", rr.Code)
+		}
+	}
+
+	// Then the ip is rejected before it's authenticated, the right password too
+	for _, authorization := range []string{"wrong", "admin", basicAuth("reader", "reader")} {
+		rr := serveAs(s, authorization, http.MethodGet, protocol.KeysPath+"/missing", "")
+		if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+			t.Errorf("Expected the ip over the limit to be rejected but actual %d", rr.Code)
+		}
+	}
+
+	// Another ip is not limited
+	req := httptest.NewRequest(http.MethodGet, protocol.KeysPath+"/missing", nil)
+	req.Header.Set(headerAuthorization, "admin")
+	req.RemoteAddr = "192.0.2.2:1234"
+	rr := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected another ip to be served but actual %d", rr.Code)
+	}
+
+	// Without rate limits failed attempts are not limited
+	s.SetLimits(Limits{})
+	for i := 0; i < 5; i++ {
+		if rr := serveAs(s, "wrong", http.MethodGet, protocol.KeysPath+"/missing", ""); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected the attempt to be unauthorized but actual %d", rr.Code)
+		}
+	}
+}
+
+func TestLimiter_Refill(t *testing.T) {
+
+	l := newLimiter()
+	l.limits.Rate = RateLimit{Rate: 10, Burst: 1}
+	now := time.Now()
+
+	if ok, _ := l.take("client", "/route", now); !ok {
+		t.Fatal("Expected the first request to be allowed")
+	}
+
+	ok, wait := l.take("client", "/route", now)
+	if ok || wait <= 0 || wait > 100*time.Millisecond {
+		t.Errorf("Expected to wait up to 100ms but actual %v %v", ok, wait)
+	}
+
+	if ok, _ := l.take("client", "/route", now.Add(100*time.Millisecond)); !ok {
+		t.Error("Expected the bucket to be refilled")
+	}
+
+	// Full buckets are swept
+	l.sweep(now.Add(time.Second))
+	if len(l.buckets) != 0 {
+		t.Errorf("Expected the idle bucket to be swept but actual %d", len(l.buckets))
+	}
+}
+
+func TestServer_SizeLimits(t *testing.T) {
+
+	s := NewServer()
+	s.SetLimits(Limits{MaxBodySize: 64, MaxKeySize: 8, MaxValueSize: 4})
+
+	cases := []struct {
+		method string
+		target string
+		body   string
+		status int
+	}{
+		{http.MethodPost, protocol.KeysPath + "/key?ttl=1", "1234", http.StatusOK},
+		{http.MethodPost, protocol.KeysPath + "/key?ttl=1", "12345", http.StatusRequestEntityTooLarge},
+		{http.MethodPost, protocol.KeysPath + "/long-key-name?ttl=1", "1", http.StatusRequestEntityTooLarge},
+		{http.MethodPost, protocol.BatchPath, `[{"op":"set","key":"k","value":"MTIzNDU=","ttl":1}]`, http.StatusRequestEntityTooLarge},
+		{http.MethodPost, "/keys?key=key&value=12345&ttl=1", "", http.StatusRequestEntityTooLarge},
+		{http.MethodPost, protocol.BatchPath, `[{"op":"set","key":"k","value":"MTIzNA==","ttl":1}]`, http.StatusOK},
+		{http.MethodPost, protocol.ListsPath + "/list?op=lpush", strings.Repeat("1", 65), http.StatusRequestEntityTooLarge},
+		// Values of bodies which fail to decode are not measured as empty
+		{http.MethodPost, protocol.BatchPath, `[{"op":"set","key":"k","value":"MTIzNDU=","ttl":1}]x`, http.StatusBadRequest},
+		{http.MethodPost, protocol.MSetPath, `{"items":{"k":"MTIzNDU="},"ttl":1} {}`, http.StatusBadRequest},
+		{http.MethodPost, protocol.MGetPath, `{"keys":["long-key-name"]`, http.StatusBadRequest},
+	}
+
+	for _, c := range cases {
+		if rr := serveAs(s, "", c.method, c.target, c.body); rr.Code != c.status {
+			t.Errorf("%s %s: expected %d but actual %d %s", c.method, c.target, c.status, rr.Code, rr.Body.String())
+		}
+	}
+
+	// Bodies of unknown length
+	req := httptest.NewRequest(http.MethodPost, protocol.KeysPath+"/key?ttl=1", strings.NewReader(strings.Repeat("1", 65)))
+	req.ContentLength = -1
+	rr := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected the chunked body to be rejected but actual %d", rr.Code)
+	}
+
+	batch := `[{"op":"get","key":"k"},` + strings.Repeat(" ", 64) + `{"op":"get","key":"k"}]`
+	req = httptest.NewRequest(http.MethodPost, protocol.BatchPath, strings.NewReader(batch))
+	req.ContentLength = -1
+	rr = httptest.NewRecorder()
+	s.Handler().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected the chunked batch to be rejected but actual %d", rr.Code)
+	}
+}
+
+func TestServer_MaxListLength(t *testing.T) {
+
+	s := NewServer()
+
+	if rr := serveAs(s, "", http.MethodPost, protocol.ConfigPath+"?name=max-list-length&value=1", ""); rr.Code != http.StatusOK {
+		t.Fatalf("Failed to set the length %d", rr.Code)
+	}
+
+	serveAs(s, "", http.MethodPost, protocol.ListsPath+"/list?op=lpush", "a")
+
+	rr := serveAs(s, "", http.MethodPost, protocol.ListsPath+"/list?op=lpush", "b")
+	if rr.Code != http.StatusRequestEntityTooLarge || !strings.Contains(rr.Body.String(), protocol.CodeTooLarge) {
+		t.Errorf("Expected the full list to be rejected but actual %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestServer_LimitsConfig(t *testing.T) {
+
+	s := NewServer()
+
+	for _, c := range []struct {
+		name  string
+		value string
+	}{{"rate-limit", "100:200"}, {"route-rate-limits", "/batch=10,/v2/lists/=0.5:2"}, {"max-body-size", "1mb"}, {"max-value-size", "512kb"}, {"max-key-size", "1kb"}} {
+		if rr := serveAs(s, "", http.MethodPost, protocol.ConfigPath+"?name="+c.name+"&value="+c.value, ""); rr.Code != http.StatusOK {
+			t.Errorf("Failed to set %s: %d %s", c.name, rr.Code, rr.Body.String())
+		}
+	}
+
+	limits := s.Limits()
+	if limits.Rate != (RateLimit{100, 200}) || limits.RouteRates["/v2/lists/"] != (RateLimit{0.5, 2}) ||
+		limits.MaxBodySize != 1<<20 || limits.MaxValueSize != 512<<10 || limits.MaxKeySize != 1<<10 {
+		t.Errorf("Unexpected limits %+v", limits)
+	}
+
+	rr := serveAs(s, "", http.MethodGet, protocol.ConfigPath+"?name=*rate-limit*", "")
+	if rr.Body.String() != "rate-limit 100:200\nroute-rate-limits /batch=10:10,/v2/lists/=0.5:2\n" {
+		t.Errorf("Unexpected config %q", rr.Body.String())
+	}
+
+	if rr := serveAs(s, "", http.MethodPost, protocol.ConfigPath+"?name=rate-limit&value=fast", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected the invalid rate to be rejected but actual %d", rr.Code)
+	}
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"gcache"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Route of the metrics in the Prometheus text exposition format
+const MetricsPath = "/metrics"
+
+// Upper bounds of the request latency buckets in seconds
+var latencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type requestLabels struct {
+	handler string
+	code    int
+}
+
+// Latency histogram of requests
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(seconds float64) {
+	i := sort.SearchFloat64s(latencyBuckets, seconds)
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// Metrics of the requests served by the server
+type metrics struct {
+	mutex    sync.Mutex
+	requests map[requestLabels]*histogram
+}
+
+func newMetrics() *metrics {
+	return &metrics{requests: make(map[requestLabels]*histogram)}
+}
+
+func (m *metrics) observe(handler string, code int, latency time.Duration) {
+	labels := requestLabels{handler: handler, code: code}
+
+	m.mutex.Lock()
+	h, ok := m.requests[labels]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		m.requests[labels] = h
+	}
+	h.observe(latency.Seconds())
+	m.mutex.Unlock()
+}
+
+// Response writer remembering the status and the size of the body. Flushing is passed through for streams
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(data)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		if r.status == 0 {
+			r.status = http.StatusOK
+		}
+		flusher.Flush()
+	}
+}
+
+// Serve the metrics of the caches of all the databases and of the requests
+func (s *Server) serveMetrics(w http.ResponseWriter, req *http.Request) {
+
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	writer := bufio.NewWriter(w)
+	s.writeMetrics(writer)
+	writer.Flush()
+}
+
+func (s *Server) writeMetrics(w *bufio.Writer) {
+
+	dbs := s.databaseList()
+	stats := make([]databaseStats, len(dbs))
+	for i, db := range dbs {
+		stats[i] = databaseStats{name: db.name, Stats: db.cache.Stats()}
+	}
+
+	counter := func(name string, help string, value func(databaseStats) uint64) {
+		writeHeader(w, name, "counter", help)
+		for _, db := range stats {
+			fmt.Fprintf(w, "%s{db=\"%s\"} %d\n", name, escapeLabel(db.name), value(db))
+		}
+	}
+
+	counter("gcache_keyspace_hits_total", "Reads of existing keys.",
+		func(db databaseStats) uint64 { return db.Hits })
+	counter("gcache_keyspace_misses_total", "Reads of missing keys.",
+		func(db databaseStats) uint64 { return db.Misses })
+	counter("gcache_sets_total", "Keys set or updated.",
+		func(db databaseStats) uint64 { return db.Sets })
+	counter("gcache_deletes_total", "Keys deleted.",
+		func(db databaseStats) uint64 { return db.Deletes })
+	counter("gcache_expired_keys_total", "Keys removed because their ttl has passed.",
+		func(db databaseStats) uint64 { return db.Expirations })
+	counter("gcache_evicted_keys_total", "Keys removed to make room for new keys.",
+		func(db databaseStats) uint64 { return db.Evictions })
+
+	writeHeader(w, "gcache_items", "gauge", "Keys by type of the value.")
+	for _, db := range stats {
+		for _, t := range []struct {
+			name  string
+			count int
+		}{{"string", db.Strings}, {"list", db.Lists}, {"hash", db.Hashes}, {"other", db.Others}} {
+			fmt.Fprintf(w, "gcache_items{db=\"%s\",type=\"%s\"} %d\n", escapeLabel(db.name), t.name, t.count)
+		}
+	}
+
+	writeHeader(w, "gcache_memory_bytes", "gauge", "Approximate memory held by keys and values.")
+	for _, db := range stats {
+		fmt.Fprintf(w, "gcache_memory_bytes{db=\"%s\"} %d\n", escapeLabel(db.name), db.Bytes)
+	}
+
+	s.writeRequestMetrics(w)
+}
+
+type databaseStats struct {
+	name string
+	gcache.Stats
+}
+
+func (s *Server) writeRequestMetrics(w *bufio.Writer) {
+
+	s.metrics.mutex.Lock()
+	defer s.metrics.mutex.Unlock()
+
+	labels := make([]requestLabels, 0, len(s.metrics.requests))
+	for l := range s.metrics.requests {
+		labels = append(labels, l)
+	}
+
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i].handler != labels[j].handler {
+			return labels[i].handler < labels[j].handler
+		}
+		return labels[i].code < labels[j].code
+	})
+
+	const name = "gcache_http_request_duration_seconds"
+	writeHeader(w, name, "histogram", "Latency of requests by handler and status code.")
+
+	for _, l := range labels {
+		h := s.metrics.requests[l]
+		base := fmt.Sprintf("handler=\"%s\",code=\"%d\"", escapeLabel(l.handler), l.code)
+
+		cumulative := uint64(0)
+		for i, bound := range latencyBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, base, formatFloat(bound), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, base, h.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", name, base, formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, base, h.count)
+	}
+}
+
+func writeHeader(w *bufio.Writer, name string, metricType string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// Escape a label value as the exposition format requires
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
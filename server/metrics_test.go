@@ -0,0 +1,81 @@
+package server
+
+import (
+	"gcache/protocol"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_Metrics(t *testing.T) {
+
+	s := NewServer()
+	s.AddDatabase("sessions", 0)
+
+	s.Cache().Set("key", "value", time.Minute)
+	s.Cache().LPush("list", "a")
+
+	serveAs(s, "", http.MethodGet, protocol.KeysPath+"/key", "")
+	serveAs(s, "", http.MethodGet, protocol.KeysPath+"/missing", "")
+
+	rr := serveAs(s, "", http.MethodGet, MetricsPath, "")
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	body := rr.Body.String()
+
+	for _, expected := range []string{
+		"# TYPE gcache_keyspace_hits_total counter\n",
+		`gcache_keyspace_hits_total{db="0"} 1` + "\n",
+		`gcache_keyspace_misses_total{db="0"} 1` + "\n",
+		`gcache_keyspace_hits_total{db="sessions"} 0` + "\n",
+		`gcache_sets_total{db="0"} 1` + "\n",
+		`gcache_items{db="0",type="string"} 1` + "\n",
+		`gcache_items{db="0",type="list"} 1` + "\n",
+		"# TYPE gcache_http_request_duration_seconds histogram\n",
+		`gcache_http_request_duration_seconds_bucket{handler="/v2/keys/",code="200",le="+Inf"} 1` + "\n",
+		`gcache_http_request_duration_seconds_count{handler="/v2/keys/",code="404"} 1` + "\n",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected the metrics to contain %q", expected)
+		}
+	}
+
+	if t.Failed() {
+		t.Log(body)
+	}
+}
+
+func TestServer_MetricsNeedAdmin(t *testing.T) {
+
+	s := NewServer()
+	s.ACL().SetUser("reader", "on", ">reader", "allkeys", "+@read")
+	s.ACL().SetUser("monitor", "on", ">monitor", "+@admin")
+
+	if rr := serveAs(s, basicAuth("reader", "reader"), http.MethodGet, MetricsPath, ""); rr.Code != http.StatusForbidden {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+
+	if rr := serveAs(s, basicAuth("monitor", "monitor"), http.MethodGet, MetricsPath, ""); rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+}
+
+func TestHistogram_Buckets(t *testing.T) {
+
+	h := histogram{counts: make([]uint64, len(latencyBuckets))}
+
+	h.observe(0.0005)
+	h.observe(0.003)
+	h.observe(100)
+
+	if h.counts[0] != 1 || h.counts[3] != 1 || h.count != 3 {
+		t.Errorf("Unexpected buckets %v, count %d", h.counts, h.count)
+	}
+
+	if escapeLabel("a\"b\\c\n") != `a\"b\\c\n` {
+		t.Errorf("Unexpected escaping %q", escapeLabel("a\"b\\c\n"))
+	}
+}
@@ -1,37 +1,287 @@
 package server
 
 import (
-	"fmt"
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
 	"gcache"
+	"gcache/protocol"
+	"gcache/server/acl"
+	"gcache/server/cluster"
 	"gcache/server/handlers"
-	"log"
+	"gcache/trace"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
 )
 
 const headerAuthorization = "Authorization"
 
 type Server struct {
-	cache             *gcache.Cache
-	urlLoggingEnabled bool
-	pws               string
+	cache        *gcache.Cache
+	pws          string
+	acl          *acl.ACL
+	membership   *cluster.Membership
+	seeds        []string
+	router       *handlers.Router
+	routesOnce   sync.Once
+	snapshotPath string
+	tlsConfig    *tls.Config
+	// Of the requests of the membership to the other nodes
+	peerTLSConfig *tls.Config
+
+	metrics   *metrics
+	accessLog accessLog
+	slowlog   *slowlog
+	limiter   *limiter
+	tracer    trace.Tracer
+	startedAt time.Time
+	// Open connections when serving by Serve
+	connections int64
+
+	saveMutex   sync.Mutex
+	lastSave    time.Time
+	lastSaveErr error
+
+	databasesMutex sync.RWMutex
+	databases      map[string]*database
+
+	mutex      sync.Mutex
+	httpServer *http.Server
+	shutdown   bool
+}
+
+// Listen on the address and serve until Shutdown is called
+func (s *Server) Run(addr string) error {
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(listener)
+}
+
+// Serve connections accepted by the listener until Shutdown is called.
+// The snapshot is loaded and the cluster membership is started first.
+// Return nil once the server is shut down
+func (s *Server) Serve(listener net.Listener) error {
+
+	handler := s.Handler()
+
+	if err := s.loadSnapshot(); err != nil {
+		listener.Close()
+		return err
+	}
+
+	httpServer := &http.Server{Handler: handler, ConnState: s.countConnections}
+
+	// Streams never become idle, so they are closed once the listeners are
+	httpServer.RegisterOnShutdown(s.closeStreams)
+
+	s.mutex.Lock()
+	if s.shutdown {
+		s.mutex.Unlock()
+		listener.Close()
+		return nil
+	}
+	s.httpServer = httpServer
+	s.mutex.Unlock()
+
+	if s.membership != nil {
+		s.membership.Start(s.seeds)
+	}
+
+	var err error
+
+	if s.tlsConfig != nil {
+		httpServer.TLSConfig = s.tlsConfig.Clone()
+		err = httpServer.ServeTLS(listener, "", "")
+	} else {
+		err = httpServer.Serve(listener)
+	}
+
+	if err == http.ErrServerClosed {
+		return nil
+	}
+
+	return err
+}
+
+// Stop accepting connections and wait for the requests in flight to complete or the context to be done.
+// Then stop the cluster membership and the eviction of the databases, and save the snapshot if the snapshot path is set.
+// The snapshot is saved even if the requests have not completed in time.
+// If the handler is served by another http server, Shutdown closes the invalidation streams and saves the snapshot
+func (s *Server) Shutdown(ctx context.Context) error {
+
+	s.mutex.Lock()
+	httpServer := s.httpServer
+	s.shutdown = true
+	s.mutex.Unlock()
+
+	var err error
+
+	if httpServer != nil {
+		err = httpServer.Shutdown(ctx)
+	} else {
+		s.closeStreams()
+	}
+
+	if s.membership != nil {
+		s.membership.Stop()
+	}
+
+	for _, db := range s.databaseList() {
+		db.cache.StopEviction()
+	}
+
+	if saveErr := s.saveSnapshot(); err == nil {
+		err = saveErr
+	}
+
+	return err
+}
+
+// Load the cache from the file when serving starts if the file exists,
+// and save the cache into the file on Shutdown.
+// Other databases than the default one are saved into the files suffixed with '.' and their names
+func (s *Server) SetSnapshotPath(path string) {
+	s.snapshotPath = path
 }
 
-func (s *Server) Run(addr string) {
+func (s *Server) snapshotFile(name string) string {
+	if name == protocol.DefaultDatabase {
+		return s.snapshotPath
+	}
+	return s.snapshotPath + "." + url.PathEscape(name)
+}
+
+func (s *Server) loadSnapshot() error {
+	if s.snapshotPath == "" {
+		return nil
+	}
+
+	for _, db := range s.databaseList() {
+		if err := loadSnapshotFile(s.snapshotFile(db.name), db.cache); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
 
-	keysHandler := new(handlers.KeysHandler).Init(s.cache)
-	listsHandler := new(handlers.ListsHandler).Init(s.cache)
-	hashesHandler := new(handlers.HashesHandler).Init(s.cache)
+func loadSnapshotFile(path string, cache *gcache.Cache) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
 
-	s.middleware("/keys", keysHandler)
-	s.middleware("/lists", listsHandler)
-	s.middleware("/hashes", hashesHandler)
+	defer file.Close()
 
-	log.Fatal(http.ListenAndServe(addr, nil))
+	return cache.Load(bufio.NewReader(file))
 }
 
-func (s *Server) middleware(route string, handler handlers.Handler) {
-	handleFunc := s.urlLoggingHandler(s.authHandler(handler)).ServeHTTP
-	http.HandleFunc(route, handleFunc)
+// Save every database even if some fail, return the first error
+func (s *Server) saveSnapshot() error {
+	if s.snapshotPath == "" {
+		return nil
+	}
+
+	s.saveMutex.Lock()
+	defer s.saveMutex.Unlock()
+
+	var err error
+
+	for _, db := range s.databaseList() {
+		if saveErr := saveSnapshotFile(s.snapshotFile(db.name), db.cache); err == nil {
+			err = saveErr
+		}
+	}
+
+	s.lastSave = time.Now()
+	s.lastSaveErr = err
+
+	return err
+}
+
+// Write the snapshot into a temporary file first, so that a failure does not corrupt the previous one
+func saveSnapshotFile(path string, cache *gcache.Cache) error {
+
+	tmpPath := path + ".tmp"
+
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+
+	if err := cache.Save(writer); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// Return the handler of all the routes of the server, e.g. to mount it under another router.
+// The cluster membership is not started and the snapshot is not loaded by the handler
+func (s *Server) Handler() http.Handler {
+	s.routesOnce.Do(s.registerRoutes)
+	return s.router
+}
+
+// Get the cache of the default database
+func (s *Server) Cache() *gcache.Cache {
+	return s.cache
+}
+
+func (s *Server) registerRoutes() {
+
+	// Users and their permissions
+	s.middleware(s.router, "/acl", s.acl, classifyACL)
+
+	if s.membership != nil {
+		s.middleware(s.router, "/cluster", s.membership, classifyCluster)
+	}
+
+	// Administration of the whole server
+	s.middleware(s.router, protocol.InfoPath, http.HandlerFunc(s.infoQuery), classifyAdmin("info"))
+	s.middleware(s.router, protocol.FlushAllPath, http.HandlerFunc(s.flushAllCommand), classifyAdmin("flushall"))
+	s.middleware(s.router, protocol.SavePath, http.HandlerFunc(s.saveCommand), classifyAdmin("save"))
+	s.middleware(s.router, protocol.SlowlogPath, http.HandlerFunc(s.slowlogCommand), classifyAdmin("slowlog"))
+
+	// Metrics of the caches and the requests
+	s.middleware(s.router, MetricsPath, http.HandlerFunc(s.serveMetrics), classifyMetrics)
+
+	// Any other route is served by the selected database
+	s.router.Handle("/", http.HandlerFunc(s.serveDatabase))
+}
+
+func (s *Server) middleware(router *handlers.Router, route string, handler http.Handler, classify classifier) {
+	router.Handle(route, s.observeHandler(route, s.authHandler(route, s.limitHandler(route, handler, classify), classify)))
 }
 
 // Server without auth
@@ -39,44 +289,135 @@ func NewServer() *Server {
 	return NewServerWithAuth("")
 }
 
+// Server whose default user requires the password. Other users are managed by the ACL
 func NewServerWithAuth(pws string) *Server {
-	return &Server{
-		cache: gcache.NewCache(),
-		pws:   pws,
+	users := acl.New()
+	if pws != "" {
+		users.SetUser(acl.DefaultUser, "resetpass", ">"+pws)
 	}
+
+	s := &Server{
+		cache:     gcache.NewCache(),
+		pws:       pws,
+		acl:       users,
+		router:    handlers.NewRouter(),
+		metrics:   newMetrics(),
+		slowlog:   newSlowlog(),
+		limiter:   newLimiter(),
+		tracer:    trace.Noop,
+		startedAt: time.Now(),
+		databases: make(map[string]*database),
+	}
+
+	s.databases[protocol.DefaultDatabase] = s.newDatabase(protocol.DefaultDatabase, s.cache)
+
+	return s
 }
 
-func (s *Server) SetUrlLogging(enabled bool) {
-	s.urlLoggingEnabled = true
+// Change the password of the default user, and the one sent to the other cluster nodes.
+// An empty password disables auth of the default user
+func (s *Server) SetPassword(pws string) {
+	if pws != "" {
+		s.acl.SetUser(acl.DefaultUser, "resetpass", ">"+pws)
+	} else {
+		s.acl.SetUser(acl.DefaultUser, "resetpass", "nopass")
+	}
+
+	s.mutex.Lock()
+	s.pws = pws
+	s.mutex.Unlock()
+
+	if s.membership != nil {
+		s.membership.SetPassword(pws)
+	}
 }
 
-// Authentication handler
-func (s *Server) authHandler(h http.Handler) http.Handler {
+// Get the users of the server
+func (s *Server) ACL() *acl.ACL {
+	return s.acl
+}
+
+// Load the users from the ACL file, the file is saved to by the ACL administration
+func (s *Server) LoadACLFile(path string) error {
+	return s.acl.LoadFile(path)
+}
+
+// Record spans of the requests and of the cache commands they run. The trace context
+// of the traceparent and tracestate headers is the parent of the spans. Set it before serving
+func (s *Server) SetTracer(tracer trace.Tracer) {
+	s.tracer = tracer
+}
+
+// Enable gossip based cluster membership. self is the address other nodes
+// reach this server at, seeds are addresses of nodes of the cluster to join.
+// The other nodes are reached over TLS if it's set by SetTLS
+func (s *Server) EnableCluster(self string, seeds []string) *cluster.Membership {
+	s.membership = cluster.NewMembership(self, s.pws)
+	s.seeds = seeds
+
+	if s.peerTLSConfig != nil {
+		s.membership.SetTLSConfig(s.peerTLSConfig)
+	}
+	return s.membership
+}
+
+// Authentication handler. Authenticates the user and checks the command of the request against its permissions.
+// Json bodies are decoded once the user is authenticated, so that unauthenticated clients can't make the server read them
+func (s *Server) authHandler(route string, h http.Handler, classify classifier) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-		if s.pws != "" {
+		// Failed attempts of an ip take tokens of their own, and the ip is rejected once they are over the rate limits,
+		// so that passwords are not guessed faster than the limits allow
+		rated := s.limiter.configuration().rated(route)
+		if rated {
+			if ok, wait := s.limiter.available(authFailuresClient(r), route, time.Now()); !ok {
+				tooManyRequests(w, r, wait)
+				return
+			}
+		}
+
+		user, err := s.authenticate(r.Header.Get(headerAuthorization))
+		if err != nil {
+			if rated {
+				s.limiter.take(authFailuresClient(r), route, time.Now())
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		r = decodeBody(route, r)
 
-			psw := r.Header.Get(headerAuthorization)
+		// The command of a body which failed to decode is unknown, so it's rejected rather than checked
+		if err := handlers.BodyError(r); err != nil {
+			rejectBody(w, r, err)
+			return
+		}
 
-			if psw != s.pws {
+		command, _ := classifyOnce(r, classify, !user.Unrestricted())
 
-				w.WriteHeader(http.StatusUnauthorized)
+		if !user.Unrestricted() {
+			if err := user.Check(command); err != nil {
+				handlers.WriteError(w, r, http.StatusForbidden, protocol.CodeNoPerm, err.Error())
 				return
 			}
 		}
 
-		h.ServeHTTP(w, r)
+		h.ServeHTTP(w, r.WithContext(acl.WithUser(r.Context(), user)))
 	})
 }
 
-// Url logging handler. Logs urls if url logging is enabled
-func (s *Server) urlLoggingHandler(h http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+// Authenticate the named user by 'Basic base64(name:password)',
+// any other authorization is the password of the default user
+func (s *Server) authenticate(authorization string) (*acl.User, error) {
 
-		if s.urlLoggingEnabled {
-			fmt.Printf("%s %s%s\n\r", r.Method, r.Host, (*r.URL).RequestURI())
+	if strings.HasPrefix(authorization, "Basic ") {
+		decoded, err := base64.StdEncoding.DecodeString(authorization[len("Basic "):])
+		if err == nil {
+			if i := strings.IndexByte(string(decoded), ':'); i >= 0 {
+				return s.acl.Authenticate(string(decoded[:i]), string(decoded[i+1:]))
+			}
 		}
+	}
 
-		h.ServeHTTP(w, r)
-	})
+	return s.acl.Authenticate(acl.DefaultUser, authorization)
 }
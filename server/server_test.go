@@ -0,0 +1,157 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"gcache/protocol"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Serve the server on an ephemeral port. Return its url and the channel of the Serve error
+func serve(t *testing.T, s *Server) (string, chan error) {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.Serve(listener)
+	}()
+
+	return "http://" + listener.Addr().String(), errs
+}
+
+func shutdown(t *testing.T, s *Server, errs chan error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.Shutdown(ctx); err != nil {
+		t.Error("Failed to shut down", err)
+	}
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Error("Serve returned an error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Serve has not returned after shutdown")
+	}
+}
+
+func TestServer_TwoServers(t *testing.T) {
+
+	first, second := NewServer(), NewServerWithAuth("psw")
+
+	firstURL, firstErrs := serve(t, first)
+	secondURL, secondErrs := serve(t, second)
+
+	first.Cache().Set("key", "first", time.Minute)
+
+	resp, err := http.Get(firstURL + protocol.KeysPath + "/key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || string(body) != "first" {
+		t.Errorf("Expected the value of the first server but actual %d %q", resp.StatusCode, body)
+	}
+
+	// The second server has its own routes with auth
+	resp, err = http.Get(secondURL + protocol.KeysPath + "/key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("server returned wrong status code: got %v want %v", resp.StatusCode, http.StatusUnauthorized)
+	}
+
+	shutdown(t, first, firstErrs)
+	shutdown(t, second, secondErrs)
+}
+
+func TestServer_ShutdownClosesStreams(t *testing.T) {
+
+	s := NewServer()
+	url, errs := serve(t, s)
+
+	resp, err := http.Get(url + protocol.InvalidationsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	shutdown(t, s, errs)
+
+	// The stream ends
+	if _, err := protocol.ReadValue(bufio.NewReader(resp.Body)); err == nil {
+		t.Error("Expected the invalidation stream to be closed")
+	}
+}
+
+func TestServer_Snapshot(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "gcache.snapshot")
+
+	s := NewServer()
+	s.SetSnapshotPath(path)
+	_, errs := serve(t, s)
+
+	s.Cache().Set("key", "value", time.Minute)
+	shutdown(t, s, errs)
+
+	restarted := NewServer()
+	restarted.SetSnapshotPath(path)
+	_, errs = serve(t, restarted)
+
+	// Serving starts once the snapshot is loaded
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if value, err := restarted.Cache().Get("key"); err == nil {
+			if value != "value" {
+				t.Errorf("Expected value but actual %v", value)
+			}
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("The snapshot has not been loaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	shutdown(t, restarted, errs)
+}
+
+func TestServer_SetPassword(t *testing.T) {
+
+	s := NewServerWithAuth("old")
+	s.SetPassword("new")
+
+	if rr := serveAs(s, "old", http.MethodGet, protocol.KeysPath+"/missing", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the old password to be rejected but actual %d", rr.Code)
+	}
+
+	if rr := serveAs(s, "new", http.MethodGet, protocol.KeysPath+"/missing", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected the new password to be accepted but actual %d", rr.Code)
+	}
+
+	// Auth is disabled by an empty password
+	s.SetPassword("")
+
+	if rr := serveAs(s, "", http.MethodGet, protocol.KeysPath+"/missing", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected no auth but actual %d", rr.Code)
+	}
+}
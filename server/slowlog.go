@@ -0,0 +1,176 @@
+package server
+
+import (
+	"encoding/json"
+	"gcache/protocol"
+	"gcache/server/handlers"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// Commands taking longer are recorded by default
+	DefaultSlowlogSlowerThan = 10 * time.Millisecond
+	// Number of commands kept by default
+	DefaultSlowlogMaxLen = 128
+	// Keys recorded per command, the rest are only counted
+	slowlogMaxKeys = 8
+	// Entries returned by the slowlog route if no count is given
+	slowlogDefaultCount = 10
+)
+
+// Routes of long lived streams, which are never slow commands
+var streamRoutes = map[string]bool{protocol.InvalidationsPath: true}
+
+// Ring buffer of the latest slow commands
+type slowlog struct {
+	mutex     sync.Mutex
+	threshold time.Duration
+	entries   []protocol.SlowlogEntry
+	// Index the next entry is written at once the buffer is full
+	next   int
+	maxLen int
+	lastID int64
+}
+
+func newSlowlog() *slowlog {
+	return &slowlog{threshold: DefaultSlowlogSlowerThan, maxLen: DefaultSlowlogMaxLen}
+}
+
+func (l *slowlog) slowerThan() time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.threshold
+}
+
+func (l *slowlog) length() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.maxLen
+}
+
+func (l *slowlog) add(start time.Time, duration time.Duration, command string, keys []string, client string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.maxLen == 0 {
+		return
+	}
+
+	l.lastID++
+
+	entry := protocol.SlowlogEntry{
+		ID:       l.lastID,
+		Time:     start.UnixNano() / int64(time.Microsecond),
+		Duration: duration.Microseconds(),
+		Command:  command,
+		KeyCount: len(keys),
+		Client:   client,
+	}
+
+	if len(keys) > slowlogMaxKeys {
+		keys = keys[:slowlogMaxKeys]
+	}
+	entry.Keys = keys
+
+	if len(l.entries) < l.maxLen {
+		l.entries = append(l.entries, entry)
+		return
+	}
+
+	l.entries[l.next] = entry
+	l.next = (l.next + 1) % l.maxLen
+}
+
+// Get at most count latest entries, the newest first
+func (l *slowlog) latest(count int) []protocol.SlowlogEntry {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if count > len(l.entries) {
+		count = len(l.entries)
+	}
+
+	entries := make([]protocol.SlowlogEntry, 0, count)
+	for i := 0; i < count; i++ {
+		// The newest entry is right before the next one
+		j := (l.next - 1 - i + 2*len(l.entries)) % len(l.entries)
+		entries = append(entries, l.entries[j])
+	}
+
+	return entries
+}
+
+// Keep the latest entries which fit the new length
+func (l *slowlog) resize(maxLen int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// The oldest entry is the next one to be overwritten
+	entries := append(append([]protocol.SlowlogEntry{}, l.entries[l.next:]...), l.entries[:l.next]...)
+	if len(entries) > maxLen {
+		entries = entries[len(entries)-maxLen:]
+	}
+
+	l.entries = entries
+	l.next = 0
+	l.maxLen = maxLen
+}
+
+func (l *slowlog) reset() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.entries = nil
+	l.next = 0
+}
+
+// Record commands taking at least the duration, zero disables the slow log
+func (s *Server) SetSlowlogSlowerThan(duration time.Duration) {
+	s.slowlog.mutex.Lock()
+	defer s.slowlog.mutex.Unlock()
+	s.slowlog.threshold = duration
+}
+
+// Keep the given number of the latest slow commands, zero disables the slow log
+func (s *Server) SetSlowlogMaxLen(maxLen int) {
+	if maxLen < 0 {
+		maxLen = 0
+	}
+	s.slowlog.resize(maxLen)
+}
+
+// Get at most count latest slow commands, the newest first
+func (s *Server) Slowlog(count int) []protocol.SlowlogEntry {
+	return s.slowlog.latest(count)
+}
+
+// SLOWLOG GET responds the latest entries in JSON, SLOWLOG RESET deletes all of them
+func (s *Server) slowlogCommand(w http.ResponseWriter, req *http.Request) {
+
+	query := req.URL.Query()
+
+	switch {
+	case req.Method == http.MethodGet:
+		count := slowlogDefaultCount
+		if value := query.Get("count"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				handlers.WriteError(w, req, http.StatusBadRequest, protocol.CodeBadRequest, "Invalid count '"+value+"'")
+				return
+			}
+			count = n
+		}
+
+		w.Header().Set("Content-Type", protocol.ContentTypeJSON)
+		json.NewEncoder(w).Encode(s.slowlog.latest(count))
+
+	case req.Method == http.MethodPost && query.Get("op") == "reset":
+		s.slowlog.reset()
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
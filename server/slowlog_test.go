@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"gcache/protocol"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSlowlog_Ring(t *testing.T) {
+
+	l := newSlowlog()
+	l.resize(3)
+
+	for i := 0; i < 5; i++ {
+		l.add(time.Now(), time.Second, "get", []string{"key" + strconv.Itoa(i)}, "client")
+	}
+
+	entries := l.latest(10)
+	if len(entries) != 3 || entries[0].ID != 5 || entries[2].ID != 3 || entries[0].Keys[0] != "key4" {
+		t.Errorf("Unexpected entries %+v", entries)
+	}
+
+	// Shrinking keeps the latest
+	l.resize(2)
+	if entries := l.latest(10); len(entries) != 2 || entries[0].ID != 5 || entries[1].ID != 4 {
+		t.Errorf("Unexpected entries %+v", entries)
+	}
+
+	// Growing keeps adding
+	l.resize(4)
+	l.add(time.Now(), time.Second, "get", nil, "client")
+	if entries := l.latest(10); len(entries) != 3 || entries[0].ID != 6 || entries[2].ID != 4 {
+		t.Errorf("Unexpected entries %+v", entries)
+	}
+
+	// Keys beyond the limit are only counted
+	keys := make([]string, 20)
+	l.add(time.Now(), time.Second, "mget", keys, "client")
+	if entry := l.latest(1)[0]; len(entry.Keys) != slowlogMaxKeys || entry.KeyCount != 20 {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+
+	l.reset()
+	if entries := l.latest(10); len(entries) != 0 {
+		t.Errorf("Expected no entries but actual %d", len(entries))
+	}
+}
+
+func TestServer_Slowlog(t *testing.T) {
+
+	s := NewServer()
+	s.SetSlowlogSlowerThan(time.Nanosecond)
+
+	serveAs(s, "", http.MethodPost, protocol.KeysPath+"/key?ttl=10", "value")
+	serveAs(s, "", http.MethodGet, protocol.KeysPath+"/key", "")
+
+	rr := serveAs(s, "", http.MethodGet, protocol.SlowlogPath+"?count=1", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	entries := []protocol.SlowlogEntry{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &entries); err != nil {
+		t.Fatal("Failed to decode the slow log", err)
+	}
+
+	if len(entries) != 1 || entries[0].Command != protocol.OpGet || entries[0].Keys[0] != "key" || entries[0].Client == "" {
+		t.Errorf("Unexpected entries %+v", entries)
+	}
+
+	if rr := serveAs(s, "", http.MethodPost, protocol.SlowlogPath+"?op=reset", ""); rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// Disabled, the slowlog request itself was recorded after the reset
+	s.SetSlowlogSlowerThan(0)
+	serveAs(s, "", http.MethodGet, protocol.KeysPath+"/key", "")
+
+	if entries := s.Slowlog(10); len(entries) != 1 || entries[0].Command != "slowlog" {
+		t.Errorf("Unexpected entries %+v", entries)
+	}
+
+	if rr := serveAs(s, "", http.MethodGet, protocol.SlowlogPath+"?count=x", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
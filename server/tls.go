@@ -0,0 +1,129 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+)
+
+var ErrNoCACertificates = errors.New("No CA certificates found")
+
+// TLS configuration of the server
+type TLSConfig struct {
+	// PEM files of the server certificate and its key
+	CertFile string
+	KeyFile  string
+	// Minimal TLS version, e.g. tls.VersionTLS13. TLS 1.2 by default
+	MinVersion uint16
+	// PEM file of the CAs verifying client certificates. If set, clients must present a certificate signed by them
+	ClientCAFile string
+
+	// PEM file of the CAs verifying the certificates of the other cluster nodes.
+	// ClientCAFile if empty, the system CAs if both are empty
+	PeerCAFile string
+	// PEM files of the certificate presented to the other cluster nodes, which verify client certificates
+	PeerCertFile string
+	PeerKeyFile  string
+}
+
+// Serve over TLS and reach the other cluster nodes over TLS. The certificates are loaded right away
+func (s *Server) SetTLS(config TLSConfig) error {
+
+	tlsConfig, err := config.build()
+	if err != nil {
+		return err
+	}
+
+	peerTLSConfig, err := config.buildPeer()
+	if err != nil {
+		return err
+	}
+
+	s.tlsConfig = tlsConfig
+	s.peerTLSConfig = peerTLSConfig
+
+	if s.membership != nil {
+		s.membership.SetTLSConfig(peerTLSConfig)
+	}
+	return nil
+}
+
+func (config TLSConfig) build() (*tls.Config, error) {
+
+	cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   config.MinVersion,
+	}
+
+	if tlsConfig.MinVersion == 0 {
+		tlsConfig.MinVersion = tls.VersionTLS12
+	}
+
+	if config.ClientCAFile != "" {
+		pool, err := loadCertPool(config.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+// Configuration of the requests of the cluster membership to the other nodes
+func (config TLSConfig) buildPeer() (*tls.Config, error) {
+
+	tlsConfig := &tls.Config{MinVersion: config.MinVersion}
+
+	if tlsConfig.MinVersion == 0 {
+		tlsConfig.MinVersion = tls.VersionTLS12
+	}
+
+	caFile := config.PeerCAFile
+	if caFile == "" {
+		caFile = config.ClientCAFile
+	}
+
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.PeerCertFile != "" || config.PeerKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.PeerCertFile, config.PeerKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+
+	pem, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, ErrNoCACertificates
+	}
+
+	return pool, nil
+}
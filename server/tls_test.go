@@ -0,0 +1,116 @@
+package server_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"gcache/gcachetest"
+	"gcache/protocol"
+	"gcache/server"
+	"gcache/server/cluster"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestServer_TLSMinVersion(t *testing.T) {
+
+	certs := gcachetest.NewCerts(t)
+	srv := gcachetest.NewTLSServer(t, "", server.TLSConfig{
+		CertFile:   certs.ServerCertFile,
+		KeyFile:    certs.ServerKeyFile,
+		MinVersion: tls.VersionTLS13,
+	})
+
+	pem, err := os.ReadFile(certs.CAFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(pem)
+
+	get := func(maxVersion uint16) error {
+		httpClient := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, MaxVersion: maxVersion},
+		}}
+
+		resp, err := httpClient.Get(srv.URL + protocol.KeysPath)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	if err := get(tls.VersionTLS13); err != nil {
+		t.Error("Failed to connect over TLS 1.3", err)
+	}
+
+	if err := get(tls.VersionTLS12); err == nil {
+		t.Error("Expected TLS 1.2 to be refused")
+	}
+}
+
+func TestServer_TLSBadFiles(t *testing.T) {
+
+	s := server.NewServer()
+
+	if err := s.SetTLS(server.TLSConfig{CertFile: "missing.pem", KeyFile: "missing-key.pem"}); err == nil {
+		t.Error("Expected an error loading missing certificate files")
+	}
+
+	certs := gcachetest.NewCerts(t)
+
+	err := s.SetTLS(server.TLSConfig{
+		CertFile:     certs.ServerCertFile,
+		KeyFile:      certs.ServerKeyFile,
+		ClientCAFile: certs.ServerKeyFile,
+	})
+	if err != server.ErrNoCACertificates {
+		t.Error("Expected no CA certificates but actual", err)
+	}
+}
+
+func TestServer_TLSCluster(t *testing.T) {
+
+	certs := gcachetest.NewCerts(t)
+	config := server.TLSConfig{
+		CertFile:     certs.ServerCertFile,
+		KeyFile:      certs.ServerKeyFile,
+		ClientCAFile: certs.CAFile,
+		PeerCertFile: certs.ClientCertFile,
+		PeerKeyFile:  certs.ClientKeyFile,
+	}
+
+	start := func(seeds []string) *cluster.Membership {
+		s := server.NewServer()
+		if err := s.SetTLS(config); err != nil {
+			t.Fatal(err)
+		}
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		membership := s.EnableCluster("https://"+listener.Addr().String(), seeds)
+
+		go s.Serve(listener)
+		t.Cleanup(func() { s.Shutdown(context.Background()) })
+
+		return membership
+	}
+
+	seed := start(nil)
+	node := start([]string{seed.Self()})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(seed.Alive()) != 2 || len(node.Alive()) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the nodes to join over mutual TLS but actual %v and %v", seed.Alive(), node.Alive())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,145 @@
+package gcache
+
+import (
+	"container/heap"
+	"errors"
+	"time"
+)
+
+var ErrInvalidInterval = errors.New("Interval must be positive")
+
+// Delete all the keys. Return the number of deleted keys.
+// The change is reported once with the empty key rather than once for every key
+func (c *Cache) Flush() int {
+	c.mutex.Lock()
+	n := len(c.items)
+
+	pq := priorityQueue{}
+	heap.Init(&pq)
+
+	c.items = make(map[string]*item)
+	c.pq = &pq
+	c.used = 0
+	c.mutex.Unlock()
+
+	c.changed("")
+
+	return n
+}
+
+// Get the maximum number of keys, zero means no limit
+func (c *Cache) MaxItems() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.maxItems
+}
+
+// Set the maximum number of keys, zero means no limit.
+// The keys which expire soonest are evicted right away if there are more keys
+func (c *Cache) SetMaxItems(maxItems int) {
+	c.mutex.Lock()
+	c.maxItems = maxItems
+
+	for maxItems > 0 && len(c.items) > maxItems && c.pq.Len() != 0 {
+		c.evictSoonest()
+	}
+	c.mutex.Unlock()
+
+	// Report the evicted keys
+	c.changed()
+}
+
+// Get the limit of the approximate memory held by keys and values in bytes, zero means no limit
+func (c *Cache) MaxMemory() int64 {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.maxMemory
+}
+
+// Set the limit of the approximate memory held by keys and values in bytes, zero means no limit.
+// When a write exceeds the limit the keys which expire soonest are evicted, the written key is kept
+func (c *Cache) SetMaxMemory(bytes int64) {
+	c.mutex.Lock()
+	c.maxMemory = bytes
+	c.shrink(nil)
+	c.mutex.Unlock()
+
+	// Report the evicted keys
+	c.changed()
+}
+
+// Get the maximum number of elements of a list, zero means no limit
+func (c *Cache) MaxListLength() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.maxListLength
+}
+
+// Set the maximum number of elements of a list, zero means no limit.
+// Pushing into a full list fails with ErrTooLong, longer lists are kept as they are
+func (c *Cache) SetMaxListLength(length int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.maxListLength = length
+}
+
+// Get the maximum number of fields of a hash, zero means no limit
+func (c *Cache) MaxHashLength() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.maxHashLength
+}
+
+// Set the maximum number of fields of a hash, zero means no limit.
+// Setting a new field of a full hash fails with ErrTooLong, existing fields may still be set
+func (c *Cache) SetMaxHashLength(length int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.maxHashLength = length
+}
+
+// Get the interval expired keys are evicted on
+func (c *Cache) EvictionInterval() time.Duration {
+	c.evictionMutex.Lock()
+	defer c.evictionMutex.Unlock()
+	return c.evictionInterval
+}
+
+// Set the interval expired keys are evicted on. Expired keys are never read anyway,
+// a longer interval trades memory held by them for less locking
+func (c *Cache) SetEvictionInterval(interval time.Duration) error {
+	if interval <= 0 {
+		return ErrInvalidInterval
+	}
+
+	c.evictionMutex.Lock()
+	defer c.evictionMutex.Unlock()
+
+	if c.stopEviction != nil {
+		c.stopEviction <- true
+	}
+	c.startEviction(interval)
+
+	return nil
+}
+
+// Stop evicting expired keys on the interval, e.g. once the cache is not served anymore.
+// Expired keys are still never read. SetEvictionInterval starts evicting again
+func (c *Cache) StopEviction() {
+	c.evictionMutex.Lock()
+	defer c.evictionMutex.Unlock()
+
+	if c.stopEviction != nil {
+		c.stopEviction <- true
+		c.stopEviction = nil
+	}
+}
+
+func (c *Cache) startEviction(interval time.Duration) {
+	c.evictionInterval = interval
+	c.stopEviction = schedule(func() {
+		c.mutex.Lock()
+		c.evict()
+		c.mutex.Unlock()
+	}, interval)
+}
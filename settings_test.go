@@ -0,0 +1,230 @@
+package gcache
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCache_Flush(t *testing.T) {
+
+	cache := NewCache()
+	changed := make(chan string, 10)
+	cache.OnChange(func(key string) {
+		changed <- key
+	})
+
+	cache.Set("a", "value", time.Minute)
+	cache.LPush("b", "value")
+	<-changed
+	<-changed
+
+	if n := cache.Flush(); n != 2 {
+		t.Errorf("Expected 2 keys to be flushed but actual %d", n)
+	}
+
+	if cache.Count() != 0 || cache.Stats().Bytes != 0 {
+		t.Errorf("Expected the cache to be empty, %d keys", cache.Count())
+	}
+
+	if len(changed) != 1 || <-changed != "" {
+		t.Errorf("Expected the flush to be reported once with the empty key but actual %d changes", len(changed))
+	}
+
+	// The cache is usable after flushing
+	cache.Set("a", "value", time.Minute)
+	if value, err := cache.Get("a"); err != nil || value != "value" {
+		t.Errorf("Expected value but actual %v, err = %v", value, err)
+	}
+}
+
+func TestCache_MaxMemory(t *testing.T) {
+
+	cache := NewCache()
+	value := strings.Repeat("v", 1000)
+
+	for i := 0; i < 10; i++ {
+		cache.Set("key"+strconv.Itoa(i), value, time.Duration(i+1)*time.Minute)
+	}
+
+	before := cache.Stats().Bytes
+	cache.SetMaxMemory(before / 2)
+
+	stats := cache.Stats()
+	if stats.Bytes > before/2 || stats.Items() == 0 {
+		t.Errorf("Expected the memory within %d but actual %d, %d keys", before/2, stats.Bytes, stats.Items())
+	}
+
+	// The keys which expire soonest are evicted first
+	if _, err := cache.Get("key0"); err != ErrKeyNotFound {
+		t.Error("Expected the soonest key to be evicted but actual", err)
+	}
+	if _, err := cache.Get("key9"); err != nil {
+		t.Error("Expected the latest key to be kept but actual", err)
+	}
+
+	// A growing list evicts the other keys, the list itself is kept even if it does not fit alone
+	for i := 0; i < 100; i++ {
+		cache.RPush("list", value)
+	}
+
+	if stats := cache.Stats(); stats.Items() != 1 || stats.Lists != 1 {
+		t.Errorf("Expected the list to be kept and others evicted, %+v", stats)
+	}
+
+	cache.LPop("list")
+	cache.HSet("hash", "field", value)
+	cache.HSet("hash", "field", "short")
+
+	used := int64(0)
+	for _, key := range cache.Keys() {
+		cache.mutex.RLock()
+		used += int64(itemSize(key, cache.items[key].value))
+		cache.mutex.RUnlock()
+	}
+
+	if stats := cache.Stats(); stats.Bytes != used {
+		t.Errorf("Expected the tracked memory %d to match the values %d", stats.Bytes, used)
+	}
+}
+
+func TestCache_SetMaxItems(t *testing.T) {
+
+	cache := NewCache()
+	for i := 0; i < 5; i++ {
+		cache.Set("key"+strconv.Itoa(i), "value", time.Duration(i+1)*time.Minute)
+	}
+
+	cache.SetMaxItems(2)
+
+	if cache.MaxItems() != 2 || cache.Count() != 2 {
+		t.Errorf("Expected 2 keys but actual %d", cache.Count())
+	}
+
+	if _, err := cache.Get("key4"); err != nil {
+		t.Error("Expected the latest key to be kept but actual", err)
+	}
+}
+
+func TestCache_LimitsReportEvictions(t *testing.T) {
+
+	cache := NewCache()
+	changed := make(chan string, 10)
+	cache.OnChange(func(key string) {
+		changed <- key
+	})
+
+	value := strings.Repeat("v", 1000)
+	for i := 0; i < 3; i++ {
+		cache.Set("key"+strconv.Itoa(i), value, time.Duration(i+1)*time.Minute)
+		<-changed
+	}
+
+	cache.SetMaxItems(2)
+	if len(changed) != 1 || <-changed != "key0" {
+		t.Error("Expected the key evicted for the maximum of keys to be reported")
+	}
+
+	cache.SetMaxMemory(cache.Stats().Bytes / 2)
+	if len(changed) != 1 || <-changed != "key1" {
+		t.Error("Expected the key evicted for the memory limit to be reported")
+	}
+
+	// A key evicted by a write is reported along with the written key
+	cache.SetMaxMemory(cache.Stats().Bytes)
+	cache.Set("key3", value, time.Hour)
+	if len(changed) != 2 || <-changed != "key2" || <-changed != "key3" {
+		t.Error("Expected the evicted key to be reported before the written key")
+	}
+}
+
+func TestCache_MaxListAndHashLength(t *testing.T) {
+
+	cache := NewCache()
+	cache.SetMaxListLength(2)
+	cache.SetMaxHashLength(1)
+
+	cache.LPush("list", "a")
+	cache.RPush("list", "b")
+
+	if err := cache.LPush("list", "c"); err != ErrTooLong {
+		t.Error("Expected the full list to reject the push but actual", err)
+	}
+
+	// Room is made by popping
+	cache.LPop("list")
+	if err := cache.RPush("list", "c"); err != nil {
+		t.Error("Failed to push", err)
+	}
+
+	cache.HSet("hash", "a", "1")
+
+	if err := cache.HSet("hash", "b", "2"); err != ErrTooLong {
+		t.Error("Expected the full hash to reject a new field but actual", err)
+	}
+
+	if err := cache.HSet("hash", "a", "3"); err != nil {
+		t.Error("Expected an existing field to be set but actual", err)
+	}
+}
+
+func TestCache_SetEvictionInterval(t *testing.T) {
+
+	cache := NewCache()
+
+	if err := cache.SetEvictionInterval(0); err != ErrInvalidInterval {
+		t.Error("Expected an invalid interval but actual", err)
+	}
+
+	if err := cache.SetEvictionInterval(10 * time.Millisecond); err != nil {
+		t.Fatal("Failed to set the interval", err)
+	}
+
+	if cache.EvictionInterval() != 10*time.Millisecond {
+		t.Error("Unexpected interval", cache.EvictionInterval())
+	}
+
+	cache.Set("key", "value", time.Millisecond)
+
+	// Expired keys are evicted in the background
+	deadline := time.Now().Add(5 * time.Second)
+	for cache.Stats().Expirations == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("The expired key has not been evicted")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCache_StopEviction(t *testing.T) {
+
+	cache := NewCache()
+	cache.SetEvictionInterval(5 * time.Millisecond)
+	cache.StopEviction()
+	cache.StopEviction()
+
+	cache.Set("key", "value", time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+
+	if cache.Stats().Expirations != 0 {
+		t.Error("Expected the expired key not to be evicted")
+	}
+
+	if _, err := cache.Get("key"); err != ErrKeyNotFound {
+		t.Error("Expected the expired key not to be read but actual", err)
+	}
+
+	// Evicting again
+	if err := cache.SetEvictionInterval(5 * time.Millisecond); err != nil {
+		t.Fatal("Failed to set the interval", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for cache.Stats().Expirations == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("The expired key has not been evicted")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
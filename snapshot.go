@@ -0,0 +1,280 @@
+package gcache
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/gob"
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+const snapshotVersion = 1
+
+var ErrSnapshotVersion = errors.New("Unsupported snapshot version")
+var ErrBadDump = errors.New("Invalid or unsupported dump")
+
+// Kinds of snapshot entries
+const (
+	entryValue = iota
+	entryList
+	entryHash
+)
+
+type snapshotHeader struct {
+	Version int
+}
+
+// Item of a snapshot. Values of types other than the basic ones must be registered with gob
+type snapshotEntry struct {
+	Key      string
+	Kind     int
+	Value    interface{}
+	List     []interface{}
+	Hash     map[string]interface{}
+	Ttl      time.Duration
+	ExpireAt time.Time
+}
+
+// Key serialized by Dump. The expiration is relative, so that the key expires
+// after the same time on a server with another clock
+type dumpEntry struct {
+	Version int
+	Kind    int
+	Value   interface{}
+	List    []interface{}
+	Hash    map[string]interface{}
+	Ttl     time.Duration
+	// Time the key had left when it was dumped
+	Remaining time.Duration
+}
+
+// Whether the kind of the dump is known and its values are strings, the only values served over http.
+// Dumps come from clients, any other value is rejected rather than failing the reads of the key
+func (entry dumpEntry) valid() bool {
+	switch entry.Kind {
+	case entryValue:
+		_, ok := entry.Value.(string)
+		return ok
+
+	case entryList:
+		for _, element := range entry.List {
+			if _, ok := element.(string); !ok {
+				return false
+			}
+		}
+		return true
+
+	case entryHash:
+		for _, value := range entry.Hash {
+			if _, ok := value.(string); !ok {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+// Write the items which have not expired yet to w
+func (c *Cache) Save(w io.Writer) error {
+
+	entries := c.snapshot()
+
+	encoder := gob.NewEncoder(w)
+
+	if err := encoder.Encode(snapshotHeader{Version: snapshotVersion}); err != nil {
+		return err
+	}
+
+	for i := range entries {
+		if err := encoder.Encode(&entries[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Copy the items so that they are encoded without holding the lock
+func (c *Cache) snapshot() []snapshotEntry {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	now := time.Now()
+	entries := make([]snapshotEntry, 0, len(c.items))
+
+	for key, item := range c.items {
+		if item.expireAt.Before(now) {
+			continue
+		}
+
+		entries = append(entries, entryOf(key, item))
+	}
+
+	return entries
+}
+
+// Copy the item into an entry, lists and hashes are copied as well
+func entryOf(key string, item *item) snapshotEntry {
+	entry := snapshotEntry{
+		Key:      key,
+		Ttl:      item.ttl,
+		ExpireAt: item.expireAt,
+	}
+
+	switch value := item.value.(type) {
+	case *list.List:
+		entry.Kind = entryList
+		entry.List = make([]interface{}, 0, value.Len())
+		for e := value.Front(); e != nil; e = e.Next() {
+			entry.List = append(entry.List, e.Value)
+		}
+
+	case map[string]interface{}:
+		entry.Kind = entryHash
+		entry.Hash = make(map[string]interface{}, len(value))
+		for hashKey, hashValue := range value {
+			entry.Hash[hashKey] = hashValue
+		}
+
+	default:
+		entry.Kind = entryValue
+		entry.Value = value
+	}
+
+	return entry
+}
+
+// Create the value of the item of the entry
+func valueOf(kind int, value interface{}, elements []interface{}, hash map[string]interface{}) interface{} {
+	switch kind {
+	case entryList:
+		l := list.New()
+		for _, element := range elements {
+			l.PushBack(element)
+		}
+		return l
+
+	case entryHash:
+		if hash == nil {
+			hash = make(map[string]interface{})
+		}
+		return hash
+	}
+
+	return value
+}
+
+// Read the items written by Save. The items replace the keys held by the cache,
+// the items which have expired meanwhile are skipped
+func (c *Cache) Load(r io.Reader) error {
+
+	decoder := gob.NewDecoder(r)
+
+	header := snapshotHeader{}
+	if err := decoder.Decode(&header); err != nil {
+		return err
+	}
+
+	if header.Version != snapshotVersion {
+		return ErrSnapshotVersion
+	}
+
+	entries := []snapshotEntry{}
+	for {
+		entry := snapshotEntry{}
+		err := decoder.Decode(&entry)
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	now := time.Now()
+	keys := make([]string, 0, len(entries))
+
+	c.mutex.Lock()
+	for _, entry := range entries {
+		if entry.ExpireAt.Before(now) {
+			continue
+		}
+
+		value := valueOf(entry.Kind, entry.Value, entry.List, entry.Hash)
+
+		// Keep the original expiration rather than counting the ttl from now
+		c.setUntil(entry.Key, value, entry.Ttl, entry.ExpireAt)
+		keys = append(keys, entry.Key)
+	}
+	c.mutex.Unlock()
+
+	c.changed(keys...)
+
+	return nil
+}
+
+// Serialize the value and the ttl of the key in the format of Save, Restore creates the key of it
+func (c *Cache) Dump(key string) ([]byte, error) {
+	c.mutex.RLock()
+	item, exists := c.getItem(key)
+	if !exists {
+		c.mutex.RUnlock()
+		return nil, ErrKeyNotFound
+	}
+
+	entry := entryOf(key, item)
+	c.mutex.RUnlock()
+
+	buffer := &bytes.Buffer{}
+	err := gob.NewEncoder(buffer).Encode(dumpEntry{
+		Version:   snapshotVersion,
+		Kind:      entry.Kind,
+		Value:     entry.Value,
+		List:      entry.List,
+		Hash:      entry.Hash,
+		Ttl:       entry.Ttl,
+		Remaining: time.Until(entry.ExpireAt),
+	})
+
+	return buffer.Bytes(), err
+}
+
+// Create the key of the value and the ttl serialized by Dump. The key expires after the time it had left
+// when it was dumped, or after ttl if it is positive. An existing key is replaced only if replace is set,
+// ErrKeyExists is returned otherwise. Dumps of values, list elements or hash values other than strings are ErrBadDump
+func (c *Cache) Restore(key string, dump []byte, ttl time.Duration, replace bool) error {
+
+	entry := dumpEntry{}
+	if err := gob.NewDecoder(bytes.NewReader(dump)).Decode(&entry); err != nil || entry.Version != snapshotVersion || !entry.valid() {
+		return ErrBadDump
+	}
+
+	expireAt := time.Now().Add(entry.Remaining)
+	if ttl > 0 {
+		entry.Ttl = ttl
+		expireAt = time.Now().Add(ttl)
+	}
+
+	value := valueOf(entry.Kind, entry.Value, entry.List, entry.Hash)
+
+	c.mutex.Lock()
+	if _, exists := c.getItem(key); exists && !replace {
+		c.mutex.Unlock()
+		return ErrKeyExists
+	}
+
+	c.setUntil(key, value, entry.Ttl, expireAt)
+	c.mutex.Unlock()
+
+	atomic.AddUint64(&c.stats.sets, 1)
+	c.changed(key)
+
+	return nil
+}
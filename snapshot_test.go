@@ -0,0 +1,149 @@
+package gcache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+	"time"
+)
+
+func TestCache_SaveLoad(t *testing.T) {
+
+	cache := NewCache()
+	cache.Set("key", "value", time.Minute)
+	cache.Set("expiring", "value", 50*time.Millisecond)
+	cache.LPush("list", "a")
+	cache.LPush("list", "b")
+	cache.HSet("hash", "hashKey", "value")
+
+	buffer := &bytes.Buffer{}
+	if err := cache.Save(buffer); err != nil {
+		t.Fatal("Failed to save", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	loaded := NewCache()
+	if err := loaded.Load(buffer); err != nil {
+		t.Fatal("Failed to load", err)
+	}
+
+	if value, err := loaded.Get("key"); err != nil || value != "value" {
+		t.Errorf("Expected value but actual %v, err = %v", value, err)
+	}
+
+	if ttl, _ := loaded.Ttl("key"); ttl != time.Minute {
+		t.Error("Expected the ttl to be kept but actual", ttl)
+	}
+
+	if _, err := loaded.Get("expiring"); err != ErrKeyNotFound {
+		t.Error("Expected the key expired meanwhile to be skipped but actual", err)
+	}
+
+	values, err := loaded.LRange("list", 0, 10)
+	if err != nil || len(values) != 2 || values[0] != "a" || values[1] != "b" {
+		t.Errorf("Expected [a b] but actual %v, err = %v", values, err)
+	}
+
+	if value, err := loaded.HGet("hash", "hashKey"); err != nil || value != "value" {
+		t.Errorf("Expected value but actual %v, err = %v", value, err)
+	}
+}
+
+func TestCache_LoadBadSnapshot(t *testing.T) {
+
+	if err := NewCache().Load(bytes.NewBufferString("not a snapshot")); err == nil {
+		t.Error("Expected an error loading a bad snapshot")
+	}
+}
+
+func TestCache_DumpRestore(t *testing.T) {
+
+	cache := NewCache()
+	cache.Set("key", "value", time.Minute)
+	cache.LPush("list", "a")
+	cache.LPush("list", "b")
+	cache.HSet("hash", "hashKey", "value")
+
+	restored := NewCache()
+
+	for _, key := range []string{"key", "list", "hash"} {
+		dump, err := cache.Dump(key)
+		if err != nil {
+			t.Fatal("Failed to dump", err)
+		}
+		if err := restored.Restore(key, dump, 0, false); err != nil {
+			t.Fatal("Failed to restore", err)
+		}
+	}
+
+	if value, err := restored.Get("key"); err != nil || value != "value" {
+		t.Errorf("Expected value but actual %v, err = %v", value, err)
+	}
+
+	if ttl, _ := restored.Ttl("key"); ttl != time.Minute {
+		t.Error("Expected the ttl to be kept but actual", ttl)
+	}
+
+	values, err := restored.LRange("list", 0, 10)
+	if err != nil || len(values) != 2 || values[0] != "a" || values[1] != "b" {
+		t.Errorf("Expected [a b] but actual %v, err = %v", values, err)
+	}
+
+	if value, err := restored.HGet("hash", "hashKey"); err != nil || value != "value" {
+		t.Errorf("Expected value but actual %v, err = %v", value, err)
+	}
+
+	// Existing keys are replaced only if asked to
+	dump, _ := cache.Dump("key")
+	restored.Set("key", "other", time.Minute)
+
+	if err := restored.Restore("key", dump, 0, false); err != ErrKeyExists {
+		t.Error("Expected the existing key not to be replaced but actual", err)
+	}
+
+	if err := restored.Restore("key", dump, time.Hour, true); err != nil {
+		t.Fatal("Failed to replace", err)
+	}
+
+	if value, _ := restored.Get("key"); value != "value" {
+		t.Error("Expected the key to be replaced but actual", value)
+	}
+
+	if ttl, _ := restored.Ttl("key"); ttl != time.Hour {
+		t.Error("Expected the given ttl but actual", ttl)
+	}
+
+	if _, err := cache.Dump("missing"); err != ErrKeyNotFound {
+		t.Error("Expected key not found but actual", err)
+	}
+
+	if err := restored.Restore("bad", []byte("not a dump"), 0, false); err != ErrBadDump {
+		t.Error("Expected a bad dump but actual", err)
+	}
+
+	// Values other than strings are not served, their dumps are rejected
+	for _, entry := range []dumpEntry{
+		{Kind: entryValue, Value: int64(1)},
+		{Kind: entryValue},
+		{Kind: entryList, List: []interface{}{"a", 1.5}},
+		{Kind: entryHash, Hash: map[string]interface{}{"a": "b", "c": []byte("d")}},
+		{Kind: 7, Value: "value"},
+	} {
+		entry.Version = snapshotVersion
+		entry.Remaining = time.Minute
+
+		buffer := &bytes.Buffer{}
+		if err := gob.NewEncoder(buffer).Encode(entry); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := restored.Restore("typed", buffer.Bytes(), 0, true); err != ErrBadDump {
+			t.Errorf("Expected the dump of %+v to be bad but actual %v", entry, err)
+		}
+	}
+
+	if _, err := restored.Get("typed"); err != ErrKeyNotFound {
+		t.Error("Expected no key of the bad dumps but actual", err)
+	}
+}
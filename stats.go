@@ -0,0 +1,135 @@
+package gcache
+
+import (
+	"container/list"
+	"sync/atomic"
+	"time"
+)
+
+// Approximate overhead of a key in bytes: the item, the map entry and the queue entry
+const itemOverhead = 96
+
+// Statistics of the cache. Counters grow since the cache is created
+type Stats struct {
+	// Reads of existing keys: get, mget, lrange and hget
+	Hits uint64
+	// Reads of missing keys
+	Misses uint64
+	// Keys set or updated
+	Sets uint64
+	// Keys deleted by del and mdel
+	Deletes uint64
+	// Keys removed because their ttl has passed
+	Expirations uint64
+	// Keys removed to make room for new keys when the cache is full
+	Evictions uint64
+
+	// Keys by type of the value
+	Strings int
+	Lists   int
+	Hashes  int
+	// Values of other types set by the Go API
+	Others int
+
+	// Approximate memory held by keys and values in bytes, the same the memory limit applies to
+	Bytes int64
+}
+
+// Get the number of keys
+func (s Stats) Items() int {
+	return s.Strings + s.Lists + s.Hashes + s.Others
+}
+
+type counters struct {
+	hits        uint64
+	misses      uint64
+	sets        uint64
+	deletes     uint64
+	expirations uint64
+	evictions   uint64
+}
+
+func (c *counters) hit() {
+	atomic.AddUint64(&c.hits, 1)
+}
+
+func (c *counters) miss() {
+	atomic.AddUint64(&c.misses, 1)
+}
+
+// Get the statistics of the cache. Keys are counted and measured on every call,
+// which takes time proportional to the number of keys
+func (c *Cache) Stats() Stats {
+
+	stats := Stats{
+		Hits:        atomic.LoadUint64(&c.stats.hits),
+		Misses:      atomic.LoadUint64(&c.stats.misses),
+		Sets:        atomic.LoadUint64(&c.stats.sets),
+		Deletes:     atomic.LoadUint64(&c.stats.deletes),
+		Expirations: atomic.LoadUint64(&c.stats.expirations),
+		Evictions:   atomic.LoadUint64(&c.stats.evictions),
+	}
+
+	now := time.Now()
+
+	c.mutex.RLock()
+	for _, item := range c.items {
+		if item.expireAt.Before(now) {
+			continue
+		}
+
+		switch item.value.(type) {
+		case string:
+			stats.Strings++
+		case *list.List:
+			stats.Lists++
+		case map[string]interface{}:
+			stats.Hashes++
+		default:
+			stats.Others++
+		}
+
+		stats.Bytes += int64(item.size)
+	}
+	c.mutex.RUnlock()
+
+	return stats
+}
+
+// Approximate memory held by the key and the value in bytes
+func itemSize(key string, value interface{}) int {
+	return itemOverhead + len(key) + sizeOf(value)
+}
+
+// Approximate size of the value in bytes
+func sizeOf(value interface{}) int {
+	switch v := value.(type) {
+	case string:
+		return len(v)
+	case []byte:
+		return len(v)
+	case *list.List:
+		size := 0
+		for e := v.Front(); e != nil; e = e.Next() {
+			size += listElementSize(e.Value)
+		}
+		return size
+	case map[string]interface{}:
+		size := 0
+		for hashKey, hashValue := range v {
+			size += hashEntrySize(hashKey, hashValue)
+		}
+		return size
+	}
+
+	return 16
+}
+
+// Elements hold pointers to their neighbours and the list
+func listElementSize(value interface{}) int {
+	return 48 + sizeOf(value)
+}
+
+func hashEntrySize(hashKey string, value interface{}) int {
+	return 32 + len(hashKey) + sizeOf(value)
+}
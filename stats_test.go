@@ -0,0 +1,49 @@
+package gcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache_Stats(t *testing.T) {
+
+	cache := NewCacheWithLimit(3)
+
+	cache.Set("string", "value", time.Minute)
+	cache.LPush("list", "a")
+	cache.HSet("hash", "field", "value")
+
+	cache.Get("string")
+	cache.Get("missing")
+	cache.MGet("string", "missing")
+	cache.LRange("list", 0, -1)
+	cache.HGet("hash", "missing")
+
+	stats := cache.Stats()
+
+	if stats.Hits != 3 || stats.Misses != 3 {
+		t.Errorf("Expected 3 hits and 3 misses but actual %d and %d", stats.Hits, stats.Misses)
+	}
+
+	if stats.Strings != 1 || stats.Lists != 1 || stats.Hashes != 1 || stats.Items() != 3 {
+		t.Errorf("Expected a key of every type but actual %+v", stats)
+	}
+
+	if stats.Bytes < int64(len("string")+len("value")) {
+		t.Errorf("Expected the size to include keys and values but actual %d", stats.Bytes)
+	}
+
+	// A new key evicts the one which expires soonest
+	cache.Set("other", "value", time.Minute)
+	cache.Del("other")
+	cache.MSet(map[string]interface{}{"short": "value"}, time.Millisecond)
+
+	time.Sleep(5 * time.Millisecond)
+	cache.Count()
+
+	stats = cache.Stats()
+
+	if stats.Sets != 3 || stats.Deletes != 1 || stats.Evictions != 1 || stats.Expirations != 1 {
+		t.Errorf("Expected 3 sets, 1 delete, 1 eviction and 1 expiration but actual %+v", stats)
+	}
+}
@@ -0,0 +1,169 @@
+package store
+
+import (
+	"context"
+	"gcache"
+	"time"
+)
+
+var cacheErrors = map[error]error{
+	gcache.ErrKeyNotFound:     ErrKeyNotFound,
+	gcache.ErrHashKeyNotFound: ErrKeyNotFound,
+	gcache.ErrWrongType:       ErrWrongType,
+}
+
+// Store of the embedded cache. Values are stored as strings
+type cacheStore struct {
+	cache *gcache.Cache
+}
+
+// Create a store of the embedded cache
+func NewCacheStore(cache *gcache.Cache) Store {
+	return &cacheStore{cache: cache}
+}
+
+func (s *cacheStore) Get(ctx context.Context, key string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	value, err := s.cache.Get(key)
+	if err != nil {
+		return "", wrap(err, cacheErrors)
+	}
+
+	return toString(value)
+}
+
+func (s *cacheStore) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.cache.Set(key, value, ttl)
+	return nil
+}
+
+func (s *cacheStore) Update(ctx context.Context, key string, value string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return wrap(s.cache.Update(key, value), cacheErrors)
+}
+
+func (s *cacheStore) UpdateWithTtl(ctx context.Context, key string, value string, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return wrap(s.cache.UpdateWithTll(key, value, ttl), cacheErrors)
+}
+
+func (s *cacheStore) Del(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return wrap(s.cache.Del(key), cacheErrors)
+}
+
+func (s *cacheStore) Keys(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return s.cache.Keys(), nil
+}
+
+func (s *cacheStore) LPush(ctx context.Context, key string, value string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return wrap(s.cache.LPush(key, value), cacheErrors)
+}
+
+func (s *cacheStore) RPush(ctx context.Context, key string, value string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return wrap(s.cache.RPush(key, value), cacheErrors)
+}
+
+func (s *cacheStore) LPop(ctx context.Context, key string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	value, err := s.cache.LPop(key)
+	if err != nil {
+		return "", wrap(err, cacheErrors)
+	}
+
+	return toString(value)
+}
+
+func (s *cacheStore) RPop(ctx context.Context, key string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	value, err := s.cache.RPop(key)
+	if err != nil {
+		return "", wrap(err, cacheErrors)
+	}
+
+	return toString(value)
+}
+
+func (s *cacheStore) LRange(ctx context.Context, key string, from int, to int) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	values, err := s.cache.LRange(key, from, to)
+	if err != nil {
+		return nil, wrap(err, cacheErrors)
+	}
+
+	strs := make([]string, len(values))
+	for i, value := range values {
+		if strs[i], err = toString(value); err != nil {
+			return nil, err
+		}
+	}
+
+	return strs, nil
+}
+
+func (s *cacheStore) HGet(ctx context.Context, key string, hashKey string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	value, err := s.cache.HGet(key, hashKey)
+	if err != nil {
+		return "", wrap(err, cacheErrors)
+	}
+
+	return toString(value)
+}
+
+func (s *cacheStore) HSet(ctx context.Context, key string, hashKey string, value string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return wrap(s.cache.HSet(key, hashKey, value), cacheErrors)
+}
+
+// Values set directly into the cache may be of any type, only strings are values of a store
+func toString(value interface{}) (string, error) {
+	str, ok := value.(string)
+	if !ok {
+		return "", wrap(gcache.ErrWrongType, cacheErrors)
+	}
+	return str, nil
+}
@@ -0,0 +1,28 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"gcache"
+	"gcache/store"
+	"gcache/store/storetest"
+	"testing"
+)
+
+var ctx = context.Background()
+
+func TestCacheStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		return store.NewCacheStore(gcache.NewCache())
+	})
+}
+
+func TestCacheStore_Errors(t *testing.T) {
+
+	_, err := store.NewCacheStore(gcache.NewCache()).Get(ctx, "missing")
+
+	// Both the store and the cache errors match
+	if !errors.Is(err, store.ErrKeyNotFound) || !errors.Is(err, gcache.ErrKeyNotFound) {
+		t.Error("Expected the error to match the store and the cache errors but actual", err)
+	}
+}
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"context"
+	"gcache/client"
+	"time"
+)
+
+var clientErrors = map[error]error{
+	client.ErrKeyNotFound: ErrKeyNotFound,
+	client.ErrWrongType:   ErrWrongType,
+}
+
+// Store of the remote client
+type clientStore struct {
+	client *client.Client
+}
+
+// Create a store of the remote client. Ttls are rounded up to whole seconds
+func NewClientStore(c *client.Client) Store {
+	return &clientStore{client: c}
+}
+
+func (s *clientStore) Get(ctx context.Context, key string) (string, error) {
+	value, err := s.client.Get(ctx, key)
+	return value, wrap(err, clientErrors)
+}
+
+func (s *clientStore) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	return wrap(s.client.Set(ctx, key, value, seconds(ttl)), clientErrors)
+}
+
+func (s *clientStore) Update(ctx context.Context, key string, value string) error {
+	return wrap(s.client.Update(ctx, key, value), clientErrors)
+}
+
+func (s *clientStore) UpdateWithTtl(ctx context.Context, key string, value string, ttl time.Duration) error {
+	return wrap(s.client.UpdateWithTtl(ctx, key, value, seconds(ttl)), clientErrors)
+}
+
+func (s *clientStore) Del(ctx context.Context, key string) error {
+	return wrap(s.client.Del(ctx, key), clientErrors)
+}
+
+func (s *clientStore) Keys(ctx context.Context) ([]string, error) {
+	keys, err := s.client.Keys(ctx)
+	return keys, wrap(err, clientErrors)
+}
+
+func (s *clientStore) LPush(ctx context.Context, key string, value string) error {
+	return wrap(s.client.LPush(ctx, key, value), clientErrors)
+}
+
+func (s *clientStore) RPush(ctx context.Context, key string, value string) error {
+	return wrap(s.client.RPush(ctx, key, value), clientErrors)
+}
+
+func (s *clientStore) LPop(ctx context.Context, key string) (string, error) {
+	value, err := s.client.LPop(ctx, key)
+	return value, wrap(err, clientErrors)
+}
+
+func (s *clientStore) RPop(ctx context.Context, key string) (string, error) {
+	value, err := s.client.RPop(ctx, key)
+	return value, wrap(err, clientErrors)
+}
+
+func (s *clientStore) LRange(ctx context.Context, key string, from int, to int) ([]string, error) {
+	values, err := s.client.LRange(ctx, key, from, to)
+	return values, wrap(err, clientErrors)
+}
+
+func (s *clientStore) HGet(ctx context.Context, key string, hashKey string) (string, error) {
+	value, err := s.client.HGet(ctx, key, hashKey)
+	return value, wrap(err, clientErrors)
+}
+
+func (s *clientStore) HSet(ctx context.Context, key string, hashKey string, value string) error {
+	return wrap(s.client.HSet(ctx, key, hashKey, value), clientErrors)
+}
+
+// Round the ttl up to whole seconds the protocol deals in
+func seconds(ttl time.Duration) int {
+	if ttl <= 0 {
+		return 0
+	}
+	return int((ttl + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,29 @@
+package store_test
+
+import (
+	"errors"
+	"gcache/client"
+	"gcache/gcachetest"
+	"gcache/store"
+	"gcache/store/storetest"
+	"testing"
+)
+
+func TestClientStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		conns := gcachetest.NewServers(t, 2, "").Connections()
+		return store.NewClientStore(client.NewClient(conns))
+	})
+}
+
+func TestClientStore_Errors(t *testing.T) {
+
+	s := store.NewClientStore(client.NewClient(client.Connections{gcachetest.NewServer(t).Connection()}))
+
+	_, err := s.Get(ctx, "missing")
+
+	// Both the store and the client errors match
+	if !errors.Is(err, store.ErrKeyNotFound) || !errors.Is(err, client.ErrKeyNotFound) {
+		t.Error("Expected the error to match the store and the client errors but actual", err)
+	}
+}
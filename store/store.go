@@ -0,0 +1,59 @@
+// Package store defines the operations shared by the embedded cache and the remote client,
+// so that code may switch between them, e.g. use the embedded cache in tests
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Errors of all the implementations. Errors returned by the adapters match them with errors.Is
+// and keep the original error of the implementation as the cause
+var ErrKeyNotFound = errors.New("Key not found")
+var ErrWrongType = errors.New("Operation against a key holding the wrong kind of value")
+
+// Operations on keys, lists and hashes. A missing field of a hash is reported as ErrKeyNotFound
+type Store interface {
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key string, value string, ttl time.Duration) error
+	Update(ctx context.Context, key string, value string) error
+	UpdateWithTtl(ctx context.Context, key string, value string, ttl time.Duration) error
+	Del(ctx context.Context, key string) error
+	Keys(ctx context.Context) ([]string, error)
+
+	LPush(ctx context.Context, key string, value string) error
+	RPush(ctx context.Context, key string, value string) error
+	LPop(ctx context.Context, key string) (string, error)
+	RPop(ctx context.Context, key string) (string, error)
+	LRange(ctx context.Context, key string, from int, to int) ([]string, error)
+
+	HGet(ctx context.Context, key string, hashKey string) (string, error)
+	HSet(ctx context.Context, key string, hashKey string, value string) error
+}
+
+// Error of an implementation matching a store error
+type storeError struct {
+	target error
+	cause  error
+}
+
+func (e *storeError) Error() string {
+	return e.cause.Error()
+}
+
+func (e *storeError) Is(target error) bool {
+	return target == e.target
+}
+
+func (e *storeError) Unwrap() error {
+	return e.cause
+}
+
+// Wrap the error of an implementation to match the store error it stands for
+func wrap(err error, targets map[error]error) error {
+	if target, ok := targets[err]; ok {
+		return &storeError{target: target, cause: err}
+	}
+	return err
+}
@@ -0,0 +1,245 @@
+// Package storetest is a conformance test suite of store.Store implementations
+package storetest
+
+import (
+	"context"
+	"errors"
+	"gcache/store"
+	"sort"
+	"testing"
+	"time"
+)
+
+// Run the suite. newStore is called for every test and must return an empty store
+func Run(t *testing.T, newStore func(t *testing.T) store.Store) {
+
+	tests := []struct {
+		name string
+		test func(t *testing.T, s store.Store)
+	}{
+		{"SetGetDel", testSetGetDel},
+		{"BinaryValues", testBinaryValues},
+		{"Update", testUpdate},
+		{"Ttl", testTtl},
+		{"Keys", testKeys},
+		{"Lists", testLists},
+		{"Hashes", testHashes},
+		{"WrongType", testWrongType},
+		{"CancelledContext", testCancelledContext},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.test(t, newStore(t))
+		})
+	}
+}
+
+var ctx = context.Background()
+
+func expectError(t *testing.T, op string, err error, target error) {
+	t.Helper()
+
+	if !errors.Is(err, target) {
+		t.Errorf("%s: expected %v but actual %v", op, target, err)
+	}
+}
+
+func expectValue(t *testing.T, op string, value string, err error, expected string) {
+	t.Helper()
+
+	if err != nil {
+		t.Errorf("%s: unexpected error %v", op, err)
+		return
+	}
+
+	if value != expected {
+		t.Errorf("%s: expected %q but actual %q", op, expected, value)
+	}
+}
+
+func expectValues(t *testing.T, op string, values []string, err error, expected []string) {
+	t.Helper()
+
+	if err != nil {
+		t.Errorf("%s: unexpected error %v", op, err)
+		return
+	}
+
+	if len(values) != len(expected) {
+		t.Errorf("%s: expected %q but actual %q", op, expected, values)
+		return
+	}
+
+	for i := range expected {
+		if values[i] != expected[i] {
+			t.Errorf("%s: expected %q but actual %q", op, expected, values)
+			return
+		}
+	}
+}
+
+func testSetGetDel(t *testing.T, s store.Store) {
+
+	if err := s.Set(ctx, "key", "value", time.Minute); err != nil {
+		t.Fatal("Set:", err)
+	}
+
+	value, err := s.Get(ctx, "key")
+	expectValue(t, "Get", value, err, "value")
+
+	if err := s.Del(ctx, "key"); err != nil {
+		t.Error("Del:", err)
+	}
+
+	_, err = s.Get(ctx, "key")
+	expectError(t, "Get deleted", err, store.ErrKeyNotFound)
+
+	expectError(t, "Del missing", s.Del(ctx, "key"), store.ErrKeyNotFound)
+}
+
+func testBinaryValues(t *testing.T, s store.Store) {
+
+	values := map[string]string{
+		"empty":  "",
+		"binary": "\x00\xff\r\n,\"",
+		"a/b.c":  "path like key",
+		"..":     "dots",
+	}
+
+	for key, expected := range values {
+		if err := s.Set(ctx, key, expected, time.Minute); err != nil {
+			t.Fatalf("Set %q: %v", key, err)
+		}
+
+		value, err := s.Get(ctx, key)
+		expectValue(t, "Get "+key, value, err, expected)
+	}
+}
+
+func testUpdate(t *testing.T, s store.Store) {
+
+	expectError(t, "Update missing", s.Update(ctx, "key", "value"), store.ErrKeyNotFound)
+	expectError(t, "UpdateWithTtl missing", s.UpdateWithTtl(ctx, "key", "value", time.Minute), store.ErrKeyNotFound)
+
+	s.Set(ctx, "key", "value", time.Minute)
+
+	if err := s.Update(ctx, "key", "updated"); err != nil {
+		t.Fatal("Update:", err)
+	}
+
+	value, err := s.Get(ctx, "key")
+	expectValue(t, "Get updated", value, err, "updated")
+
+	if err := s.UpdateWithTtl(ctx, "key", "updated again", time.Minute); err != nil {
+		t.Fatal("UpdateWithTtl:", err)
+	}
+
+	value, err = s.Get(ctx, "key")
+	expectValue(t, "Get updated with ttl", value, err, "updated again")
+}
+
+func testTtl(t *testing.T, s store.Store) {
+
+	s.Set(ctx, "key", "value", time.Second)
+
+	value, err := s.Get(ctx, "key")
+	expectValue(t, "Get", value, err, "value")
+
+	time.Sleep(1200 * time.Millisecond)
+
+	_, err = s.Get(ctx, "key")
+	expectError(t, "Get expired", err, store.ErrKeyNotFound)
+}
+
+func testKeys(t *testing.T, s store.Store) {
+
+	s.Set(ctx, "key1", "value", time.Minute)
+	s.Set(ctx, "key2", "value", time.Minute)
+	s.LPush(ctx, "list", "value")
+
+	keys, err := s.Keys(ctx)
+	sort.Strings(keys)
+	expectValues(t, "Keys", keys, err, []string{"key1", "key2", "list"})
+}
+
+func testLists(t *testing.T, s store.Store) {
+
+	s.LPush(ctx, "list", "a")
+	s.LPush(ctx, "list", "b")
+	s.RPush(ctx, "list", "c")
+
+	values, err := s.LRange(ctx, "list", 0, 10)
+	expectValues(t, "LRange", values, err, []string{"c", "a", "b"})
+
+	values, err = s.LRange(ctx, "list", 1, 1)
+	expectValues(t, "LRange 1 1", values, err, []string{"a"})
+
+	value, err := s.LPop(ctx, "list")
+	expectValue(t, "LPop", value, err, "b")
+
+	value, err = s.RPop(ctx, "list")
+	expectValue(t, "RPop", value, err, "c")
+
+	value, err = s.LPop(ctx, "list")
+	expectValue(t, "LPop", value, err, "a")
+
+	_, err = s.LPop(ctx, "list")
+	expectError(t, "LPop empty", err, store.ErrKeyNotFound)
+
+	_, err = s.RPop(ctx, "missing")
+	expectError(t, "RPop missing", err, store.ErrKeyNotFound)
+
+	_, err = s.LRange(ctx, "missing", 0, 10)
+	expectError(t, "LRange missing", err, store.ErrKeyNotFound)
+}
+
+func testHashes(t *testing.T, s store.Store) {
+
+	if err := s.HSet(ctx, "hash", "field", "value"); err != nil {
+		t.Fatal("HSet:", err)
+	}
+
+	value, err := s.HGet(ctx, "hash", "field")
+	expectValue(t, "HGet", value, err, "value")
+
+	_, err = s.HGet(ctx, "hash", "missing")
+	expectError(t, "HGet missing field", err, store.ErrKeyNotFound)
+
+	_, err = s.HGet(ctx, "missing", "field")
+	expectError(t, "HGet missing key", err, store.ErrKeyNotFound)
+}
+
+func testWrongType(t *testing.T, s store.Store) {
+
+	s.Set(ctx, "key", "value", time.Minute)
+	s.LPush(ctx, "list", "value")
+	s.HSet(ctx, "hash", "field", "value")
+
+	expectError(t, "LPush on key", s.LPush(ctx, "key", "value"), store.ErrWrongType)
+	expectError(t, "HSet on list", s.HSet(ctx, "list", "field", "value"), store.ErrWrongType)
+
+	_, err := s.Get(ctx, "list")
+	expectError(t, "Get on list", err, store.ErrWrongType)
+
+	_, err = s.HGet(ctx, "list", "field")
+	expectError(t, "HGet on list", err, store.ErrWrongType)
+
+	_, err = s.LRange(ctx, "hash", 0, 10)
+	expectError(t, "LRange on hash", err, store.ErrWrongType)
+}
+
+func testCancelledContext(t *testing.T, s store.Store) {
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if err := s.Set(cancelled, "key", "value", time.Minute); err == nil {
+		t.Error("Expected an error setting with a cancelled context")
+	}
+
+	if _, err := s.Get(cancelled, "key"); err == nil {
+		t.Error("Expected an error getting with a cancelled context")
+	}
+}
@@ -0,0 +1,317 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers of the W3C trace context
+const (
+	HeaderTraceparent = "Traceparent"
+	HeaderTracestate  = "Tracestate"
+)
+
+// Longest tracestate propagated, longer ones are dropped as the W3C trace context allows
+const maxTracestateLength = 512
+
+const flagSampled = 0x01
+
+var ErrBadTraceparent = errors.New("Bad traceparent")
+
+type TraceID [16]byte
+
+type SpanID [8]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// Identity of a span propagated between processes
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+	// Vendor specific tracestate, propagated as it is
+	State string
+}
+
+// Whether the trace and the span are identified, all zero ids are invalid
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Format the span context as the traceparent header, e.g. 00-{trace id}-{span id}-01
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// Parse the traceparent header. Versions newer than 00 are parsed by the fields of 00
+func ParseTraceparent(traceparent string) (SpanContext, error) {
+	sc := SpanContext{}
+
+	traceparent = strings.TrimSpace(traceparent)
+	if len(traceparent) < 55 || traceparent[2] != '-' || traceparent[35] != '-' || traceparent[52] != '-' {
+		return sc, ErrBadTraceparent
+	}
+
+	version, ok := decodeHex(traceparent[:2], 1)
+	if !ok || version[0] == 0xff || (version[0] == 0 && len(traceparent) != 55) {
+		return sc, ErrBadTraceparent
+	}
+	if len(traceparent) > 55 && traceparent[55] != '-' {
+		return sc, ErrBadTraceparent
+	}
+
+	traceID, ok := decodeHex(traceparent[3:35], len(sc.TraceID))
+	if !ok {
+		return sc, ErrBadTraceparent
+	}
+	spanID, ok := decodeHex(traceparent[36:52], len(sc.SpanID))
+	if !ok {
+		return sc, ErrBadTraceparent
+	}
+	flags, ok := decodeHex(traceparent[53:55], 1)
+	if !ok {
+		return sc, ErrBadTraceparent
+	}
+
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Sampled = flags[0]&flagSampled != 0
+
+	if !sc.IsValid() {
+		return SpanContext{}, ErrBadTraceparent
+	}
+
+	return sc, nil
+}
+
+// Decode lowercase hex only, as the W3C trace context requires
+func decodeHex(s string, length int) ([]byte, bool) {
+	if len(s) != 2*length || strings.ToLower(s) != s {
+		return nil, false
+	}
+	decoded, err := hex.DecodeString(s)
+	return decoded, err == nil
+}
+
+// Get the span context of the traceparent and tracestate headers
+func Extract(header http.Header) (SpanContext, bool) {
+	sc, err := ParseTraceparent(header.Get(HeaderTraceparent))
+	if err != nil {
+		return SpanContext{}, false
+	}
+
+	if state := strings.TrimSpace(strings.Join(header.Values(HeaderTracestate), ",")); len(state) <= maxTracestateLength {
+		sc.State = state
+	}
+
+	return sc, true
+}
+
+// Set the traceparent and tracestate headers of the span context of ctx, if there is one
+func Inject(ctx context.Context, header http.Header) {
+	sc, ok := SpanContextFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	header.Set(HeaderTraceparent, sc.Traceparent())
+	if sc.State != "" {
+		header.Set(HeaderTracestate, sc.State)
+	}
+}
+
+type spanContextKey struct{}
+
+type tracerKey struct{}
+
+// Return the context whose spans are children of the span context, e.g. extracted from incoming headers
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// Get the span context of the current span
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc, ok && sc.IsValid()
+}
+
+// Return the context carrying the tracer, so that code deeper in the call chain starts spans by it
+func ContextWithTracer(ctx context.Context, tracer Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, tracer)
+}
+
+// Start the span by the tracer of the context, or by Noop if there is none
+func StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	tracer, ok := ctx.Value(tracerKey{}).(Tracer)
+	if !ok {
+		tracer = Noop
+	}
+	return tracer.Start(ctx, name)
+}
+
+// Tracer starts spans. Spans of a context carrying a span context are its children
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span measures an operation. End must be called once the operation is done
+type Span interface {
+	SetAttribute(key string, value interface{})
+	SetError(err error)
+	End()
+	SpanContext() SpanContext
+}
+
+// Tracer recording nothing. The span context of the parent is kept, so it is still propagated
+var Noop Tracer = noopTracer{}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	sc, _ := SpanContextFromContext(ctx)
+	return ctx, noopSpan{sc}
+}
+
+type noopSpan struct {
+	sc SpanContext
+}
+
+func (noopSpan) SetAttribute(key string, value interface{}) {}
+func (noopSpan) SetError(err error)                         {}
+func (noopSpan) End()                                       {}
+func (s noopSpan) SpanContext() SpanContext                 { return s.sc }
+
+// Span ended by a recording tracer
+type SpanData struct {
+	Name string
+	SpanContext
+	// Span id of the parent, zero for the root span of a trace
+	ParentID   SpanID
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]interface{}
+	Err        error
+}
+
+// Exporter receives the sampled spans once they end, e.g. to send them to a collector.
+// Export is called by the goroutine ending the span, so it should not block
+type Exporter interface {
+	Export(span *SpanData)
+}
+
+// Function exporting the spans
+type ExporterFunc func(span *SpanData)
+
+func (f ExporterFunc) Export(span *SpanData) {
+	f(span)
+}
+
+// Create a tracer exporting the sampled spans. Root spans are always sampled,
+// other spans are sampled if their parent is
+func NewTracer(exporter Exporter) Tracer {
+	return &tracer{exporter: exporter}
+}
+
+type tracer struct {
+	exporter Exporter
+}
+
+func (t *tracer) Start(ctx context.Context, name string) (context.Context, Span) {
+
+	s := &span{
+		exporter: t.exporter,
+		data: SpanData{
+			Name:  name,
+			Start: time.Now(),
+		},
+	}
+
+	if parent, ok := SpanContextFromContext(ctx); ok {
+		s.data.SpanContext = parent
+		s.data.ParentID = parent.SpanID
+	} else {
+		s.data.TraceID = newTraceID()
+		s.data.Sampled = true
+	}
+
+	s.data.SpanID = newSpanID()
+
+	return ContextWithSpanContext(ctx, s.data.SpanContext), s
+}
+
+type span struct {
+	exporter Exporter
+
+	mutex sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+func (s *span) SetAttribute(key string, value interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.data.Attributes == nil {
+		s.data.Attributes = make(map[string]interface{})
+	}
+	s.data.Attributes[key] = value
+}
+
+func (s *span) SetError(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.data.Err = err
+}
+
+// Export the span the first time it ends
+func (s *span) End() {
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mutex.Unlock()
+
+	if data.Sampled && s.exporter != nil {
+		s.exporter.Export(&data)
+	}
+}
+
+func (s *span) SpanContext() SpanContext {
+	return s.data.SpanContext
+}
+
+func newTraceID() TraceID {
+	id := TraceID{}
+	for id == (TraceID{}) {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	id := SpanID{}
+	for id == (SpanID{}) {
+		rand.Read(id[:])
+	}
+	return id
+}
@@ -0,0 +1,133 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParseTraceparent(t *testing.T) {
+
+	sc, err := ParseTraceparent(traceparent)
+	if err != nil {
+		t.Fatal("Failed to parse", err)
+	}
+
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" || !sc.Sampled {
+		t.Errorf("Unexpected span context %+v", sc)
+	}
+
+	if sc.Traceparent() != traceparent {
+		t.Errorf("Expected %s but actual %s", traceparent, sc.Traceparent())
+	}
+
+	// Future versions may append fields
+	if _, err := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra"); err != nil {
+		t.Error("Expected a newer version to be parsed", err)
+	}
+
+	bad := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+	}
+
+	for _, header := range bad {
+		if _, err := ParseTraceparent(header); err != ErrBadTraceparent {
+			t.Errorf("Expected '%s' to be rejected", header)
+		}
+	}
+}
+
+func TestInjectExtract(t *testing.T) {
+
+	header := http.Header{}
+	header.Set(HeaderTraceparent, traceparent)
+	header.Set(HeaderTracestate, "vendor=value")
+
+	sc, ok := Extract(header)
+	if !ok || sc.State != "vendor=value" {
+		t.Fatalf("Unexpected span context %+v", sc)
+	}
+
+	injected := http.Header{}
+	Inject(ContextWithSpanContext(context.Background(), sc), injected)
+
+	if injected.Get(HeaderTraceparent) != traceparent || injected.Get(HeaderTracestate) != "vendor=value" {
+		t.Errorf("Unexpected headers %v", injected)
+	}
+
+	// Nothing to propagate
+	empty := http.Header{}
+	Inject(context.Background(), empty)
+
+	if len(empty) != 0 {
+		t.Errorf("Expected no headers but actual %v", empty)
+	}
+}
+
+func TestNoop(t *testing.T) {
+
+	ctx, span := Noop.Start(context.Background(), "root")
+	span.End()
+
+	if _, ok := SpanContextFromContext(ctx); ok {
+		t.Error("Expected no span context of a noop root span")
+	}
+
+	parent, _ := ParseTraceparent(traceparent)
+	ctx, span = StartSpan(ContextWithSpanContext(context.Background(), parent), "child")
+
+	if span.SpanContext() != parent {
+		t.Errorf("Expected the parent to be kept but actual %+v", span.SpanContext())
+	}
+
+	if sc, _ := SpanContextFromContext(ctx); sc != parent {
+		t.Errorf("Expected the parent to be propagated but actual %+v", sc)
+	}
+}
+
+func TestTracer(t *testing.T) {
+
+	spans := []*SpanData{}
+	tracer := NewTracer(ExporterFunc(func(span *SpanData) {
+		spans = append(spans, span)
+	}))
+
+	ctx, root := tracer.Start(context.Background(), "root")
+	_, child := StartSpan(ContextWithTracer(ctx, tracer), "child")
+
+	child.SetAttribute("key", "value")
+	child.End()
+	child.End()
+	root.End()
+
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans but actual %d", len(spans))
+	}
+
+	if spans[0].Name != "child" || spans[0].TraceID != root.SpanContext().TraceID ||
+		spans[0].ParentID != root.SpanContext().SpanID || spans[0].Attributes["key"] != "value" {
+		t.Errorf("Unexpected child %+v", spans[0])
+	}
+
+	if spans[1].Name != "root" || spans[1].ParentID != (SpanID{}) || !spans[1].Sampled || spans[1].End.Before(spans[1].Start) {
+		t.Errorf("Unexpected root %+v", spans[1])
+	}
+
+	// Children of a trace which is not sampled are not exported
+	parent, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	_, span := tracer.Start(ContextWithSpanContext(context.Background(), parent), "unsampled")
+	span.End()
+
+	if len(spans) != 2 {
+		t.Errorf("Expected the span not to be exported")
+	}
+}